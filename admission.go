@@ -0,0 +1,107 @@
+package gotx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrOverloaded is returned when an admission policy sheds a transaction. Callers can
+// match it with errors.Is to degrade gracefully, e.g. skip optional work or answer
+// with 503 Service Unavailable.
+var ErrOverloaded = errors.New("gotx: overloaded")
+
+// admissionPollInterval is how often a delayed transaction checks the load again.
+const admissionPollInterval = 10 * time.Millisecond
+
+// AdmissionPolicy decides whether a db transaction may begin.
+type AdmissionPolicy interface {
+	// Admit is called before a db transaction with opts begins, and may block to
+	// delay it. Returning an error aborts the Exec call with that error.
+	Admit(ctx context.Context, tm *TxManager, opts *Options) error
+}
+
+// AdmissionPolicyFunc is an adapter to allow the use of ordinary functions as
+// admission policies.
+type AdmissionPolicyFunc func(ctx context.Context, tm *TxManager, opts *Options) error
+
+// Admit calls f(ctx, tm, opts).
+func (f AdmissionPolicyFunc) Admit(ctx context.Context, tm *TxManager, opts *Options) error {
+	return f(ctx, tm, opts)
+}
+
+// WithAdmissionPolicy makes the manager consult policy before each db transaction
+// begins. Nested transactions joining a db transaction are always admitted.
+func WithAdmissionPolicy(policy AdmissionPolicy) ManagerOption {
+	return func(tm *TxManager) {
+		tm.admission = policy
+	}
+}
+
+// LoadShedder is an AdmissionPolicy delaying and shedding transactions of low priority
+// while the manager is overloaded, so they give way to interactive traffic:
+//
+//	tm := gotx.NewTxManager(db, gotx.WithAdmissionPolicy(&gotx.LoadShedder{
+//		MaxPoolUsage: 0.8,
+//		MaxDelay:     100 * time.Millisecond,
+//	}))
+type LoadShedder struct {
+	// MaxPoolUsage is the fraction of the open connection limit of the pool in use
+	// from which the manager is overloaded. It requires db.SetMaxOpenConns. Zero
+	// disables the check.
+	MaxPoolUsage float64
+
+	// MaxActive is the number of active transactions from which the manager is
+	// overloaded. Zero disables the check.
+	MaxActive int64
+
+	// MaxDelay is how long a transaction waits for the load to drop before it is shed
+	// with ErrOverloaded. Zero sheds it immediately.
+	MaxDelay time.Duration
+
+	// ShedBelow is the priority below which transactions are delayed and shed. The
+	// zero value PriorityNormal subjects low priority transactions only.
+	ShedBelow Priority
+}
+
+// Admit implements AdmissionPolicy.
+func (s *LoadShedder) Admit(ctx context.Context, tm *TxManager, opts *Options) error {
+	if opts.Priority >= s.ShedBelow {
+		return nil
+	}
+
+	deadline := tm.now().Add(s.MaxDelay)
+	for {
+		reason := s.overloaded(tm)
+		if reason == "" {
+			return nil
+		}
+
+		if !tm.now().Before(deadline) {
+			return fmt.Errorf("%w: %s", ErrOverloaded, reason)
+		}
+		if err := sleepContext(ctx, tm.clock, admissionPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// overloaded describes why tm is overloaded, or returns an empty string.
+func (s *LoadShedder) overloaded(tm *TxManager) string {
+	if s.MaxPoolUsage > 0 {
+		pool := tm.DBStats()
+		if pool.MaxOpenConnections > 0 && float64(pool.InUse) >= s.MaxPoolUsage*float64(pool.MaxOpenConnections) {
+			return fmt.Sprintf("%d of %d connections in use", pool.InUse, pool.MaxOpenConnections)
+		}
+	}
+
+	if s.MaxActive > 0 {
+		// the active transactions include the one being admitted
+		if active := tm.Stats().Active - 1; active >= s.MaxActive {
+			return fmt.Sprintf("%d active transactions", active)
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,159 @@
+package gotx
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// AllowListMode decides what an AllowList does with queries.
+type AllowListMode uint8
+
+const (
+	// AllowListLearn records the fingerprints of all queries, to be saved as the
+	// baseline with AllowList.Save.
+	AllowListLearn AllowListMode = iota
+
+	// AllowListEnforce rejects queries whose fingerprint is not in the baseline with a
+	// *PolicyError.
+	AllowListEnforce
+
+	// AllowListAlert runs queries whose fingerprint is not in the baseline, but logs
+	// them once and passes them to the OnUnknown callback.
+	AllowListAlert
+)
+
+// AllowList is an Interceptor guarding against unreviewed dynamic SQL and accidental
+// query explosions by only allowing the query fingerprints recorded in a baseline run.
+// A baseline is learned by running the test suite or a staging workload in
+// AllowListLearn mode and saving the fingerprints, one per line, to a file which is
+// reviewed and committed with the code:
+//
+//	list, err := gotx.NewAllowList("testdata/queries.allow", gotx.AllowListLearn)
+//	tm := gotx.NewTxManager(db, gotx.WithInterceptors(list))
+//	... run the workload ...
+//	err = list.Save()
+//
+// In production the same file is loaded in AllowListEnforce or AllowListAlert mode.
+// Queries are compared by Fingerprint, so the values of literals, the lengths of IN
+// lists and the names of savepoints do not matter.
+type AllowList struct {
+	// OnUnknown is called in AllowListAlert mode the first time a query with an
+	// unknown fingerprint runs.
+	OnUnknown func(fingerprint string, query string)
+
+	path string
+	mode AllowListMode
+
+	mux     sync.Mutex
+	allowed map[string]bool
+	unknown map[string]bool
+}
+
+// NewAllowList creates an allow-list backed by the file at path. The fingerprints
+// already in the file are loaded; in learn mode the file may not exist yet and new
+// fingerprints are added to the loaded ones.
+func NewAllowList(path string, mode AllowListMode) (*AllowList, error) {
+	a := &AllowList{
+		path:    path,
+		mode:    mode,
+		allowed: make(map[string]bool),
+		unknown: make(map[string]bool),
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) && mode == AllowListLearn {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			a.allowed[line] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("gotx: reading allow-list %s: %w", path, err)
+	}
+	return a, nil
+}
+
+// Intercept implements Interceptor.
+func (a *AllowList) Intercept(ctx context.Context, stmt *Statement, next StatementHandler) error {
+	fingerprint := fingerprint(stmt.Query, stmt.dialect())
+
+	a.mux.Lock()
+	allowed := a.allowed[fingerprint]
+	first := !allowed && !a.unknown[fingerprint]
+	if a.mode == AllowListLearn {
+		a.allowed[fingerprint] = true
+	} else if first {
+		a.unknown[fingerprint] = true
+	}
+	a.mux.Unlock()
+
+	if allowed || a.mode == AllowListLearn {
+		return next(ctx, stmt)
+	}
+
+	if a.mode == AllowListEnforce {
+		return &PolicyError{
+			Rule:   "allow-list",
+			Reason: "query fingerprint not in the baseline: " + fingerprint,
+			Query:  stmt.Query,
+		}
+	}
+
+	if first {
+		log.Printf("gotx: query fingerprint not in the baseline: %s", fingerprint)
+		if a.OnUnknown != nil {
+			a.OnUnknown(fingerprint, stmt.Query)
+		}
+	}
+	return next(ctx, stmt)
+}
+
+// Unknown returns the sorted fingerprints seen outside of the baseline in enforce and
+// alert mode.
+func (a *AllowList) Unknown() []string {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return sortedKeys(a.unknown)
+}
+
+// Save writes the sorted fingerprints of the baseline, including those recorded in
+// learn mode, to the file of the allow-list.
+func (a *AllowList) Save() error {
+	a.mux.Lock()
+	fingerprints := sortedKeys(a.allowed)
+	a.mux.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# query fingerprints allowed by gotx.AllowList\n")
+	for _, fingerprint := range fingerprints {
+		b.WriteString(fingerprint)
+		b.WriteString("\n")
+	}
+	return os.WriteFile(a.path, []byte(b.String()), 0o644)
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,103 @@
+package gotx
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrArchiveMismatch is returned by ArchiveRows when it deleted another number of
+// rows than it copied, and by the commit of its db transaction.
+var ErrArchiveMismatch = errors.New("gotx: archived and deleted rows do not match")
+
+// ArchiveRows moves the rows of srcTable matching where, with args as its arguments,
+// to dstTable: it copies them with INSERT ... SELECT and deletes them from srcTable in
+// the transaction, and returns how many rows moved:
+//
+//	n, err := tx.ArchiveRows("orders", "orders_archive", "closed_at < ?", cutoff)
+//
+// The columns of srcTable which dstTable has as well are copied, so dstTable may have
+// additional columns with defaults, e.g. the time the rows were archived, if the
+// columns are known to TxManager.Schema. Otherwise all the columns of srcTable are
+// copied and dstTable must have the same columns in the same order.
+//
+// When a concurrent transaction changes the matching rows between the copy and the
+// delete, the counts differ: ArchiveRows then fails with ErrArchiveMismatch and dooms
+// the db transaction, whose commit fails even if the error is ignored, so rows are
+// never deleted without being archived, nor archived twice. Running it with
+// sql.LevelRepeatableRead or above, or locking the rows first, avoids the retries.
+// Bindvars of where must follow the driver's style.
+func (t *Transaction) ArchiveRows(srcTable, dstTable, where string, args ...interface{}) (int64, error) {
+	if err := t.checkState(); err != nil {
+		return 0, err
+	}
+
+	columns := "*"
+	if copied := t.archiveColumns(srcTable, dstTable); len(copied) > 0 {
+		columns = strings.Join(copied, ", ")
+	}
+
+	var insert, del strings.Builder
+	insert.WriteString("INSERT INTO " + dstTable)
+	if columns != "*" {
+		insert.WriteString(" (" + columns + ")")
+	}
+	insert.WriteString(" SELECT " + columns + " FROM " + srcTable)
+	writeCondition(&insert, strings.TrimSpace(where))
+	del.WriteString("DELETE FROM " + srcTable)
+	writeCondition(&del, strings.TrimSpace(where))
+
+	result, err := t.exec(insert.String(), args...)
+	if err != nil {
+		return 0, fmt.Errorf("archiving rows of %s failed: %w", srcTable, err)
+	}
+	copied, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	result, err = t.exec(del.String(), args...)
+	if err != nil {
+		return 0, fmt.Errorf("deleting archived rows of %s failed: %w", srcTable, err)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if copied != deleted {
+		err := fmt.Errorf("%w: %d rows of %s copied to %s, %d deleted", ErrArchiveMismatch, copied, srcTable, dstTable, deleted)
+		t.tx.valuesMux.Lock()
+		if t.tx.doomed == nil {
+			t.tx.doomed = err
+		}
+		t.tx.valuesMux.Unlock()
+		return 0, err
+	}
+	return copied, nil
+}
+
+// archiveColumns returns the columns of srcTable which dstTable has as well, or nil if
+// the schema does not know both tables.
+func (t *Transaction) archiveColumns(srcTable, dstTable string) []string {
+	schema, err := t.txManager.Schema(t.ctx)
+	if err != nil {
+		return nil
+	}
+	src, ok := schema.Table(srcTable)
+	if !ok {
+		return nil
+	}
+	dst, ok := schema.Table(dstTable)
+	if !ok {
+		return nil
+	}
+
+	var columns []string
+	for _, c := range src.Columns {
+		if _, ok := dst.Column(c.Name); ok {
+			columns = append(columns, c.Name)
+		}
+	}
+	return columns
+}
@@ -0,0 +1,234 @@
+package gotx
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// Array binds a slice to a Postgres array column without importing driver specific
+// wrappers such as pq.Array. Use it as struct field type to scan array columns:
+//
+//	type Post struct {
+//		ID   int64              `db:"id"`
+//		Tags gotx.Array[string] `db:"tags"`
+//	}
+//
+// Elements may be strings, booleans, integers or floats. Slice arguments of queries
+// run by a manager with the Postgres dialect are bound as arrays automatically, so
+// plain []int64 or []string values work in queries like WHERE id = ANY($1).
+type Array[T any] []T
+
+// Value implements driver.Valuer.
+func (a Array[T]) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	return encodePGArray(reflect.ValueOf([]T(a)))
+}
+
+// Scan implements sql.Scanner.
+func (a *Array[T]) Scan(src interface{}) error {
+	var text string
+	switch v := src.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return fmt.Errorf("gotx: can not scan %T into Array", src)
+	}
+
+	elems, err := parsePGArray(text)
+	if err != nil {
+		return err
+	}
+
+	result := make(Array[T], len(elems))
+	for i, elem := range elems {
+		if elem == nil {
+			continue
+		}
+		if err := parseArrayElem(reflect.ValueOf(&result[i]).Elem(), *elem); err != nil {
+			return err
+		}
+	}
+
+	*a = result
+	return nil
+}
+
+// pgArrayArg binds a plain slice argument as a Postgres array.
+type pgArrayArg struct {
+	v reflect.Value
+}
+
+func (a pgArrayArg) Value() (driver.Value, error) {
+	return encodePGArray(a.v)
+}
+
+// wrapArrayArgs replaces slice arguments with array values for the Postgres dialect.
+func wrapArrayArgs(args []interface{}) []interface{} {
+	var wrapped []interface{}
+	for i, arg := range args {
+		v := reflect.ValueOf(arg)
+		if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 || v.Type().Implements(valuerType) {
+			continue
+		}
+
+		if wrapped == nil {
+			wrapped = append([]interface{}{}, args...)
+		}
+		wrapped[i] = pgArrayArg{v: v}
+	}
+
+	if wrapped == nil {
+		return args
+	}
+	return wrapped
+}
+
+// encodePGArray encodes a slice in the Postgres array text format.
+func encodePGArray(v reflect.Value) (driver.Value, error) {
+	if v.IsNil() {
+		return nil, nil
+	}
+
+	var b strings.Builder
+	b.WriteString("{")
+	for i := 0; i < v.Len(); i++ {
+		if i > 0 {
+			b.WriteString(",")
+		}
+
+		elem := v.Index(i)
+		for elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				break
+			}
+			elem = elem.Elem()
+		}
+
+		switch elem.Kind() {
+		case reflect.Ptr:
+			b.WriteString("NULL")
+		case reflect.String:
+			b.WriteString(`"`)
+			b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(elem.String()))
+			b.WriteString(`"`)
+		case reflect.Bool:
+			if elem.Bool() {
+				b.WriteString("t")
+			} else {
+				b.WriteString("f")
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			b.WriteString(strconv.FormatInt(elem.Int(), 10))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			b.WriteString(strconv.FormatUint(elem.Uint(), 10))
+		case reflect.Float32, reflect.Float64:
+			b.WriteString(strconv.FormatFloat(elem.Float(), 'g', -1, 64))
+		default:
+			return nil, fmt.Errorf("gotx: unsupported array element type %s", elem.Type())
+		}
+	}
+	b.WriteString("}")
+
+	return b.String(), nil
+}
+
+// parsePGArray parses a one dimensional array in the Postgres array text format. NULL
+// elements are returned as nil.
+func parsePGArray(text string) ([]*string, error) {
+	if len(text) < 2 || text[0] != '{' || text[len(text)-1] != '}' {
+		return nil, fmt.Errorf("gotx: invalid array %q", text)
+	}
+
+	body := text[1 : len(text)-1]
+	if body == "" {
+		return []*string{}, nil
+	}
+
+	var elems []*string
+	for i := 0; i <= len(body); {
+		if i < len(body) && body[i] == '{' {
+			return nil, errors.New("gotx: multi-dimensional arrays are not supported")
+		}
+
+		var elem strings.Builder
+		quoted := i < len(body) && body[i] == '"'
+		if quoted {
+			i++
+			for i < len(body) && body[i] != '"' {
+				if body[i] == '\\' && i+1 < len(body) {
+					i++
+				}
+				elem.WriteByte(body[i])
+				i++
+			}
+			// closing quote
+			i++
+		} else {
+			for i < len(body) && body[i] != ',' {
+				elem.WriteByte(body[i])
+				i++
+			}
+		}
+
+		s := elem.String()
+		if !quoted && strings.EqualFold(s, "NULL") {
+			elems = append(elems, nil)
+		} else {
+			elems = append(elems, &s)
+		}
+
+		// skip the delimiter
+		i++
+	}
+
+	return elems, nil
+}
+
+func parseArrayElem(dest reflect.Value, s string) error {
+	for dest.Kind() == reflect.Ptr {
+		dest.Set(reflect.New(dest.Type().Elem()))
+		dest = dest.Elem()
+	}
+
+	switch dest.Kind() {
+	case reflect.String:
+		dest.SetString(s)
+	case reflect.Bool:
+		dest.SetBool(s == "t" || s == "true")
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		dest.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		dest.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		dest.SetFloat(f)
+	default:
+		return fmt.Errorf("gotx: unsupported array element type %s", dest.Type())
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package gotx
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+)
+
+type attemptContextKey struct{}
+
+// Attempt is the state of the attempts of a transaction retried by its manager, see
+// Options.MaxRetries. The txFunc of every attempt receives the same Attempt from
+// Transaction.Attempt, so values computed by a failed attempt, such as tokens sent to
+// external services or the progress of a batch, survive the rollback of its db
+// transaction:
+//
+//	err := tm.Exec(ctx, func(tx *gotx.Transaction) error {
+//		attempt := tx.Attempt()
+//		if attempt.Number() > 1 {
+//			log.Printf("charging order %d again after %v", orderID, attempt.Errors())
+//		}
+//		// the payment provider sees the same key on every attempt
+//		return payments.Charge(tx.Context(), attempt.Token("charge"), amount)
+//	}, &gotx.Options{MaxRetries: 3})
+//
+// Values stored in an Attempt are not rolled back: they must describe work done
+// outside of the db transaction, or be checked against the database by the next
+// attempt.
+type Attempt struct {
+	mux    sync.Mutex
+	number int
+	errs   []error
+	values map[interface{}]interface{}
+}
+
+// Number returns the number of the current attempt, 1 for the first one.
+func (a *Attempt) Number() int {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.number
+}
+
+// Errors returns the errors of the previous attempts, oldest first.
+func (a *Attempt) Errors() []error {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return append([]error(nil), a.errs...)
+}
+
+// Set stores value under key for the following attempts.
+func (a *Attempt) Set(key, value interface{}) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	if a.values == nil {
+		a.values = make(map[interface{}]interface{})
+	}
+	a.values[key] = value
+}
+
+// Value returns the value stored under key by this attempt or a previous one, or nil.
+func (a *Attempt) Value(key interface{}) interface{} {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.values[key]
+}
+
+// Memo returns the value stored under key, calling fn to compute and store it if no
+// attempt stored it yet. Errors of fn are returned and not stored, so the next attempt
+// calls fn again.
+func (a *Attempt) Memo(key interface{}, fn func() (interface{}, error)) (interface{}, error) {
+	if value := a.Value(key); value != nil {
+		return value, nil
+	}
+
+	value, err := fn()
+	if err != nil {
+		return nil, err
+	}
+	a.Set(key, value)
+	return value, nil
+}
+
+type attemptTokenKey string
+
+// Token returns a random token named name, generated by the first attempt asking for
+// it and the same for all the following ones, e.g. the idempotency key of a call to
+// an external service.
+func (a *Attempt) Token(name string) string {
+	token, _ := a.Memo(attemptTokenKey(name), func() (interface{}, error) {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			panic("gotx: reading random token failed: " + err.Error())
+		}
+		return hex.EncodeToString(b), nil
+	})
+	return token.(string)
+}
+
+// next starts attempt number n after an attempt which failed with err.
+func (a *Attempt) next(n int, err error) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+
+	a.number = n
+	if err != nil {
+		a.errs = append(a.errs, err)
+	}
+}
+
+// Attempt returns the attempt state of the transaction. Nested transactions sharing
+// the db transaction of their parent are retried with it and share its Attempt, while
+// a transaction with PropagationNew has its own.
+func (t *Transaction) Attempt() *Attempt {
+	if a, ok := t.ctx.Value(attemptContextKey{}).(*Attempt); ok {
+		return a
+	}
+	// nested transactions started with an unrelated context
+	for p := t.parent; p != nil; p = p.parent {
+		if a, ok := p.ctx.Value(attemptContextKey{}).(*Attempt); ok {
+			return a
+		}
+	}
+	return &Attempt{number: 1}
+}
@@ -0,0 +1,311 @@
+// Package bench runs load tests of gotx transactions against a database, to evaluate
+// the effect of options, isolation levels or schema changes before they reach
+// production:
+//
+//	hot := bench.HotRows{Table: "bench_counter", Rows: 10}
+//	report, err := bench.Run(ctx, tm, bench.Config{
+//		Setup:       hot.Setup,
+//		Concurrency: 32,
+//		Duration:    30 * time.Second,
+//		Workloads: []bench.Workload{
+//			{Name: "read", Weight: 8, Statements: 5, Statement: hot.Read},
+//			{Name: "increment", Weight: 2, Depth: 2, Statement: hot.Increment,
+//				Options: &gotx.Options{MaxRetries: 3, IsolationLevel: sql.LevelSerializable}},
+//		},
+//	})
+//	fmt.Print(report)
+//
+// The report gives the throughput, latency percentiles, retries and errors of every
+// workload and of the whole mix.
+package bench
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/tabwriter"
+	"time"
+
+	"github.com/oligo/gotx"
+)
+
+// Workload is a kind of transaction of the load test.
+type Workload struct {
+	Name string
+
+	// Weight is the share of the transactions of the mix run with this workload,
+	// relative to the weights of the other workloads. Zero counts as 1.
+	Weight int
+
+	// Depth is the nesting depth of the transactions: each transaction runs its
+	// statements and then a nested transaction with Exec, down to Depth levels. Zero
+	// counts as 1.
+	Depth int
+
+	// Statements is the number of statements run at each level. Zero counts as 1.
+	Statements int
+
+	// Options are the options of the root transaction, nested transactions use the
+	// defaults.
+	Options *gotx.Options
+
+	// Statement runs one statement of the workload in tx. rnd is the random source of
+	// the worker, e.g. to pick the rows of the statement.
+	Statement func(tx *gotx.Transaction, rnd *rand.Rand) error
+}
+
+// Config configures a load test.
+type Config struct {
+	Workloads []Workload
+
+	// Concurrency is the number of goroutines running transactions. Zero counts as 1.
+	Concurrency int
+
+	// Duration and Transactions end the load test, whichever is reached first. At
+	// least one must be set.
+	Duration     time.Duration
+	Transactions int
+
+	// Setup prepares the database before the load test, if set.
+	Setup func(ctx context.Context, tm *gotx.TxManager) error
+
+	// Seed seeds the random sources of the workers, which makes the sequence of
+	// workloads run by each worker reproducible.
+	Seed int64
+}
+
+// Result are the statistics of a workload, or of the whole mix.
+type Result struct {
+	Workload string
+
+	Transactions int64
+	Committed    int64
+	Failed       int64
+
+	// Retried is the number of retries of the root transactions.
+	Retried int64
+
+	// Throughput is the number of committed transactions per second.
+	Throughput float64
+
+	Mean time.Duration
+	P50  time.Duration
+	P95  time.Duration
+	P99  time.Duration
+	Max  time.Duration
+
+	// Errors count the errors of the failed transactions by message.
+	Errors map[string]int64
+}
+
+// Report is the outcome of a load test.
+type Report struct {
+	Duration  time.Duration
+	Total     Result
+	Workloads []Result
+}
+
+// String formats the report as a table.
+func (r *Report) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "load test ran for %s\n", r.Duration.Round(time.Millisecond))
+
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "workload\ttx\tcommitted\tfailed\tretried\ttx/s\tmean\tp50\tp95\tp99\tmax\t")
+	for _, res := range append(r.Workloads, r.Total) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.1f\t%s\t%s\t%s\t%s\t%s\t\n", res.Workload, res.Transactions,
+			res.Committed, res.Failed, res.Retried, res.Throughput, round(res.Mean), round(res.P50),
+			round(res.P95), round(res.P99), round(res.Max))
+	}
+	w.Flush()
+
+	if len(r.Total.Errors) > 0 {
+		b.WriteString("errors:\n")
+		messages := make([]string, 0, len(r.Total.Errors))
+		for msg := range r.Total.Errors {
+			messages = append(messages, msg)
+		}
+		sort.Strings(messages)
+		for _, msg := range messages {
+			fmt.Fprintf(&b, "  %6d  %s\n", r.Total.Errors[msg], msg)
+		}
+	}
+	return b.String()
+}
+
+func round(d time.Duration) time.Duration {
+	return d.Round(time.Microsecond)
+}
+
+// sample is the outcome of one transaction of a workload.
+type sample struct {
+	workload int
+	duration time.Duration
+	retries  int
+	err      error
+}
+
+// Run runs the load test configured by cfg with the transactions of tm and reports
+// its statistics. Failed transactions are counted, they do not stop the load test.
+// Canceling ctx ends it early.
+func Run(ctx context.Context, tm *gotx.TxManager, cfg Config) (*Report, error) {
+	if len(cfg.Workloads) == 0 {
+		return nil, errors.New("bench: no workloads")
+	}
+	if cfg.Duration <= 0 && cfg.Transactions <= 0 {
+		return nil, errors.New("bench: Duration or Transactions must be set")
+	}
+
+	var weights []int
+	total := 0
+	for _, w := range cfg.Workloads {
+		if w.Statement == nil {
+			return nil, fmt.Errorf("bench: workload %s has no Statement", w.Name)
+		}
+		total += atLeastOne(w.Weight)
+		weights = append(weights, total)
+	}
+
+	if cfg.Setup != nil {
+		if err := cfg.Setup(ctx, tm); err != nil {
+			return nil, fmt.Errorf("bench: setup failed: %w", err)
+		}
+	}
+
+	if cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Duration)
+		defer cancel()
+	}
+
+	var started int64
+	var mux sync.Mutex
+	var samples []sample
+	var wg sync.WaitGroup
+
+	start := time.Now()
+	for i := 0; i < atLeastOne(cfg.Concurrency); i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+
+			rnd := rand.New(rand.NewSource(cfg.Seed + int64(worker)))
+			var local []sample
+			for ctx.Err() == nil {
+				if cfg.Transactions > 0 && atomic.AddInt64(&started, 1) > int64(cfg.Transactions) {
+					break
+				}
+
+				n := rnd.Intn(total)
+				idx := sort.SearchInts(weights, n+1)
+				s := runWorkload(ctx, tm, idx, &cfg.Workloads[idx], rnd)
+				if s.err != nil && ctx.Err() != nil {
+					// interrupted by the end of the load test
+					break
+				}
+				local = append(local, s)
+			}
+
+			mux.Lock()
+			samples = append(samples, local...)
+			mux.Unlock()
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	report := &Report{Duration: elapsed}
+	for i, w := range cfg.Workloads {
+		report.Workloads = append(report.Workloads, summarize(w.Name, samples, i, elapsed))
+	}
+	report.Total = summarize("total", samples, -1, elapsed)
+	return report, nil
+}
+
+// runWorkload runs one transaction of w.
+func runWorkload(ctx context.Context, tm *gotx.TxManager, idx int, w *Workload, rnd *rand.Rand) sample {
+	attempts := 0
+	var level func(ctx context.Context, depth int, opts *gotx.Options, root bool) error
+	level = func(ctx context.Context, depth int, opts *gotx.Options, root bool) error {
+		return tm.Exec(ctx, func(tx *gotx.Transaction) error {
+			if root {
+				attempts++
+			}
+			for i := 0; i < atLeastOne(w.Statements); i++ {
+				if err := w.Statement(tx, rnd); err != nil {
+					return err
+				}
+			}
+			if depth > 1 {
+				return level(tx.Context(), depth-1, nil, false)
+			}
+			return nil
+		}, opts)
+	}
+
+	start := time.Now()
+	err := level(ctx, atLeastOne(w.Depth), w.Options, true)
+	s := sample{workload: idx, duration: time.Since(start), err: err}
+	if attempts > 1 {
+		s.retries = attempts - 1
+	}
+	return s
+}
+
+// summarize computes the result of the samples of workload idx, or of all samples if
+// idx is negative.
+func summarize(name string, samples []sample, idx int, elapsed time.Duration) Result {
+	res := Result{Workload: name, Errors: make(map[string]int64)}
+	var durations []time.Duration
+	var sum time.Duration
+	for _, s := range samples {
+		if idx >= 0 && s.workload != idx {
+			continue
+		}
+
+		res.Transactions++
+		res.Retried += int64(s.retries)
+		if s.err != nil {
+			res.Failed++
+			res.Errors[s.err.Error()]++
+			continue
+		}
+		res.Committed++
+		durations = append(durations, s.duration)
+		sum += s.duration
+	}
+
+	if len(durations) > 0 {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		res.Mean = sum / time.Duration(len(durations))
+		res.P50 = percentile(durations, 50)
+		res.P95 = percentile(durations, 95)
+		res.P99 = percentile(durations, 99)
+		res.Max = durations[len(durations)-1]
+	}
+	if elapsed > 0 {
+		res.Throughput = float64(res.Committed) / elapsed.Seconds()
+	}
+	return res
+}
+
+// percentile returns the p-th percentile of sorted durations using the nearest rank.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func atLeastOne(n int) int {
+	if n < 1 {
+		return 1
+	}
+	return n
+}
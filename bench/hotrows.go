@@ -0,0 +1,56 @@
+package bench
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+
+	"github.com/oligo/gotx"
+)
+
+// HotRows is a table of counters with a few rows, which transactions incrementing them
+// contend on. It measures the cost of row locks, deadlocks and serialization failures
+// with the options of the workloads. The table has the columns id and value, and is
+// created by Setup on databases supporting CREATE TABLE IF NOT EXISTS.
+type HotRows struct {
+	Table string
+
+	// Rows is the number of rows, fewer rows give more contention. Zero counts as 1.
+	Rows int
+}
+
+// Setup creates the table if needed and resets its rows to zero.
+func (h HotRows) Setup(ctx context.Context, tm *gotx.TxManager) error {
+	return tm.Exec(ctx, func(tx *gotx.Transaction) error {
+		noArgs := map[string]interface{}{}
+		if _, err := tx.NamedExec("CREATE TABLE IF NOT EXISTS "+h.Table+" (id INTEGER PRIMARY KEY, value BIGINT NOT NULL)", noArgs); err != nil {
+			return err
+		}
+		if _, err := tx.NamedExec("DELETE FROM "+h.Table, noArgs); err != nil {
+			return err
+		}
+		for id := 1; id <= atLeastOne(h.Rows); id++ {
+			if _, err := tx.NamedExec("INSERT INTO "+h.Table+" (id, value) VALUES (:id, 0)", map[string]interface{}{"id": id}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, &gotx.Options{Propagation: gotx.PropagationNew})
+}
+
+// Increment increments the counter of a random row, taking its row lock until the
+// transaction ends.
+func (h HotRows) Increment(tx *gotx.Transaction, rnd *rand.Rand) error {
+	_, err := tx.Update("UPDATE "+h.Table+" SET value = value + 1 WHERE id = :id", map[string]interface{}{"id": h.row(rnd)})
+	return err
+}
+
+// Read reads the counter of a random row.
+func (h HotRows) Read(tx *gotx.Transaction, rnd *rand.Rand) error {
+	var value int64
+	return tx.GetOne(&value, "SELECT value FROM "+h.Table+" WHERE id = "+strconv.Itoa(h.row(rnd)))
+}
+
+func (h HotRows) row(rnd *rand.Rand) int {
+	return rnd.Intn(atLeastOne(h.Rows)) + 1
+}
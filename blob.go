@@ -0,0 +1,236 @@
+package gotx
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// defaultBlobChunkSize is the number of bytes read or written by a statement of
+// ReadBlob and WriteBlob.
+const defaultBlobChunkSize = 256 << 10
+
+// Blob identifies a binary column of a row streamed by ReadBlob and WriteBlob.
+type Blob struct {
+	Table  string
+	Column string
+
+	// KeyColumn and Key identify the row. KeyColumn defaults to "id".
+	KeyColumn string
+	Key       interface{}
+
+	// LargeObject marks a Postgres column holding the OID of a large object rather
+	// than the bytes themselves.
+	LargeObject bool
+
+	// ChunkSize is the number of bytes read or written by one statement, 256 KiB by
+	// default.
+	ChunkSize int
+}
+
+func (b Blob) keyColumn() string {
+	if b.KeyColumn == "" {
+		return "id"
+	}
+	return b.KeyColumn
+}
+
+func (b Blob) chunkSize() int {
+	if b.ChunkSize <= 0 {
+		return defaultBlobChunkSize
+	}
+	return b.ChunkSize
+}
+
+// where returns the condition selecting the row of the blob.
+func (b Blob) where() string {
+	return " FROM " + b.Table + " WHERE " + b.keyColumn() + " = ?"
+}
+
+// ReadBlob copies the value of a binary column to w, reading it in chunks so the
+// value is never held in memory as a whole:
+//
+//	w.Header().Set("Content-Type", "application/pdf")
+//	_, err := tx.ReadBlob(w, gotx.Blob{Table: "invoice", Column: "pdf", Key: invoiceID})
+//
+// Chunks are read with SUBSTRING, or lo_get for Postgres large objects, and all of
+// them within the transaction, so the value read is consistent when the isolation
+// level gives a snapshot. It returns the number of bytes written to w, and
+// sql.ErrNoRows if there is no row with the key. A NULL value writes nothing.
+func (t *Transaction) ReadBlob(w io.Writer, blob Blob) (int64, error) {
+	if err := t.checkState(); err != nil {
+		return 0, err
+	}
+
+	var query string
+	var object sql.NullInt64
+	switch {
+	case blob.LargeObject:
+		if t.txManager.dialect != DialectPostgres {
+			return 0, errors.New("gotx: large objects are only supported on postgres")
+		}
+		if err := t.GetOne(&object, t.tx.Rebind("SELECT "+blob.Column+blob.where()), blob.Key); err != nil {
+			return 0, err
+		}
+		if !object.Valid {
+			return 0, nil
+		}
+		query = "SELECT lo_get(?, ?, ?)"
+	case t.txManager.dialect == DialectPostgres:
+		query = "SELECT substring(" + blob.Column + " from ? for ?)" + blob.where()
+	case t.txManager.dialect == DialectSQLite:
+		query = "SELECT substr(" + blob.Column + ", ?, ?)" + blob.where()
+	case t.txManager.dialect == DialectMySQL, t.txManager.dialect == DialectSQLServer:
+		query = "SELECT SUBSTRING(" + blob.Column + ", ?, ?)" + blob.where()
+	default:
+		return 0, fmt.Errorf("gotx: streaming blobs is not supported on %s", t.txManager.dialect)
+	}
+	query = t.tx.Rebind(query)
+
+	chunk := blob.chunkSize()
+	var total int64
+	for {
+		var data []byte
+		var err error
+		if blob.LargeObject {
+			err = t.GetOne(&data, query, object.Int64, total, chunk)
+		} else {
+			// SUBSTRING positions start at 1
+			err = t.GetOne(&data, query, total+1, chunk, blob.Key)
+		}
+		if err != nil {
+			return total, err
+		}
+
+		if len(data) > 0 {
+			n, err := w.Write(data)
+			total += int64(n)
+			if err != nil {
+				return total, err
+			}
+		}
+		if len(data) < chunk {
+			return total, nil
+		}
+	}
+}
+
+// WriteBlob replaces the value of a binary column with the content of r, writing it
+// in chunks so the value is never held in memory as a whole:
+//
+//	_, err := tx.WriteBlob(gotx.Blob{Table: "invoice", Column: "pdf", Key: invoiceID}, file)
+//
+// The first chunk replaces the value and the following ones are appended to it, so
+// the column holds a partial value until the transaction commits. On Postgres each
+// append rewrites the bytea value, which large objects avoid: the content is written
+// to a new large object, whose OID is stored in the column, and the previous one is
+// unlinked. It returns the number of bytes read from r, and sql.ErrNoRows if
+// there is no row with the key.
+func (t *Transaction) WriteBlob(blob Blob, r io.Reader) (int64, error) {
+	if err := t.checkState(); err != nil {
+		return 0, err
+	}
+
+	if blob.LargeObject {
+		return t.writeLargeObject(blob, r)
+	}
+
+	var appendExpr string
+	switch t.txManager.dialect {
+	case DialectPostgres:
+		appendExpr = blob.Column + " = " + blob.Column + " || ?"
+	case DialectSQLite:
+		appendExpr = blob.Column + " = CAST(" + blob.Column + " || ? AS BLOB)"
+	case DialectMySQL:
+		appendExpr = blob.Column + " = CONCAT(" + blob.Column + ", ?)"
+	case DialectSQLServer:
+		appendExpr = blob.Column + ".WRITE(?, NULL, 0)"
+	default:
+		return 0, fmt.Errorf("gotx: streaming blobs is not supported on %s", t.txManager.dialect)
+	}
+	replace := t.tx.Rebind("UPDATE " + blob.Table + " SET " + blob.Column + " = ? WHERE " + blob.keyColumn() + " = ?")
+	appendQuery := t.tx.Rebind("UPDATE " + blob.Table + " SET " + appendExpr + " WHERE " + blob.keyColumn() + " = ?")
+
+	var total int64
+	err := readChunks(r, blob.chunkSize(), func(data []byte) error {
+		if total == 0 {
+			result, err := t.exec(replace, data, blob.Key)
+			if err != nil {
+				return err
+			}
+			// MySQL counts changed rows only
+			if n, err := result.RowsAffected(); err == nil && n == 0 && t.txManager.dialect != DialectMySQL {
+				return sql.ErrNoRows
+			}
+		} else if _, err := t.exec(appendQuery, data, blob.Key); err != nil {
+			return err
+		}
+		total += int64(len(data))
+		return nil
+	})
+	return total, err
+}
+
+// writeLargeObject writes the content of r to a new Postgres large object referenced
+// by the column of blob.
+func (t *Transaction) writeLargeObject(blob Blob, r io.Reader) (int64, error) {
+	if t.txManager.dialect != DialectPostgres {
+		return 0, errors.New("gotx: large objects are only supported on postgres")
+	}
+
+	var previous sql.NullInt64
+	if err := t.GetOne(&previous, t.tx.Rebind("SELECT "+blob.Column+blob.where()), blob.Key); err != nil {
+		return 0, err
+	}
+
+	var object int64
+	if err := t.GetOne(&object, "SELECT lo_create(0)"); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	err := readChunks(r, blob.chunkSize(), func(data []byte) error {
+		if _, err := t.exec("SELECT lo_put($1, $2, $3)", object, total, data); err != nil {
+			return err
+		}
+		total += int64(len(data))
+		return nil
+	})
+	if err != nil {
+		return total, err
+	}
+
+	query := "UPDATE " + blob.Table + " SET " + blob.Column + " = $1 WHERE " + blob.keyColumn() + " = $2"
+	if _, err := t.exec(query, object, blob.Key); err != nil {
+		return total, err
+	}
+	if previous.Valid {
+		if _, err := t.exec("SELECT lo_unlink($1)", previous.Int64); err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// readChunks calls fn with the content of r in chunks of size bytes, and once with an
+// empty chunk if r is empty.
+func readChunks(r io.Reader, size int, fn func(data []byte) error) error {
+	buf := make([]byte, size)
+	for first := true; ; first = false {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF && !first {
+			return nil
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		if fnErr := fn(buf[:n]); fnErr != nil {
+			return fnErr
+		}
+		if err != nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package gotx
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"reflect"
+	"sync"
+	"time"
+)
+
+type bypassCacheContextKey struct{}
+
+type cacheReadsContextKey struct{}
+
+// cacheWritesKey is the key of the tables written in a db transaction, stored in its
+// values.
+type cacheWritesKey struct{ cache *QueryCache }
+
+// allTables is the generation name invalidating all cached results, used for writes
+// to unknown tables.
+const allTables = "*"
+
+// CacheStore stores the results cached by a QueryCache. Implementations must be safe
+// for concurrent use. An in-memory store is returned by NewLRUStore, and a Redis store
+// is in the contrib/redisgotx module.
+type CacheStore interface {
+	// Get returns the value stored under key, and false if there is none or it
+	// expired.
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+
+	// Set stores value under key for ttl. A ttl of zero stores value without expiry.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+}
+
+// QueryCache is an Interceptor caching the results of Get and Select statements of
+// read-only transactions for a TTL, read through on a miss, to take load off the
+// database for hot reference data lookups:
+//
+//	cache := gotx.NewQueryCache(gotx.NewLRUStore(10000), time.Minute, "country", "currency")
+//	tm := gotx.NewTxManager(db, gotx.WithQueryCache(cache))
+//	err := tm.Exec(ctx, txFunc, (&gotx.Options{}).WithReadOnly())
+//
+// Reads of read-write transactions are not cached, since a transaction writing back a
+// value up to the TTL old would lose the updates made meanwhile, unless their context
+// is returned by CacheReads.
+//
+// Cached results are invalidated by table: every statement writing data run through a
+// Transaction records the tables it writes, and once its db transaction commits the
+// results read from these tables are dropped. Writes whose tables can not be told from
+// the statement drop all cached results. Writes made around gotx, e.g. by other
+// services, are only picked up when the TTL expires.
+//
+// Results are keyed by the query and its arguments and cached as JSON, so destinations
+// must survive a JSON round trip: unexported fields are not cached. To keep reading
+// its own writes, a db transaction stops using the cache once it wrote, and locking
+// reads such as SELECT ... FOR UPDATE are never cached. Cached results may be up to the
+// TTL old, even within a transaction. Statements run with a context returned by
+// BypassCache skip the cache.
+type QueryCache struct {
+	store  CacheStore
+	ttl    time.Duration
+	tables map[string]bool
+}
+
+// NewQueryCache returns a cache storing results in store for ttl. If tables are given
+// only statements reading exclusively from these tables are cached.
+func NewQueryCache(store CacheStore, ttl time.Duration, tables ...string) *QueryCache {
+	c := &QueryCache{store: store, ttl: ttl}
+	if len(tables) > 0 {
+		c.tables = tableSet(tables)
+	}
+	return c
+}
+
+// BypassCache returns a context whose statements skip query caches, e.g. to read the
+// latest data right before updating it:
+//
+//	err := tm.Exec(gotx.BypassCache(ctx), func(tx *gotx.Transaction) error { ... }, nil)
+func BypassCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassCacheContextKey{}, true)
+}
+
+// CacheReads returns a context whose Get and Select statements use query caches even in
+// read-write transactions, for reads whose results may be stale, e.g. of reference
+// data the transaction never writes back:
+//
+//	err := tm.Exec(gotx.CacheReads(ctx), func(tx *gotx.Transaction) error { ... }, nil)
+func CacheReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, cacheReadsContextKey{}, true)
+}
+
+// WithQueryCache adds cache to the statement execution chain of the manager and
+// invalidates its results after commits.
+func WithQueryCache(cache *QueryCache) ManagerOption {
+	return func(tm *TxManager) {
+		WithInterceptors(cache)(tm)
+		WithHooks(Hooks{AfterCommit: cache.invalidate})(tm)
+		if u, ok := cache.store.(clockUser); ok {
+			tm.clockUsers = append(tm.clockUsers, u)
+		}
+	}
+}
+
+// Intercept implements Interceptor.
+func (c *QueryCache) Intercept(ctx context.Context, stmt *Statement, next StatementHandler) error {
+	if stmt.Kind != StatementGet && stmt.Kind != StatementSelect {
+		if writes(stmt) {
+			c.recordWrite(stmt)
+		}
+		return next(ctx, stmt)
+	}
+	if !c.cacheable(ctx, stmt) {
+		return next(ctx, stmt)
+	}
+
+	key, err := c.cacheKey(ctx, stmt)
+	if err != nil {
+		return next(ctx, stmt)
+	}
+
+	if cached, ok, err := c.store.Get(ctx, key); err != nil {
+		log.Printf("gotx: reading query cache failed: %v", err)
+	} else if ok && decodeCached(cached, stmt.Dest) == nil {
+		return nil
+	}
+
+	if err := next(ctx, stmt); err != nil {
+		return err
+	}
+
+	if encoded, err := json.Marshal(stmt.Dest); err != nil {
+		log.Printf("gotx: encoding result for the query cache failed: %v", err)
+	} else if err := c.store.Set(ctx, key, encoded, c.ttl); err != nil {
+		log.Printf("gotx: writing query cache failed: %v", err)
+	}
+	return nil
+}
+
+// decodeCached decodes a cached result into dest, a pointer. The result is decoded into
+// a new value which replaces the one dest points to only once decoded completely, so a
+// result failing to decode leaves dest untouched for the query.
+func decodeCached(cached []byte, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("gotx: dest must be a non-nil pointer")
+	}
+
+	decoded := reflect.New(v.Elem().Type())
+	if err := json.Unmarshal(cached, decoded.Interface()); err != nil {
+		return err
+	}
+	v.Elem().Set(decoded.Elem())
+	return nil
+}
+
+// cacheable reports whether the result of stmt may be served from the cache.
+func (c *QueryCache) cacheable(ctx context.Context, stmt *Statement) bool {
+	if bypass, _ := ctx.Value(bypassCacheContextKey{}).(bool); bypass {
+		return false
+	}
+	if tx := stmt.Tx(); tx != nil {
+		if optIn, _ := ctx.Value(cacheReadsContextKey{}).(bool); !optIn && !tx.opts.ReadOnly {
+			return false
+		}
+		if c.wrote(tx) {
+			return false
+		}
+	}
+	if hasTopLevelKeyword(stmt.Query, "FOR", stmt.dialect()) {
+		return false
+	}
+
+	if c.tables != nil {
+		tables := statementTables(stmt.Query, stmt.dialect())
+		if len(tables) == 0 {
+			return false
+		}
+		for _, table := range tables {
+			if !c.tables[table] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// cacheKey returns the cache key of the query and arguments of stmt, which includes
+// the current generations of the tables it reads.
+func (c *QueryCache) cacheKey(ctx context.Context, stmt *Statement) (string, error) {
+	args, err := json.Marshal(stmt.Args)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write([]byte{byte(stmt.Kind)})
+	h.Write([]byte(stmt.Query))
+	h.Write([]byte{0})
+	h.Write(args)
+
+	for _, table := range append(statementTables(stmt.Query, stmt.dialect()), allTables) {
+		generation, err := c.generation(ctx, table)
+		if err != nil {
+			log.Printf("gotx: reading query cache failed: %v", err)
+			return "", err
+		}
+		h.Write([]byte{0})
+		h.Write([]byte(generation))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// generation returns the generation of table, which changes whenever the results
+// read from the table are invalidated.
+func (c *QueryCache) generation(ctx context.Context, table string) (string, error) {
+	generation, ok, err := c.store.Get(ctx, generationKey(table))
+	if err != nil || ok {
+		return string(generation), err
+	}
+
+	// a generation evicted from the store must not fall back to one used before
+	next := txIDs.next()
+	return next, c.store.Set(ctx, generationKey(table), []byte(next), 0)
+}
+
+func generationKey(table string) string {
+	return "generation:" + table
+}
+
+// writes reports whether stmt writes data, which reads such as ForEach queries and
+// the statements managing savepoints do not.
+func writes(stmt *Statement) bool {
+	verb := statementVerb(stmt.Query, stmt.dialect())
+	if !readOnlyVerbs[verb] && !savepointVerbs[verb] {
+		return true
+	}
+	// a locking read does not write, but a data modifying CTE does
+	tokens := tokenizeSQL(stmt.Query, stmt.dialect())
+	for i, t := range tokens {
+		switch t.keyword() {
+		case "INSERT", "DELETE", "MERGE":
+			return true
+		case "UPDATE":
+			if i > 0 && tokens[i-1].text == "(" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wrote reports whether the db transaction of tx recorded a write.
+func (c *QueryCache) wrote(tx *Transaction) bool {
+	tx.tx.valuesMux.Lock()
+	defer tx.tx.valuesMux.Unlock()
+	written, _ := tx.tx.values[cacheWritesKey{c}].(map[string]bool)
+	return len(written) > 0
+}
+
+// recordWrite records the tables written by stmt in its db transaction.
+func (c *QueryCache) recordWrite(stmt *Statement) {
+	tx := stmt.Tx()
+	if tx == nil {
+		return
+	}
+
+	tables := statementTables(stmt.Query, stmt.dialect())
+	if len(tables) == 0 {
+		tables = []string{allTables}
+	}
+
+	tx.tx.valuesMux.Lock()
+	defer tx.tx.valuesMux.Unlock()
+
+	if tx.tx.values == nil {
+		tx.tx.values = make(map[interface{}]interface{})
+	}
+	written, _ := tx.tx.values[cacheWritesKey{c}].(map[string]bool)
+	if written == nil {
+		written = make(map[string]bool)
+		tx.tx.values[cacheWritesKey{c}] = written
+	}
+	for _, table := range tables {
+		written[table] = true
+	}
+}
+
+// invalidate drops the cached results read from the tables written by the committed
+// db transaction of tx.
+func (c *QueryCache) invalidate(tx *Transaction) {
+	tx.tx.valuesMux.Lock()
+	written, _ := tx.tx.values[cacheWritesKey{c}].(map[string]bool)
+	tx.tx.valuesMux.Unlock()
+
+	// the transaction context may have expired while committing
+	ctx := context.Background()
+	for table := range written {
+		if err := c.store.Set(ctx, generationKey(table), []byte(txIDs.next()), 0); err != nil {
+			log.Printf("gotx: invalidating query cache of %s failed: %v", table, err)
+		}
+	}
+}
+
+// LRUStore is an in-memory CacheStore evicting the least recently used entries when
+// it is full.
+type LRUStore struct {
+	maxEntries int
+
+	mux     sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	clock   Clock
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRUStore returns an in-memory store holding at most maxEntries entries. Entries
+// expire on the clock of the first manager it is passed to with WithQueryCache.
+func NewLRUStore(maxEntries int) *LRUStore {
+	return &LRUStore{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+		clock:      SystemClock{},
+	}
+}
+
+// useClock implements clockUser.
+func (s *LRUStore) useClock(clock Clock) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if _, ok := s.clock.(SystemClock); ok {
+		s.clock = clock
+	}
+}
+
+// Get implements CacheStore.
+func (s *LRUStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, false, nil
+	}
+
+	entry := elem.Value.(*lruEntry)
+	if !entry.expires.IsZero() && s.clock.Now().After(entry.expires) {
+		s.lru.Remove(elem)
+		delete(s.entries, key)
+		return nil, false, nil
+	}
+
+	s.lru.MoveToFront(elem)
+	return entry.value, true, nil
+}
+
+// Set implements CacheStore.
+func (s *LRUStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	entry := &lruEntry{key: key, value: value}
+	if ttl > 0 {
+		entry.expires = s.clock.Now().Add(ttl)
+	}
+	if elem, ok := s.entries[key]; ok {
+		elem.Value = entry
+		s.lru.MoveToFront(elem)
+		return nil
+	}
+
+	s.entries[key] = s.lru.PushFront(entry)
+	for s.maxEntries > 0 && s.lru.Len() > s.maxEntries {
+		oldest := s.lru.Back()
+		s.lru.Remove(oldest)
+		delete(s.entries, oldest.Value.(*lruEntry).key)
+	}
+	return nil
+}
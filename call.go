@@ -0,0 +1,261 @@
+package gotx
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Call invokes the stored procedure procName with the in parameters and stores its
+// OUT parameters in out, generating the CALL syntax of the manager's dialect:
+//
+//	out := map[string]interface{}{"balance": new(int64)}
+//	err := tx.Call("transfer", map[string]interface{}{"src": 1, "dst": 2, "amount": 100}, out)
+//
+// Parameters are matched by name. A name present in both maps is an INOUT parameter.
+// If an out value is a non-nil pointer the parameter is scanned into it, otherwise the
+// value in the map is replaced with the raw value returned by the driver.
+//
+// On Postgres the procedure is called with named notation and OUT parameters are read
+// from the row returned by CALL. MySQL does not support named notation, so parameter
+// positions are looked up in information_schema and OUT parameters are passed through
+// session variables. SQL Server and Oracle bind OUT parameters with sql.Out, which the
+// driver must support. procName and the parameter names are inlined into the statement
+// and must not come from user input.
+func (t *Transaction) Call(procName string, in map[string]interface{}, out map[string]interface{}) error {
+	if err := t.checkState(); err != nil {
+		return err
+	}
+
+	for _, params := range []map[string]interface{}{in, out} {
+		for name := range params {
+			if !isIdentifier(name) {
+				return fmt.Errorf("call %s failed: invalid parameter name %q", procName, name)
+			}
+		}
+	}
+
+	var err error
+	switch t.txManager.dialect {
+	case DialectPostgres:
+		err = t.callPostgres(procName, in, out)
+	case DialectMySQL:
+		err = t.callMySQL(procName, in, out)
+	case DialectSQLServer, DialectOracle:
+		err = t.callWithOutArgs(procName, in, out)
+	default:
+		err = fmt.Errorf("stored procedures are not supported by the %s dialect", t.txManager.dialect)
+	}
+
+	if err != nil {
+		return fmt.Errorf("call %s failed: %w", procName, err)
+	}
+	return nil
+}
+
+func (t *Transaction) callPostgres(procName string, in, out map[string]interface{}) error {
+	var params []string
+	var args []interface{}
+	for _, name := range paramNames(in, out) {
+		if v, ok := in[name]; ok {
+			args = append(args, v)
+			params = append(params, name+" => "+t.txManager.Placeholder(len(args)))
+		} else {
+			params = append(params, name+" => NULL")
+		}
+	}
+
+	query := "CALL " + procName + "(" + strings.Join(params, ", ") + ")"
+	if len(out) == 0 {
+		_, err := t.exec(query, args...)
+		return err
+	}
+
+	return t.run(&Statement{Kind: StatementQuery, Query: query, Args: args, EachRow: scanOutParams(out)})
+}
+
+func (t *Transaction) callMySQL(procName string, in, out map[string]interface{}) error {
+	var schema interface{}
+	name := procName
+	if i := strings.LastIndex(procName, "."); i >= 0 {
+		schema, name = strings.Trim(procName[:i], "`"), procName[i+1:]
+	}
+
+	var positions []string
+	err := t.Select(&positions, "SELECT PARAMETER_NAME FROM information_schema.PARAMETERS"+
+		" WHERE SPECIFIC_SCHEMA = COALESCE(?, DATABASE()) AND SPECIFIC_NAME = ?"+
+		" AND ROUTINE_TYPE = 'PROCEDURE' AND ORDINAL_POSITION > 0 ORDER BY ORDINAL_POSITION",
+		schema, strings.Trim(name, "`"))
+	if err != nil {
+		return err
+	}
+
+	known := make(map[string]bool, len(positions))
+	for _, p := range positions {
+		known[p] = true
+	}
+	for _, p := range paramNames(in, out) {
+		if !known[p] {
+			return fmt.Errorf("procedure has no parameter %s", p)
+		}
+	}
+
+	var params, selects []string
+	var args []interface{}
+	for _, p := range positions {
+		_, isIn := in[p]
+		_, isOut := out[p]
+		switch {
+		case isOut:
+			variable := "@gotx_" + p
+			if isIn {
+				if _, err := t.exec("SET "+variable+" = ?", in[p]); err != nil {
+					return err
+				}
+			}
+			params = append(params, variable)
+			selects = append(selects, variable+" AS "+p)
+		case isIn:
+			params = append(params, "?")
+			args = append(args, in[p])
+		default:
+			params = append(params, "NULL")
+		}
+	}
+
+	if _, err := t.exec("CALL "+procName+"("+strings.Join(params, ", ")+")", args...); err != nil {
+		return err
+	}
+	if len(selects) == 0 {
+		return nil
+	}
+
+	return t.run(&Statement{Kind: StatementQuery, Query: "SELECT " + strings.Join(selects, ", "), EachRow: scanOutParams(out)})
+}
+
+// callWithOutArgs calls a procedure of a driver supporting sql.Out arguments.
+func (t *Transaction) callWithOutArgs(procName string, in, out map[string]interface{}) error {
+	var params []string
+	var args []interface{}
+	holders := make(map[string]*interface{})
+
+	for _, name := range paramNames(in, out) {
+		v, isIn := in[name]
+		if _, isOut := out[name]; !isOut {
+			args = append(args, sql.Named(name, v))
+			params = append(params, t.namedParam(name, false))
+			continue
+		}
+
+		dest := out[name]
+		if !isNonNilPointer(dest) {
+			holder := new(interface{})
+			holders[name], dest = holder, holder
+		}
+		args = append(args, sql.Named(name, sql.Out{Dest: dest, In: isIn}))
+		params = append(params, t.namedParam(name, true))
+	}
+
+	var query string
+	if t.txManager.dialect == DialectSQLServer {
+		query = "EXEC " + procName + " " + strings.Join(params, ", ")
+	} else {
+		query = "BEGIN " + procName + "(" + strings.Join(params, ", ") + "); END;"
+	}
+
+	if _, err := t.exec(query, args...); err != nil {
+		return err
+	}
+
+	for name, holder := range holders {
+		out[name] = *holder
+	}
+	return nil
+}
+
+// namedParam returns the parameter assignment of a procedure call by name.
+func (t *Transaction) namedParam(name string, isOut bool) string {
+	if t.txManager.dialect == DialectSQLServer {
+		if isOut {
+			return "@" + name + " = @" + name + " OUTPUT"
+		}
+		return "@" + name + " = @" + name
+	}
+	return name + " => :" + name
+}
+
+// scanOutParams returns a row callback storing the columns of the first row in out.
+func scanOutParams(out map[string]interface{}) func(rows *sqlx.Rows) error {
+	return func(rows *sqlx.Rows) error {
+		columns, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+
+		keys := make([]string, len(columns))
+		dests := make([]interface{}, len(columns))
+		values := make([]interface{}, len(columns))
+		for i, column := range columns {
+			keys[i] = column
+			for name := range out {
+				if strings.EqualFold(name, column) {
+					keys[i] = name
+				}
+			}
+
+			if dest, ok := out[keys[i]]; ok && isNonNilPointer(dest) {
+				dests[i] = dest
+			} else {
+				dests[i] = &values[i]
+			}
+		}
+
+		if err := rows.Scan(dests...); err != nil {
+			return err
+		}
+
+		for i, key := range keys {
+			if _, ok := out[key]; ok && dests[i] == &values[i] {
+				out[key] = values[i]
+			}
+		}
+		return errStopRows
+	}
+}
+
+// paramNames returns the sorted union of the keys of in and out.
+func paramNames(in, out map[string]interface{}) []string {
+	var names []string
+	for name := range in {
+		names = append(names, name)
+	}
+	for name := range out {
+		if _, ok := in[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func isNonNilPointer(v interface{}) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Ptr && !rv.IsNil()
+}
+
+// isIdentifier reports whether name is a plain SQL identifier.
+func isIdentifier(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if r == '$' || !isIdentRune(r) {
+			return false
+		}
+	}
+	return true
+}
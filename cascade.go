@@ -0,0 +1,199 @@
+package gotx
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// maxCascadeDepth bounds the levels of dependent rows followed by CascadeDelete, which
+// are only unbounded for cyclic data.
+const maxCascadeDepth = 64
+
+// CascadeCount is the number of rows of a table deleted, or to be deleted, by
+// CascadeDelete.
+type CascadeCount struct {
+	Table string
+	Rows  int64
+}
+
+// CascadeDelete deletes the row of table with the primary key key, and the rows
+// depending on it through foreign keys, dependent rows first, for schemas without ON
+// DELETE CASCADE:
+//
+//	counts, err := tx.CascadeDelete("customer", customerID)
+//
+// key is the value of a single column primary key, or a map[string]interface{} of the
+// columns of a composite one. Foreign keys are read with TxManager.Schema. It returns
+// the number of deleted rows per table, in the order the tables were deleted from.
+// Rows of self referencing tables are followed to a depth of 64.
+func (t *Transaction) CascadeDelete(table string, key interface{}) ([]CascadeCount, error) {
+	return t.cascade(table, key, false)
+}
+
+// CascadeDeleteDryRun returns what CascadeDelete would delete without deleting any row.
+// Rows depending on the row through several foreign keys are counted once per foreign
+// key.
+func (t *Transaction) CascadeDeleteDryRun(table string, key interface{}) ([]CascadeCount, error) {
+	return t.cascade(table, key, true)
+}
+
+// cascadeDelete is the state of a CascadeDelete call.
+type cascadeDelete struct {
+	tx     *Transaction
+	schema *Schema
+	dryRun bool
+	counts []CascadeCount
+}
+
+func (t *Transaction) cascade(table string, key interface{}, dryRun bool) ([]CascadeCount, error) {
+	if err := t.checkState(); err != nil {
+		return nil, err
+	}
+
+	schema, err := t.txManager.Schema(t.ctx)
+	if err != nil {
+		return nil, err
+	}
+	root, ok := schema.Table(table)
+	if !ok {
+		return nil, fmt.Errorf("gotx: table %s not found", table)
+	}
+	if len(root.PrimaryKey) == 0 {
+		return nil, fmt.Errorf("gotx: table %s has no primary key", table)
+	}
+
+	var values []interface{}
+	if m, ok := key.(map[string]interface{}); ok {
+		for _, column := range root.PrimaryKey {
+			v, ok := m[column]
+			if !ok {
+				return nil, fmt.Errorf("gotx: key of %s misses column %s", table, column)
+			}
+			values = append(values, v)
+		}
+	} else if len(root.PrimaryKey) == 1 {
+		values = []interface{}{key}
+	} else {
+		return nil, fmt.Errorf("gotx: key of %s must be a map of the columns %s", table, strings.Join(root.PrimaryKey, ", "))
+	}
+
+	c := &cascadeDelete{tx: t, schema: schema, dryRun: dryRun}
+	if err := c.delete(root, root.PrimaryKey, [][]interface{}{values}, 0); err != nil {
+		return nil, err
+	}
+	return c.counts, nil
+}
+
+// delete deletes the rows of table whose columns have one of keys, after the rows
+// depending on them.
+func (c *cascadeDelete) delete(table *Table, columns []string, keys [][]interface{}, depth int) error {
+	if depth > maxCascadeDepth {
+		return fmt.Errorf("gotx: cascade delete of %s exceeds %d levels of dependent rows", table.Name, maxCascadeDepth)
+	}
+
+	batch := c.tx.txManager.maxParams() / len(columns)
+	for start := 0; start < len(keys); start += batch {
+		end := start + batch
+		if end > len(keys) {
+			end = len(keys)
+		}
+		where, args := keyCondition(columns, keys[start:end])
+
+		for _, name := range c.schema.TableNames() {
+			child := c.schema.Tables[strings.ToLower(name)]
+			for _, fk := range child.ForeignKeys {
+				if !strings.EqualFold(fk.RefTable, table.Name) {
+					continue
+				}
+
+				refs, err := c.selectKeys(table.Name, fk.RefColumns, where, args)
+				if err != nil {
+					return err
+				}
+				if len(refs) > 0 {
+					if err := c.delete(child, fk.Columns, refs, depth+1); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		n, err := c.deleteRows(table.Name, where, args)
+		if err != nil {
+			return err
+		}
+		c.count(table.Name, n)
+	}
+	return nil
+}
+
+// selectKeys returns the distinct non-NULL values of columns of the rows of table
+// matching where.
+func (c *cascadeDelete) selectKeys(table string, columns []string, where string, args []interface{}) ([][]interface{}, error) {
+	notNull := make([]string, len(columns))
+	for i, column := range columns {
+		notNull[i] = column + " IS NOT NULL"
+	}
+	query := "SELECT DISTINCT " + strings.Join(columns, ", ") + " FROM " + table +
+		" WHERE (" + where + ") AND " + strings.Join(notNull, " AND ")
+
+	var keys [][]interface{}
+	err := c.tx.run(&Statement{Kind: StatementQuery, Query: c.tx.tx.Rebind(query), Args: args, EachRow: func(rows *sqlx.Rows) error {
+		values, err := rows.SliceScan()
+		if err != nil {
+			return err
+		}
+		keys = append(keys, values)
+		return nil
+	}})
+	return keys, err
+}
+
+// deleteRows deletes the rows of table matching where, or counts them in a dry run.
+func (c *cascadeDelete) deleteRows(table string, where string, args []interface{}) (int64, error) {
+	if c.dryRun {
+		return c.tx.Count(c.tx.tx.Rebind("SELECT COUNT(*) FROM "+table+" WHERE "+where), args...)
+	}
+
+	result, err := c.tx.exec(c.tx.tx.Rebind("DELETE FROM "+table+" WHERE "+where), args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (c *cascadeDelete) count(table string, n int64) {
+	for i := range c.counts {
+		if c.counts[i].Table == table {
+			c.counts[i].Rows += n
+			return
+		}
+	}
+	c.counts = append(c.counts, CascadeCount{Table: table, Rows: n})
+}
+
+// keyCondition returns the condition matching the rows whose columns have one of keys.
+func keyCondition(columns []string, keys [][]interface{}) (string, []interface{}) {
+	args := make([]interface{}, 0, len(columns)*len(keys))
+	if len(columns) == 1 {
+		params := make([]string, len(keys))
+		for i, key := range keys {
+			params[i] = "?"
+			args = append(args, key[0])
+		}
+		return columns[0] + " IN (" + strings.Join(params, ", ") + ")", args
+	}
+
+	rows := make([]string, len(keys))
+	for i, key := range keys {
+		match := make([]string, len(columns))
+		for j, column := range columns {
+			match[j] = column + " = ?"
+			args = append(args, key[j])
+		}
+		rows[i] = "(" + strings.Join(match, " AND ") + ")"
+	}
+	return strings.Join(rows, " OR "), args
+}
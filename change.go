@@ -0,0 +1,150 @@
+package gotx
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"time"
+)
+
+// ChangeOp is the kind of a recorded change.
+type ChangeOp string
+
+const (
+	ChangeInsert ChangeOp = "insert"
+	ChangeUpdate ChangeOp = "update"
+	ChangeDelete ChangeOp = "delete"
+)
+
+// Change is a normalized entry of the change feed, recorded for every row change made
+// with Transaction.Insert, Update or Delete.
+type Change struct {
+	// TxID is the ID of the db transaction which made the change.
+	TxID  string   `json:"tx_id"`
+	Table string   `json:"table"`
+	Op    ChangeOp `json:"op"`
+
+	// Keys are the values of the key columns found in the arguments of the statement,
+	// or the generated ID of an insert.
+	Keys map[string]interface{} `json:"keys"`
+
+	// Args are the named arguments of the statement.
+	Args map[string]interface{} `json:"args"`
+
+	Time time.Time `json:"time"`
+}
+
+// ChangeSink receives the changes of committed transactions.
+type ChangeSink interface {
+	// Deliver is called with the changes of a db transaction, in order, after it
+	// committed. The transaction can not be undone anymore, so errors are logged only.
+	Deliver(ctx context.Context, changes []Change) error
+}
+
+// ChangeSinkFunc is an adapter to allow the use of ordinary functions as change sinks.
+type ChangeSinkFunc func(ctx context.Context, changes []Change) error
+
+// Deliver calls f(ctx, changes).
+func (f ChangeSinkFunc) Deliver(ctx context.Context, changes []Change) error {
+	return f(ctx, changes)
+}
+
+// WithChangeSink enables the change feed: Insert, Update and Delete record a Change,
+// and once the db transaction commits its changes are delivered to sink. Changes of
+// rolled back transactions are dropped. keyColumns name the columns identifying a row
+// and default to "id". This gives lightweight change data capture of the writes made
+// through gotx, without binlog or logical replication tooling; writes made with plain
+// SQL through other methods are not recorded.
+func WithChangeSink(sink ChangeSink, keyColumns ...string) ManagerOption {
+	if len(keyColumns) == 0 {
+		keyColumns = []string{"id"}
+	}
+
+	return func(tm *TxManager) {
+		tm.changeSink = sink
+		tm.changeKeys = keyColumns
+	}
+}
+
+// recordChange records a change made by a named statement with arg.
+func (t *Transaction) recordChange(op ChangeOp, query string, arg interface{}, insertID int64) {
+	if t.txManager.changeSink == nil {
+		return
+	}
+
+	tables := statementTables(query, t.txManager.dialect)
+	if len(tables) == 0 {
+		return
+	}
+
+	change := Change{
+		TxID:  t.RootID(),
+		Table: tables[0],
+		Op:    op,
+		Keys:  make(map[string]interface{}),
+		Args:  t.namedArgs(query, arg),
+		Time:  t.txManager.now(),
+	}
+
+	for _, key := range t.txManager.changeKeys {
+		if v, ok := change.Args[key]; ok {
+			change.Keys[key] = v
+		}
+	}
+	if op == ChangeInsert && insertID > 0 && len(t.txManager.changeKeys) == 1 {
+		if _, ok := change.Keys[t.txManager.changeKeys[0]]; !ok {
+			change.Keys[t.txManager.changeKeys[0]] = insertID
+		}
+	}
+
+	t.tx.valuesMux.Lock()
+	t.tx.changes = append(t.tx.changes, change)
+	t.tx.valuesMux.Unlock()
+}
+
+// namedArgs returns the values of the named parameters of query taken from arg.
+func (t *Transaction) namedArgs(query string, arg interface{}) map[string]interface{} {
+	args := make(map[string]interface{})
+
+	var m map[string]interface{}
+	var v reflect.Value
+	switch a := arg.(type) {
+	case map[string]interface{}:
+		m = a
+	default:
+		v = reflect.Indirect(reflect.ValueOf(arg))
+		if v.Kind() != reflect.Struct {
+			return args
+		}
+	}
+
+	for _, tok := range tokenizeSQL(query, t.txManager.dialect) {
+		if tok.kind != tokenParam || tok.text[0] != ':' {
+			continue
+		}
+
+		name := tok.text[1:]
+		if m != nil {
+			if value, ok := m[name]; ok {
+				args[name] = value
+			}
+			continue
+		}
+		if field := t.tx.Mapper.FieldByName(v, name); field.IsValid() {
+			args[name] = field.Interface()
+		}
+	}
+
+	return args
+}
+
+// deliverChanges sends the changes of a committed db transaction to the change sink.
+func (tm *TxManager) deliverChanges(tx *Transaction, changes []Change) {
+	if tm.changeSink == nil || len(changes) == 0 {
+		return
+	}
+
+	if err := tm.changeSink.Deliver(tx.Context(), changes); err != nil {
+		log.Printf("gotx: delivering %d changes of %s failed: %v", len(changes), tx, err)
+	}
+}
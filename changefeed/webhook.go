@@ -0,0 +1,71 @@
+// Package changefeed provides change sinks for the change feed of gotx, enabled with
+// gotx.WithChangeSink. A Kafka sink is available in the contrib/kafkagotx module.
+package changefeed
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/oligo/gotx"
+)
+
+// Webhook is a change sink posting the changes of each committed transaction as a JSON
+// document to URL:
+//
+//	{"changes": [{"tx_id": "...", "table": "account", "op": "update", ...}]}
+//
+// Any status other than 2xx is an error.
+type Webhook struct {
+	URL string
+
+	// Header is added to every request, e.g. for authentication.
+	Header http.Header
+
+	// Client sends the requests. http.DefaultClient is used if it is nil.
+	Client *http.Client
+}
+
+// NewWebhook returns a webhook sink posting to url.
+func NewWebhook(url string) *Webhook {
+	return &Webhook{URL: url}
+}
+
+// Deliver implements gotx.ChangeSink.
+func (w *Webhook) Deliver(ctx context.Context, changes []gotx.Change) error {
+	body, err := json.Marshal(struct {
+		Changes []gotx.Change `json:"changes"`
+	}{changes})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range w.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("changefeed: webhook %s returned %s", w.URL, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package gotx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ClaimRows locks and reads up to limit rows of table matching where into dest, a
+// pointer to a slice, skipping the rows locked by other transactions. It is the
+// building block of work queues kept in a table: concurrent workers each claim
+// different rows, process them and delete or update them before the transaction
+// commits, which releases the locks:
+//
+//	var jobs []Job
+//	err := tx.ClaimRows(&jobs, "job", "status = ? AND run_at <= ? ORDER BY id", 10, "ready", now)
+//
+// where is the condition selecting the rows, optionally followed by an ORDER BY
+// clause, with args as its arguments, and may be empty. Rows are locked with FOR
+// UPDATE SKIP LOCKED on Postgres and MySQL, and with the UPDLOCK, ROWLOCK and READPAST
+// hints on SQL Server. Oracle does not allow a row limit with FOR UPDATE, so ROWNUM
+// limits the rows before they are ordered and before locked rows are skipped: fewer
+// rows than limit may be claimed even if more are available. SQLite has no row locks
+// and serializes the transactions writing instead, so the rows are only read.
+func (t *Transaction) ClaimRows(dest interface{}, table string, where string, limit int, args ...interface{}) error {
+	if err := t.checkState(); err != nil {
+		return err
+	}
+
+	cond, order := splitOrderBy(where, t.txManager.dialect)
+	var b strings.Builder
+	switch t.txManager.dialect {
+	case DialectSQLServer:
+		fmt.Fprintf(&b, "SELECT TOP (%d) * FROM %s WITH (UPDLOCK, ROWLOCK, READPAST)", limit, table)
+		writeCondition(&b, cond)
+		b.WriteString(order)
+	case DialectOracle:
+		b.WriteString("SELECT * FROM " + table)
+		if cond != "" {
+			cond = "(" + cond + ") AND "
+		}
+		writeCondition(&b, fmt.Sprintf("%sROWNUM <= %d", cond, limit))
+		b.WriteString(order + " FOR UPDATE SKIP LOCKED")
+	default:
+		b.WriteString("SELECT * FROM " + table)
+		writeCondition(&b, cond)
+		b.WriteString(order)
+		fmt.Fprintf(&b, " LIMIT %d", limit)
+		if t.txManager.dialect == DialectPostgres || t.txManager.dialect == DialectMySQL {
+			b.WriteString(" FOR UPDATE SKIP LOCKED")
+		}
+	}
+
+	if err := t.Select(dest, b.String(), args...); err != nil {
+		return fmt.Errorf("claiming rows of %s failed: %w", table, err)
+	}
+	return nil
+}
+
+func writeCondition(b *strings.Builder, cond string) {
+	if cond != "" {
+		b.WriteString(" WHERE " + cond)
+	}
+}
+
+// splitOrderBy splits a condition followed by an ORDER BY clause outside of
+// parentheses into the condition and the clause, which keeps a leading space.
+func splitOrderBy(where string, dialect Dialect) (string, string) {
+	tokens := tokenizeSQL(where, dialect)
+	for i, t := range tokens {
+		if t.depth == 0 && t.keyword() == "ORDER" && i+1 < len(tokens) && tokens[i+1].keyword() == "BY" {
+			return strings.TrimSpace(where[:t.pos]), " " + strings.TrimSpace(where[t.pos:])
+		}
+	}
+	return strings.TrimSpace(where), ""
+}
@@ -0,0 +1,163 @@
+package gotx
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Clock tells the time to a TxManager. Every timestamp written by gotx, e.g. the
+// created_at column of the job outbox and the idempotency keys, the durations of its
+// statistics, its watchdogs, the timeouts of Options.Timeout, the windows of group
+// commits, the expiry of the in-memory query cache and rate limiter and the delays
+// between retries and polls use it, so tests can replace the wall clock with one they
+// advance themselves, see txtest.Clock, and check timeouts and retries without
+// sleeping. The contrib modules relaying the job outbox use it too. Those timing other
+// systems, e.g. the heartbeats of Temporal activities, the Redis locks and the
+// OpenTelemetry metrics, keep the wall clock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer returns a timer sending the current time on its channel once d
+	// elapsed.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a timer of a Clock, like time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is sent when the timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing, and reports whether it did stop it.
+	Stop() bool
+}
+
+// SystemClock is the Clock of the wall clock, the default of a TxManager.
+type SystemClock struct{}
+
+// Now returns time.Now().
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer returns a time.Timer.
+func (SystemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time { return t.t.C }
+func (t systemTimer) Stop() bool          { return t.t.Stop() }
+
+// WithClock makes the manager tell the time with clock rather than the wall clock.
+// Transactions running on the database still see its own clock, e.g. in CURRENT_TIMESTAMP.
+func WithClock(clock Clock) ManagerOption {
+	return func(tm *TxManager) {
+		tm.clock = clock
+	}
+}
+
+// clockUser is a component of a manager created without it which tells the time, e.g.
+// an in-memory store. NewTxManager passes it the clock of the manager.
+type clockUser interface {
+	useClock(clock Clock)
+}
+
+// Clock returns the clock of the manager, e.g. for packages writing timestamps in its
+// transactions.
+func (tm *TxManager) Clock() Clock {
+	return tm.clock
+}
+
+// now returns the current time of the clock of the manager.
+func (tm *TxManager) now() time.Time {
+	return tm.clock.Now()
+}
+
+// since returns the time elapsed since t on the clock of the manager.
+func (tm *TxManager) since(t time.Time) time.Duration {
+	return tm.clock.Now().Sub(t)
+}
+
+// withTimeout returns a copy of ctx with a deadline d from now on the clock of the
+// manager, like context.WithTimeout.
+func (tm *TxManager) withTimeout(ctx context.Context, d time.Duration) (context.Context, context.CancelFunc) {
+	return tm.withDeadline(ctx, tm.now().Add(d))
+}
+
+// withDeadline returns a copy of ctx expiring at deadline on the clock of the manager,
+// like context.WithDeadline.
+func (tm *TxManager) withDeadline(ctx context.Context, deadline time.Time) (context.Context, context.CancelFunc) {
+	if _, ok := tm.clock.(SystemClock); ok {
+		return context.WithDeadline(ctx, deadline)
+	}
+	cancelCtx, cancel := context.WithCancel(ctx)
+	c := &clockContext{Context: cancelCtx, parent: ctx, deadline: deadline}
+	timer := tm.clock.NewTimer(deadline.Sub(tm.now()))
+	go func() {
+		select {
+		case <-timer.C():
+			atomic.StoreInt32(&c.expired, 1)
+			cancel()
+		case <-cancelCtx.Done():
+			timer.Stop()
+		}
+	}()
+	return c, cancel
+}
+
+// clockContext is a context expiring at a deadline of a Clock other than the wall
+// clock.
+type clockContext struct {
+	context.Context
+	parent   context.Context
+	deadline time.Time
+	expired  int32
+}
+
+func (c *clockContext) Deadline() (time.Time, bool) {
+	return c.deadline, true
+}
+
+func (c *clockContext) Err() error {
+	if atomic.LoadInt32(&c.expired) == 1 {
+		return context.DeadlineExceeded
+	}
+	// a parent expiring first cancels the context with its own error
+	if err := c.parent.Err(); err != nil {
+		return err
+	}
+	return c.Context.Err()
+}
+
+// sleepContext waits for d on clock or until ctx is done.
+func sleepContext(ctx context.Context, clock Clock, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := clock.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C():
+		return nil
+	}
+}
+
+// tick calls fn every interval on clock until fn returns false.
+func tick(clock Clock, interval time.Duration, fn func() bool) {
+	for {
+		timer := clock.NewTimer(interval)
+		<-timer.C()
+		if !fn() {
+			return
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package gotx
+
+import (
+	"context"
+	"strings"
+	"unicode/utf8"
+)
+
+// WithConnectionTag tags the connection of every db transaction with the string
+// returned by tag for the transaction which began it, so DBAs can tell which part of
+// the application and which request a session in pg_stat_activity or the MySQL
+// processlist belongs to:
+//
+//	tm := gotx.NewTxManager(db, gotx.WithConnectionTag(gotx.ConnectionTag("billing")))
+//
+// On Postgres application_name is set with set_config right after BEGIN, local to the
+// transaction, so it reverts once the transaction commits or rolls back. It is cut to
+// the 63 bytes Postgres keeps. Other databases have no setting visible to other
+// sessions which could be changed per transaction, so the statements of the
+// transaction are prefixed with the tag in a comment instead. An empty tag leaves the
+// transaction untagged.
+func WithConnectionTag(tag func(tx *Transaction) string) ManagerOption {
+	return func(tm *TxManager) {
+		t := &connectionTagger{tag: tag}
+		tm.hooks = append(tm.hooks, Hooks{AfterBegin: t.afterBegin})
+		tm.interceptors = append(tm.interceptors, t)
+	}
+}
+
+// ConnectionTag returns a tag for WithConnectionTag made of app, the Options.Name of
+// the transaction if set, and the root transaction ID of its correlation, which
+// identifies the request across services, e.g. "billing charge-order tx=42".
+func ConnectionTag(app string) func(tx *Transaction) string {
+	return func(tx *Transaction) string {
+		parts := []string{app}
+		if tx.opts != nil && tx.opts.Name != "" {
+			parts = append(parts, tx.opts.Name)
+		}
+		parts = append(parts, "tx="+tx.Correlation().RootTxID)
+		return strings.Join(parts, " ")
+	}
+}
+
+type connectionTagKey struct{}
+
+type connectionTagger struct {
+	tag func(tx *Transaction) string
+}
+
+func (t *connectionTagger) afterBegin(tx *Transaction) error {
+	tag := t.tag(tx)
+	if tag == "" {
+		return nil
+	}
+
+	if tx.txManager.dialect == DialectPostgres {
+		if len(tag) > 63 {
+			n := 63
+			for n > 0 && !utf8.RuneStart(tag[n]) {
+				n--
+			}
+			tag = tag[:n]
+		}
+		_, err := tx.exec("SELECT set_config('application_name', $1, true)", tag)
+		return err
+	}
+
+	// a comment can not be ended by its content
+	tx.Set(connectionTagKey{}, strings.ReplaceAll(tag, "*/", "* /"))
+	return nil
+}
+
+// Intercept prefixes the statements of tagged transactions with their tag.
+func (t *connectionTagger) Intercept(ctx context.Context, stmt *Statement, next StatementHandler) error {
+	if tx := stmt.Tx(); tx != nil {
+		if tag, ok := tx.Value(connectionTagKey{}).(string); ok {
+			stmt.Query = "/* " + tag + " */ " + stmt.Query
+		}
+	}
+	return next(ctx, stmt)
+}
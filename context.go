@@ -0,0 +1,63 @@
+package gotx
+
+import "context"
+
+type (
+	txContextKey      struct{}
+	managerContextKey struct{}
+)
+
+// FromContext returns the transaction of the context returned by
+// Transaction.Context, or a context derived from it. Repository functions which only
+// receive a context can use it to take part in the active transaction without a
+// reference to the TxManager:
+//
+//	func (r *AccountRepo) Rename(ctx context.Context, id int64, name string) error {
+//		tx, ok := gotx.FromContext(ctx)
+//		if !ok {
+//			return errors.New("no transaction")
+//		}
+//		_, err := tx.NamedExec("UPDATE account SET name = :name WHERE id = :id", ...)
+//		return err
+//	}
+func FromContext(ctx context.Context) (*Transaction, bool) {
+	tx, ok := ctx.Value(txContextKey{}).(*Transaction)
+	return tx, ok
+}
+
+// MustFromContext is like FromContext but panics if ctx carries no transaction.
+func MustFromContext(ctx context.Context) *Transaction {
+	tx, ok := FromContext(ctx)
+	if !ok {
+		panic("gotx: no transaction in context")
+	}
+	return tx
+}
+
+// NewContext returns a context carrying tm, so libraries can work with the ambient
+// transaction manager of the application instead of taking a *TxManager everywhere:
+//
+//	ctx = gotx.NewContext(ctx, tm)
+//	...
+//	tm, ok := gotx.ManagerFromContext(ctx)
+func NewContext(ctx context.Context, tm *TxManager) context.Context {
+	return context.WithValue(ctx, managerContextKey{}, tm)
+}
+
+// ManagerFromContext returns the manager of the context returned by NewContext. The
+// context of a transaction carries the manager which started it too.
+func ManagerFromContext(ctx context.Context) (*TxManager, bool) {
+	if tm, ok := ctx.Value(managerContextKey{}).(*TxManager); ok {
+		return tm, true
+	}
+
+	if tx, ok := FromContext(ctx); ok {
+		return tx.txManager, true
+	}
+	return nil, false
+}
+
+// contextWithTx returns a context carrying tx.
+func contextWithTx(ctx context.Context, tx *Transaction) context.Context {
+	return context.WithValue(ctx, txContextKey{}, tx)
+}
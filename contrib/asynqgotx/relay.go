@@ -0,0 +1,73 @@
+// Package asynqgotx bridges the job outbox of gotx to asynq. Jobs enqueued with
+// tx.Enqueue are stored in the outbox with the writes of the transaction, and a relay
+// turns them into asynq tasks once the transaction committed:
+//
+//	client := asynq.NewClient(asynq.RedisClientOpt{Addr: "localhost:6379"})
+//	go asynqgotx.Relay(ctx, tm, client, time.Second, 100)
+//
+// The Kind of a job is the type of its task and its JSON encoded Args the payload.
+package asynqgotx
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/oligo/gotx"
+)
+
+// Publisher returns a publish function for tm.RelayJobs enqueuing the jobs as asynq
+// tasks. The task ID is derived from the outbox ID of the job, so a job relayed twice
+// is enqueued once, as long as its first task is retained by asynq.
+func Publisher(client *asynq.Client) func(ctx context.Context, jobs []gotx.OutboxJob) error {
+	return func(ctx context.Context, jobs []gotx.OutboxJob) error {
+		for _, job := range jobs {
+			opts := []asynq.Option{asynq.TaskID("gotx-outbox-" + strconv.FormatInt(job.ID, 10))}
+			if job.Queue != "" {
+				opts = append(opts, asynq.Queue(job.Queue))
+			}
+			if job.RunAt.Valid {
+				opts = append(opts, asynq.ProcessAt(job.RunAt.Time))
+			}
+			if job.MaxAttempts > 0 {
+				opts = append(opts, asynq.MaxRetry(job.MaxAttempts-1))
+			}
+
+			_, err := client.EnqueueContext(ctx, asynq.NewTask(job.Kind, job.Args), opts...)
+			if err != nil && !errors.Is(err, asynq.ErrTaskIDConflict) {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Relay relays up to batch jobs from the outbox of tm to client every interval, and
+// immediately again while full batches are relayed, until ctx is done. Failures are
+// logged and retried at the next interval. The interval is waited for on the clock of
+// tm, so tests using gotx.WithClock advance the relay without sleeping.
+func Relay(ctx context.Context, tm *gotx.TxManager, client *asynq.Client, interval time.Duration, batch int) error {
+	publish := Publisher(client)
+	clock := tm.Clock()
+
+	for {
+		n, err := tm.RelayJobs(ctx, batch, publish)
+		if err != nil {
+			log.Printf("asynqgotx: %v", err)
+		}
+		if err == nil && n == batch {
+			continue
+		}
+
+		timer := clock.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package etcdgotx provides an etcd backend of the gotx.Lock interface:
+//
+//	client, err := clientv3.New(clientv3.Config{Endpoints: []string{"localhost:2379"}})
+//	lock, err := etcdgotx.NewLock(client, 30)
+//	err = tm.ExecLocked(ctx, lock, "billing", txFunc, nil)
+package etcdgotx
+
+import (
+	"context"
+	"sync"
+
+	"github.com/oligo/gotx"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/concurrency"
+)
+
+// Lock is a gotx.Lock using the mutexes of the etcd concurrency package. All locks of a
+// Lock share one session whose lease is kept alive while the process runs, so locks of
+// a crashed process are freed once the lease expires. Since etcd mutexes of the same
+// session do not exclude each other, goroutines sharing a Lock are serialized locally.
+type Lock struct {
+	session *concurrency.Session
+	prefix  string
+
+	mux   sync.Mutex
+	local map[string]chan struct{}
+	held  map[string]*concurrency.Mutex
+}
+
+// NewLock returns a Lock using client, with a session lease of ttl seconds. Keys are
+// prefixed with "/gotx/lock/".
+func NewLock(client *clientv3.Client, ttl int) (*Lock, error) {
+	session, err := concurrency.NewSession(client, concurrency.WithTTL(ttl))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Lock{
+		session: session,
+		prefix:  "/gotx/lock/",
+		local:   make(map[string]chan struct{}),
+		held:    make(map[string]*concurrency.Mutex),
+	}, nil
+}
+
+// Close ends the session, releasing all locks held by l.
+func (l *Lock) Close() error {
+	return l.session.Close()
+}
+
+// Acquire implements gotx.Lock.
+func (l *Lock) Acquire(ctx context.Context, name string) error {
+	local := l.localLock(name)
+	select {
+	case local <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	mutex := concurrency.NewMutex(l.session, l.prefix+name)
+	if err := mutex.Lock(ctx); err != nil {
+		<-local
+		return err
+	}
+
+	l.setHeld(name, mutex)
+	return nil
+}
+
+// TryAcquire implements gotx.Lock.
+func (l *Lock) TryAcquire(ctx context.Context, name string) (bool, error) {
+	local := l.localLock(name)
+	select {
+	case local <- struct{}{}:
+	default:
+		return false, nil
+	}
+
+	mutex := concurrency.NewMutex(l.session, l.prefix+name)
+	if err := mutex.TryLock(ctx); err != nil {
+		<-local
+		if err == concurrency.ErrLocked {
+			return false, nil
+		}
+		return false, err
+	}
+
+	l.setHeld(name, mutex)
+	return true, nil
+}
+
+// Release implements gotx.Lock.
+func (l *Lock) Release(ctx context.Context, name string) error {
+	l.mux.Lock()
+	mutex, ok := l.held[name]
+	delete(l.held, name)
+	l.mux.Unlock()
+	if !ok {
+		return gotx.ErrLockNotHeld
+	}
+
+	err := mutex.Unlock(ctx)
+	<-l.localLock(name)
+	return err
+}
+
+// localLock returns the semaphore serializing the goroutines locking name.
+func (l *Lock) localLock(name string) chan struct{} {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	local, ok := l.local[name]
+	if !ok {
+		local = make(chan struct{}, 1)
+		l.local[name] = local
+	}
+	return local
+}
+
+func (l *Lock) setHeld(name string, mutex *concurrency.Mutex) {
+	l.mux.Lock()
+	l.held[name] = mutex
+	l.mux.Unlock()
+}
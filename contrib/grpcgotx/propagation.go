@@ -0,0 +1,86 @@
+// Package grpcgotx propagates the correlation metadata of gotx over gRPC:
+//
+//	conn, err := grpc.NewClient(target,
+//		grpc.WithUnaryInterceptor(grpcgotx.UnaryClientInterceptor()),
+//		grpc.WithStreamInterceptor(grpcgotx.StreamClientInterceptor()))
+//
+//	server := grpc.NewServer(
+//		grpc.UnaryInterceptor(grpcgotx.UnaryServerInterceptor()),
+//		grpc.StreamInterceptor(grpcgotx.StreamServerInterceptor()))
+package grpcgotx
+
+import (
+	"context"
+	"strings"
+
+	"github.com/oligo/gotx"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Inject returns ctx with the correlation of ctx appended to its outgoing metadata.
+func Inject(ctx context.Context) context.Context {
+	var kv []string
+	gotx.Inject(ctx, func(key, value string) {
+		kv = append(kv, strings.ToLower(key), value)
+	})
+	if len(kv) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// Extract returns ctx carrying the correlation of its incoming metadata.
+func Extract(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	return gotx.Extract(ctx, func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	})
+}
+
+// UnaryClientInterceptor sends the correlation of the call context with unary calls.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(Inject(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor sends the correlation of the call context with streams.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(Inject(ctx), desc, cc, method, opts...)
+	}
+}
+
+// UnaryServerInterceptor restores the correlation of unary calls into the context of
+// the handler.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		return handler(Extract(ctx), req)
+	}
+}
+
+// StreamServerInterceptor restores the correlation of streams into the context of the
+// handler.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return handler(srv, &serverStream{ServerStream: ss, ctx: Extract(ss.Context())})
+	}
+}
+
+// serverStream overrides the context of a stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,16 @@
+module github.com/oligo/gotx/contrib/kafkagotx
+
+go 1.20
+
+require (
+	github.com/oligo/gotx v0.0.0
+	github.com/segmentio/kafka-go v0.4.47
+)
+
+require (
+	github.com/jmoiron/sqlx v1.3.5 // indirect
+	github.com/klauspost/compress v1.15.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
+)
+
+replace github.com/oligo/gotx => ../..
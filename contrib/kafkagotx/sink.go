@@ -0,0 +1,65 @@
+// Package kafkagotx provides a Kafka change sink for the change feed of gotx:
+//
+//	writer := &kafka.Writer{Addr: kafka.TCP("localhost:9092"), Topic: "changes"}
+//	tm := gotx.NewTxManager(db, gotx.WithChangeSink(kafkagotx.NewSink(writer)))
+package kafkagotx
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/oligo/gotx"
+	"github.com/segmentio/kafka-go"
+)
+
+// Sink writes every change as a JSON message. Messages are keyed by table and key
+// values, so the changes of a row land in the same partition in commit order. The
+// changes of a transaction are written in one batch.
+type Sink struct {
+	writer *kafka.Writer
+}
+
+// NewSink returns a sink writing with writer, which must have a topic set.
+func NewSink(writer *kafka.Writer) *Sink {
+	return &Sink{writer: writer}
+}
+
+// Deliver implements gotx.ChangeSink.
+func (s *Sink) Deliver(ctx context.Context, changes []gotx.Change) error {
+	messages := make([]kafka.Message, 0, len(changes))
+	for _, change := range changes {
+		value, err := json.Marshal(change)
+		if err != nil {
+			return err
+		}
+
+		messages = append(messages, kafka.Message{
+			Key:   []byte(messageKey(change)),
+			Value: value,
+			Headers: []kafka.Header{
+				{Key: "gotx-table", Value: []byte(change.Table)},
+				{Key: "gotx-op", Value: []byte(change.Op)},
+			},
+		})
+	}
+
+	return s.writer.WriteMessages(ctx, messages...)
+}
+
+// messageKey returns table/key=value/... with the keys in sorted order.
+func messageKey(change gotx.Change) string {
+	names := make([]string, 0, len(change.Keys))
+	for name := range change.Keys {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parts := []string{change.Table}
+	for _, name := range names {
+		value, _ := json.Marshal(change.Keys[name])
+		parts = append(parts, name+"="+string(value))
+	}
+	return strings.Join(parts, "/")
+}
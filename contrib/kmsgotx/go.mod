@@ -0,0 +1,18 @@
+module github.com/oligo/gotx/contrib/kmsgotx
+
+go 1.20
+
+require (
+	github.com/aws/aws-sdk-go-v2 v1.24.1
+	github.com/aws/aws-sdk-go-v2/service/kms v1.27.9
+	github.com/oligo/gotx v0.0.0
+)
+
+require (
+	github.com/aws/aws-sdk-go-v2/internal/configsources v1.2.10 // indirect
+	github.com/aws/aws-sdk-go-v2/internal/endpoints/v2 v2.5.10 // indirect
+	github.com/aws/smithy-go v1.19.0 // indirect
+	github.com/jmoiron/sqlx v1.3.5 // indirect
+)
+
+replace github.com/oligo/gotx => ../..
@@ -0,0 +1,13 @@
+module github.com/oligo/gotx/contrib/otelgotx
+
+go 1.20
+
+require (
+	github.com/oligo/gotx v0.0.0
+	go.opentelemetry.io/otel v1.19.0
+	go.opentelemetry.io/otel/metric v1.19.0
+)
+
+require github.com/jmoiron/sqlx v1.3.5 // indirect
+
+replace github.com/oligo/gotx => ../..
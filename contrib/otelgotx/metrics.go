@@ -0,0 +1,147 @@
+// Package otelgotx records OpenTelemetry metrics of the transactions and statements of
+// a gotx.TxManager, for backends receiving OTLP only:
+//
+//	opt, err := otelgotx.Metrics(otel.GetMeterProvider())
+//	if err != nil {
+//		return err
+//	}
+//	tm := gotx.NewTxManager(db, opt)
+//
+// The following instruments are recorded, with the db.system attribute set to the
+// dialect of the manager:
+//
+//	gotx.transactions.active     up-down counter of db transactions in progress
+//	gotx.transactions            counter of finished db transactions by outcome
+//	gotx.transaction.duration    histogram of db transaction durations in seconds
+//	gotx.statement.duration      histogram of statement durations in seconds
+//	gotx.retries                 counter of retried attempts by error.class
+//	gotx.exec.attempts           histogram of the attempts of Exec calls owning a db transaction
+package otelgotx
+
+import (
+	"context"
+	"time"
+
+	"github.com/oligo/gotx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const instrumentationName = "github.com/oligo/gotx/contrib/otelgotx"
+
+type startKey struct{}
+
+type instruments struct {
+	active      metric.Int64UpDownCounter
+	finished    metric.Int64Counter
+	txDuration  metric.Float64Histogram
+	stmDuration metric.Float64Histogram
+	retries     metric.Int64Counter
+	attempts    metric.Int64Histogram
+}
+
+// Metrics returns a manager option recording metrics with a meter of provider.
+func Metrics(provider metric.MeterProvider) (gotx.ManagerOption, error) {
+	meter := provider.Meter(instrumentationName)
+
+	var ins instruments
+	var err error
+	if ins.active, err = meter.Int64UpDownCounter("gotx.transactions.active",
+		metric.WithDescription("Number of db transactions in progress")); err != nil {
+		return nil, err
+	}
+	if ins.finished, err = meter.Int64Counter("gotx.transactions",
+		metric.WithDescription("Number of finished db transactions")); err != nil {
+		return nil, err
+	}
+	if ins.txDuration, err = meter.Float64Histogram("gotx.transaction.duration",
+		metric.WithDescription("Duration of db transactions"), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if ins.stmDuration, err = meter.Float64Histogram("gotx.statement.duration",
+		metric.WithDescription("Duration of statements"), metric.WithUnit("s")); err != nil {
+		return nil, err
+	}
+	if ins.retries, err = meter.Int64Counter("gotx.retries",
+		metric.WithDescription("Number of retried transaction attempts")); err != nil {
+		return nil, err
+	}
+	if ins.attempts, err = meter.Int64Histogram("gotx.exec.attempts",
+		metric.WithDescription("Number of attempts of Exec calls")); err != nil {
+		return nil, err
+	}
+
+	return func(tm *gotx.TxManager) {
+		system := func() attribute.KeyValue {
+			return attribute.String("db.system", tm.Dialect().String())
+		}
+
+		gotx.WithHooks(gotx.Hooks{
+			AfterBegin: func(tx *gotx.Transaction) error {
+				tx.Set(startKey{}, time.Now())
+				ins.active.Add(tx.Context(), 1, metric.WithAttributes(system()))
+				return nil
+			},
+			AfterCommit: func(tx *gotx.Transaction) {
+				ins.end(tx, "commit", system())
+			},
+			AfterRollback: func(tx *gotx.Transaction) {
+				ins.end(tx, "rollback", system())
+			},
+			OnRetry: func(event *gotx.RetryEvent) {
+				ins.retries.Add(context.Background(), 1, metric.WithAttributes(system(),
+					attribute.String("error.class", event.Class)))
+			},
+			AfterExec: func(summary *gotx.ExecSummary) {
+				if !summary.Retryable {
+					return
+				}
+				ins.attempts.Record(context.Background(), int64(summary.Attempts), metric.WithAttributes(system(),
+					attribute.Bool("error", summary.Err != nil)))
+			},
+		})(tm)
+
+		gotx.WithInterceptors(gotx.InterceptorFunc(func(ctx context.Context, stmt *gotx.Statement, next gotx.StatementHandler) error {
+			start := time.Now()
+			err := next(ctx, stmt)
+			ins.stmDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+				system(),
+				attribute.String("gotx.statement.kind", kindName(stmt.Kind)),
+				attribute.Bool("error", err != nil),
+			))
+			return err
+		}))(tm)
+	}, nil
+}
+
+// end records the end of the db transaction of tx. The rollback hook runs for every
+// logical transaction rolled back, so the start time is removed once recorded.
+func (ins *instruments) end(tx *gotx.Transaction, outcome string, system attribute.KeyValue) {
+	start, ok := tx.Value(startKey{}).(time.Time)
+	if !ok {
+		return
+	}
+	tx.Set(startKey{}, nil)
+
+	ctx := tx.Context()
+	ins.active.Add(ctx, -1, metric.WithAttributes(system))
+	ins.finished.Add(ctx, 1, metric.WithAttributes(system, attribute.String("outcome", outcome)))
+	ins.txDuration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(system, attribute.String("outcome", outcome)))
+}
+
+func kindName(kind gotx.StatementKind) string {
+	switch kind {
+	case gotx.StatementExec:
+		return "exec"
+	case gotx.StatementGet:
+		return "get"
+	case gotx.StatementSelect:
+		return "select"
+	case gotx.StatementQuery:
+		return "query"
+	case gotx.StatementMultiQuery:
+		return "multi_query"
+	default:
+		return "unknown"
+	}
+}
@@ -0,0 +1,171 @@
+// Package pgxgotx adds the APIs of pgx to gotx transactions of managers whose
+// database is opened with the database/sql driver of pgx:
+//
+//	db := sqlx.NewDb(stdlib.OpenDB(*config), "pgx")
+//	tm := gotx.NewTxManager(db)
+package pgxgotx
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/jmoiron/sqlx"
+	"github.com/oligo/gotx"
+)
+
+// ErrNotPgx is returned when a transaction does not run on a connection of the pgx
+// driver.
+var ErrNotPgx = errors.New("pgxgotx: transaction does not run on a pgx connection")
+
+// Batch queues queries which are sent to the database in a single round trip with the
+// batch protocol of pgx, and scans their results into the given destinations:
+//
+//	var account Account
+//	var orders []Order
+//	var pending int
+//	b := pgxgotx.NewBatch()
+//	b.Get(&account, "SELECT * FROM account WHERE id = $1", id)
+//	b.Select(&orders, "SELECT * FROM orders WHERE account_id = $1", id)
+//	b.Get(&pending, "SELECT count(*) FROM payment WHERE account_id = $1 AND state = 'pending'", id)
+//	err := b.Send(tx)
+//
+// Queries use the $n placeholders of Postgres. Structs are scanned like sqlx does,
+// with the mapper of the sqlx package. The queries run in the db transaction, but
+// bypass the interceptors of the manager.
+type Batch struct {
+	batch pgx.Batch
+	scans []func(pgx.BatchResults) error
+}
+
+// NewBatch returns an empty batch.
+func NewBatch() *Batch {
+	return &Batch{}
+}
+
+// Len returns the number of queued queries.
+func (b *Batch) Len() int {
+	return b.batch.Len()
+}
+
+// Get queues a query whose single row is scanned into dest, as Transaction.Get does.
+// Send returns sql.ErrNoRows if the query returns no row.
+func (b *Batch) Get(dest interface{}, query string, args ...interface{}) {
+	b.queue(query, args, func(results pgx.BatchResults) error {
+		rows, err := results.Query()
+		if err != nil {
+			return err
+		}
+		return scanOne(&pgxRows{rows: rows}, dest)
+	})
+}
+
+// Select queues a query whose rows are scanned into the slice dest points to, as
+// Transaction.Select does.
+func (b *Batch) Select(dest interface{}, query string, args ...interface{}) {
+	b.queue(query, args, func(results pgx.BatchResults) error {
+		rows, err := results.Query()
+		if err != nil {
+			return err
+		}
+		return sqlx.StructScan(&pgxRows{rows: rows}, dest)
+	})
+}
+
+// Exec queues a statement returning no rows. If rowsAffected is not nil the number of
+// rows affected by the statement is stored in it.
+func (b *Batch) Exec(rowsAffected *int64, query string, args ...interface{}) {
+	b.queue(query, args, func(results pgx.BatchResults) error {
+		tag, err := results.Exec()
+		if err != nil {
+			return err
+		}
+		if rowsAffected != nil {
+			*rowsAffected = tag.RowsAffected()
+		}
+		return nil
+	})
+}
+
+func (b *Batch) queue(query string, args []interface{}, scan func(pgx.BatchResults) error) {
+	b.batch.Queue(query, args...)
+	b.scans = append(b.scans, scan)
+}
+
+// Send sends the queued queries in the db transaction of tx and scans their results.
+// It stops at the first failing query, whose error is returned with its position in
+// the batch.
+func (b *Batch) Send(tx *gotx.Transaction) error {
+	if b.Len() == 0 {
+		return nil
+	}
+
+	return tx.Raw(func(driverConn interface{}) error {
+		conn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return ErrNotPgx
+		}
+
+		results := conn.Conn().SendBatch(tx.Context(), &b.batch)
+		for i, scan := range b.scans {
+			if err := scan(results); err != nil {
+				results.Close()
+				return fmt.Errorf("pgxgotx: query %d of batch failed: %w", i, err)
+			}
+		}
+		return results.Close()
+	})
+}
+
+// scanOne scans the single row of rows into dest.
+func scanOne(rows *pgxRows, dest interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		rows.Close()
+		return errors.New("pgxgotx: destination must be a non-nil pointer")
+	}
+
+	slice := reflect.New(reflect.SliceOf(v.Elem().Type()))
+	if err := sqlx.StructScan(rows, slice.Interface()); err != nil {
+		return err
+	}
+	if slice.Elem().Len() == 0 {
+		return sql.ErrNoRows
+	}
+	v.Elem().Set(slice.Elem().Index(0))
+	return nil
+}
+
+// pgxRows adapts pgx rows to the rows scanned by sqlx.StructScan.
+type pgxRows struct {
+	rows pgx.Rows
+}
+
+func (r *pgxRows) Close() error {
+	r.rows.Close()
+	return r.rows.Err()
+}
+
+func (r *pgxRows) Columns() ([]string, error) {
+	fields := r.rows.FieldDescriptions()
+	columns := make([]string, len(fields))
+	for i, f := range fields {
+		columns[i] = f.Name
+	}
+	return columns, nil
+}
+
+func (r *pgxRows) Err() error {
+	return r.rows.Err()
+}
+
+func (r *pgxRows) Next() bool {
+	return r.rows.Next()
+}
+
+func (r *pgxRows) Scan(dest ...interface{}) error {
+	return r.rows.Scan(dest...)
+}
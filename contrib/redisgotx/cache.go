@@ -0,0 +1,44 @@
+package redisgotx
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/oligo/gotx"
+	"github.com/redis/go-redis/v9"
+)
+
+// CacheStore is a gotx.CacheStore keeping cached query results in Redis, shared by
+// all processes using the same server:
+//
+//	cache := gotx.NewQueryCache(redisgotx.NewCacheStore(client), time.Minute)
+//	tm := gotx.NewTxManager(db, gotx.WithQueryCache(cache))
+type CacheStore struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+var _ gotx.CacheStore = (*CacheStore)(nil)
+
+// NewCacheStore returns a store keeping results in keys prefixed with "gotx:cache:".
+func NewCacheStore(client redis.UniversalClient) *CacheStore {
+	return &CacheStore{client: client, prefix: "gotx:cache:"}
+}
+
+// Get implements gotx.CacheStore.
+func (s *CacheStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Set implements gotx.CacheStore.
+func (s *CacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, s.prefix+key, value, ttl).Err()
+}
@@ -0,0 +1,16 @@
+module github.com/oligo/gotx/contrib/redisgotx
+
+go 1.20
+
+require (
+	github.com/oligo/gotx v0.0.0
+	github.com/redis/go-redis/v9 v9.5.1
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.2.0 // indirect
+	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/jmoiron/sqlx v1.3.5 // indirect
+)
+
+replace github.com/oligo/gotx => ../..
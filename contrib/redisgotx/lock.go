@@ -0,0 +1,123 @@
+// Package redisgotx provides Redis backends of the gotx.Lock, gotx.CacheStore and
+// gotx.RateLimiter interfaces:
+//
+//	lock := redisgotx.NewLock(redis.NewClient(&redis.Options{Addr: "localhost:6379"}), 30*time.Second)
+//	err := tm.ExecLocked(ctx, lock, "billing", txFunc, nil)
+package redisgotx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/oligo/gotx"
+	"github.com/redis/go-redis/v9"
+)
+
+// retryInterval is how often Acquire tries to take a held lock.
+const retryInterval = 50 * time.Millisecond
+
+// releaseScript deletes the lock key only if it still holds the token of the owner, so
+// a lock which expired and was taken by another process is left alone.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Lock is a gotx.Lock storing each lock as a key set with SET NX and a random token.
+// Keys expire after the TTL, so a lock held by a crashed process is freed eventually;
+// the TTL must exceed the longest critical section, since locks are not renewed.
+type Lock struct {
+	client redis.UniversalClient
+	ttl    time.Duration
+	prefix string
+
+	mux    sync.Mutex
+	tokens map[string]string
+}
+
+// NewLock returns a Lock using client with locks expiring after ttl. Keys are prefixed
+// with "gotx:lock:".
+func NewLock(client redis.UniversalClient, ttl time.Duration) *Lock {
+	return &Lock{
+		client: client,
+		ttl:    ttl,
+		prefix: "gotx:lock:",
+		tokens: make(map[string]string),
+	}
+}
+
+// Acquire implements gotx.Lock.
+func (l *Lock) Acquire(ctx context.Context, name string) error {
+	ticker := time.NewTicker(retryInterval)
+	defer ticker.Stop()
+
+	for {
+		ok, err := l.TryAcquire(ctx, name)
+		if err != nil || ok {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// TryAcquire implements gotx.Lock.
+func (l *Lock) TryAcquire(ctx context.Context, name string) (bool, error) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if _, held := l.tokens[name]; held {
+		return false, nil
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return false, err
+	}
+
+	ok, err := l.client.SetNX(ctx, l.prefix+name, token, l.ttl).Result()
+	if err != nil || !ok {
+		return false, err
+	}
+
+	l.tokens[name] = token
+	return true, nil
+}
+
+// Release implements gotx.Lock. It returns gotx.ErrLockNotHeld if the lock expired and
+// was taken by another process in the meantime.
+func (l *Lock) Release(ctx context.Context, name string) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	token, ok := l.tokens[name]
+	if !ok {
+		return gotx.ErrLockNotHeld
+	}
+	delete(l.tokens, name)
+
+	deleted, err := releaseScript.Run(ctx, l.client, []string{l.prefix + name}, token).Int()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return gotx.ErrLockNotHeld
+	}
+	return nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
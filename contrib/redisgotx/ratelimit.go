@@ -0,0 +1,71 @@
+package redisgotx
+
+import (
+	"context"
+	"time"
+
+	"github.com/oligo/gotx"
+	"github.com/redis/go-redis/v9"
+)
+
+// tokenBucketScript takes a token from the bucket stored in the hash KEYS[1], holding
+// up to ARGV[1] tokens refilled over ARGV[2] microseconds. It returns 1 and 0 if a
+// token was taken, or 0 and the microseconds until one is available. The clock of the
+// server is used, so the clocks of the clients do not matter.
+var tokenBucketScript = redis.NewScript(`
+local limit = tonumber(ARGV[1])
+local per = tonumber(ARGV[2])
+local time = redis.call("TIME")
+local now = tonumber(time[1]) * 1000000 + tonumber(time[2])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "updated")
+local tokens = tonumber(bucket[1]) or limit
+local updated = tonumber(bucket[2]) or now
+tokens = math.min(limit, tokens + math.max(0, now - updated) * limit / per)
+
+local ok, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	ok = 1
+else
+	wait = math.ceil((1 - tokens) * per / limit)
+end
+redis.call("HSET", KEYS[1], "tokens", tostring(tokens), "updated", tostring(now))
+redis.call("PEXPIRE", KEYS[1], math.ceil(per / 1000))
+return {ok, wait}`)
+
+// RateLimiter is a gotx.RateLimiter keeping a token bucket per key in Redis, so the
+// limits of gotx.WithRateLimits hold across all processes using the same server:
+//
+//	limiter := redisgotx.NewRateLimiter(client)
+//	tm := gotx.NewTxManager(db, gotx.WithRateLimits(limiter,
+//		gotx.RateLimitRule{Key: "export", TxName: "export", PerLabel: "tenant", Limit: 10, Per: time.Minute},
+//	))
+//
+// Buckets expire once refilled, so idle keys use no memory. It needs Redis 5 or
+// later.
+type RateLimiter struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+var _ gotx.RateLimiter = (*RateLimiter)(nil)
+
+// NewRateLimiter returns a limiter keeping buckets in keys prefixed with
+// "gotx:ratelimit:".
+func NewRateLimiter(client redis.UniversalClient) *RateLimiter {
+	return &RateLimiter{client: client, prefix: "gotx:ratelimit:"}
+}
+
+// Allow implements gotx.RateLimiter.
+func (l *RateLimiter) Allow(ctx context.Context, key string, limit int, per time.Duration) (bool, time.Duration, error) {
+	if limit <= 0 || per < time.Microsecond {
+		return true, 0, nil
+	}
+
+	res, err := tokenBucketScript.Run(ctx, l.client, []string{l.prefix + key}, limit, per.Microseconds()).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	return res[0] == 1, time.Duration(res[1]) * time.Microsecond, nil
+}
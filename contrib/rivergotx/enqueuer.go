@@ -0,0 +1,70 @@
+// Package rivergotx enqueues the jobs of tx.Enqueue with River, inserting them in the
+// transaction itself:
+//
+//	riverClient, err := river.NewClient(riverdatabasesql.New(db.DB), &river.Config{...})
+//	tm := gotx.NewTxManager(db, gotx.WithEnqueuer(rivergotx.NewEnqueuer(riverClient)))
+//
+// River requires Postgres and its migrations. Unlike the other contrib modules, which
+// build with the Go version of gotx, this module needs Go 1.21, the oldest version
+// supported by River.
+package rivergotx
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/oligo/gotx"
+	"github.com/riverqueue/river"
+)
+
+// Enqueuer is a gotx.Enqueuer inserting jobs with River's transactional insert.
+type Enqueuer struct {
+	client *river.Client[*sql.Tx]
+}
+
+// NewEnqueuer returns an enqueuer inserting jobs with client.
+func NewEnqueuer(client *river.Client[*sql.Tx]) *Enqueuer {
+	return &Enqueuer{client: client}
+}
+
+// Enqueue implements gotx.Enqueuer. If the Args of job implement river.JobArgs they are
+// inserted as they are and their kind must be the Kind of job. Other Args are inserted
+// as the JSON encoded arguments of a job of Kind, which its River worker decodes into
+// its own argument type.
+func (e *Enqueuer) Enqueue(tx *gotx.Transaction, job gotx.Job) error {
+	args, ok := job.Args.(river.JobArgs)
+	if ok {
+		if args.Kind() != job.Kind {
+			return fmt.Errorf("rivergotx: job of kind %s has args of kind %s", job.Kind, args.Kind())
+		}
+	} else {
+		encoded, err := json.Marshal(job.Args)
+		if err != nil {
+			return err
+		}
+		args = rawArgs{kind: job.Kind, args: encoded}
+	}
+
+	opts := &river.InsertOpts{
+		Queue:       job.Queue,
+		ScheduledAt: job.RunAt,
+		MaxAttempts: job.MaxAttempts,
+	}
+	_, err := e.client.InsertTx(tx.Context(), tx.SQLTx(), args, opts)
+	return err
+}
+
+// rawArgs are JSON encoded job arguments of a kind.
+type rawArgs struct {
+	kind string
+	args json.RawMessage
+}
+
+func (a rawArgs) Kind() string {
+	return a.kind
+}
+
+func (a rawArgs) MarshalJSON() ([]byte, error) {
+	return a.args, nil
+}
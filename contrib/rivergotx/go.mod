@@ -0,0 +1,24 @@
+module github.com/oligo/gotx/contrib/rivergotx
+
+go 1.21
+
+require (
+	github.com/oligo/gotx v0.0.0
+	github.com/riverqueue/river v0.11.4
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/jmoiron/sqlx v1.3.5 // indirect
+	github.com/kr/text v0.2.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/riverqueue/river/riverdriver v0.11.4 // indirect
+	github.com/riverqueue/river/rivershared v0.11.4 // indirect
+	github.com/riverqueue/river/rivertype v0.11.4 // indirect
+	github.com/stretchr/testify v1.9.0 // indirect
+	go.uber.org/goleak v1.3.0 // indirect
+	golang.org/x/sync v0.8.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
+
+replace github.com/oligo/gotx => ../..
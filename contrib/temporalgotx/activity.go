@@ -0,0 +1,135 @@
+// Package temporalgotx runs gotx transactions inside Temporal activities:
+//
+//	func (a *Activities) ReserveStock(ctx context.Context, order Order) error {
+//		return temporalgotx.Exec(ctx, a.tm, func(tx *gotx.Transaction) error {
+//			...
+//		}, nil)
+//	}
+//
+// Exec makes the transaction idempotent across activity attempts, heartbeats while it
+// runs and maps its errors to retryable or non-retryable activity errors.
+package temporalgotx
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/oligo/gotx"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+)
+
+// Error types of the application errors returned by Exec, for the
+// NonRetryableErrorTypes of retry policies and for workflows handling the errors.
+const (
+	ErrorTypeSerializationFailure = "gotx.SerializationFailure"
+	ErrorTypeDeadlock             = "gotx.Deadlock"
+	ErrorTypeLockTimeout          = "gotx.LockTimeout"
+	ErrorTypeUniqueViolation      = "gotx.UniqueViolation"
+	ErrorTypeConstraintViolation  = "gotx.ConstraintViolation"
+	ErrorTypeIdempotencyConflict  = "gotx.IdempotencyConflict"
+	ErrorType                     = "gotx.Error"
+)
+
+// Exec runs txFunc in a transaction of tm from the activity of ctx:
+//
+//   - Unless options set an idempotency key, the key of IdempotencyKey is used, so an
+//     attempt retrying an activity whose previous attempt committed does not run
+//     txFunc again. The result of the first attempt is replayed into
+//     options.IdempotencyResult. The table of tm.CreateIdempotencyTable must exist.
+//   - If the activity has a heartbeat timeout, a heartbeat is recorded every half of
+//     it while the transaction runs, so long transactions are not timed out by the
+//     server. When the activity is canceled the transaction is rolled back.
+//   - Errors are mapped by Error.
+func Exec(ctx context.Context, tm *gotx.TxManager, txFunc func(tx *gotx.Transaction) error, options *gotx.Options) error {
+	var opts gotx.Options
+	if options != nil {
+		opts = *options
+	}
+	if opts.IdempotencyKey == "" {
+		opts.IdempotencyKey = IdempotencyKey(ctx)
+	}
+
+	if interval := activity.GetInfo(ctx).HeartbeatTimeout / 2; interval > 0 {
+		stop := heartbeat(ctx, interval)
+		defer stop()
+	}
+
+	return Error(tm, tm.Exec(ctx, txFunc, &opts))
+}
+
+// IdempotencyKey returns a key identifying the activity of ctx, which is the same for
+// all its attempts: the workflow ID, run ID and activity ID.
+func IdempotencyKey(ctx context.Context) string {
+	info := activity.GetInfo(ctx)
+	return info.WorkflowExecution.ID + "/" + info.WorkflowExecution.RunID + "/" + info.ActivityID
+}
+
+// Error maps err, returned by a transaction of tm, to an activity error. Errors the
+// retry classifier of tm deems retryable, such as serialization failures or deadlocks,
+// and idempotency conflicts between concurrent attempts become retryable application
+// errors, so Temporal retries the activity according to its retry policy. Other
+// database errors, such as constraint violations, become non-retryable application
+// errors, since running the same transaction again would fail again. Context errors
+// and errors which are not database errors are returned unchanged.
+func Error(tm *gotx.TxManager, err error) error {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	errType := errorType(err)
+	// the next attempt replays the result recorded by the concurrent attempt
+	if tm.IsRetryable(err) || errors.Is(err, gotx.ErrIdempotencyConflict) {
+		return temporal.NewApplicationErrorWithCause(err.Error(), errType, err)
+	}
+
+	var dbErr *gotx.DBError
+	if errors.As(err, &dbErr) {
+		return temporal.NewNonRetryableApplicationError(err.Error(), errType, err)
+	}
+	return err
+}
+
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, gotx.ErrSerializationFailure):
+		return ErrorTypeSerializationFailure
+	case errors.Is(err, gotx.ErrDeadlock):
+		return ErrorTypeDeadlock
+	case errors.Is(err, gotx.ErrLockTimeout):
+		return ErrorTypeLockTimeout
+	case errors.Is(err, gotx.ErrUniqueViolation):
+		return ErrorTypeUniqueViolation
+	case errors.Is(err, gotx.ErrForeignKeyViolation), errors.Is(err, gotx.ErrCheckViolation),
+		errors.Is(err, gotx.ErrNotNullViolation):
+		return ErrorTypeConstraintViolation
+	case errors.Is(err, gotx.ErrIdempotencyConflict):
+		return ErrorTypeIdempotencyConflict
+	default:
+		return ErrorType
+	}
+}
+
+// heartbeat records heartbeats of the activity of ctx every interval until the
+// returned function is called.
+func heartbeat(ctx context.Context, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				activity.RecordHeartbeat(ctx)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
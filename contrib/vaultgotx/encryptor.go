@@ -0,0 +1,81 @@
+// Package vaultgotx provides a gotx.Encryptor using the transit secrets engine of
+// HashiCorp Vault:
+//
+//	client, err := vault.NewClient(vault.DefaultConfig())
+//	enc := vaultgotx.NewEncryptor(client, "transit", "customer-data")
+//	tm := gotx.NewTxManager(db, gotx.WithEncryption(enc))
+package vaultgotx
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	vault "github.com/hashicorp/vault/api"
+	"github.com/oligo/gotx"
+)
+
+// Encryptor encrypts values with a key of the transit engine, so the key never leaves
+// Vault. Every value is encrypted and decrypted by a request to Vault. The key ID
+// stored with a value is the name of the key and the version which encrypted it, as
+// in "customer-data:v3", so values encrypted before the key was rotated still decrypt
+// as long as their version is not below the min_decryption_version of the key.
+type Encryptor struct {
+	client *vault.Client
+	mount  string
+	key    string
+}
+
+var _ gotx.Encryptor = (*Encryptor)(nil)
+
+// NewEncryptor returns an Encryptor using the key named key of the transit engine
+// mounted at mount, usually "transit".
+func NewEncryptor(client *vault.Client, mount, key string) *Encryptor {
+	return &Encryptor{client: client, mount: mount, key: key}
+}
+
+// Encrypt implements gotx.Encryptor.
+func (e *Encryptor) Encrypt(ctx context.Context, plaintext []byte) (string, []byte, error) {
+	secret, err := e.client.Logical().WriteWithContext(ctx, e.mount+"/encrypt/"+e.key, map[string]interface{}{
+		"plaintext": base64.StdEncoding.EncodeToString(plaintext),
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	if secret == nil {
+		return "", nil, errors.New("vaultgotx: empty encrypt response")
+	}
+
+	// the ciphertext is "vault:v<version>:<base64>"
+	ciphertext, _ := secret.Data["ciphertext"].(string)
+	parts := strings.SplitN(ciphertext, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" {
+		return "", nil, errors.New("vaultgotx: unexpected ciphertext format")
+	}
+	raw, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, err
+	}
+	return e.key + ":" + parts[1], raw, nil
+}
+
+// Decrypt implements gotx.Encryptor.
+func (e *Encryptor) Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	i := strings.LastIndexByte(keyID, ':')
+	if i < 0 {
+		return nil, errors.New("vaultgotx: key ID has no version")
+	}
+	secret, err := e.client.Logical().WriteWithContext(ctx, e.mount+"/decrypt/"+keyID[:i], map[string]interface{}{
+		"ciphertext": "vault:" + keyID[i+1:] + ":" + base64.StdEncoding.EncodeToString(ciphertext),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if secret == nil {
+		return nil, errors.New("vaultgotx: empty decrypt response")
+	}
+
+	plaintext, _ := secret.Data["plaintext"].(string)
+	return base64.StdEncoding.DecodeString(plaintext)
+}
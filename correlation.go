@@ -0,0 +1,120 @@
+package gotx
+
+import (
+	"context"
+	"net/http"
+)
+
+// Header names carrying the correlation metadata between services. gRPC metadata keys
+// are their lower case forms.
+const (
+	HeaderRootTxID       = "Gotx-Root-Tx-Id"
+	HeaderSagaID         = "Gotx-Saga-Id"
+	HeaderIdempotencyKey = "Gotx-Idempotency-Key"
+)
+
+type correlationContextKey struct{}
+
+// Correlation is the metadata correlating the transactions of a flow spanning several
+// services. It is sent along with requests with InjectHTTP, or Inject for other
+// transports such as gRPC metadata, and restored by the receiving service with
+// ExtractHTTP or Extract.
+type Correlation struct {
+	// RootTxID is the ID of the root transaction of the service which started the flow.
+	RootTxID string `json:"root_tx_id,omitempty"`
+
+	// SagaID identifies the saga the flow is a step of.
+	SagaID string `json:"saga_id,omitempty"`
+
+	// IdempotencyKey is the idempotency key of the flow, see Options.IdempotencyKey.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// IsZero reports whether c carries no metadata.
+func (c Correlation) IsZero() bool {
+	return c == Correlation{}
+}
+
+// WithCorrelation returns a context carrying c. Transactions started with it report
+// c.RootTxID as their origin in TxInfo and pass c on to further services.
+func WithCorrelation(ctx context.Context, c Correlation) context.Context {
+	return context.WithValue(ctx, correlationContextKey{}, c)
+}
+
+// CorrelationFromContext returns the correlation to send to other services from ctx.
+// If ctx carries a transaction, it is the correlation of the transaction, otherwise
+// the one set by WithCorrelation.
+func CorrelationFromContext(ctx context.Context) Correlation {
+	if tx, ok := FromContext(ctx); ok {
+		return tx.Correlation()
+	}
+
+	c, _ := ctx.Value(correlationContextKey{}).(Correlation)
+	return c
+}
+
+// Correlation returns the correlation metadata of t: the metadata received from the
+// service which started the flow if any, completed with the root transaction ID and
+// idempotency key of t.
+func (t *Transaction) Correlation() Correlation {
+	c, _ := t.ctx.Value(correlationContextKey{}).(Correlation)
+	if c.RootTxID == "" {
+		c.RootTxID = t.RootID()
+	}
+	for tx := t; tx != nil && c.IdempotencyKey == ""; tx = tx.parent {
+		if tx.opts != nil {
+			c.IdempotencyKey = tx.opts.IdempotencyKey
+		}
+	}
+	return c
+}
+
+// Inject passes the correlation of ctx to set, once per non-empty field, using the
+// header names as keys.
+func Inject(ctx context.Context, set func(key, value string)) {
+	c := CorrelationFromContext(ctx)
+	for _, field := range []struct{ key, value string }{
+		{HeaderRootTxID, c.RootTxID},
+		{HeaderSagaID, c.SagaID},
+		{HeaderIdempotencyKey, c.IdempotencyKey},
+	} {
+		if field.value != "" {
+			set(field.key, field.value)
+		}
+	}
+}
+
+// Extract returns a context carrying the correlation read with get, which is called
+// with the header names. ctx is returned unchanged if no metadata is found.
+func Extract(ctx context.Context, get func(key string) string) context.Context {
+	c := Correlation{
+		RootTxID:       get(HeaderRootTxID),
+		SagaID:         get(HeaderSagaID),
+		IdempotencyKey: get(HeaderIdempotencyKey),
+	}
+	if c.IsZero() {
+		return ctx
+	}
+	return WithCorrelation(ctx, c)
+}
+
+// InjectHTTP sets the correlation headers of ctx on header:
+//
+//	req, err := http.NewRequestWithContext(tx.Context(), http.MethodPost, url, body)
+//	gotx.InjectHTTP(req.Context(), req.Header)
+func InjectHTTP(ctx context.Context, header http.Header) {
+	Inject(ctx, header.Set)
+}
+
+// ExtractHTTP returns a context carrying the correlation of the headers.
+func ExtractHTTP(ctx context.Context, header http.Header) context.Context {
+	return Extract(ctx, header.Get)
+}
+
+// CorrelationHandler is a middleware restoring the correlation sent by the caller into
+// the context of the request.
+func CorrelationHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(ExtractHTTP(r.Context(), r.Header)))
+	})
+}
@@ -0,0 +1,129 @@
+// Package debug provides an HTTP handler exposing the state of a gotx.TxManager, to be
+// mounted on an internal admin mux:
+//
+//	mux.Handle("/debug/gotx", debug.Handler(tm))
+//
+// The handler renders HTML for browsers and JSON for requests with ?format=json or an
+// Accept header asking for application/json.
+package debug
+
+import (
+	"database/sql"
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/oligo/gotx"
+)
+
+// State is the manager state rendered by the handler.
+type State struct {
+	Time    time.Time          `json:"time"`
+	Config  gotx.Config        `json:"config"`
+	Stats   gotx.Stats         `json:"stats"`
+	Callers []gotx.CallerStats `json:"callers"`
+	Pool    sql.DBStats        `json:"pool"`
+	Active  []gotx.TxInfo      `json:"active"`
+	Slow    []gotx.TxInfo      `json:"slow"`
+}
+
+// Snapshot returns the current state of tm.
+func Snapshot(tm *gotx.TxManager) State {
+	return State{
+		Time:    time.Now(),
+		Config:  tm.Config(),
+		Stats:   tm.Stats(),
+		Callers: tm.StatsByCaller(),
+		Pool:    tm.DBStats(),
+		Active:  tm.ActiveTransactions(),
+		Slow:    tm.SlowTransactions(),
+	}
+}
+
+// Handler returns a handler rendering the state of tm.
+func Handler(tm *gotx.TxManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := Snapshot(tm)
+
+		if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+			w.Header().Set("Content-Type", "application/json")
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(state); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := page.Execute(w, state); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+var page = template.Must(template.New("gotx").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>gotx</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; }
+table { border-collapse: collapse; margin-bottom: 24px; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+</style>
+</head>
+<body>
+<h1>gotx</h1>
+<p>{{.Time.Format "2006-01-02 15:04:05"}}</p>
+
+<h2>Configuration</h2>
+<table>
+<tr><th>Dialect</th><td>{{.Config.Dialect}}</td></tr>
+<tr><th>Debug</th><td>{{.Config.Debug}}</td></tr>
+<tr><th>Slow threshold</th><td>{{.Config.SlowThreshold}}</td></tr>
+<tr><th>Interceptors</th><td>{{.Config.Interceptors}}</td></tr>
+<tr><th>Hooks</th><td>{{.Config.Hooks}}</td></tr>
+<tr><th>Registered queries</th><td>{{.Config.Queries}}</td></tr>
+</table>
+
+<h2>Transactions</h2>
+<table>
+<tr><th>Active</th><td>{{.Stats.Active}}</td></tr>
+<tr><th>Committed</th><td>{{.Stats.Committed}}</td></tr>
+<tr><th>Rolled back</th><td>{{.Stats.RolledBack}}</td></tr>
+<tr><th>Retried</th><td>{{.Stats.Retried}}</td></tr>
+<tr><th>Average duration</th><td>{{.Stats.AvgDuration}}</td></tr>
+</table>
+
+<h2>Connection pool</h2>
+<table>
+<tr><th>Open</th><td>{{.Pool.OpenConnections}} / {{.Pool.MaxOpenConnections}}</td></tr>
+<tr><th>In use</th><td>{{.Pool.InUse}}</td></tr>
+<tr><th>Idle</th><td>{{.Pool.Idle}}</td></tr>
+<tr><th>Waits</th><td>{{.Pool.WaitCount}} ({{.Pool.WaitDuration}})</td></tr>
+</table>
+
+<h2>Active transactions</h2>
+<table>
+<tr><th>ID</th><th>Root</th><th>Parent</th><th>Goroutine</th><th>New</th><th>Savepoint</th><th>Started</th><th>Running for</th></tr>
+{{range .Active}}<tr><td>{{.ID}}</td><td>{{.RootID}}</td><td>{{.ParentID}}</td><td>{{.Goroutine}}</td><td>{{.RequiresNew}}</td><td>{{.Savepoint}}</td><td>{{.Started.Format "15:04:05.000"}}</td><td>{{.Duration}}</td></tr>
+{{else}}<tr><td colspan="8">none</td></tr>
+{{end}}</table>
+
+<h2>Recent slow transactions</h2>
+<table>
+<tr><th>ID</th><th>Root</th><th>Parent</th><th>Started</th><th>Duration</th><th>Statements</th><th>Statement time</th><th>Think time</th><th>Error</th></tr>
+{{range .Slow}}<tr><td>{{.ID}}</td><td>{{.RootID}}</td><td>{{.ParentID}}</td><td>{{.Started.Format "15:04:05.000"}}</td><td>{{.Duration}}</td><td>{{.Statements}}</td><td>{{.StatementTime}}</td><td>{{.ThinkTime}}</td><td>{{.Err}}</td></tr>
+{{else}}<tr><td colspan="9">none</td></tr>
+{{end}}</table>
+
+<h2>Callers</h2>
+<table>
+<tr><th>Caller</th><th>Committed</th><th>Rolled back</th><th>Retried</th><th>p50</th><th>p95</th><th>p99</th><th>Max</th></tr>
+{{range .Callers}}<tr><td>{{.Caller}}</td><td>{{.Committed}}</td><td>{{.RolledBack}}</td><td>{{.Retried}}</td><td>{{.P50}}</td><td>{{.P95}}</td><td>{{.P99}}</td><td>{{.Max}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
@@ -0,0 +1,137 @@
+package gotx
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Dialect identifies the SQL dialect spoken by the database of a TxManager. Helpers
+// generating SQL use it to pick the right syntax.
+type Dialect uint8
+
+const (
+	DialectUnknown Dialect = iota
+	DialectMySQL
+	DialectPostgres
+	DialectSQLite
+	DialectSQLServer
+	DialectOracle
+)
+
+func (d Dialect) String() string {
+	switch d {
+	case DialectMySQL:
+		return "mysql"
+	case DialectPostgres:
+		return "postgres"
+	case DialectSQLite:
+		return "sqlite"
+	case DialectSQLServer:
+		return "sqlserver"
+	case DialectOracle:
+		return "oracle"
+	default:
+		return "unknown"
+	}
+}
+
+// dialectOf guesses the dialect from a database/sql driver name.
+func dialectOf(driverName string) Dialect {
+	name := strings.ToLower(driverName)
+	switch {
+	case strings.Contains(name, "mysql"):
+		return DialectMySQL
+	case strings.Contains(name, "postgres"), strings.Contains(name, "pgx"), name == "pq",
+		strings.Contains(name, "cockroach"):
+		return DialectPostgres
+	case strings.Contains(name, "sqlite"):
+		return DialectSQLite
+	case strings.Contains(name, "sqlserver"), strings.Contains(name, "mssql"):
+		return DialectSQLServer
+	case strings.Contains(name, "oracle"), strings.Contains(name, "oci8"), strings.Contains(name, "godror"):
+		return DialectOracle
+	default:
+		return DialectUnknown
+	}
+}
+
+// oracleCreateIfNotExists wraps the CREATE statement ddl into a PL/SQL block ignoring
+// ORA-00955, the error of an existing object, since Oracle only supports IF NOT EXISTS
+// from 23ai on.
+func oracleCreateIfNotExists(ddl string) string {
+	return "BEGIN EXECUTE IMMEDIATE '" + strings.ReplaceAll(ddl, "'", "''") + "'; " +
+		"EXCEPTION WHEN OTHERS THEN IF SQLCODE != -955 THEN RAISE; END IF; END;"
+}
+
+// CreateIfNotExists runs the CREATE statements ddls of the tables and indexes of a
+// package built on gotx in a transaction. On Oracle, which only supports IF NOT EXISTS
+// from 23ai on, ddls are written without it and run in PL/SQL blocks ignoring the error
+// of an existing object. On the other dialects ddls must skip existing objects
+// themselves, e.g. with IF NOT EXISTS.
+func (tm *TxManager) CreateIfNotExists(ctx context.Context, ddls ...string) error {
+	return tm.exec(ctx, getCaller(), func(tx *Transaction) error {
+		for _, ddl := range ddls {
+			if tm.dialect == DialectOracle {
+				ddl = oracleCreateIfNotExists(ddl)
+			}
+			if _, err := tx.exec(ddl); err != nil {
+				return err
+			}
+		}
+		return nil
+	}, nil)
+}
+
+// WithDialect overrides the dialect guessed from the driver name, e.g. for drivers
+// registered under custom names.
+func WithDialect(d Dialect) ManagerOption {
+	return func(tm *TxManager) {
+		tm.dialect = d
+	}
+}
+
+// Dialect returns the SQL dialect of the database managed by tm.
+func (tm *TxManager) Dialect() Dialect {
+	return tm.dialect
+}
+
+// Placeholder returns the n-th (1 based) bindvar in the style of the manager's driver,
+// for the queries of packages built on gotx.
+func (tm *TxManager) Placeholder(n int) string {
+	return bindVar(tm.bindType(), n)
+}
+
+// bindType returns the sqlx bindvar style of the manager's driver, or the one of its
+// dialect for driver names sqlx does not know.
+func (tm *TxManager) bindType() int {
+	if bt := sqlx.BindType(tm.db.DriverName()); bt != sqlx.UNKNOWN {
+		return bt
+	}
+	switch tm.dialect {
+	case DialectPostgres:
+		return sqlx.DOLLAR
+	case DialectSQLServer:
+		return sqlx.AT
+	case DialectOracle:
+		return sqlx.NAMED
+	default:
+		return sqlx.QUESTION
+	}
+}
+
+// bindVar returns the n-th (1 based) bindvar of bindType.
+func bindVar(bindType int, n int) string {
+	switch bindType {
+	case sqlx.DOLLAR:
+		return "$" + strconv.Itoa(n)
+	case sqlx.NAMED:
+		return ":arg" + strconv.Itoa(n)
+	case sqlx.AT:
+		return "@p" + strconv.Itoa(n)
+	default:
+		return "?"
+	}
+}
@@ -0,0 +1,156 @@
+package gotx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrLockNotHeld is returned when releasing a lock which is not held.
+var ErrLockNotHeld = errors.New("gotx: lock not held")
+
+// Lock is a distributed lock on names, shared by all processes using the same backend.
+// Unlike tx.NamedLock the locks are not bound to a db transaction, so they can guard
+// critical sections spanning several transactions or none. Implementations for Redis
+// and etcd are in the contrib/redisgotx and contrib/etcdgotx modules.
+type Lock interface {
+	// Acquire blocks until the lock name is acquired or ctx is done. Locks are not
+	// re-entrant: a lock held already, even by the same Lock, must be released first.
+	Acquire(ctx context.Context, name string) error
+
+	// TryAcquire acquires the lock name if it is free and reports whether it did.
+	TryAcquire(ctx context.Context, name string) (bool, error)
+
+	// Release releases the lock name held by this Lock. It returns ErrLockNotHeld if
+	// the lock is not held.
+	Release(ctx context.Context, name string) error
+}
+
+// DBLock is a Lock using the session level named locks of the database: GET_LOCK on
+// MySQL and advisory locks on the hash of the name on Postgres. Each held lock pins a
+// connection of the pool until it is released.
+type DBLock struct {
+	db      *sqlx.DB
+	dialect Dialect
+
+	mux   sync.Mutex
+	conns map[string]*sql.Conn
+}
+
+// NewDBLock returns a Lock using the named locks of db.
+func NewDBLock(db *sqlx.DB) *DBLock {
+	return &DBLock{
+		db:      db,
+		dialect: dialectOf(db.DriverName()),
+		conns:   make(map[string]*sql.Conn),
+	}
+}
+
+// Acquire implements Lock.
+func (l *DBLock) Acquire(ctx context.Context, name string) error {
+	for {
+		ok, err := l.TryAcquire(ctx, name)
+		if err != nil || ok {
+			return err
+		}
+
+		if err := sleepContext(ctx, SystemClock{}, lockPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// TryAcquire implements Lock.
+func (l *DBLock) TryAcquire(ctx context.Context, name string) (bool, error) {
+	var query string
+	switch l.dialect {
+	case DialectMySQL:
+		query = "SELECT COALESCE(GET_LOCK(?, 0), 0) = 1"
+	case DialectPostgres:
+		query = "SELECT pg_try_advisory_lock(hashtext($1))"
+	default:
+		return false, fmt.Errorf("named locks are not supported by the %s dialect", l.dialect)
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if _, held := l.conns[name]; held {
+		return false, nil
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, query, name).Scan(&acquired); err != nil {
+		conn.Close()
+		return false, fmt.Errorf("lock %s failed: %w", name, err)
+	}
+	if !acquired {
+		conn.Close()
+		return false, nil
+	}
+
+	l.conns[name] = conn
+	return true, nil
+}
+
+// Release implements Lock.
+func (l *DBLock) Release(ctx context.Context, name string) error {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	conn, ok := l.conns[name]
+	if !ok {
+		return ErrLockNotHeld
+	}
+	delete(l.conns, name)
+
+	query := "SELECT RELEASE_LOCK(?)"
+	if l.dialect == DialectPostgres {
+		query = "SELECT pg_advisory_unlock(hashtext($1))"
+	}
+
+	_, err := conn.ExecContext(ctx, query, name)
+	if err != nil {
+		// a connection still holding the lock must not go back to the pool
+		_ = conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	if closeErr := conn.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return fmt.Errorf("unlock %s failed: %w", name, err)
+	}
+	return nil
+}
+
+// ExecLocked runs txFunc in a transaction like Exec while holding the lock name of
+// lock, which is acquired before the transaction begins and released after it ended.
+// The lock thus also covers the commit, so the next holder sees its changes.
+func (tm *TxManager) ExecLocked(ctx context.Context, lock Lock, name string, txFunc func(tx *Transaction) error, options *Options) (err error) {
+	if err := lock.Acquire(ctx, name); err != nil {
+		return fmt.Errorf("gotx: acquiring lock %s failed: %w", name, err)
+	}
+
+	defer func() {
+		// release even if ctx is canceled already
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if relErr := lock.Release(releaseCtx, name); relErr != nil && err == nil {
+			err = fmt.Errorf("gotx: releasing lock %s failed: %w", name, relErr)
+		}
+	}()
+
+	return tm.exec(ctx, getCaller(), txFunc, options)
+}
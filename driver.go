@@ -0,0 +1,348 @@
+package gotx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// NewConnector wraps a driver connector so that code using plain database/sql takes
+// part in the gotx transaction carried by the context of its statements. This allows
+// to adopt gotx gradually in code bases not structured around a TxManager:
+//
+//	db := sql.OpenDB(gotx.NewConnector(connector))
+//	tm.Exec(ctx, func(tx *gotx.Transaction) error {
+//		// runs in tx, as tx.Context() carries it
+//		_, err := legacyRepo.Save(tx.Context(), db, order)
+//		return err
+//	}, nil)
+//
+// Statements run with a context returned by Transaction.Context, or derived from it,
+// are run by the transaction, through the interceptors of its manager. Other
+// statements run on connections of the wrapped connector as usual. A transaction begun
+// with such a context joins the gotx transaction instead of beginning a db transaction:
+// its Commit and Rollback do nothing, the gotx transaction commits or rolls back when
+// its txFunc returns, so errors must be returned from txFunc to roll it back.
+func NewConnector(base driver.Connector) driver.Connector {
+	return &connector{base: base}
+}
+
+// OpenDB opens a database like sql.Open whose connections take part in the gotx
+// transactions carried by the contexts of statements, see NewConnector.
+func OpenDB(driverName string, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	d := db.Driver()
+	db.Close()
+
+	var base driver.Connector
+	if dc, ok := d.(driver.DriverContext); ok {
+		if base, err = dc.OpenConnector(dsn); err != nil {
+			return nil, err
+		}
+	} else {
+		base = dsnConnector{driver: d, dsn: dsn}
+	}
+	return sql.OpenDB(NewConnector(base)), nil
+}
+
+// dsnConnector is the connector of drivers which do not implement
+// driver.DriverContext.
+type dsnConnector struct {
+	driver driver.Driver
+	dsn    string
+}
+
+func (c dsnConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.dsn)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+type connector struct {
+	base driver.Connector
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	base, err := c.base.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{base: base}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.base.Driver()
+}
+
+// conn routes the statements run with a transaction context to the transaction.
+type conn struct {
+	base driver.Conn
+
+	// joined is the gotx transaction joined by a database/sql transaction of conn
+	joined *Transaction
+}
+
+// ambient returns the gotx transaction statements with ctx run in, or nil.
+func (c *conn) ambient(ctx context.Context) *Transaction {
+	if c.joined != nil {
+		return c.joined
+	}
+	if tx, ok := FromContext(ctx); ok {
+		return tx
+	}
+	return nil
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var base driver.Stmt
+	var err error
+	if pc, ok := c.base.(driver.ConnPrepareContext); ok {
+		base, err = pc.PrepareContext(ctx, query)
+	} else {
+		base, err = c.base.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &stmt{conn: c, base: base, query: query}, nil
+}
+
+func (c *conn) Close() error {
+	return c.base.Close()
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if tx := c.ambient(ctx); tx != nil {
+		c.joined = tx
+		return joinedTx{conn: c}, nil
+	}
+
+	if bc, ok := c.base.(driver.ConnBeginTx); ok {
+		return bc.BeginTx(ctx, opts)
+	}
+	return c.base.Begin()
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if tx := c.ambient(ctx); tx != nil {
+		return ambientExec(tx, query, args)
+	}
+
+	if ec, ok := c.base.(driver.ExecerContext); ok {
+		return ec.ExecContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if tx := c.ambient(ctx); tx != nil {
+		return ambientQuery(tx, query, args)
+	}
+
+	if qc, ok := c.base.(driver.QueryerContext); ok {
+		return qc.QueryContext(ctx, query, args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := c.base.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.base.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	c.joined = nil
+	if r, ok := c.base.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.base.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+// joinedTx is a database/sql transaction joining a gotx transaction.
+type joinedTx struct {
+	conn *conn
+}
+
+func (t joinedTx) Commit() error {
+	t.conn.joined = nil
+	return nil
+}
+
+func (t joinedTx) Rollback() error {
+	t.conn.joined = nil
+	return nil
+}
+
+// stmt is a prepared statement of conn, run by the gotx transaction of the context
+// it is executed with, if any.
+type stmt struct {
+	conn  *conn
+	base  driver.Stmt
+	query string
+}
+
+func (s *stmt) Close() error {
+	return s.base.Close()
+}
+
+func (s *stmt) NumInput() int {
+	return s.base.NumInput()
+}
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.base.Exec(args)
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.base.Query(args)
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if tx := s.conn.ambient(ctx); tx != nil {
+		return ambientExec(tx, s.query, args)
+	}
+
+	if ec, ok := s.base.(driver.StmtExecContext); ok {
+		return ec.ExecContext(ctx, args)
+	}
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.base.Exec(values)
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if tx := s.conn.ambient(ctx); tx != nil {
+		return ambientQuery(tx, s.query, args)
+	}
+
+	if qc, ok := s.base.(driver.StmtQueryContext); ok {
+		return qc.QueryContext(ctx, args)
+	}
+	values, err := namedValuesToValues(args)
+	if err != nil {
+		return nil, err
+	}
+	return s.base.Query(values)
+}
+
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("gotx: driver does not support named parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
+
+// ambientArgs converts driver arguments back to database/sql arguments.
+func ambientArgs(args []driver.NamedValue) []interface{} {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			values[i] = sql.Named(arg.Name, arg.Value)
+		} else {
+			values[i] = arg.Value
+		}
+	}
+	return values
+}
+
+func ambientExec(tx *Transaction, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := tx.checkState(); err != nil {
+		return nil, err
+	}
+	return tx.exec(query, ambientArgs(args)...)
+}
+
+func ambientQuery(tx *Transaction, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := tx.checkState(); err != nil {
+		return nil, err
+	}
+
+	stmt := &Statement{Kind: StatementMultiQuery, Query: query, Args: ambientArgs(args)}
+	if err := tx.run(stmt); err != nil {
+		return nil, err
+	}
+
+	columns, err := stmt.Rows.Columns()
+	if err != nil {
+		stmt.Rows.Close()
+		return nil, err
+	}
+	return &ambientRows{rows: stmt.Rows, columns: columns}, nil
+}
+
+// ambientRows are the rows of a query run by a gotx transaction, read through
+// database/sql once more.
+type ambientRows struct {
+	rows    *sqlx.Rows
+	columns []string
+}
+
+func (r *ambientRows) Columns() []string {
+	return r.columns
+}
+
+func (r *ambientRows) Close() error {
+	return r.rows.Close()
+}
+
+func (r *ambientRows) Next(dest []driver.Value) error {
+	if !r.rows.Next() {
+		if err := r.rows.Err(); err != nil {
+			return err
+		}
+		return io.EOF
+	}
+
+	values := make([]interface{}, len(dest))
+	ptrs := make([]interface{}, len(dest))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if err := r.rows.Scan(ptrs...); err != nil {
+		return err
+	}
+
+	for i, v := range values {
+		dest[i] = v
+	}
+	return nil
+}
@@ -0,0 +1,292 @@
+package gotx
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// Encryptor encrypts the values of the struct fields tagged with the encrypt option,
+// see WithEncryption. Implementations call a local cipher or a key management service
+// such as AWS KMS or Vault.
+type Encryptor interface {
+	// Encrypt encrypts plaintext with the current key and returns the ID of that key
+	// with the ciphertext.
+	Encrypt(ctx context.Context, plaintext []byte) (keyID string, ciphertext []byte, err error)
+
+	// Decrypt decrypts ciphertext encrypted with the key keyID, which may be an older
+	// key than the current one.
+	Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error)
+}
+
+// WithEncryption encrypts the struct fields tagged with the encrypt option, as in
+// `db:"ssn,encrypt"`, with e:
+//
+//	type Customer struct {
+//		ID  int64  `db:"id"`
+//		SSN string `db:"ssn,encrypt"`
+//	}
+//	enc, err := gotx.NewAESGCM("2024-01", keys)
+//	tm := gotx.NewTxManager(db, gotx.WithEncryption(enc))
+//
+// Struct arguments of Insert, Update, NamedExec, Save and UpdateChanged are encrypted
+// before they are bound, and struct destinations of GetOne and Select are decrypted
+// once scanned. Rows read with ForEach are decrypted by calling Decrypt. Encrypted
+// fields are strings or byte slices, or pointers to them where nil is NULL, and their
+// columns must hold text: the value stored is the ID of the key followed by a colon
+// and the base64 encoded ciphertext. Values thus keep the key they were encrypted with
+// after the key rotates, and are encrypted with the current key when written again.
+// Encrypted columns can not be searched or compared in SQL, and named arguments passed
+// as maps are not encrypted.
+func WithEncryption(e Encryptor) ManagerOption {
+	return func(tm *TxManager) {
+		tm.encryptor = e
+	}
+}
+
+// AESGCM is an Encryptor using AES-GCM with local keys. Values are encrypted with the
+// current key and decrypted with the key they were encrypted with, so keys can be
+// rotated by adding a new current key and keeping the old ones.
+type AESGCM struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewAESGCM returns an AESGCM encrypting with the key currentKeyID of keys. Keys are
+// 16, 24 or 32 bytes long, for AES-128, AES-192 or AES-256.
+func NewAESGCM(currentKeyID string, keys map[string][]byte) (*AESGCM, error) {
+	if _, ok := keys[currentKeyID]; !ok {
+		return nil, fmt.Errorf("gotx: current key %q not found", currentKeyID)
+	}
+
+	e := &AESGCM{current: currentKeyID, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if id == "" {
+			return nil, errors.New("gotx: empty key ID")
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("gotx: key %q: %w", id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("gotx: key %q: %w", id, err)
+		}
+		e.keys[id] = aead
+	}
+	return e, nil
+}
+
+// Encrypt implements Encryptor. The random nonce is prepended to the ciphertext.
+func (e *AESGCM) Encrypt(ctx context.Context, plaintext []byte) (string, []byte, error) {
+	aead := e.keys[e.current]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+	return e.current, aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// Decrypt implements Encryptor.
+func (e *AESGCM) Decrypt(ctx context.Context, keyID string, ciphertext []byte) ([]byte, error) {
+	aead, ok := e.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("gotx: unknown encryption key %q", keyID)
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("gotx: ciphertext too short")
+	}
+	nonce, sealed := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, nil)
+}
+
+// Decrypt decrypts the encrypted fields of dest, a pointer to a struct or to a slice
+// of structs or struct pointers, in place. GetOne and Select decrypt their destination
+// themselves, Decrypt is for the rows scanned with ForEach:
+//
+//	err := tx.ForEach(query, func(rows *sqlx.Rows) error {
+//		var c Customer
+//		if err := rows.StructScan(&c); err != nil {
+//			return err
+//		}
+//		if err := tx.Decrypt(&c); err != nil {
+//			return err
+//		}
+//		...
+//	})
+//
+// It does nothing if the manager has no Encryptor.
+func (t *Transaction) Decrypt(dest interface{}) error {
+	if t.txManager.encryptor == nil {
+		return nil
+	}
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil
+	}
+	v = v.Elem()
+
+	switch v.Kind() {
+	case reflect.Struct:
+		return t.decryptStruct(v)
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			elem := reflect.Indirect(v.Index(i))
+			if elem.Kind() != reflect.Struct {
+				return nil
+			}
+			if err := t.decryptStruct(elem); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// encryptedFields returns the fields of sm tagged with the encrypt option.
+func encryptedFields(sm *reflectx.StructMap) []*reflectx.FieldInfo {
+	var fields []*reflectx.FieldInfo
+	for _, fi := range sm.Index {
+		if _, ok := fi.Options["encrypt"]; ok {
+			fields = append(fields, fi)
+		}
+	}
+	return fields
+}
+
+// fieldByIndexes returns the field of v at indexes, or an invalid value if a pointer
+// on the way is nil.
+func fieldByIndexes(v reflect.Value, indexes []int) reflect.Value {
+	for _, i := range indexes {
+		v = reflect.Indirect(v)
+		if !v.IsValid() {
+			return v
+		}
+		v = v.Field(i)
+	}
+	return v
+}
+
+func (t *Transaction) decryptStruct(v reflect.Value) error {
+	sm := t.tx.Mapper.TypeMap(v.Type())
+	for _, fi := range encryptedFields(sm) {
+		field := fieldByIndexes(v, fi.Index)
+		if field.Kind() == reflect.Ptr {
+			field = field.Elem()
+		}
+		if !field.IsValid() {
+			continue
+		}
+
+		var stored string
+		switch {
+		case field.Kind() == reflect.String:
+			stored = field.String()
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.Uint8:
+			stored = string(field.Bytes())
+		default:
+			return fmt.Errorf("gotx: encrypted field %s must be a string or []byte", fi.Path)
+		}
+		// NULL columns scan to empty values
+		if stored == "" {
+			continue
+		}
+
+		plaintext, err := t.decryptValue(stored)
+		if err != nil {
+			return fmt.Errorf("gotx: decrypting %s failed: %w", fi.Path, err)
+		}
+		if field.Kind() == reflect.String {
+			field.SetString(string(plaintext))
+		} else {
+			field.SetBytes(plaintext)
+		}
+	}
+	return nil
+}
+
+func (t *Transaction) decryptValue(stored string) ([]byte, error) {
+	// key IDs may contain colons, base64 does not
+	i := strings.LastIndexByte(stored, ':')
+	if i < 0 {
+		return nil, errors.New("value is not encrypted")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(stored[i+1:])
+	if err != nil {
+		return nil, err
+	}
+	return t.txManager.encryptor.Decrypt(t.ctx, stored[:i], ciphertext)
+}
+
+// encryptArg returns the named argument arg with its encrypted fields encrypted. A
+// struct with encrypted fields is returned as a map of its field values by name, other
+// arguments are returned unchanged.
+func (t *Transaction) encryptArg(arg interface{}) (interface{}, error) {
+	if t.txManager.encryptor == nil {
+		return arg, nil
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(arg))
+	if v.Kind() != reflect.Struct {
+		return arg, nil
+	}
+	sm := t.tx.Mapper.TypeMap(v.Type())
+	encrypted := encryptedFields(sm)
+	if len(encrypted) == 0 {
+		return arg, nil
+	}
+
+	values := make(map[string]interface{}, len(sm.Names))
+	for name, fi := range sm.Names {
+		if field := fieldByIndexes(v, fi.Index); field.IsValid() {
+			values[name] = field.Interface()
+		}
+	}
+	for _, fi := range encrypted {
+		value, err := t.encryptField(fi, values[fi.Path])
+		if err != nil {
+			return nil, err
+		}
+		values[fi.Path] = value
+	}
+	return values, nil
+}
+
+// encryptField returns the value stored for the value of an encrypted field.
+func (t *Transaction) encryptField(fi *reflectx.FieldInfo, value interface{}) (interface{}, error) {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	var plaintext []byte
+	switch {
+	case v.Kind() == reflect.String:
+		plaintext = []byte(v.String())
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+		if v.IsNil() {
+			return nil, nil
+		}
+		plaintext = v.Bytes()
+	default:
+		return nil, fmt.Errorf("gotx: encrypted field %s must be a string or []byte", fi.Path)
+	}
+
+	keyID, ciphertext, err := t.txManager.encryptor.Encrypt(t.ctx, plaintext)
+	if err != nil {
+		return nil, fmt.Errorf("gotx: encrypting %s failed: %w", fi.Path, err)
+	}
+	return keyID + ":" + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
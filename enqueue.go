@@ -0,0 +1,228 @@
+package gotx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// jobOutboxTable is the table of the built-in job outbox.
+const jobOutboxTable = "gotx_job_outbox"
+
+// Job is a background job enqueued by a transaction.
+type Job struct {
+	// Kind names the job, e.g. the task type or worker it is dispatched to.
+	Kind string `json:"kind"`
+
+	// Args are the arguments of the job. The outbox stores them as JSON.
+	Args interface{} `json:"args"`
+
+	// Queue is the queue of the job. Empty means the default queue of the job system.
+	Queue string `json:"queue,omitempty"`
+
+	// RunAt schedules the job. The zero time runs it as soon as possible.
+	RunAt time.Time `json:"run_at,omitempty"`
+
+	// MaxAttempts limits how often the job is attempted. Zero means the default of the
+	// job system.
+	MaxAttempts int `json:"max_attempts,omitempty"`
+}
+
+// Enqueuer enqueues jobs atomically with the writes of a transaction: a job enqueued by
+// a transaction which rolls back is never run.
+type Enqueuer interface {
+	Enqueue(tx *Transaction, job Job) error
+}
+
+// EnqueuerFunc is an adapter to allow the use of ordinary functions as enqueuers.
+type EnqueuerFunc func(tx *Transaction, job Job) error
+
+// Enqueue calls f(tx, job).
+func (f EnqueuerFunc) Enqueue(tx *Transaction, job Job) error {
+	return f(tx, job)
+}
+
+// WithEnqueuer sets the enqueuer of Transaction.Enqueue, e.g. the River adapter of the
+// contrib/rivergotx module. By default jobs are written to the job outbox.
+func WithEnqueuer(e Enqueuer) ManagerOption {
+	return func(tm *TxManager) {
+		tm.enqueuer = e
+	}
+}
+
+// Enqueue enqueues job in the transaction with the enqueuer of the manager. Without
+// one the job is inserted into the gotx_job_outbox table, created by
+// CreateJobOutboxTable, from where RelayJobs hands it to the job system once the
+// transaction committed:
+//
+//	err := tm.Exec(ctx, func(tx *gotx.Transaction) error {
+//		id, err := tx.Insert("INSERT INTO orders ...", order)
+//		if err != nil {
+//			return err
+//		}
+//		return tx.Enqueue(gotx.Job{Kind: "order:confirm", Args: map[string]int64{"id": id}})
+//	}, nil)
+func (t *Transaction) Enqueue(job Job) error {
+	if err := t.checkState(); err != nil {
+		return err
+	}
+	if job.Kind == "" {
+		return fmt.Errorf("gotx: job has no kind")
+	}
+
+	var err error
+	if t.txManager.enqueuer != nil {
+		err = t.txManager.enqueuer.Enqueue(t, job)
+	} else {
+		err = t.insertOutboxJob(job)
+	}
+
+	if err != nil {
+		return fmt.Errorf("enqueue %s failed: %w", job.Kind, err)
+	}
+	return nil
+}
+
+func (t *Transaction) insertOutboxJob(job Job) error {
+	args, err := json.Marshal(job.Args)
+	if err != nil {
+		return err
+	}
+
+	var runAt sql.NullTime
+	if !job.RunAt.IsZero() {
+		runAt = sql.NullTime{Time: job.RunAt.UTC(), Valid: true}
+	}
+
+	_, err = t.NamedExec("INSERT INTO "+jobOutboxTable+" (kind, queue, args, run_at, max_attempts, created_at)"+
+		" VALUES (:kind, :queue, :args, :run_at, :max_attempts, :created_at)", map[string]interface{}{
+		"kind":         job.Kind,
+		"queue":        job.Queue,
+		"args":         string(args),
+		"run_at":       runAt,
+		"max_attempts": job.MaxAttempts,
+		"created_at":   t.txManager.now().UTC(),
+	})
+	return err
+}
+
+// CreateJobOutboxTable creates the table of the job outbox if it does not exist. Call
+// it at startup, or create the table with a migration using the same columns.
+func (tm *TxManager) CreateJobOutboxTable(ctx context.Context) error {
+	id, name, text, integer, timestamp := "", "VARCHAR(255)", "TEXT", "INT", "TIMESTAMP"
+	// Oracle stores the empty string as NULL, the queue of the default queue is NULL there
+	queue := "VARCHAR(255) NOT NULL"
+	switch tm.dialect {
+	case DialectPostgres:
+		id = "BIGSERIAL PRIMARY KEY"
+	case DialectMySQL:
+		id, timestamp = "BIGINT AUTO_INCREMENT PRIMARY KEY", "DATETIME(6)"
+	case DialectSQLServer:
+		id, text, timestamp = "BIGINT IDENTITY PRIMARY KEY", "NVARCHAR(MAX)", "DATETIME2"
+	case DialectOracle:
+		id, name, text, integer = "NUMBER(19) GENERATED BY DEFAULT AS IDENTITY PRIMARY KEY", "VARCHAR2(255)", "CLOB", "NUMBER(10)"
+		queue = name
+	default:
+		id = "INTEGER PRIMARY KEY AUTOINCREMENT"
+	}
+
+	columns := " (id " + id + ", kind " + name + " NOT NULL, queue " + queue + ", args " + text +
+		", run_at " + timestamp + ", max_attempts " + integer + " NOT NULL, created_at " + timestamp + " NOT NULL)"
+
+	var ddl string
+	switch tm.dialect {
+	case DialectSQLServer:
+		ddl = "IF OBJECT_ID('" + jobOutboxTable + "') IS NULL CREATE TABLE " + jobOutboxTable + columns
+	case DialectOracle:
+		ddl = oracleCreateIfNotExists("CREATE TABLE " + jobOutboxTable + columns)
+	default:
+		ddl = "CREATE TABLE IF NOT EXISTS " + jobOutboxTable + columns
+	}
+
+	_, err := tm.db.ExecContext(ctx, ddl)
+	return Translate(err)
+}
+
+// OutboxJob is a job read from the job outbox.
+type OutboxJob struct {
+	ID          int64        `db:"id"`
+	Kind        string       `db:"kind"`
+	Queue       string       `db:"queue"`
+	Args        []byte       `db:"args"` // JSON encoded
+	RunAt       sql.NullTime `db:"run_at"`
+	MaxAttempts int          `db:"max_attempts"`
+	CreatedAt   time.Time    `db:"created_at"`
+}
+
+// outboxRow is a row of the job outbox, whose queue is NULL for the default queue on
+// Oracle. Its Queue shadows the one of OutboxJob.
+type outboxRow struct {
+	OutboxJob
+	Queue sql.NullString `db:"queue"`
+}
+
+// RelayJobs hands up to limit of the oldest jobs of the job outbox to publish and
+// deletes them, returning how many were relayed. The jobs are deleted in the same
+// transaction, so if publish fails they stay in the outbox and are relayed by a later
+// call. Since publish may succeed before the deletion commits, a job can be published
+// more than once and workers should be idempotent. Call RelayJobs periodically,
+// e.g. with the bridges of the contrib/asynqgotx module. On Postgres, MySQL and SQL
+// Server concurrent relays skip the jobs locked by each other.
+func (tm *TxManager) RelayJobs(ctx context.Context, limit int, publish func(ctx context.Context, jobs []OutboxJob) error) (int, error) {
+	var relayed int
+	err := tm.exec(ctx, getCaller(), func(tx *Transaction) error {
+		var b strings.Builder
+		b.WriteString("SELECT id, kind, queue, args, run_at, max_attempts, created_at FROM " + jobOutboxTable)
+		if tm.dialect == DialectSQLServer {
+			b.WriteString(" WITH (UPDLOCK, READPAST)")
+		}
+		b.WriteString(" ORDER BY id")
+		tx.writeLimit(&b, limit, 0, true)
+		if tm.dialect == DialectPostgres || tm.dialect == DialectMySQL {
+			b.WriteString(" FOR UPDATE SKIP LOCKED")
+		}
+
+		var rows []outboxRow
+		if err := tx.Select(&rows, b.String()); err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		jobs := make([]OutboxJob, len(rows))
+		for i, row := range rows {
+			jobs[i] = row.OutboxJob
+			jobs[i].Queue = row.Queue.String
+		}
+
+		if err := publish(tx.Context(), jobs); err != nil {
+			return err
+		}
+
+		ids := make([]int64, len(jobs))
+		for i, job := range jobs {
+			ids[i] = job.ID
+		}
+		query, args, err := sqlx.In("DELETE FROM "+jobOutboxTable+" WHERE id IN (?)", ids)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.exec(tx.tx.Rebind(query), args...); err != nil {
+			return err
+		}
+
+		relayed = len(jobs)
+		return nil
+	}, &Options{Propagation: PropagationNew})
+
+	if err != nil {
+		return 0, fmt.Errorf("gotx: relaying jobs failed: %w", err)
+	}
+	return relayed, nil
+}
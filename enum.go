@@ -0,0 +1,254 @@
+package gotx
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+)
+
+// ErrInvalidEnum is returned when a value of a registered enum type, or a column
+// scanned into one, is not one of the registered values.
+var ErrInvalidEnum = errors.New("gotx: invalid enum value")
+
+// EnumStorage tells how the values of an enum type are stored in their columns.
+type EnumStorage uint8
+
+const (
+	// EnumString stores the name of the value, e.g. in a VARCHAR or a Postgres enum
+	// column.
+	EnumString EnumStorage = iota
+
+	// EnumInt stores the integer value itself.
+	EnumInt
+)
+
+// EnumInteger is the constraint of the enum types, integer types with iota constants.
+type EnumInteger interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 | ~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+type enumType struct {
+	name    string
+	storage EnumStorage
+	names   map[int64]string
+	values  map[string]int64
+}
+
+var (
+	enumsMux sync.RWMutex
+	enums    map[reflect.Type]*enumType
+)
+
+// RegisterEnum registers the values of the enum type T with their names, so values of
+// T are validated and stored as storage says:
+//
+//	type Status int
+//
+//	const (
+//		StatusPending Status = iota
+//		StatusActive
+//		StatusClosed
+//	)
+//
+//	func init() {
+//		gotx.RegisterEnum(gotx.EnumString, map[Status]string{
+//			StatusPending: "pending",
+//			StatusActive:  "active",
+//			StatusClosed:  "closed",
+//		})
+//	}
+//
+// Arguments of type T or *T, including the struct fields bound by NamedExec, Insert
+// and Update, are checked against the registered values and replaced with their
+// names or integers before the statement is sent, and fail with ErrInvalidEnum if
+// they are not registered. Scanning needs a method on T, which EnumValue and ScanEnum
+// implement:
+//
+//	func (s Status) Value() (driver.Value, error) { return gotx.EnumValue(s) }
+//	func (s *Status) Scan(src interface{}) error  { return gotx.ScanEnum(s, src) }
+//
+// Enums are registered once per process, usually in an init function, and
+// registering T again replaces its values.
+func RegisterEnum[T EnumInteger](storage EnumStorage, names map[T]string) {
+	e := &enumType{
+		name:    reflect.TypeOf((*T)(nil)).Elem().String(),
+		storage: storage,
+		names:   make(map[int64]string, len(names)),
+		values:  make(map[string]int64, len(names)),
+	}
+	for v, name := range names {
+		if other, ok := e.values[name]; ok {
+			panic(fmt.Sprintf("gotx: enum %s has the name %q for %d and %d", e.name, name, other, int64(v)))
+		}
+		e.names[int64(v)] = name
+		e.values[name] = int64(v)
+	}
+
+	enumsMux.Lock()
+	defer enumsMux.Unlock()
+	if enums == nil {
+		enums = make(map[reflect.Type]*enumType)
+	}
+	enums[reflect.TypeOf((*T)(nil)).Elem()] = e
+}
+
+// lookupEnum returns the registration of enum type t, or nil.
+func lookupEnum(t reflect.Type) *enumType {
+	enumsMux.RLock()
+	defer enumsMux.RUnlock()
+	return enums[t]
+}
+
+func enumOf[T EnumInteger]() (*enumType, error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	e := lookupEnum(t)
+	if e == nil {
+		return nil, fmt.Errorf("gotx: enum %s is not registered", t)
+	}
+	return e, nil
+}
+
+// value returns the stored value of v.
+func (e *enumType) value(v int64) (driver.Value, error) {
+	name, ok := e.names[v]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d is not a %s", ErrInvalidEnum, v, e.name)
+	}
+	if e.storage == EnumInt {
+		return v, nil
+	}
+	return name, nil
+}
+
+// parse returns the value of the stored src.
+func (e *enumType) parse(src interface{}) (int64, error) {
+	var text string
+	switch s := src.(type) {
+	case int64:
+		if _, ok := e.names[s]; !ok {
+			return 0, fmt.Errorf("%w: %d is not a %s", ErrInvalidEnum, s, e.name)
+		}
+		return s, nil
+	case string:
+		text = s
+	case []byte:
+		text = string(s)
+	default:
+		return 0, fmt.Errorf("gotx: can not scan %T into %s", src, e.name)
+	}
+
+	if v, ok := e.values[text]; ok {
+		return v, nil
+	}
+	// integers stored in text columns
+	if v, err := strconv.ParseInt(text, 10, 64); err == nil && e.storage == EnumInt {
+		if _, ok := e.names[v]; ok {
+			return v, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q is not a %s", ErrInvalidEnum, text, e.name)
+}
+
+// EnumValue returns the stored value of v, a value of a registered enum type, for the
+// driver.Valuer implementation of the type. It fails with ErrInvalidEnum if v is not
+// registered.
+func EnumValue[T EnumInteger](v T) (driver.Value, error) {
+	e, err := enumOf[T]()
+	if err != nil {
+		return nil, err
+	}
+	return e.value(int64(v))
+}
+
+// ScanEnum scans the stored value src into dest, for the sql.Scanner implementation
+// of a registered enum type. Names and integers are accepted whatever the storage of
+// the type. NULL scans to the zero value. It fails with ErrInvalidEnum if src is not
+// a registered value.
+func ScanEnum[T EnumInteger](dest *T, src interface{}) error {
+	if src == nil {
+		*dest = 0
+		return nil
+	}
+	e, err := enumOf[T]()
+	if err != nil {
+		return err
+	}
+	v, err := e.parse(src)
+	if err != nil {
+		return err
+	}
+	*dest = T(v)
+	return nil
+}
+
+// ParseEnum returns the value of the registered enum type T named name, e.g. to
+// validate the input of an API.
+func ParseEnum[T EnumInteger](name string) (T, error) {
+	e, err := enumOf[T]()
+	if err != nil {
+		return 0, err
+	}
+	v, ok := e.values[name]
+	if !ok {
+		return 0, fmt.Errorf("%w: %q is not a %s", ErrInvalidEnum, name, e.name)
+	}
+	return T(v), nil
+}
+
+// bindEnumArgs replaces the arguments of registered enum types with their stored
+// values. Types implementing driver.Valuer convert themselves.
+func bindEnumArgs(args []interface{}) ([]interface{}, error) {
+	enumsMux.RLock()
+	registered := len(enums) > 0
+	enumsMux.RUnlock()
+	if !registered {
+		return args, nil
+	}
+
+	var bound []interface{}
+	for i, arg := range args {
+		v := reflect.ValueOf(arg)
+		if !v.IsValid() || v.Type().Implements(valuerType) {
+			continue
+		}
+		t := v.Type()
+		if t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		e := lookupEnum(t)
+		if e == nil {
+			continue
+		}
+
+		if bound == nil {
+			bound = append([]interface{}{}, args...)
+		}
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				bound[i] = nil
+				continue
+			}
+			v = v.Elem()
+		}
+
+		var n int64
+		if v.CanInt() {
+			n = v.Int()
+		} else {
+			n = int64(v.Uint())
+		}
+		value, err := e.value(n)
+		if err != nil {
+			return nil, err
+		}
+		bound[i] = value
+	}
+
+	if bound == nil {
+		return args, nil
+	}
+	return bound, nil
+}
@@ -0,0 +1,187 @@
+package gotx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+)
+
+// Portable error kinds translated from driver specific errors. Use errors.Is to test
+// an error returned by gotx against them, or errors.As with *DBError to get details
+// such as the violated constraint.
+var (
+	ErrUniqueViolation      = errors.New("gotx: unique violation")
+	ErrForeignKeyViolation  = errors.New("gotx: foreign key violation")
+	ErrCheckViolation       = errors.New("gotx: check violation")
+	ErrNotNullViolation     = errors.New("gotx: not null violation")
+	ErrSerializationFailure = errors.New("gotx: serialization failure")
+	ErrDeadlock             = errors.New("gotx: deadlock detected")
+	ErrLockTimeout          = errors.New("gotx: lock wait timeout")
+)
+
+// DBError is a driver error translated to one of the portable error kinds.
+type DBError struct {
+	// Kind is one of the Err* error kinds of this package.
+	Kind error
+	// Constraint is the name of the violated constraint, if the driver reports it.
+	Constraint string
+	// Err is the original driver error.
+	Err error
+}
+
+func (e *DBError) Error() string {
+	if e.Constraint != "" {
+		return fmt.Sprintf("%s (constraint %s): %s", e.Kind, e.Constraint, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Kind, e.Err)
+}
+
+// Is reports whether target is the kind of e.
+func (e *DBError) Is(target error) bool {
+	return e.Kind == target
+}
+
+func (e *DBError) Unwrap() error {
+	return e.Err
+}
+
+// IsUniqueViolation reports whether err is caused by a unique constraint violation.
+func IsUniqueViolation(err error) bool {
+	return errors.Is(Translate(err), ErrUniqueViolation)
+}
+
+// IsForeignKeyViolation reports whether err is caused by a foreign key violation.
+func IsForeignKeyViolation(err error) bool {
+	return errors.Is(Translate(err), ErrForeignKeyViolation)
+}
+
+// IsCheckViolation reports whether err is caused by a check constraint violation.
+func IsCheckViolation(err error) bool {
+	return errors.Is(Translate(err), ErrCheckViolation)
+}
+
+// IsSerializationFailure reports whether err is caused by a serialization failure.
+func IsSerializationFailure(err error) bool {
+	return errors.Is(Translate(err), ErrSerializationFailure)
+}
+
+// ConstraintName returns the name of the constraint violated by err, or an empty
+// string if it is unknown.
+func ConstraintName(err error) string {
+	var dbErr *DBError
+	if errors.As(Translate(err), &dbErr) {
+		return dbErr.Constraint
+	}
+	return ""
+}
+
+// postgres SQLSTATE codes
+var pgErrorKinds = map[string]error{
+	"23505": ErrUniqueViolation,
+	"23503": ErrForeignKeyViolation,
+	"23514": ErrCheckViolation,
+	"23502": ErrNotNullViolation,
+	"40001": ErrSerializationFailure,
+	"40P01": ErrDeadlock,
+	"55P03": ErrLockTimeout,
+}
+
+// mysql error numbers
+var mysqlErrorKinds = map[uint64]error{
+	1062: ErrUniqueViolation,
+	1216: ErrForeignKeyViolation,
+	1217: ErrForeignKeyViolation,
+	1451: ErrForeignKeyViolation,
+	1452: ErrForeignKeyViolation,
+	3819: ErrCheckViolation,
+	1048: ErrNotNullViolation,
+	1364: ErrNotNullViolation,
+	1213: ErrDeadlock,
+	1205: ErrLockTimeout,
+}
+
+var mysqlConstraintPatterns = []*regexp.Regexp{
+	regexp.MustCompile("for key '([^']+)'"),
+	regexp.MustCompile("CONSTRAINT `([^`]+)`"),
+	regexp.MustCompile("constraint '([^']+)'"),
+}
+
+// Translate converts a Postgres (lib/pq, pgx) or MySQL driver error into a *DBError of
+// a portable kind. Errors which are already translated or unknown to gotx are returned
+// unchanged. Statement and commit errors returned by gotx are translated already.
+func Translate(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var dbErr *DBError
+	if errors.As(err, &dbErr) {
+		return err
+	}
+
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		// both lib/pq and pgx expose the SQLSTATE of an error this way
+		if pgErr, ok := e.(interface{ SQLState() string }); ok {
+			if kind, ok := pgErrorKinds[pgErr.SQLState()]; ok {
+				return &DBError{Kind: kind, Constraint: stringField(e, "Constraint", "ConstraintName"), Err: err}
+			}
+			return err
+		}
+
+		// go-sql-driver/mysql: *MySQLError{Number uint16, Message string}
+		if number, ok := uintField(e, "Number"); ok {
+			if kind, ok := mysqlErrorKinds[number]; ok {
+				return &DBError{Kind: kind, Constraint: mysqlConstraint(stringField(e, "Message")), Err: err}
+			}
+			return err
+		}
+	}
+
+	return err
+}
+
+func mysqlConstraint(msg string) string {
+	for _, re := range mysqlConstraintPatterns {
+		if m := re.FindStringSubmatch(msg); m != nil {
+			return m[1]
+		}
+	}
+	return ""
+}
+
+// structField returns the named field of the struct err points to.
+func structField(err error, name string) (reflect.Value, bool) {
+	v := reflect.ValueOf(err)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+
+	f := v.FieldByName(name)
+	return f, f.IsValid()
+}
+
+func stringField(err error, names ...string) string {
+	for _, name := range names {
+		if f, ok := structField(err, name); ok && f.Kind() == reflect.String {
+			return f.String()
+		}
+	}
+	return ""
+}
+
+func uintField(err error, name string) (uint64, bool) {
+	f, ok := structField(err, name)
+	if !ok {
+		return 0, false
+	}
+
+	switch f.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return f.Uint(), true
+	}
+	return 0, false
+}
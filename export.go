@@ -0,0 +1,178 @@
+package gotx
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ExportFormat is the output format of Transaction.Export.
+type ExportFormat string
+
+const (
+	// ExportCSV writes a header line with the column names followed by one line per
+	// row. NULL is written as an empty field, and nothing is written for an empty
+	// result.
+	ExportCSV ExportFormat = "csv"
+
+	// ExportNDJSON writes one JSON object per line and row, keyed by column name in
+	// the order of the columns.
+	ExportNDJSON ExportFormat = "ndjson"
+)
+
+// Redactor replaces the value of a column read by Transaction.Export, e.g. to hide
+// personal data in admin exports. It returns value unchanged for columns it does not
+// redact.
+type Redactor func(ctx context.Context, column string, value interface{}) interface{}
+
+// WithRedactor sets the redactor applied to the values of exported columns.
+func WithRedactor(r Redactor) ManagerOption {
+	return func(tm *TxManager) {
+		tm.redactor = r
+	}
+}
+
+// RedactColumns returns a Redactor replacing the non-NULL values of the given columns
+// with "[REDACTED]". Column names are compared case insensitively.
+func RedactColumns(columns ...string) Redactor {
+	redacted := tableSet(columns)
+	return func(ctx context.Context, column string, value interface{}) interface{} {
+		if value != nil && redacted[strings.ToLower(column)] {
+			return "[REDACTED]"
+		}
+		return value
+	}
+}
+
+// Export runs query and streams its rows to w in format, one row at a time, so large
+// result sets are exported with bounded memory while reading a consistent snapshot of
+// the transaction. Options.MaxRows applies as for Select, and values are passed
+// through the redactor of the manager:
+//
+//	w.Header().Set("Content-Type", "text/csv")
+//	err := tx.Export(w, gotx.ExportCSV, "SELECT id, email, created_at FROM account")
+func (t *Transaction) Export(w io.Writer, format ExportFormat, query string, args ...interface{}) error {
+	if err := t.checkState(); err != nil {
+		return err
+	}
+
+	var write func(columns []string, values []interface{}) error
+	buf := bufio.NewWriter(w)
+	flush := buf.Flush
+	switch format {
+	case ExportCSV:
+		cw := csv.NewWriter(buf)
+		flush = func() error {
+			cw.Flush()
+			if err := cw.Error(); err != nil {
+				return err
+			}
+			return buf.Flush()
+		}
+		header := false
+		write = func(columns []string, values []interface{}) error {
+			if !header {
+				header = true
+				if err := cw.Write(columns); err != nil {
+					return err
+				}
+			}
+			record := make([]string, len(values))
+			for i, v := range values {
+				record[i] = csvField(v)
+			}
+			return cw.Write(record)
+		}
+	case ExportNDJSON:
+		write = func(columns []string, values []interface{}) error {
+			return writeJSONRow(buf, columns, values)
+		}
+	default:
+		return fmt.Errorf("gotx: unknown export format %q", format)
+	}
+
+	var masks map[string]Mask
+	if m := t.txManager.masking; m != nil {
+		masks = m.masks(t.ctx)
+	}
+
+	var columns []string
+	err := t.run(&Statement{Kind: StatementQuery, Query: query, Args: args, masked: true, EachRow: func(rows *sqlx.Rows) error {
+		if columns == nil {
+			var err error
+			if columns, err = rows.Columns(); err != nil {
+				return err
+			}
+		}
+
+		values, err := rows.SliceScan()
+		if err != nil {
+			return err
+		}
+		for i, v := range values {
+			if b, ok := v.([]byte); ok && utf8.Valid(b) {
+				v = string(b)
+			}
+			if t.txManager.redactor != nil {
+				v = t.txManager.redactor(t.ctx, columns[i], v)
+			}
+			if mask := masks[strings.ToLower(columns[i])]; mask != nil && v != nil {
+				v = mask(v)
+			}
+			values[i] = v
+		}
+		return write(columns, values)
+	}})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+func csvField(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func writeJSONRow(w *bufio.Writer, columns []string, values []interface{}) error {
+	w.WriteByte('{')
+	for i, column := range columns {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		key, err := json.Marshal(column)
+		if err != nil {
+			return err
+		}
+		value, err := json.Marshal(values[i])
+		if err != nil {
+			return err
+		}
+		w.Write(key)
+		w.WriteByte(':')
+		w.Write(value)
+	}
+	w.WriteByte('}')
+	return w.WriteByte('\n')
+}
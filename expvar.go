@@ -0,0 +1,34 @@
+package gotx
+
+import (
+	"expvar"
+	"log"
+)
+
+// WithExpvar publishes the counters of the manager with expvar, under names starting
+// with prefix: prefix.active, prefix.committed, prefix.rolled_back, prefix.retried and
+// prefix.avg_duration_ms. They are served on /debug/vars along with the other expvar
+// variables. The prefix must be unique per manager; names which are published already
+// are left alone.
+func WithExpvar(prefix string) ManagerOption {
+	return func(tm *TxManager) {
+		vars := map[string]func(s Stats) interface{}{
+			"active":          func(s Stats) interface{} { return s.Active },
+			"committed":       func(s Stats) interface{} { return s.Committed },
+			"rolled_back":     func(s Stats) interface{} { return s.RolledBack },
+			"retried":         func(s Stats) interface{} { return s.Retried },
+			"avg_duration_ms": func(s Stats) interface{} { return float64(s.AvgDuration().Microseconds()) / 1000 },
+		}
+
+		for name, value := range vars {
+			name, value := prefix+"."+name, value
+			if expvar.Get(name) != nil {
+				log.Printf("gotx: expvar %s is published already", name)
+				continue
+			}
+			expvar.Publish(name, expvar.Func(func() interface{} {
+				return value(tm.Stats())
+			}))
+		}
+	}
+}
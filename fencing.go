@@ -0,0 +1,148 @@
+package gotx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// fencingTable is the table storing the last fencing token issued per name.
+const fencingTable = "gotx_fencing_tokens"
+
+// ErrStaleFencingToken is returned by the commit of a transaction fenced with a token
+// which is no longer the latest one, because another process took over the lock.
+var ErrStaleFencingToken = errors.New("gotx: stale fencing token")
+
+// CreateFencingTable creates the table storing the fencing tokens of NextFencingToken
+// if it does not exist. Call it at startup, or create the table with a migration using
+// the same columns.
+func (tm *TxManager) CreateFencingTable(ctx context.Context) error {
+	var ddl string
+	switch tm.dialect {
+	case DialectSQLServer:
+		ddl = "IF OBJECT_ID('" + fencingTable + "') IS NULL CREATE TABLE " + fencingTable +
+			" (name NVARCHAR(255) PRIMARY KEY, token BIGINT NOT NULL)"
+	case DialectOracle:
+		ddl = oracleCreateIfNotExists("CREATE TABLE " + fencingTable +
+			" (name VARCHAR2(255) PRIMARY KEY, token NUMBER(19) NOT NULL)")
+	default:
+		ddl = "CREATE TABLE IF NOT EXISTS " + fencingTable +
+			" (name VARCHAR(255) PRIMARY KEY, token BIGINT NOT NULL)"
+	}
+
+	_, err := tm.db.ExecContext(ctx, ddl)
+	return Translate(err)
+}
+
+// NextFencingToken issues the next fencing token of name, which is greater than all
+// tokens issued for name before. Call it after acquiring a lock or leadership and pass
+// the token to the transactions writing as the holder with Options.WithFencingToken:
+// once a new holder got a token, writes fenced with older tokens fail. The token is
+// committed in its own db transaction, even if ctx carries a transaction.
+func (tm *TxManager) NextFencingToken(ctx context.Context, name string) (int64, error) {
+	var token int64
+	issue := func(tx *Transaction) error {
+		p1, p2 := tm.Placeholder(1), tm.Placeholder(2)
+		result, err := tx.exec("UPDATE "+fencingTable+" SET token = token + 1 WHERE name = "+p1, name)
+		if err != nil {
+			return err
+		}
+
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			if _, err := tx.exec("INSERT INTO "+fencingTable+" (name, token) VALUES ("+p1+", "+p2+")", name, 1); err != nil {
+				return err
+			}
+		}
+
+		return tx.GetOne(&token, "SELECT token FROM "+fencingTable+" WHERE name = "+p1, name)
+	}
+
+	caller := getCaller()
+	err := tm.exec(ctx, caller, issue, &Options{Propagation: PropagationNew})
+	if errors.Is(err, ErrUniqueViolation) {
+		// a concurrent call issued the first token of name, so the row exists now
+		err = tm.exec(ctx, caller, issue, &Options{Propagation: PropagationNew})
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("gotx: issuing fencing token of %s failed: %w", name, err)
+	}
+	return token, nil
+}
+
+// AcquireFenced acquires the lock name of lock and issues its next fencing token. The
+// lock is released again if no token could be issued.
+func (tm *TxManager) AcquireFenced(ctx context.Context, lock Lock, name string) (int64, error) {
+	if err := lock.Acquire(ctx, name); err != nil {
+		return 0, err
+	}
+
+	token, err := tm.NextFencingToken(ctx, name)
+	if err != nil {
+		if relErr := lock.Release(context.Background(), name); relErr != nil {
+			return 0, fmt.Errorf("%w (releasing the lock failed: %v)", err, relErr)
+		}
+		return 0, err
+	}
+	return token, nil
+}
+
+// addFence makes the db tx check the fencing token of name before it commits.
+func (t *rawTx) addFence(name string, token int64) {
+	t.valuesMux.Lock()
+	defer t.valuesMux.Unlock()
+
+	if t.fences == nil {
+		t.fences = make(map[string]int64)
+	}
+	t.fences[name] = token
+}
+
+// checkFences verifies that the fencing tokens of the db tx of t are still the latest
+// ones. The check locks the token row until the tx ends, so a new holder can not take
+// over between the check and the commit. It is a write predicated on the token, except
+// on MySQL which reports changed rather than matched rows and selects FOR UPDATE.
+func (t *Transaction) checkFences() error {
+	t.tx.valuesMux.Lock()
+	names := make([]string, 0, len(t.tx.fences))
+	for name := range t.tx.fences {
+		names = append(names, name)
+	}
+	fences := t.tx.fences
+	t.tx.valuesMux.Unlock()
+
+	// a fixed order avoids deadlocks between transactions checking the same tokens
+	sort.Strings(names)
+	for _, name := range names {
+		if t.txManager.dialect == DialectMySQL {
+			var latest int64
+			if err := t.GetOne(&latest, "SELECT token FROM "+fencingTable+" WHERE name = ? FOR UPDATE", name); err != nil {
+				return err
+			}
+			if latest != fences[name] {
+				return fmt.Errorf("%w: %d of %s", ErrStaleFencingToken, fences[name], name)
+			}
+			continue
+		}
+
+		p1, p2 := t.txManager.Placeholder(1), t.txManager.Placeholder(2)
+		result, err := t.exec("UPDATE "+fencingTable+" SET token = token WHERE name = "+p1+" AND token = "+p2,
+			name, fences[name])
+		if err != nil {
+			return err
+		}
+
+		n, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("%w: %d of %s", ErrStaleFencingToken, fences[name], name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,204 @@
+package gotx
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SelectKeyed runs a query and returns its rows in a map keyed by the value of
+// keyColumn, the common lookup table pattern. When V is a struct each row is scanned
+// into a V and the key is read from the field mapped to keyColumn. Otherwise the query
+// must return exactly two columns, the key followed by the value. Later rows replace
+// earlier rows with the same key.
+//
+//	accounts, err := gotx.SelectKeyed[int64, Account](tx, "id", "SELECT * FROM account")
+func SelectKeyed[K comparable, V any](tx *Transaction, keyColumn string, query string, args ...interface{}) (map[K]V, error) {
+	result := make(map[K]V)
+
+	valueType := reflect.TypeOf((*V)(nil)).Elem()
+	structType := valueType
+	if structType.Kind() == reflect.Ptr {
+		structType = structType.Elem()
+	}
+
+	if isScannable(structType) {
+		err := tx.ForEach(query, func(rows *sqlx.Rows) error {
+			var key K
+			var value V
+			if err := rows.Scan(&key, &value); err != nil {
+				return err
+			}
+			result[key] = value
+			return nil
+		}, args...)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	fi, ok := tx.tx.Mapper.TypeMap(structType).Names[keyColumn]
+	if !ok {
+		return nil, fmt.Errorf("gotx: key column %s not found in %s", keyColumn, structType)
+	}
+
+	keyType := reflect.TypeOf((*K)(nil)).Elem()
+	err := tx.ForEach(query, func(rows *sqlx.Rows) error {
+		vp := reflect.New(structType)
+		if err := rows.StructScan(vp.Interface()); err != nil {
+			return err
+		}
+
+		field := vp.Elem().FieldByIndex(fi.Index)
+		if !field.Type().ConvertibleTo(keyType) {
+			return fmt.Errorf("gotx: key column %s of type %s is not convertible to %s", keyColumn, field.Type(), keyType)
+		}
+		key := field.Convert(keyType).Interface().(K)
+
+		if valueType.Kind() == reflect.Ptr {
+			result[key] = vp.Interface().(V)
+		} else {
+			result[key] = vp.Elem().Interface().(V)
+		}
+		return nil
+	}, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// streamBufferSize is the number of rows Stream scans ahead of the consumer.
+const streamBufferSize = 64
+
+// Stream runs a query and sends its rows, scanned into values of type T, on the
+// returned channel so consumers can pipeline the processing of large result sets. The
+// query runs in the goroutine of the transaction, the rows are then scanned by a new
+// goroutine keeping at most a small, fixed number of rows ahead of the consumer. As for
+// Select, Options.MaxRows applies and the rows are decrypted and masked.
+//
+// The row channel is closed when the result set is exhausted or reading it fails; the
+// error channel then yields the error, if any, and is closed. Streaming stops when the
+// context of the transaction is done, and at the latest when the db transaction ends.
+// Consumers must not run other statements on tx until the row channel is closed.
+func Stream[T any](tx *Transaction, query string, args ...interface{}) (<-chan T, <-chan error) {
+	rowc := make(chan T, streamBufferSize)
+	errc := make(chan error, 1)
+
+	fail := func(err error) (<-chan T, <-chan error) {
+		errc <- err
+		close(errc)
+		close(rowc)
+		return rowc, errc
+	}
+	if err := tx.checkState(); err != nil {
+		return fail(err)
+	}
+	stmt := &Statement{Kind: StatementMultiQuery, Query: query, Args: args, masked: true}
+	if err := tx.run(stmt); err != nil {
+		return fail(fmt.Errorf("query failed: %w", err))
+	}
+
+	baseType := reflect.TypeOf((*T)(nil)).Elem()
+	isPtr := baseType.Kind() == reflect.Ptr
+	if isPtr {
+		baseType = baseType.Elem()
+	}
+	scannable := isScannable(baseType)
+	rows, ctx := stmt.Rows, tx.ctx
+	limit, policy := tx.opts.MaxRows, tx.opts.MaxRowsPolicy
+
+	stop, done := make(chan struct{}), make(chan struct{})
+	tx.tx.addStream(func() {
+		close(stop)
+		rows.Close()
+		<-done
+	})
+
+	next := func() (T, error) {
+		var value T
+		vp := reflect.New(baseType)
+
+		var err error
+		if scannable {
+			err = rows.Scan(vp.Interface())
+		} else {
+			err = rows.StructScan(vp.Interface())
+		}
+		if err != nil {
+			return value, err
+		}
+		if err := tx.Decrypt(vp.Interface()); err != nil {
+			return value, err
+		}
+		tx.mask(vp.Interface(), query)
+
+		if isPtr {
+			value = vp.Interface().(T)
+		} else {
+			value = vp.Elem().Interface().(T)
+		}
+		return value, nil
+	}
+
+	go func() {
+		defer close(done)
+		defer close(errc)
+		defer close(rowc)
+		defer rows.Close()
+
+		err := func() error {
+			for count := 0; rows.Next(); count++ {
+				if limit > 0 && count == limit {
+					if policy == RowLimitTruncate {
+						return nil
+					}
+					return ErrTooManyRows
+				}
+
+				value, err := next()
+				if err != nil {
+					return err
+				}
+
+				select {
+				case rowc <- value:
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-stop:
+					return ErrInvalidTxState
+				}
+			}
+			return Translate(rows.Err())
+		}()
+
+		if err != nil {
+			errc <- err
+		}
+	}()
+
+	return rowc, errc
+}
+
+// addStream registers the function stopping a stream reading rows of the db tx.
+func (t *rawTx) addStream(stop func()) {
+	t.valuesMux.Lock()
+	t.streams = append(t.streams, stop)
+	t.valuesMux.Unlock()
+}
+
+// closeStreams stops the streams reading rows of the db tx and waits for them, so the
+// connection is free again. It must run before the db tx ends.
+func (t *rawTx) closeStreams() {
+	t.valuesMux.Lock()
+	streams := t.streams
+	t.streams = nil
+	t.valuesMux.Unlock()
+
+	for _, stop := range streams {
+		stop()
+	}
+}
@@ -0,0 +1,84 @@
+package gotx
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// GetOrInsert loads the row selected by selectQuery into dest, inserting it with
+// insertQuery first if it does not exist. Both queries are named queries bound to arg.
+// It returns true if the row was inserted by this call.
+//
+// When a concurrent transaction inserts the same row between the select and the
+// insert, the unique violation is caught and the row is selected again. The insert
+// runs under a savepoint so the failure does not abort the whole transaction on
+// Postgres, and the second select is a locking read so it sees the row committed by
+// the other transaction even under MySQL's REPEATABLE READ snapshot.
+//
+//	var account Account
+//	created, err := tx.GetOrInsert(&account,
+//		"SELECT * FROM account WHERE name = :name",
+//		"INSERT INTO account (name) VALUES (:name)",
+//		map[string]interface{}{"name": "alice"})
+func (t *Transaction) GetOrInsert(dest interface{}, selectQuery string, insertQuery string, arg interface{}) (bool, error) {
+	if err := t.checkState(); err != nil {
+		return false, err
+	}
+
+	query, args, err := t.tx.BindNamed(selectQuery, arg)
+	if err != nil {
+		return false, err
+	}
+
+	err = t.GetOne(dest, query, args...)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+
+	insertQuery, insertArgs, err := t.tx.BindNamed(insertQuery, arg)
+	if err != nil {
+		return false, err
+	}
+
+	savepoint := "gotx_get_or_insert"
+	if err := t.savepoint(savepoint); err != nil {
+		return false, err
+	}
+
+	_, err = t.exec(insertQuery, insertArgs...)
+	if err == nil {
+		if err := t.releaseSavepoint(savepoint); err != nil {
+			return false, err
+		}
+		if err := t.GetOne(dest, query, args...); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	if !errors.Is(err, ErrUniqueViolation) {
+		return false, fmt.Errorf("insert failed: %w", err)
+	}
+
+	// lost the race against a concurrent insert, load the winner's row
+	if err := t.rollbackToSavepoint(savepoint); err != nil {
+		return false, err
+	}
+
+	switch t.txManager.dialect {
+	case DialectMySQL:
+		query += " LOCK IN SHARE MODE"
+	case DialectPostgres:
+		query += " FOR SHARE"
+	}
+
+	if err := t.GetOne(dest, query, args...); err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
@@ -0,0 +1,208 @@
+package gotx
+
+import (
+	"context"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WithGroupCommit enables group commit for transactions started with
+// Options.GroupCommit. Instead of committing its own db transaction, such a
+// transaction is queued for up to window, or until maxBatch transactions are queued,
+// and the queued transactions then run one after another in a shared db transaction
+// which is committed once. Every transaction runs within its own savepoint, so one
+// failing is rolled back to its savepoint and returns its error while the others
+// commit. If the shared commit fails, all of them return its error.
+//
+// This trades latency for throughput of many small independent writes, which
+// otherwise each wait for the database to flush its commit to disk. Grouped
+// transactions run in a goroutine of the manager rather than in the caller's, share
+// locks and isolation with the other members of their group, and must not depend on
+// being committed on their own.
+func WithGroupCommit(window time.Duration, maxBatch int) ManagerOption {
+	return func(tm *TxManager) {
+		tm.groups = &groupCommitter{tm: tm, window: window, maxBatch: maxBatch}
+	}
+}
+
+// groupCommitter collects grouped transactions and runs them in shared db transactions.
+type groupCommitter struct {
+	tm       *TxManager
+	window   time.Duration
+	maxBatch int
+
+	mux     sync.Mutex
+	pending []*groupMember
+	timer   Timer
+	// stop ends the goroutine waiting for timer
+	stop chan struct{}
+}
+
+// groupMember is a queued transaction.
+type groupMember struct {
+	ctx    context.Context
+	txFunc func(tx *Transaction) error
+	opt    *Options
+	done   chan error
+}
+
+// execGrouped runs txFunc in a group commit, bounded by opt.Timeout.
+func (tm *TxManager) execGrouped(ctx context.Context, txFunc func(tx *Transaction) error, opt *Options) error {
+	if opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = tm.withTimeout(ctx, opt.Timeout)
+		defer cancel()
+	}
+
+	return tm.groups.submit(ctx, txFunc, opt)
+}
+
+// submit queues txFunc and waits until its group committed.
+func (g *groupCommitter) submit(ctx context.Context, txFunc func(tx *Transaction) error, opt *Options) error {
+	// the member joins the shared db tx
+	memberOpt := *opt
+	memberOpt.Propagation = PropagationRequired
+	m := &groupMember{ctx: ctx, txFunc: txFunc, opt: &memberOpt, done: make(chan error, 1)}
+
+	g.mux.Lock()
+	g.pending = append(g.pending, m)
+	switch {
+	case len(g.pending) >= g.maxBatch && g.maxBatch > 0:
+		batch := g.take()
+		go g.flush(batch)
+	case len(g.pending) == 1:
+		timer, stop := g.tm.clock.NewTimer(g.window), make(chan struct{})
+		g.timer, g.stop = timer, stop
+		go func() {
+			select {
+			case <-timer.C():
+			case <-stop:
+				return
+			}
+
+			g.mux.Lock()
+			if g.stop != stop {
+				// the batch was taken meanwhile
+				g.mux.Unlock()
+				return
+			}
+			batch := g.take()
+			g.mux.Unlock()
+			g.flush(batch)
+		}()
+	}
+	g.mux.Unlock()
+
+	// the member may be running already, so its outcome is awaited even if ctx is done
+	return <-m.done
+}
+
+// take removes the pending members. It must be called with g.mux held.
+func (g *groupCommitter) take() []*groupMember {
+	if g.timer != nil {
+		g.timer.Stop()
+		close(g.stop)
+		g.timer, g.stop = nil, nil
+	}
+
+	batch := g.pending
+	g.pending = nil
+	return batch
+}
+
+// flush runs the members of batch in a shared db transaction and reports their
+// outcomes.
+func (g *groupCommitter) flush(batch []*groupMember) {
+	if len(batch) == 0 {
+		return
+	}
+
+	goid := curGoroutineID()
+	leader, err := g.tm.startTx(context.Background(), goid, &Options{Propagation: PropagationNew})
+	if err != nil {
+		for _, m := range batch {
+			m.done <- err
+		}
+		return
+	}
+
+	errs := make([]error, len(batch))
+	for i, m := range batch {
+		if errs[i] = m.ctx.Err(); errs[i] != nil {
+			continue
+		}
+
+		errs[i], err = g.run(leader, goid, m, "gotx_group_"+strconv.Itoa(i))
+		if err != nil {
+			// the shared db tx is unusable
+			break
+		}
+	}
+
+	if err != nil {
+		err = g.tm.rollbackError(leader.RootID(), err, leader.Rollback())
+	} else {
+		err = leader.Commit()
+	}
+	g.tm.finishTx(leader, err)
+
+	for i, m := range batch {
+		if errs[i] != nil {
+			m.done <- errs[i]
+		} else {
+			m.done <- err
+		}
+	}
+}
+
+// run runs member m within savepoint in the db tx of leader. It returns the error of
+// the member, and an error if the db tx can not be used anymore.
+func (g *groupCommitter) run(leader *Transaction, goid uint64, m *groupMember, savepoint string) (memberErr, err error) {
+	if err := leader.savepoint(savepoint); err != nil {
+		return err, err
+	}
+
+	leader.tx.valuesMux.Lock()
+	changes := len(leader.tx.changes)
+	leader.tx.valuesMux.Unlock()
+
+	trans, err := g.tm.startTx(m.ctx, goid, m.opt)
+	if err != nil {
+		return err, err
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				trans.setError(&PanicError{Value: r, Stack: debug.Stack()})
+			}
+		}()
+		trans.execTxFunc(m.txFunc)
+	}()
+
+	if trans.err == nil {
+		if err := leader.releaseSavepoint(savepoint); err != nil {
+			return err, err
+		}
+		err := trans.Commit()
+		g.tm.finishTx(trans, err)
+		return err, nil
+	}
+
+	// undo the member without ending the shared db tx, including its recorded changes
+	g.tm.detach(trans)
+	atomic.AddUint32(&trans.tx.refCount, ^uint32(0))
+	trans.committed = true
+	g.tm.finishTx(trans, trans.err)
+	if err := leader.rollbackToSavepoint(savepoint); err != nil {
+		return trans.err, err
+	}
+
+	leader.tx.valuesMux.Lock()
+	leader.tx.changes = leader.tx.changes[:changes]
+	leader.tx.valuesMux.Unlock()
+	return trans.err, nil
+}
@@ -0,0 +1,163 @@
+package gotx
+
+import (
+	"context"
+)
+
+// Hooks are callbacks invoked at the lifecycle points of db transactions. All fields
+// are optional. When several Hooks are registered they run in registration order.
+type Hooks struct {
+	// BeforeBegin is called before a db transaction is started. Returning an error
+	// aborts the Exec call with that error.
+	BeforeBegin func(ctx context.Context, opts *Options) error
+
+	// AfterBegin is called right after a db transaction is started. Returning an error
+	// rolls the db transaction back and aborts the Exec call.
+	AfterBegin func(tx *Transaction) error
+
+	// BeforeCommit is called before the db transaction is committed. Returning an error
+	// rolls the db transaction back instead and Commit returns the error.
+	BeforeCommit func(tx *Transaction) error
+
+	// AfterCommit is called after the db transaction is committed successfully.
+	AfterCommit func(tx *Transaction)
+
+	// AfterRollback is called after the db transaction is rolled back, including when
+	// committing it failed, e.g. with a serialization failure or a deferred constraint
+	// violation, and the database rolled it back.
+	AfterRollback func(tx *Transaction)
+
+	// OnLeak is called in strict mode when a transaction is used after its Exec call
+	// returned.
+	OnLeak func(report *LeakReport)
+
+	// OnIdle is called when no statement ran in a db transaction for longer than its
+	// idle limit, see WithIdleLimit.
+	OnIdle func(report *IdleReport)
+
+	// OnRetry is called when a transaction failed with a retryable error and is about
+	// to be run again, before the backoff delay.
+	OnRetry func(event *RetryEvent)
+
+	// AfterExec is called when an Exec call returns, with its summary.
+	AfterExec func(summary *ExecSummary)
+
+	// OnSweep is called when the sweeper of WithTxSweeper rolled back a db
+	// transaction.
+	OnSweep func(report *SweepReport)
+}
+
+// WithHooks registers lifecycle hooks on the manager.
+func WithHooks(hooks Hooks) ManagerOption {
+	return func(tm *TxManager) {
+		tm.hooks = append(tm.hooks, hooks)
+	}
+}
+
+func (tm *TxManager) beforeBegin(ctx context.Context, opts *Options) error {
+	for _, h := range tm.hooks {
+		if h.BeforeBegin != nil {
+			if err := h.BeforeBegin(ctx, opts); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (tm *TxManager) afterBegin(tx *Transaction) error {
+	for _, h := range tm.hooks {
+		if h.AfterBegin != nil {
+			if err := h.AfterBegin(tx); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (tm *TxManager) beforeCommit(tx *Transaction) error {
+	for _, h := range tm.hooks {
+		if h.BeforeCommit != nil {
+			if err := h.BeforeCommit(tx); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (tm *TxManager) afterCommit(tx *Transaction) {
+	for _, h := range tm.hooks {
+		if h.AfterCommit != nil {
+			h.AfterCommit(tx)
+		}
+	}
+}
+
+func (tm *TxManager) afterRollback(tx *Transaction) {
+	for _, h := range tm.hooks {
+		if h.AfterRollback != nil {
+			h.AfterRollback(tx)
+		}
+	}
+}
+
+func (tm *TxManager) onRetry(event *RetryEvent) {
+	for _, h := range tm.hooks {
+		if h.OnRetry != nil {
+			h.OnRetry(event)
+		}
+	}
+}
+
+func (tm *TxManager) afterExec(summary *ExecSummary) {
+	for _, h := range tm.hooks {
+		if h.AfterExec != nil {
+			h.AfterExec(summary)
+		}
+	}
+}
+
+// commitRaw commits the db transaction of tx, or rolls it back when a BeforeCommit
+// hook fails. A failed commit calls the AfterRollback hooks.
+func (tm *TxManager) commitRaw(tx *Transaction) error {
+	defer tx.tx.clearValues()
+	defer tm.leaks.untrack(tx.tx)
+	defer tx.tx.releaseConn()
+
+	err := tm.beforeCommit(tx)
+	if err == nil {
+		err = tx.checkDoomed()
+	}
+	if err == nil {
+		err = tx.checkInvariants()
+	}
+	if err == nil {
+		err = tx.checkFences()
+	}
+	if err != nil {
+		tx.tx.cleanup()
+		err = tm.rollbackError(tx.RootID(), err, tx.tx.Rollback())
+		tm.afterRollback(tx)
+		return err
+	}
+
+	tx.tx.valuesMux.Lock()
+	changes := tx.tx.changes
+	tx.tx.valuesMux.Unlock()
+
+	tx.tx.cleanup()
+	if err := tx.tx.Commit(); err != nil {
+		// the database rolled the transaction back
+		tm.afterRollback(tx)
+		return Translate(err)
+	}
+
+	tm.afterCommit(tx)
+	tm.deliverChanges(tx, changes)
+	return nil
+}
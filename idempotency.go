@@ -0,0 +1,91 @@
+package gotx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// idempotencyTable is the table recording idempotency keys and results.
+const idempotencyTable = "gotx_idempotency_keys"
+
+// ErrIdempotencyConflict is returned when a concurrent transaction recorded the same
+// idempotency key first. Calling Exec again replays the recorded result.
+var ErrIdempotencyConflict = errors.New("gotx: idempotency key recorded by a concurrent transaction")
+
+// CreateIdempotencyTable creates the table recording the idempotency keys of
+// Options.IdempotencyKey if it does not exist. Call it at startup, or create the table
+// with a migration using the same columns.
+func (tm *TxManager) CreateIdempotencyTable(ctx context.Context) error {
+	var ddl string
+	switch tm.dialect {
+	case DialectSQLServer:
+		ddl = "IF OBJECT_ID('" + idempotencyTable + "') IS NULL CREATE TABLE " + idempotencyTable +
+			" (idempotency_key NVARCHAR(255) PRIMARY KEY, result NVARCHAR(MAX), created_at DATETIME2 NOT NULL)"
+	case DialectOracle:
+		ddl = oracleCreateIfNotExists("CREATE TABLE " + idempotencyTable +
+			" (idempotency_key VARCHAR2(255) PRIMARY KEY, result CLOB, created_at TIMESTAMP NOT NULL)")
+	default:
+		ddl = "CREATE TABLE IF NOT EXISTS " + idempotencyTable +
+			" (idempotency_key VARCHAR(255) PRIMARY KEY, result TEXT, created_at TIMESTAMP NOT NULL)"
+	}
+
+	_, err := tm.db.ExecContext(ctx, ddl)
+	return Translate(err)
+}
+
+// PurgeIdempotencyKeys deletes idempotency keys recorded more than maxAge ago and
+// returns how many were deleted. Requests retried after that can not be replayed.
+func (tm *TxManager) PurgeIdempotencyKeys(ctx context.Context, maxAge time.Duration) (int64, error) {
+	result, err := tm.db.ExecContext(ctx, "DELETE FROM "+idempotencyTable+" WHERE created_at < "+tm.Placeholder(1),
+		tm.now().UTC().Add(-maxAge))
+	if err != nil {
+		return 0, Translate(err)
+	}
+
+	return result.RowsAffected()
+}
+
+// idempotent wraps txFunc to run at most once per key.
+func idempotent(txFunc func(tx *Transaction) error, key string, result interface{}) func(tx *Transaction) error {
+	return func(tx *Transaction) error {
+		var recorded sql.NullString
+		err := tx.GetOne(&recorded, "SELECT result FROM "+idempotencyTable+
+			" WHERE idempotency_key = "+tx.txManager.Placeholder(1), key)
+		if err == nil {
+			log.Printf("%s replays idempotency key %s", tx, key)
+			if result == nil || !recorded.Valid {
+				return nil
+			}
+			return json.Unmarshal([]byte(recorded.String), result)
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		if err := txFunc(tx); err != nil {
+			return err
+		}
+
+		var data interface{}
+		if result != nil {
+			encoded, err := json.Marshal(result)
+			if err != nil {
+				return err
+			}
+			data = string(encoded)
+		}
+
+		_, err = tx.exec("INSERT INTO "+idempotencyTable+" (idempotency_key, result, created_at) VALUES ("+
+			tx.txManager.Placeholder(1)+", "+tx.txManager.Placeholder(2)+", "+tx.txManager.Placeholder(3)+")",
+			key, data, tx.txManager.now().UTC())
+		if errors.Is(err, ErrUniqueViolation) {
+			return fmt.Errorf("%w: %s", ErrIdempotencyConflict, key)
+		}
+		return err
+	}
+}
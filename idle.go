@@ -0,0 +1,215 @@
+package gotx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTxIdle is matched by the errors of transactions aborted by IdleAbort.
+var ErrTxIdle = errors.New("gotx: transaction idle for too long")
+
+// IdleAction decides what happens with a db transaction in which no statement ran for
+// longer than its idle limit.
+type IdleAction uint8
+
+const (
+	// IdleWarn logs the transaction and passes an IdleReport to the OnIdle hooks.
+	IdleWarn IdleAction = iota
+
+	// IdleAbort also cancels the context of the transaction, which rolls the db
+	// transaction back immediately and releases its locks. The Exec call returns an
+	// error matching ErrTxIdle.
+	IdleAbort
+)
+
+// IdleReport describes a db transaction in which no statement ran for longer than its
+// idle limit.
+type IdleReport struct {
+	TxID string
+
+	// Idle is how long no statement ran when the transaction was reported.
+	Idle time.Duration
+
+	// LastQuery is the last statement which ran before the idle period, or empty if
+	// none ran yet.
+	LastQuery string
+
+	Aborted bool
+}
+
+func (r *IdleReport) String() string {
+	action := "open"
+	if r.Aborted {
+		action = "aborted"
+	}
+	return fmt.Sprintf("gotx: db tx-%s %s after %s without running a statement, last statement: %q",
+		r.TxID, action, r.Idle.Round(time.Millisecond), r.LastQuery)
+}
+
+// WithIdleLimit flags db transactions in which no statement runs for longer than limit
+// while they are open. That is usually a txFunc calling an HTTP API or sleeping while
+// holding the locks and connection of the transaction. Options.MaxIdle and
+// Options.IdleAction override the limit and action for an Exec call. Idle
+// transactions are found by a goroutine which runs only while such transactions are
+// open.
+func WithIdleLimit(limit time.Duration, action IdleAction) ManagerOption {
+	return func(tm *TxManager) {
+		tm.idleLimit = limit
+		tm.idleAction = action
+	}
+}
+
+// WithMaxIdle sets MaxIdle and IdleAction and returns o.
+func (o *Options) WithMaxIdle(limit time.Duration, action IdleAction) *Options {
+	o.MaxIdle = limit
+	o.IdleAction = action
+	return o
+}
+
+// idleSettings returns the idle limit and action for a root transaction with opt.
+func (tm *TxManager) idleSettings(opt *Options) (time.Duration, IdleAction) {
+	if opt.MaxIdle != 0 {
+		return opt.MaxIdle, opt.IdleAction
+	}
+	return tm.idleLimit, tm.idleAction
+}
+
+// idleWatch is the idle state of a db transaction.
+type idleWatch struct {
+	limit  time.Duration
+	action IdleAction
+	cancel context.CancelFunc
+	clock  Clock
+
+	// running counts the statements in progress, and activity is the time the last
+	// one started or ended in unix nanoseconds
+	running  int32
+	activity int64
+	aborted  int32
+
+	mux       sync.Mutex
+	lastQuery string
+	reported  bool
+}
+
+func (w *idleWatch) begin(query string) {
+	atomic.AddInt32(&w.running, 1)
+	atomic.StoreInt64(&w.activity, w.clock.Now().UnixNano())
+
+	w.mux.Lock()
+	w.lastQuery = query
+	w.mux.Unlock()
+}
+
+func (w *idleWatch) end() {
+	atomic.StoreInt64(&w.activity, w.clock.Now().UnixNano())
+	atomic.AddInt32(&w.running, -1)
+}
+
+// idleDetector finds the idle db transactions.
+type idleDetector struct {
+	mux     sync.Mutex
+	open    map[*rawTx]*idleWatch
+	running bool
+}
+
+func newIdleDetector() *idleDetector {
+	return &idleDetector{open: make(map[*rawTx]*idleWatch)}
+}
+
+// track starts watching a db transaction which just began.
+func (d *idleDetector) track(tm *TxManager, tx *rawTx, limit time.Duration, action IdleAction, cancel context.CancelFunc) {
+	w := &idleWatch{limit: limit, action: action, cancel: cancel, clock: tm.clock, activity: tm.now().UnixNano()}
+	tx.idle = w
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.open[tx] = w
+	if !d.running {
+		d.running = true
+		go d.sweep(tm)
+	}
+}
+
+// untrack stops watching a db transaction which ended.
+func (d *idleDetector) untrack(tx *rawTx) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	delete(d.open, tx)
+}
+
+// sweep reports the idle db transactions until none is watched anymore.
+func (d *idleDetector) sweep(tm *TxManager) {
+	for {
+		d.mux.Lock()
+		if len(d.open) == 0 {
+			d.running = false
+			d.mux.Unlock()
+			return
+		}
+
+		var reports []*IdleReport
+		interval := time.Second
+		for tx, w := range d.open {
+			if w.limit/4 < interval {
+				interval = w.limit / 4
+			}
+			if report := w.check(tx); report != nil {
+				reports = append(reports, report)
+			}
+		}
+		d.mux.Unlock()
+
+		for _, report := range reports {
+			tm.reportIdle(report)
+		}
+
+		if interval < 5*time.Millisecond {
+			interval = 5 * time.Millisecond
+		}
+		<-tm.clock.NewTimer(interval).C()
+	}
+}
+
+// check returns the report of the db transaction if it became idle.
+func (w *idleWatch) check(tx *rawTx) *IdleReport {
+	if atomic.LoadInt32(&w.running) > 0 {
+		return nil
+	}
+
+	idle := w.clock.Now().Sub(time.Unix(0, atomic.LoadInt64(&w.activity)))
+	if idle <= w.limit {
+		return nil
+	}
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.reported {
+		return nil
+	}
+	w.reported = true
+
+	report := &IdleReport{TxID: tx.id, Idle: idle, LastQuery: w.lastQuery}
+	if w.action == IdleAbort && w.cancel != nil {
+		report.Aborted = true
+		atomic.StoreInt32(&w.aborted, 1)
+		w.cancel()
+	}
+	return report
+}
+
+func (tm *TxManager) reportIdle(report *IdleReport) {
+	log.Print(report)
+	for _, h := range tm.hooks {
+		if h.OnIdle != nil {
+			h.OnIdle(report)
+		}
+	}
+}
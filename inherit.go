@@ -0,0 +1,90 @@
+package gotx
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrReadOnlyTx is returned for statements writing in a read-only transaction.
+var ErrReadOnlyTx = errors.New("gotx: write in read-only transaction")
+
+// Root returns the logical transaction which began the db transaction of t, t itself
+// if it began it. Nested transactions share its db transaction and thus its session
+// settings, see Options.
+func (t *Transaction) Root() *Transaction {
+	root := t
+	for root.txID != t.tx.id && root.parent != nil {
+		root = root.parent
+	}
+	return root
+}
+
+// Options returns the effective options of t. Nested transactions inherit some options
+// of their parent:
+//
+//   - Labels are merged with the labels of the parent, the own labels winning.
+//   - MaxRows and MaxRowsPolicy are inherited unless MaxRows is set.
+//   - The deadline of the context of the parent bounds the nested transaction, even
+//     if it was started with an unrelated context.
+//
+// Transactions joining the db transaction of their parent also share the settings of
+// the db transaction: IsolationLevel and AsyncCommit are the ones of the root, and they
+// are read-only if the root or they themselves are.
+func (t *Transaction) Options() Options {
+	return *t.opts
+}
+
+// Labels returns the labels of t, including the inherited ones. The map must not be
+// modified.
+func (t *Transaction) Labels() map[string]string {
+	return t.opts.Labels
+}
+
+// ReadOnly reports whether t may only run statements which read data.
+func (t *Transaction) ReadOnly() bool {
+	return t.opts.ReadOnly
+}
+
+// inheritOptions returns the effective options of a transaction started with options
+// and nested in parent, sharing its db transaction if joined. options is not modified.
+func inheritOptions(options *Options, parent *Transaction, joined bool) *Options {
+	if parent == nil {
+		return options
+	}
+
+	opts := *options
+	if len(parent.opts.Labels) > 0 {
+		labels := make(map[string]string, len(parent.opts.Labels)+len(options.Labels))
+		for k, v := range parent.opts.Labels {
+			labels[k] = v
+		}
+		for k, v := range options.Labels {
+			labels[k] = v
+		}
+		opts.Labels = labels
+	}
+	if opts.MaxRows == 0 {
+		opts.MaxRows, opts.MaxRowsPolicy = parent.opts.MaxRows, parent.opts.MaxRowsPolicy
+	}
+
+	if joined {
+		opts.IsolationLevel = parent.opts.IsolationLevel
+		opts.AsyncCommit = parent.opts.AsyncCommit
+		opts.ReadOnly = opts.ReadOnly || parent.opts.ReadOnly
+	}
+	return &opts
+}
+
+// checkReadOnly rejects the statements of read-only transactions which do not read.
+// Read-only db transactions are enforced by the database too, but a nested read-only
+// transaction may join a read-write one.
+func (t *Transaction) checkReadOnly(stmt *Statement) error {
+	if !t.opts.ReadOnly {
+		return nil
+	}
+	// the savepoints of nested transactions do not write
+	if verb := statementVerb(stmt.Query, t.txManager.dialect); !readOnlyVerbs[verb] && !savepointVerbs[verb] {
+		return fmt.Errorf("%w: %s", ErrReadOnlyTx, verb)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package gotx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// InsertBatchIDs inserts one row per element of args, a slice of structs or maps, with
+// a named INSERT ... VALUES query and returns the generated ID of every row, in the
+// order of args:
+//
+//	ids, err := tx.InsertBatchIDs("INSERT INTO account(name) VALUES (:name)", accounts)
+//
+// On Postgres and SQLite the rows are inserted with a single statement returning the
+// "id" column, unless the query has its own RETURNING clause. On MySQL the rows are
+// inserted with a single statement and the IDs are derived from LastInsertId, which is
+// only safe when InnoDB allocates consecutive IDs to the statement: the arithmetic is
+// used with innodb_autoinc_lock_mode 0 or 1 when every row was inserted, and rows
+// must not set the auto-increment column explicitly. Otherwise, as with the other
+// dialects, each row is inserted by its own statement.
+func (t *Transaction) InsertBatchIDs(query string, args interface{}) ([]int64, error) {
+	if err := t.checkState(); err != nil {
+		return nil, err
+	}
+
+	rows := reflect.ValueOf(args)
+	if rows.Kind() != reflect.Slice && rows.Kind() != reflect.Array {
+		return nil, errors.New("gotx: args of a batch insert must be a slice")
+	}
+	if rows.Len() == 0 {
+		return nil, nil
+	}
+
+	var ids []int64
+	var err error
+	switch t.txManager.dialect {
+	case DialectPostgres, DialectSQLite:
+		ids, err = t.insertBatchReturning(query, args, rows.Len())
+	case DialectMySQL:
+		ids, err = t.insertBatchMySQL(query, args, rows.Len())
+	default:
+		ids, err = t.insertEach(query, rows)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("batch insert failed: %w", err)
+	}
+	return ids, nil
+}
+
+func (t *Transaction) insertBatchReturning(query string, args interface{}, n int) ([]int64, error) {
+	if !hasTopLevelKeyword(query, "RETURNING", t.txManager.dialect) {
+		query += " RETURNING id"
+	}
+
+	query2, args2, err := t.tx.BindNamed(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, 0, n)
+	err = t.run(&Statement{Kind: StatementQuery, Query: query2, Args: args2, EachRow: scanInto(&ids)})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) != n {
+		return nil, fmt.Errorf("gotx: %d IDs returned for %d rows", len(ids), n)
+	}
+	return ids, nil
+}
+
+func (t *Transaction) insertBatchMySQL(query string, args interface{}, n int) ([]int64, error) {
+	if hasTopLevelKeyword(query, "IGNORE", t.txManager.dialect) || hasTopLevelKeyword(query, "DUPLICATE", t.txManager.dialect) {
+		return t.insertEach(query, reflect.ValueOf(args))
+	}
+
+	var settings struct {
+		Increment int64 `db:"increment"`
+		LockMode  int64 `db:"lock_mode"`
+	}
+	err := t.GetOne(&settings, "SELECT @@auto_increment_increment AS increment, @@innodb_autoinc_lock_mode AS lock_mode")
+	if err != nil {
+		return nil, err
+	}
+	if settings.LockMode >= 2 {
+		return t.insertEach(query, reflect.ValueOf(args))
+	}
+
+	query2, args2, err := t.tx.BindNamed(query, args)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := t.exec(query2, args2...)
+	if err != nil {
+		return nil, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if affected != int64(n) {
+		return nil, fmt.Errorf("gotx: %d rows affected by the insert of %d rows", affected, n)
+	}
+
+	// LastInsertId is the ID of the first row inserted by the statement
+	first, err := result.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]int64, n)
+	for i := range ids {
+		ids[i] = first + int64(i)*settings.Increment
+	}
+	return ids, nil
+}
+
+// insertEach inserts the rows one by one.
+func (t *Transaction) insertEach(query string, rows reflect.Value) ([]int64, error) {
+	ids := make([]int64, 0, rows.Len())
+	for i := 0; i < rows.Len(); i++ {
+		id, err := t.Insert(query, rows.Index(i).Interface())
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,146 @@
+package gotx
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// StatementKind tells how a statement is executed and what it returns.
+type StatementKind uint8
+
+const (
+	// StatementExec is a statement that does not return rows, e.g. INSERT, UPDATE or DELETE.
+	StatementExec StatementKind = iota
+
+	// StatementGet is a query whose first row is scanned into Dest.
+	StatementGet
+
+	// StatementSelect is a query whose rows are all scanned into Dest.
+	StatementSelect
+
+	// StatementQuery is a query whose rows are passed one by one to EachRow.
+	StatementQuery
+
+	// StatementMultiQuery is a query returning several result sets, which are read
+	// from Rows after the statement is executed.
+	StatementMultiQuery
+)
+
+// Statement is a SQL statement run by a Transaction. Named parameters and IN clauses
+// are already expanded when a Statement reaches the interceptors, so Query holds the
+// final SQL text sent to the database and Args its positional arguments.
+type Statement struct {
+	Kind  StatementKind
+	Query string
+	Args  []interface{}
+
+	// Dest is the scan destination of StatementGet and StatementSelect statements.
+	Dest interface{}
+
+	// EachRow is called for every row of a StatementQuery statement.
+	EachRow func(rows *sqlx.Rows) error
+
+	// Result is set once a StatementExec statement is executed successfully.
+	Result sql.Result
+
+	// Rows is set once a StatementMultiQuery statement is executed successfully. The
+	// result sets are read after the interceptors returned.
+	Rows *sqlx.Rows
+
+	// Priority is the priority of the transaction running the statement.
+	Priority Priority
+
+	tx *Transaction
+
+	// masked marks queries whose rows are masked by their reader
+	masked bool
+
+	// savepoint marks the statements managing the savepoints of nested transactions,
+	// which neither write nor count as statements of the transaction
+	savepoint bool
+}
+
+// Tx returns the logical transaction running the statement.
+func (s *Statement) Tx() *Transaction {
+	return s.tx
+}
+
+// dialect returns the dialect of the manager running s.
+func (s *Statement) dialect() Dialect {
+	if s.tx == nil {
+		return DialectUnknown
+	}
+	return s.tx.txManager.dialect
+}
+
+// StatementHandler executes a statement.
+type StatementHandler func(ctx context.Context, stmt *Statement) error
+
+// Interceptor wraps the execution of every statement run through a Transaction. An
+// interceptor may inspect or rewrite the statement before calling next, reject it by
+// returning an error without calling next, or examine the outcome afterwards.
+type Interceptor interface {
+	Intercept(ctx context.Context, stmt *Statement, next StatementHandler) error
+}
+
+// InterceptorFunc is an adapter to allow the use of ordinary functions as interceptors.
+type InterceptorFunc func(ctx context.Context, stmt *Statement, next StatementHandler) error
+
+// Intercept calls f(ctx, stmt, next).
+func (f InterceptorFunc) Intercept(ctx context.Context, stmt *Statement, next StatementHandler) error {
+	return f(ctx, stmt, next)
+}
+
+// chainInterceptors builds a handler which runs interceptors in order before handler.
+func chainInterceptors(interceptors []Interceptor, handler StatementHandler) StatementHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor, next := interceptors[i], handler
+		handler = func(ctx context.Context, stmt *Statement) error {
+			return interceptor.Intercept(ctx, stmt, next)
+		}
+	}
+
+	return handler
+}
+
+// execStatement is the innermost handler which sends the statement to the database.
+// Driver errors are translated to the portable error kinds.
+func execStatement(ctx context.Context, stmt *Statement) error {
+	tx := stmt.tx.tx
+
+	args, err := bindEnumArgs(stmt.Args)
+	if err != nil {
+		return err
+	}
+	if stmt.tx.txManager.dialect == DialectPostgres {
+		args = wrapArrayArgs(args)
+	}
+
+	switch stmt.Kind {
+	case StatementGet:
+		return Translate(tx.GetContext(ctx, stmt.Dest, stmt.Query, args...))
+	case StatementSelect:
+		if stmt.tx.opts.MaxRows <= 0 {
+			return Translate(tx.SelectContext(ctx, stmt.Dest, stmt.Query, args...))
+		}
+		return Translate(queryRows(ctx, stmt, args, scanInto(stmt.Dest)))
+	case StatementQuery:
+		return Translate(queryRows(ctx, stmt, args, stmt.EachRow))
+	case StatementMultiQuery:
+		rows, err := tx.QueryxContext(ctx, stmt.Query, args...)
+		if err != nil {
+			return Translate(err)
+		}
+		stmt.Rows = rows
+		return nil
+	default:
+		result, err := tx.ExecContext(ctx, stmt.Query, args...)
+		if err != nil {
+			return Translate(err)
+		}
+		stmt.Result = result
+		return nil
+	}
+}
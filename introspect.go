@@ -0,0 +1,160 @@
+package gotx
+
+import (
+	"database/sql"
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// slowTxHistory is how many recent slow transactions a manager keeps.
+const slowTxHistory = 50
+
+// TxInfo describes a logical transaction for introspection.
+type TxInfo struct {
+	ID          string        `json:"id"`
+	RootID      string        `json:"root_id"`
+	ParentID    string        `json:"parent_id,omitempty"`
+	OriginID    string        `json:"origin_id,omitempty"`
+	Goroutine   uint64        `json:"goroutine"`
+	RequiresNew bool          `json:"requires_new"`
+	Started     time.Time     `json:"started"`
+	Duration    time.Duration `json:"duration"`
+	Err         string        `json:"error,omitempty"`
+
+	// Labels are the labels of the transaction, including the inherited ones.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Savepoint is the name of the savepoint the transaction runs within, if any.
+	Savepoint string `json:"savepoint,omitempty"`
+
+	// Statements is the number of statements run by the transaction, including the
+	// ones of nested transactions, and StatementTime the time spent executing them.
+	// ThinkTime is the remainder of Duration, spent by the application while the
+	// transaction was open: a transaction with a large think time holds its locks and
+	// connection while e.g. waiting for external APIs, rather than running slow queries.
+	Statements    int64         `json:"statements"`
+	StatementTime time.Duration `json:"statement_time"`
+	ThinkTime     time.Duration `json:"think_time"`
+}
+
+// Config describes the configuration of a manager.
+type Config struct {
+	Dialect       string        `json:"dialect"`
+	Debug         bool          `json:"debug"`
+	SlowThreshold time.Duration `json:"slow_threshold"`
+	Interceptors  int           `json:"interceptors"`
+	Hooks         int           `json:"hooks"`
+	Queries       int           `json:"queries"`
+}
+
+// WithSlowThreshold makes the manager keep the most recent transactions which took at
+// least d, returned by SlowTransactions. Zero, the default, keeps none.
+func WithSlowThreshold(d time.Duration) ManagerOption {
+	return func(tm *TxManager) {
+		tm.slowThreshold = d
+	}
+}
+
+// ActiveTransactions returns the logical transactions in progress, oldest first.
+func (tm *TxManager) ActiveTransactions() []TxInfo {
+	tm.mux.Lock()
+	defer tm.mux.Unlock()
+
+	var infos []TxInfo
+	for _, txs := range tm.txMap {
+		for _, tx := range txs {
+			info := txInfo(tx)
+			info.setDuration(tm.since(tx.started))
+			infos = append(infos, info)
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Started.Before(infos[j].Started) })
+	return infos
+}
+
+// SlowTransactions returns the most recent transactions which took at least the slow
+// threshold of the manager, newest first.
+func (tm *TxManager) SlowTransactions() []TxInfo {
+	tm.mux.Lock()
+	defer tm.mux.Unlock()
+
+	infos := make([]TxInfo, len(tm.slowTxs))
+	for i, info := range tm.slowTxs {
+		infos[len(infos)-1-i] = info
+	}
+	return infos
+}
+
+// DBStats returns the connection pool statistics of the database.
+func (tm *TxManager) DBStats() sql.DBStats {
+	return tm.db.Stats()
+}
+
+// Config returns the configuration of the manager.
+func (tm *TxManager) Config() Config {
+	tm.mux.Lock()
+	queries := len(tm.queries)
+	tm.mux.Unlock()
+
+	return Config{
+		Dialect:       tm.dialect.String(),
+		Debug:         tm.debug,
+		SlowThreshold: tm.slowThreshold,
+		Interceptors:  len(tm.interceptors),
+		Hooks:         len(tm.hooks),
+		Queries:       queries,
+	}
+}
+
+// recordSlowTx keeps tx if it took at least the slow threshold.
+func (tm *TxManager) recordSlowTx(tx *Transaction) {
+	if tm.slowThreshold <= 0 || tx.duration < tm.slowThreshold {
+		return
+	}
+
+	info := txInfo(tx)
+	info.setDuration(tx.duration)
+	if tx.outcome != nil {
+		info.Err = tx.outcome.Error()
+	}
+
+	tm.mux.Lock()
+	defer tm.mux.Unlock()
+
+	if len(tm.slowTxs) == slowTxHistory {
+		tm.slowTxs = append(tm.slowTxs[:0], tm.slowTxs[1:]...)
+	}
+	tm.slowTxs = append(tm.slowTxs, info)
+}
+
+func txInfo(tx *Transaction) TxInfo {
+	info := TxInfo{
+		ID:          tx.txID,
+		RootID:      tx.RootID(),
+		Goroutine:   tx.goid,
+		RequiresNew: tx.requiredNew,
+		Started:     tx.started,
+		Labels:      tx.opts.Labels,
+		Savepoint:   tx.savepointMark,
+	}
+	if tx.parent != nil {
+		info.ParentID = tx.parent.txID
+	}
+	info.Statements = atomic.LoadInt64(&tx.statements)
+	info.StatementTime = time.Duration(atomic.LoadInt64(&tx.statementTime))
+	if c, ok := tx.ctx.Value(correlationContextKey{}).(Correlation); ok {
+		info.OriginID = c.RootTxID
+	}
+	return info
+}
+
+// setDuration sets Duration and the think time remaining of it.
+func (info *TxInfo) setDuration(d time.Duration) {
+	info.Duration = d
+	info.ThinkTime = d - info.StatementTime
+	if info.ThinkTime < 0 {
+		info.ThinkTime = 0
+	}
+}
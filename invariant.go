@@ -0,0 +1,157 @@
+package gotx
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// maxInvariantViolations bounds the violating rows kept in an InvariantError.
+const maxInvariantViolations = 10
+
+// ErrInvariantViolated is matched by the errors returned for invariants which do not
+// hold when a transaction commits.
+var ErrInvariantViolated = errors.New("gotx: invariant violated")
+
+// Invariant is a consistency check run right before a db transaction commits, an
+// application level constraint spanning rows or tables which the database can not
+// express. Query selects the rows violating the invariant, so it holds when Query
+// returns no rows:
+//
+//	gotx.Invariant{
+//		Name: "ledger balances",
+//		Query: `SELECT a.id, a.balance, SUM(l.amount) AS ledger FROM account a
+//			JOIN ledger_entry l ON l.account_id = a.id
+//			GROUP BY a.id, a.balance HAVING a.balance <> SUM(l.amount)`,
+//	}
+//
+// Queries see the uncommitted changes of the transaction. They should be restricted to
+// the rows the transaction may have changed, such as rows updated after a timestamp or
+// marked with the transaction ID, or they scan the whole tables on every commit.
+type Invariant struct {
+	Name  string
+	Query string
+	Args  []interface{}
+}
+
+// InvariantError reports an invariant which does not hold.
+type InvariantError struct {
+	Invariant string
+
+	// Violations are the first violating rows, by column name, and Count the number of
+	// violating rows.
+	Violations []map[string]interface{}
+	Count      int
+}
+
+func (e *InvariantError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s: %d violating rows", ErrInvariantViolated, e.Invariant, e.Count)
+	if len(e.Violations) > 0 {
+		b.WriteString(", first: ")
+		row := e.Violations[0]
+		columns := make([]string, 0, len(row))
+		for column := range row {
+			columns = append(columns, column)
+		}
+		sort.Strings(columns)
+		for i, column := range columns {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			fmt.Fprintf(&b, "%s=%v", column, row[column])
+		}
+	}
+	return b.String()
+}
+
+// Is reports whether target is ErrInvariantViolated.
+func (e *InvariantError) Is(target error) bool {
+	return target == ErrInvariantViolated
+}
+
+// WithInvariants checks invariants before every db transaction which wrote commits.
+// The first violated invariant rolls the db transaction back, and Commit, thus Exec,
+// returns an *InvariantError. Read-only transactions are not checked.
+func WithInvariants(invariants ...Invariant) ManagerOption {
+	return func(tm *TxManager) {
+		tm.invariants = append(tm.invariants, invariants...)
+	}
+}
+
+// AddInvariant checks inv before the db transaction of t commits, after the invariants
+// of the manager, for invariants only some units of work must maintain:
+//
+//	tx.AddInvariant(gotx.Invariant{
+//		Name:  "transfer is balanced",
+//		Query: "SELECT transfer_id FROM ledger_entry WHERE transfer_id = ? GROUP BY transfer_id HAVING SUM(amount) <> 0",
+//		Args:  []interface{}{transferID},
+//	})
+//
+// The invariant is checked even if the db transaction wrote nothing afterwards. Adding
+// an invariant with the name of one already added replaces it.
+func (t *Transaction) AddInvariant(inv Invariant) {
+	t.tx.valuesMux.Lock()
+	defer t.tx.valuesMux.Unlock()
+
+	for i, existing := range t.tx.invariants {
+		if existing.Name == inv.Name {
+			t.tx.invariants[i] = inv
+			return
+		}
+	}
+	t.tx.invariants = append(t.tx.invariants, inv)
+}
+
+// checkInvariants checks the invariants of the manager and of the db transaction of
+// t, in that order.
+func (t *Transaction) checkInvariants() error {
+	t.tx.valuesMux.Lock()
+	invariants := append([]Invariant(nil), t.tx.invariants...)
+	t.tx.valuesMux.Unlock()
+
+	if atomic.LoadInt32(&t.tx.wrote) != 0 {
+		invariants = append(append([]Invariant(nil), t.txManager.invariants...), invariants...)
+	}
+
+	for _, inv := range invariants {
+		if err := t.checkInvariant(inv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Transaction) checkInvariant(inv Invariant) error {
+	ierr := &InvariantError{Invariant: inv.Name}
+	err := t.run(&Statement{Kind: StatementQuery, Query: inv.Query, Args: inv.Args, EachRow: func(rows *sqlx.Rows) error {
+		ierr.Count++
+		if len(ierr.Violations) == maxInvariantViolations {
+			return nil
+		}
+
+		row := make(map[string]interface{})
+		if err := rows.MapScan(row); err != nil {
+			return err
+		}
+		for column, v := range row {
+			if b, ok := v.([]byte); ok {
+				row[column] = string(b)
+			}
+		}
+		ierr.Violations = append(ierr.Violations, row)
+		return nil
+	}})
+	if err != nil {
+		return fmt.Errorf("gotx: checking invariant %s failed: %w", inv.Name, err)
+	}
+
+	if ierr.Count > 0 {
+		return ierr
+	}
+	return nil
+}
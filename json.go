@@ -0,0 +1,104 @@
+package gotx
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// JSON stores a value of type T in a JSON column. It implements sql.Scanner and
+// driver.Valuer, so struct fields of type JSON[T] are marshaled transparently by
+// NamedExec, Insert and Update and unmarshaled when rows are scanned:
+//
+//	type Order struct {
+//		ID    int64                 `db:"id"`
+//		Items gotx.JSON[[]LineItem] `db:"items"`
+//	}
+//
+// Values are sent to the database as JSON text, which both Postgres json/jsonb and
+// MySQL JSON columns accept. A NULL column scans to the zero value of T.
+type JSON[T any] struct {
+	Data T
+}
+
+// NewJSON wraps v for storage in a JSON column.
+func NewJSON[T any](v T) JSON[T] {
+	return JSON[T]{Data: v}
+}
+
+// Value implements driver.Valuer.
+func (j JSON[T]) Value() (driver.Value, error) {
+	data, err := json.Marshal(j.Data)
+	if err != nil {
+		return nil, err
+	}
+	// text rather than []byte: lib/pq sends []byte parameters as bytea
+	return string(data), nil
+}
+
+// Scan implements sql.Scanner.
+func (j *JSON[T]) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case nil:
+		var zero T
+		j.Data = zero
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("gotx: can not scan %T into JSON", src)
+	}
+
+	return json.Unmarshal(data, &j.Data)
+}
+
+// MarshalJSON encodes the wrapped value, so JSON[T] fields serialize like T.
+func (j JSON[T]) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.Data)
+}
+
+// UnmarshalJSON decodes into the wrapped value.
+func (j *JSON[T]) UnmarshalJSON(data []byte) error {
+	return json.Unmarshal(data, &j.Data)
+}
+
+// JSONField returns an expression extracting the value at path from a JSON column as
+// text, in the syntax of the dialect. Path elements are object keys or array indexes,
+// e.g. JSONField("doc", "items", "0", "sku"). Path elements are inlined into the
+// expression and must not come from user input.
+func (d Dialect) JSONField(column string, path ...string) string {
+	switch d {
+	case DialectPostgres:
+		if len(path) == 1 {
+			return column + " ->> '" + path[0] + "'"
+		}
+		return column + " #>> '{" + strings.Join(path, ",") + "}'"
+
+	case DialectSQLServer:
+		return "JSON_VALUE(" + column + ", '" + jsonPath(path) + "')"
+
+	case DialectSQLite:
+		return "json_extract(" + column + ", '" + jsonPath(path) + "')"
+
+	default:
+		return "JSON_UNQUOTE(JSON_EXTRACT(" + column + ", '" + jsonPath(path) + "'))"
+	}
+}
+
+// jsonPath converts path elements to a $.key[index] JSON path.
+func jsonPath(path []string) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, p := range path {
+		if p != "" && strings.Trim(p, "0123456789") == "" {
+			b.WriteString("[" + p + "]")
+		} else {
+			b.WriteString(".\"" + p + "\"")
+		}
+	}
+	return b.String()
+}
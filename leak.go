@@ -0,0 +1,87 @@
+package gotx
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// WithLeakDetector enables a detector for db transactions left open: every db
+// transaction open for longer than maxAge is logged once, with the stack of the code
+// which began it. Open transactions are checked periodically by a goroutine which runs
+// only while db transactions are open.
+func WithLeakDetector(maxAge time.Duration) ManagerOption {
+	return func(tm *TxManager) {
+		tm.leaks = &leakDetector{maxAge: maxAge, open: make(map[*rawTx]*openTx)}
+	}
+}
+
+type leakDetector struct {
+	maxAge time.Duration
+	clock  Clock
+
+	mux     sync.Mutex
+	open    map[*rawTx]*openTx
+	running bool
+}
+
+type openTx struct {
+	started  time.Time
+	stack    []byte
+	reported bool
+}
+
+// track registers a db transaction which just began.
+func (d *leakDetector) track(tx *rawTx) {
+	if d == nil {
+		return
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	d.open[tx] = &openTx{started: d.clock.Now(), stack: debug.Stack()}
+	if !d.running {
+		d.running = true
+		go d.sweep()
+	}
+}
+
+// untrack removes a db transaction which committed or rolled back.
+func (d *leakDetector) untrack(tx *rawTx) {
+	if d == nil {
+		return
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+
+	delete(d.open, tx)
+}
+
+// sweep logs the db transactions older than maxAge until none is open anymore.
+func (d *leakDetector) sweep() {
+	interval := d.maxAge / 2
+	if interval < 10*time.Millisecond {
+		interval = 10 * time.Millisecond
+	}
+
+	tick(d.clock, interval, func() bool {
+		d.mux.Lock()
+		defer d.mux.Unlock()
+		if len(d.open) == 0 {
+			d.running = false
+			return false
+		}
+
+		for tx, info := range d.open {
+			if age := d.clock.Now().Sub(info.started); !info.reported && age > d.maxAge {
+				info.reported = true
+				log.Printf("gotx: db tx-%s is open for %s without commit or rollback, began at:\n%s",
+					tx.id, age.Round(time.Millisecond), info.stack)
+			}
+		}
+		return true
+	})
+}
@@ -0,0 +1,349 @@
+// Package ledger keeps double-entry accounts in gotx transactions. Money moves
+// between accounts with journals, sets of entries summing to zero, which are appended
+// to the ledger and never updated:
+//
+//	l := ledger.New(tm)
+//	id, err := l.Post(ctx, ledger.Journal{
+//		Key:         "order-1234-payment",
+//		Currency:    "EUR",
+//		Description: "order 1234",
+//		Entries: []ledger.Entry{
+//			{Account: "customer:42", Amount: -2500},
+//			{Account: "merchant:7", Amount: 2500},
+//		},
+//	})
+//
+// Posting joins the transaction of ctx if there is one, so journals are posted
+// atomically with the changes of the business transaction. The balances of the
+// accounts are kept with the entries in the same transaction, and idempotency keys
+// make posting a journal again a no-op, e.g. when a request is retried.
+package ledger
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/oligo/gotx"
+)
+
+// Tables of the ledger.
+const (
+	accountsTable = "gotx_ledger_accounts"
+	journalsTable = "gotx_ledger_journals"
+	entriesTable  = "gotx_ledger_entries"
+)
+
+var (
+	// ErrUnbalanced is returned for journals whose entries do not sum to zero.
+	ErrUnbalanced = errors.New("ledger: journal is not balanced")
+
+	// ErrUnknownAccount is returned for entries of accounts which were not opened.
+	ErrUnknownAccount = errors.New("ledger: unknown account")
+
+	// ErrCurrencyMismatch is returned for entries of accounts in another currency than
+	// their journal.
+	ErrCurrencyMismatch = errors.New("ledger: currency mismatch")
+
+	// ErrInsufficientFunds is returned for entries making the balance of an account
+	// negative when it does not allow it.
+	ErrInsufficientFunds = errors.New("ledger: insufficient funds")
+
+	// ErrBalanceMismatch is returned by Verify when the balance of an account differs
+	// from the sum of its entries.
+	ErrBalanceMismatch = errors.New("ledger: balance does not match entries")
+)
+
+// Account is an account of the ledger.
+type Account struct {
+	ID       string `db:"id"`
+	Currency string `db:"currency"`
+
+	// AllowNegative lets the balance of the account go below zero, e.g. for the
+	// accounts of external parties or of the house.
+	AllowNegative bool `db:"allow_negative"`
+
+	// Balance is the sum of the entries of the account, in minor units.
+	Balance int64 `db:"balance"`
+}
+
+// Entry credits an account with Amount, in minor units of the currency such as
+// cents, or debits it if Amount is negative.
+type Entry struct {
+	Account string
+	Amount  int64
+}
+
+// Journal is a set of entries posted together.
+type Journal struct {
+	// Key is the idempotency key of the journal. Posting a journal with the key of a
+	// journal already posted does nothing and returns the ID of that journal. Empty
+	// keys are not checked.
+	Key string
+
+	Currency    string
+	Description string
+
+	// Entries are the entries of the journal, at least two, whose amounts sum to zero.
+	Entries []Entry
+}
+
+// Ledger posts journals in the transactions of a manager.
+type Ledger struct {
+	tm *gotx.TxManager
+}
+
+// New returns a Ledger using the transactions of tm.
+func New(tm *gotx.TxManager) *Ledger {
+	return &Ledger{tm: tm}
+}
+
+// CreateTables creates the tables of the ledger if they do not exist. Call it at
+// startup, or create the tables with a migration using the same columns.
+func CreateTables(ctx context.Context, tm *gotx.TxManager) error {
+	var ddls []string
+	switch tm.Dialect() {
+	case gotx.DialectSQLServer:
+		ddls = []string{
+			"IF OBJECT_ID('" + accountsTable + "') IS NULL CREATE TABLE " + accountsTable +
+				" (id NVARCHAR(255) PRIMARY KEY, currency NVARCHAR(16) NOT NULL, allow_negative INT NOT NULL," +
+				" balance BIGINT NOT NULL)",
+			"IF OBJECT_ID('" + journalsTable + "') IS NULL CREATE TABLE " + journalsTable +
+				" (id NVARCHAR(64) PRIMARY KEY, idempotency_key NVARCHAR(255) NULL, currency NVARCHAR(16) NOT NULL," +
+				" description NVARCHAR(MAX), posted_at DATETIME2 NOT NULL," +
+				" INDEX " + journalsTable + "_key UNIQUE (idempotency_key) WHERE idempotency_key IS NOT NULL)",
+			"IF OBJECT_ID('" + entriesTable + "') IS NULL CREATE TABLE " + entriesTable +
+				" (journal_id NVARCHAR(64) NOT NULL, seq INT NOT NULL, account_id NVARCHAR(255) NOT NULL," +
+				" amount BIGINT NOT NULL, PRIMARY KEY (journal_id, seq), INDEX " + entriesTable + "_account (account_id))",
+		}
+	case gotx.DialectMySQL:
+		ddls = []string{
+			"CREATE TABLE IF NOT EXISTS " + accountsTable +
+				" (id VARCHAR(255) PRIMARY KEY, currency VARCHAR(16) NOT NULL, allow_negative INT NOT NULL," +
+				" balance BIGINT NOT NULL)",
+			"CREATE TABLE IF NOT EXISTS " + journalsTable +
+				" (id VARCHAR(64) PRIMARY KEY, idempotency_key VARCHAR(255) UNIQUE, currency VARCHAR(16) NOT NULL," +
+				" description TEXT, posted_at TIMESTAMP NOT NULL)",
+			"CREATE TABLE IF NOT EXISTS " + entriesTable +
+				" (journal_id VARCHAR(64) NOT NULL, seq INT NOT NULL, account_id VARCHAR(255) NOT NULL," +
+				" amount BIGINT NOT NULL, PRIMARY KEY (journal_id, seq), INDEX (account_id))",
+		}
+	case gotx.DialectOracle:
+		ddls = []string{
+			"CREATE TABLE " + accountsTable +
+				" (id VARCHAR2(255) PRIMARY KEY, currency VARCHAR2(16) NOT NULL, allow_negative NUMBER(1) NOT NULL," +
+				" balance NUMBER(19) NOT NULL)",
+			"CREATE TABLE " + journalsTable +
+				" (id VARCHAR2(64) PRIMARY KEY, idempotency_key VARCHAR2(255) UNIQUE, currency VARCHAR2(16) NOT NULL," +
+				" description CLOB, posted_at TIMESTAMP NOT NULL)",
+			"CREATE TABLE " + entriesTable +
+				" (journal_id VARCHAR2(64) NOT NULL, seq NUMBER(10) NOT NULL, account_id VARCHAR2(255) NOT NULL," +
+				" amount NUMBER(19) NOT NULL, PRIMARY KEY (journal_id, seq))",
+			"CREATE INDEX " + entriesTable + "_account ON " + entriesTable + " (account_id)",
+		}
+	default:
+		ddls = []string{
+			"CREATE TABLE IF NOT EXISTS " + accountsTable +
+				" (id VARCHAR(255) PRIMARY KEY, currency VARCHAR(16) NOT NULL, allow_negative INT NOT NULL," +
+				" balance BIGINT NOT NULL)",
+			"CREATE TABLE IF NOT EXISTS " + journalsTable +
+				" (id VARCHAR(64) PRIMARY KEY, idempotency_key VARCHAR(255) UNIQUE, currency VARCHAR(16) NOT NULL," +
+				" description TEXT, posted_at TIMESTAMP NOT NULL)",
+			"CREATE TABLE IF NOT EXISTS " + entriesTable +
+				" (journal_id VARCHAR(64) NOT NULL, seq INT NOT NULL, account_id VARCHAR(255) NOT NULL," +
+				" amount BIGINT NOT NULL, PRIMARY KEY (journal_id, seq))",
+			"CREATE INDEX IF NOT EXISTS " + entriesTable + "_account ON " + entriesTable + " (account_id)",
+		}
+	}
+
+	return tm.CreateIfNotExists(ctx, ddls...)
+}
+
+// OpenAccount opens an account with a zero balance. The Balance of account is ignored.
+func (l *Ledger) OpenAccount(ctx context.Context, account Account) error {
+	allowNegative := 0
+	if account.AllowNegative {
+		allowNegative = 1
+	}
+
+	return l.tm.Exec(ctx, func(tx *gotx.Transaction) error {
+		_, err := tx.NamedExec("INSERT INTO "+accountsTable+" (id, currency, allow_negative, balance)"+
+			" VALUES (:id, :currency, :allow_negative, 0)", map[string]interface{}{
+			"id":             account.ID,
+			"currency":       account.Currency,
+			"allow_negative": allowNegative,
+		})
+		return err
+	}, nil)
+}
+
+// Account returns the account id with its balance.
+func (l *Ledger) Account(ctx context.Context, id string) (Account, error) {
+	var account Account
+	err := l.tm.Exec(ctx, func(tx *gotx.Transaction) error {
+		err := tx.GetOne(&account, "SELECT id, currency, allow_negative, balance FROM "+accountsTable+
+			" WHERE id = "+l.tm.Placeholder(1), id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrUnknownAccount, id)
+		}
+		return err
+	}, nil)
+	return account, err
+}
+
+// Post appends journal to the ledger and updates the balances of its accounts, and
+// returns the ID of the journal. It fails with ErrUnbalanced, ErrUnknownAccount,
+// ErrCurrencyMismatch or ErrInsufficientFunds without changing the ledger. Balances are
+// updated in the order of the account IDs, so concurrent journals do not deadlock.
+// An invariant checks that the entries of the journal still sum to zero when the
+// transaction commits. Journals posted concurrently with the same key fail with
+// gotx.ErrUniqueViolation for all but one of them, posting them again returns the ID of
+// the journal which was posted.
+func (l *Ledger) Post(ctx context.Context, journal Journal) (string, error) {
+	if len(journal.Entries) < 2 {
+		return "", fmt.Errorf("%w: a journal needs at least two entries", ErrUnbalanced)
+	}
+	amounts := make(map[string]int64)
+	var sum int64
+	for _, e := range journal.Entries {
+		amounts[e.Account] += e.Amount
+		sum += e.Amount
+	}
+	if sum != 0 {
+		return "", fmt.Errorf("%w: entries sum to %d", ErrUnbalanced, sum)
+	}
+
+	var id string
+	err := l.tm.Exec(ctx, func(tx *gotx.Transaction) error {
+		if journal.Key != "" {
+			err := tx.GetOne(&id, "SELECT id FROM "+journalsTable+" WHERE idempotency_key = "+l.tm.Placeholder(1), journal.Key)
+			if err == nil {
+				return nil
+			}
+			if !errors.Is(err, sql.ErrNoRows) {
+				return err
+			}
+		}
+
+		var err error
+		if id, err = newID(); err != nil {
+			return err
+		}
+		var key sql.NullString
+		if journal.Key != "" {
+			key = sql.NullString{String: journal.Key, Valid: true}
+		}
+		_, err = tx.NamedExec("INSERT INTO "+journalsTable+" (id, idempotency_key, currency, description, posted_at)"+
+			" VALUES (:id, :key, :currency, :description, :posted_at)", map[string]interface{}{
+			"id":          id,
+			"key":         key,
+			"currency":    journal.Currency,
+			"description": journal.Description,
+			"posted_at":   l.tm.Clock().Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+
+		for i, e := range journal.Entries {
+			_, err := tx.NamedExec("INSERT INTO "+entriesTable+" (journal_id, seq, account_id, amount)"+
+				" VALUES (:journal_id, :seq, :account_id, :amount)", map[string]interface{}{
+				"journal_id": id,
+				"seq":        i,
+				"account_id": e.Account,
+				"amount":     e.Amount,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		accounts := make([]string, 0, len(amounts))
+		for account := range amounts {
+			accounts = append(accounts, account)
+		}
+		sort.Strings(accounts)
+		for _, account := range accounts {
+			if err := l.updateBalance(tx, account, journal.Currency, amounts[account]); err != nil {
+				return err
+			}
+		}
+
+		tx.AddInvariant(gotx.Invariant{
+			Name: "ledger journal " + id + " balanced",
+			Query: "SELECT journal_id, SUM(amount) AS sum FROM " + entriesTable + " WHERE journal_id = " + l.tm.Placeholder(1) +
+				" GROUP BY journal_id HAVING SUM(amount) <> 0",
+			Args: []interface{}{id},
+		})
+		return nil
+	}, nil)
+	if err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// updateBalance adds amount to the balance of account, checking its currency and
+// whether it may go negative.
+func (l *Ledger) updateBalance(tx *gotx.Transaction, account, currency string, amount int64) error {
+	n, err := tx.NamedExec("UPDATE "+accountsTable+" SET balance = balance + :amount"+
+		" WHERE id = :id AND currency = :currency AND (allow_negative <> 0 OR balance + :amount >= 0)",
+		map[string]interface{}{"id": account, "currency": currency, "amount": amount})
+	if err != nil {
+		return err
+	}
+	if n == 1 {
+		return nil
+	}
+
+	// find out why the account was not updated
+	var a Account
+	err = tx.GetOne(&a, "SELECT id, currency, allow_negative, balance FROM "+accountsTable+
+		" WHERE id = "+l.tm.Placeholder(1), account)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		return fmt.Errorf("%w: %s", ErrUnknownAccount, account)
+	case err != nil:
+		return err
+	case a.Currency != currency:
+		return fmt.Errorf("%w: account %s is in %s, journal in %s", ErrCurrencyMismatch, account, a.Currency, currency)
+	default:
+		return fmt.Errorf("%w: account %s has %d, needs %d", ErrInsufficientFunds, account, a.Balance, -amount)
+	}
+}
+
+// Verify checks that the balance of account equals the sum of its entries, e.g. in a
+// periodic reconciliation job, and returns ErrBalanceMismatch otherwise.
+func (l *Ledger) Verify(ctx context.Context, account string) error {
+	return l.tm.Exec(ctx, func(tx *gotx.Transaction) error {
+		var balance, sum int64
+		err := tx.GetOne(&balance, "SELECT balance FROM "+accountsTable+" WHERE id = "+l.tm.Placeholder(1), account)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: %s", ErrUnknownAccount, account)
+		}
+		if err != nil {
+			return err
+		}
+		err = tx.GetOne(&sum, "SELECT COALESCE(SUM(amount), 0) FROM "+entriesTable+" WHERE account_id = "+l.tm.Placeholder(1), account)
+		if err != nil {
+			return err
+		}
+		if balance != sum {
+			return fmt.Errorf("%w: account %s has balance %d, entries sum to %d", ErrBalanceMismatch, account, balance, sum)
+		}
+		return nil
+	}, nil)
+}
+
+// newID returns a random journal ID.
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
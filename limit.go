@@ -0,0 +1,115 @@
+package gotx
+
+import (
+	"context"
+	"strings"
+)
+
+// aggregateFuncs are the aggregate functions making a query without GROUP BY return a
+// single row.
+var aggregateFuncs = map[string]bool{
+	"COUNT":        true,
+	"SUM":          true,
+	"AVG":          true,
+	"MIN":          true,
+	"MAX":          true,
+	"BOOL_AND":     true,
+	"BOOL_OR":      true,
+	"EVERY":        true,
+	"ARRAY_AGG":    true,
+	"STRING_AGG":   true,
+	"GROUP_CONCAT": true,
+	"JSON_AGG":     true,
+	"JSONB_AGG":    true,
+	"LISTAGG":      true,
+}
+
+// LimitInjector is an Interceptor appending a LIMIT to the SELECT statements which
+// have none, as a safety default for services which should never read unbounded
+// result sets in a transaction:
+//
+//	tm := gotx.NewTxManager(db, gotx.WithInterceptors(gotx.NewLimitInjector(1000)))
+//
+// Queries read with Select and ForEach are rewritten, unless they already bound their
+// rows with LIMIT, FETCH, TOP, ROWNUM or OFFSET, or return a single row: queries
+// without FROM, such as SELECT EXISTS (...), and aggregates without GROUP BY. The
+// LIMIT is inserted before FOR UPDATE and similar locking clauses. SQL Server and
+// Oracle get OFFSET 0 ROWS FETCH NEXT n ROWS ONLY instead, after ORDER BY (SELECT
+// NULL) on SQL Server if the query is not ordered. Rows beyond the limit are silently
+// dropped, unlike Options.MaxRows which fails with ErrTooManyRows but reads them from
+// the database first. Like Policy, the injector relies on a lightweight lexer: it is
+// a safeguard, not a replacement for paginating large reads.
+type LimitInjector struct {
+	limit int
+}
+
+// NewLimitInjector creates an injector limiting unbounded SELECT statements to limit
+// rows.
+func NewLimitInjector(limit int) *LimitInjector {
+	return &LimitInjector{limit: limit}
+}
+
+// Intercept implements Interceptor.
+func (l *LimitInjector) Intercept(ctx context.Context, stmt *Statement, next StatementHandler) error {
+	if tx := stmt.Tx(); tx != nil && l.limit > 0 && (stmt.Kind == StatementSelect || stmt.Kind == StatementQuery) {
+		stmt.Query = tx.injectLimit(stmt.Query, l.limit)
+	}
+	return next(ctx, stmt)
+}
+
+// injectLimit returns query with a LIMIT of limit rows if it is an unbounded SELECT,
+// or query unchanged.
+func (t *Transaction) injectLimit(query string, limit int) string {
+	tokens := tokenizeSQL(query, t.txManager.dialect)
+	// trailing semicolons are kept after the limit
+	for len(tokens) > 0 && tokens[len(tokens)-1].kind == tokenPunct && tokens[len(tokens)-1].text == ";" {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 || statementVerb(query, t.txManager.dialect) != "SELECT" {
+		return query
+	}
+
+	selectAt := indexTopLevelKeyword(tokens, 0, "SELECT")
+	if selectAt < 0 {
+		return query
+	}
+	fromAt := indexTopLevelKeyword(tokens, selectAt, "FROM")
+	if fromAt < 0 {
+		// no table, the query returns a single row
+		return query
+	}
+	if indexTopLevelKeyword(tokens, 0, "LIMIT", "FETCH", "TOP", "ROWNUM", "OFFSET", "INTO") >= 0 {
+		return query
+	}
+
+	grouped := indexTopLevelKeyword(tokens, fromAt, "GROUP") >= 0
+	if !grouped {
+		selectList := tokens[selectAt+1 : fromAt]
+		aggregate, window := false, false
+		for i, tok := range selectList {
+			switch {
+			case tok.depth == 0 && aggregateFuncs[tok.keyword()] && i+1 < len(selectList) && selectList[i+1].text == "(":
+				aggregate = true
+			case tok.keyword() == "OVER":
+				window = true
+			}
+		}
+		if aggregate && !window {
+			return query
+		}
+	}
+
+	// the limit goes before the locking clauses and query hints
+	last := tokens[len(tokens)-1]
+	at, sep := last.pos+len(last.text), ""
+	if i := indexTopLevelKeyword(tokens, fromAt, "FOR", "LOCK", "OPTION"); i >= 0 {
+		at, sep = tokens[i].pos, " "
+	}
+
+	var b strings.Builder
+	b.WriteString(strings.TrimRight(query[:at], " \t\r\n"))
+	t.writeLimit(&b, limit, 0, indexTopLevelKeyword(tokens, fromAt, "ORDER") >= 0)
+	b.WriteString(sep)
+	b.WriteString(query[at:])
+	return b.String()
+}
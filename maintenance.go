@@ -0,0 +1,212 @@
+package gotx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ChunkOptions configures the chunked maintenance operations of RunChunks and
+// PurgeRows.
+type ChunkOptions struct {
+	// Pause is the sleep between two chunks, leaving the database time to serve other
+	// transactions and replicas time to catch up.
+	Pause time.Duration
+
+	// MaxChunks stops the operation after that many chunks, e.g. to spread a purge over
+	// several maintenance windows. Zero means no limit.
+	MaxChunks int
+
+	// Options are the options of the transaction of every chunk. Their Propagation is
+	// ignored: every chunk commits its own db transaction.
+	Options *Options
+
+	// OnProgress is called after every chunk committed.
+	OnProgress func(progress ChunkProgress)
+}
+
+// ChunkProgress is the progress of a chunked maintenance operation.
+type ChunkProgress struct {
+	// Partition is the partition of the last chunk, for PurgeRows.
+	Partition string
+
+	// Chunks counts the committed chunks and Rows the rows they affected.
+	Chunks int
+	Rows   int64
+
+	// Elapsed is the time since the operation started, pauses included.
+	Elapsed time.Duration
+}
+
+// RunChunks runs chunk repeatedly, every run in its own transaction, until it returns
+// zero rows affected, an error or ctx is done. It is the pattern of the maintenance
+// operations on large tables, which would hold their locks for too long and bloat the
+// undo log if they ran in a single transaction:
+//
+//	progress, err := tm.RunChunks(ctx, func(tx *gotx.Transaction) (int64, error) {
+//		return tx.Update("UPDATE account SET region = 'eu' WHERE region IS NULL AND id IN"+
+//			" (SELECT id FROM account WHERE region IS NULL LIMIT 10000)", struct{}{})
+//	}, &gotx.ChunkOptions{Pause: time.Second})
+//
+// The chunks which committed are kept when a later one fails, so chunk must select the
+// rows left to process rather than count them. The returned progress covers the
+// committed chunks. opts may be nil.
+func (tm *TxManager) RunChunks(ctx context.Context, chunk func(tx *Transaction) (int64, error), opts *ChunkOptions) (*ChunkProgress, error) {
+	return tm.runChunks(ctx, getCaller(), chunk, "", opts, &ChunkProgress{}, tm.now())
+}
+
+func (tm *TxManager) runChunks(ctx context.Context, caller string, chunk func(tx *Transaction) (int64, error),
+	partition string, opts *ChunkOptions, progress *ChunkProgress, started time.Time) (*ChunkProgress, error) {
+	if opts == nil {
+		opts = &ChunkOptions{}
+	}
+	txOpts := defaultOptions()
+	if opts.Options != nil {
+		copied := *opts.Options
+		txOpts = &copied
+	}
+	txOpts.Propagation = PropagationNew
+
+	for opts.MaxChunks <= 0 || progress.Chunks < opts.MaxChunks {
+		if progress.Chunks > 0 {
+			if err := sleepContext(ctx, tm.clock, opts.Pause); err != nil {
+				return progress, err
+			}
+		}
+
+		var n int64
+		err := tm.exec(ctx, caller, func(tx *Transaction) error {
+			var err error
+			n, err = chunk(tx)
+			return err
+		}, txOpts)
+		if err != nil {
+			return progress, err
+		}
+		if n <= 0 {
+			break
+		}
+
+		progress.Partition = partition
+		progress.Chunks++
+		progress.Rows += n
+		progress.Elapsed = tm.since(started)
+		log.Printf("gotx: chunk %d of %s affected %d rows, %d in total", progress.Chunks, caller, n, progress.Rows)
+		if opts.OnProgress != nil {
+			opts.OnProgress(*progress)
+		}
+	}
+	return progress, nil
+}
+
+// PurgeRows deletes the rows of table matching where, with args as its arguments, in
+// chunks of at most batchSize rows, every chunk in its own transaction, and returns
+// the progress of the purge:
+//
+//	progress, err := tm.PurgeRows(ctx, "audit_log", "created_at < ?", 10000,
+//		&gotx.ChunkOptions{Pause: 100 * time.Millisecond}, time.Now().AddDate(0, -6, 0))
+//
+// A partitioned table is purged one partition after the other, see Partitions, so a
+// chunk only scans and locks a single partition. An empty where deletes all the rows.
+// Bindvars of where must follow the driver's style.
+func (tm *TxManager) PurgeRows(ctx context.Context, table, where string, batchSize int, opts *ChunkOptions, args ...interface{}) (*ChunkProgress, error) {
+	if batchSize <= 0 {
+		return nil, errors.New("gotx: batch size must be positive")
+	}
+
+	partitions, err := tm.Partitions(ctx, table)
+	if err != nil {
+		return nil, err
+	}
+
+	caller := getCaller()
+	progress, started := &ChunkProgress{}, tm.now()
+	for _, partition := range partitions {
+		query := tm.chunkDeleteQuery(partition, strings.TrimSpace(where), batchSize)
+		chunk := func(tx *Transaction) (int64, error) {
+			result, err := tx.exec(query, args...)
+			if err != nil {
+				return 0, fmt.Errorf("purging rows of %s failed: %w", partition, err)
+			}
+			return result.RowsAffected()
+		}
+
+		// the progress is shared, so the pause and the chunk limit span the partitions
+		if _, err := tm.runChunks(ctx, caller, chunk, partition, opts, progress, started); err != nil {
+			return progress, err
+		}
+	}
+	return progress, nil
+}
+
+// chunkDeleteQuery returns the statement deleting up to limit rows of the table
+// expression table matching cond.
+func (tm *TxManager) chunkDeleteQuery(table, cond string, limit int) string {
+	var b strings.Builder
+	switch tm.dialect {
+	case DialectMySQL:
+		b.WriteString("DELETE FROM " + table)
+		writeCondition(&b, cond)
+		fmt.Fprintf(&b, " LIMIT %d", limit)
+	case DialectSQLServer:
+		fmt.Fprintf(&b, "DELETE TOP (%d) FROM %s", limit, table)
+		writeCondition(&b, cond)
+	case DialectOracle:
+		if cond != "" {
+			cond = "(" + cond + ") AND "
+		}
+		b.WriteString("DELETE FROM " + table)
+		writeCondition(&b, fmt.Sprintf("%sROWNUM <= %d", cond, limit))
+	default:
+		// Postgres and SQLite can not limit a DELETE, the physical row ids of a limited
+		// SELECT do
+		rowID := "rowid"
+		if tm.dialect == DialectPostgres {
+			rowID = "ctid"
+		}
+		fmt.Fprintf(&b, "DELETE FROM %s WHERE %s IN (SELECT %s FROM %s", table, rowID, rowID, table)
+		writeCondition(&b, cond)
+		fmt.Fprintf(&b, " LIMIT %d)", limit)
+	}
+	return b.String()
+}
+
+// Partitions returns the partitions of table as table expressions for the statements
+// of a maintenance operation, e.g. "events_2024_01" on Postgres and
+// "events PARTITION (p2024_01)" on MySQL and Oracle. It returns table itself if it is
+// not partitioned, or if the database has no partitions.
+func (tm *TxManager) Partitions(ctx context.Context, table string) ([]string, error) {
+	var query string
+	switch tm.dialect {
+	case DialectPostgres:
+		// the leaves of the partition tree, or the table itself
+		query = "SELECT relid::regclass::text FROM pg_partition_tree($1::regclass) WHERE isleaf ORDER BY 1"
+	case DialectMySQL:
+		query = "SELECT PARTITION_NAME FROM information_schema.PARTITIONS" +
+			" WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND PARTITION_NAME IS NOT NULL ORDER BY PARTITION_ORDINAL_POSITION"
+	case DialectOracle:
+		query = "SELECT partition_name FROM user_tab_partitions WHERE table_name = UPPER(:1) ORDER BY partition_position"
+	default:
+		return []string{table}, nil
+	}
+
+	var names []string
+	if err := tm.db.SelectContext(ctx, &names, query, table); err != nil {
+		return nil, fmt.Errorf("listing partitions of %s failed: %w", table, Translate(err))
+	}
+	if len(names) == 0 {
+		return []string{table}, nil
+	}
+	if tm.dialect == DialectPostgres {
+		return names, nil
+	}
+
+	partitions := make([]string, len(names))
+	for i, name := range names {
+		partitions[i] = table + " PARTITION (" + name + ")"
+	}
+	return partitions, nil
+}
@@ -0,0 +1,58 @@
+package gotx
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// WithMapper sets the mapper used to map struct fields to columns in all transactions of
+// the manager, instead of the mapper of the sqlx.DB. Nested transactions share the
+// mapper of their db transaction.
+func WithMapper(mapper *reflectx.Mapper) ManagerOption {
+	return func(tm *TxManager) {
+		tm.mapper = mapper
+	}
+}
+
+// WithNameMapper maps struct fields to columns using the struct tag tagName, falling
+// back to nameMapper(fieldName) for fields without the tag, e.g.:
+//
+//	gotx.WithNameMapper("db", gotx.SnakeCase)
+//
+// lets fields like CreatedAt map to created_at without a db tag on every field.
+func WithNameMapper(tagName string, nameMapper func(string) string) ManagerOption {
+	return WithMapper(reflectx.NewMapperFunc(tagName, nameMapper))
+}
+
+// SnakeCase converts a Go field name to snake case, e.g. UserID to user_id and
+// HTTPServer to http_server. It is meant to be used with WithNameMapper.
+func SnakeCase(name string) string {
+	runes := []rune(name)
+
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// start a new word at a lower to upper transition, or at the last upper
+			// case letter of an acronym followed by a lower case letter
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) ||
+				(i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				b.WriteByte('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// bindNamedQuestion binds a named query using ? bindvars and the given mapper.
+// sqlx.Named always uses the package level mapper of sqlx, so a Tx without driver
+// name, which binds with ? bindvars, is used instead.
+func bindNamedQuestion(mapper *reflectx.Mapper, query string, arg interface{}) (string, []interface{}, error) {
+	return (&sqlx.Tx{Mapper: mapper}).BindNamed(query, arg)
+}
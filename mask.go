@@ -0,0 +1,330 @@
+package gotx
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// ErrMaskedColumn is returned when rows read one by one, with ForEach or QueryMulti,
+// include a column masked for the role of the transaction. Such rows are scanned by
+// the caller, so their values can not be masked.
+var ErrMaskedColumn = errors.New("gotx: masked column read row by row")
+
+// Mask rewrites the non-NULL value of a masked column. It returns nil to read the
+// column as NULL.
+type Mask func(value interface{}) interface{}
+
+// MaskNull returns a Mask reading the column as NULL.
+func MaskNull() Mask {
+	return func(value interface{}) interface{} {
+		return nil
+	}
+}
+
+// MaskHash returns a Mask replacing the value with the hex encoded SHA-256 of its text,
+// so masked values can still be compared and grouped without being disclosed. Values
+// with few possible texts, such as birth dates, are easily recovered from their hash.
+func MaskHash() Mask {
+	return func(value interface{}) interface{} {
+		sum := sha256.Sum256([]byte(maskText(value)))
+		return hex.EncodeToString(sum[:])
+	}
+}
+
+// MaskPartial returns a Mask keeping the first keepStart and the last keepEnd
+// characters of the text of the value and replacing the others with '*', e.g.
+// "jo***********com" for MaskPartial(2, 3). Values too short to hide anything are
+// masked entirely.
+func MaskPartial(keepStart, keepEnd int) Mask {
+	return func(value interface{}) interface{} {
+		runes := []rune(maskText(value))
+		if len(runes) <= keepStart+keepEnd {
+			return strings.Repeat("*", len(runes))
+		}
+		for i := keepStart; i < len(runes)-keepEnd; i++ {
+			runes[i] = '*'
+		}
+		return string(runes)
+	}
+}
+
+func maskText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// MaskRule masks a column for some roles.
+type MaskRule struct {
+	// Column is the name of the masked column, compared case insensitively with the
+	// columns of the result sets.
+	Column string
+
+	// Roles are the roles the rule applies to, every role if empty.
+	Roles []string
+
+	// Mask rewrites the values of the column. A nil Mask leaves the column unmasked,
+	// to exempt roles from the rules which follow.
+	Mask Mask
+}
+
+type roleContextKey struct{}
+
+// WithRole returns a copy of ctx carrying the role of the caller, for WithMasking.
+func WithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleContextKey{}, role)
+}
+
+// RoleFromContext returns the role carried by ctx, or "" if it has none.
+func RoleFromContext(ctx context.Context) string {
+	role, _ := ctx.Value(roleContextKey{}).(string)
+	return role
+}
+
+// WithMasking masks the values of columns read by transactions according to the role
+// of their caller, so the same repositories serve roles with different data exposure:
+//
+//	tm := gotx.NewTxManager(db, gotx.WithMasking(nil,
+//		gotx.MaskRule{Column: "email", Roles: []string{"admin"}},
+//		gotx.MaskRule{Column: "email", Roles: []string{"support"}, Mask: gotx.MaskPartial(2, 4)},
+//		gotx.MaskRule{Column: "email", Mask: gotx.MaskNull()},
+//	))
+//	err := tm.Exec(gotx.WithRole(ctx, "support"), txFunc, nil)
+//
+// role returns the role of the caller from the context of the transaction, and
+// defaults to RoleFromContext. For each column the first rule applying to the role is
+// used. Struct fields scanned by GetOne and Select are masked by column name, as are
+// the values of Export. String and byte slice fields receive the masked text, fields
+// of other types are zeroed by any mask. Scalar destinations are masked if the select
+// list of the query mentions a masked column. Rows read one by one with ForEach or
+// QueryMulti can not be masked and fail with ErrMaskedColumn instead. Like Policy,
+// masking relies on a lightweight lexer and column names: it is a safeguard, not a
+// security boundary.
+func WithMasking(role func(ctx context.Context) string, rules ...MaskRule) ManagerOption {
+	return func(tm *TxManager) {
+		if role == nil {
+			role = RoleFromContext
+		}
+		m := &masking{role: role, rules: rules}
+		tm.masking = m
+		tm.interceptors = append(tm.interceptors, m)
+	}
+}
+
+type masking struct {
+	role  func(ctx context.Context) string
+	rules []MaskRule
+}
+
+// masks returns the masks of the columns masked for the role of the caller, by lower
+// cased column name.
+func (m *masking) masks(ctx context.Context) map[string]Mask {
+	role := m.role(ctx)
+	decided := make(map[string]bool)
+	masks := make(map[string]Mask)
+	for _, rule := range m.rules {
+		column := strings.ToLower(rule.Column)
+		if decided[column] || (len(rule.Roles) > 0 && !containsString(rule.Roles, role)) {
+			continue
+		}
+		decided[column] = true
+		if rule.Mask != nil {
+			masks[column] = rule.Mask
+		}
+	}
+	return masks
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// mask masks the values scanned into dest by query. It runs after decryption, and
+// after the interceptors so cached results are shared by all roles.
+func (t *Transaction) mask(dest interface{}, query string) {
+	if m := t.txManager.masking; m != nil {
+		if masks := m.masks(t.ctx); len(masks) > 0 {
+			maskDest(t.tx.Mapper, dest, query, t.txManager.dialect, masks)
+		}
+	}
+}
+
+// Intercept rejects the queries whose rows are read one by one and include masked
+// columns. GetOne and Select mask their destinations themselves.
+func (m *masking) Intercept(ctx context.Context, stmt *Statement, next StatementHandler) error {
+	if stmt.Kind == StatementExec || stmt.Kind == StatementGet || stmt.Kind == StatementSelect || stmt.masked {
+		return next(ctx, stmt)
+	}
+	masks := m.masks(ctx)
+	if len(masks) == 0 {
+		return next(ctx, stmt)
+	}
+
+	switch stmt.Kind {
+	case StatementQuery:
+		eachRow, checked := stmt.EachRow, false
+		stmt.EachRow = func(rows *sqlx.Rows) error {
+			if !checked {
+				checked = true
+				columns, err := rows.Columns()
+				if err != nil {
+					return err
+				}
+				for _, column := range columns {
+					if masks[strings.ToLower(column)] != nil {
+						return fmt.Errorf("%w: %s", ErrMaskedColumn, column)
+					}
+				}
+			}
+			return eachRow(rows)
+		}
+		return next(ctx, stmt)
+	default:
+		// the result sets are read after the statement, check the query instead
+		for _, t := range tokenizeSQL(stmt.Query, stmt.dialect()) {
+			if t.kind == tokenPunct && t.text == "*" {
+				return fmt.Errorf("%w: *", ErrMaskedColumn)
+			}
+			if name := columnName(t); masks[name] != nil {
+				return fmt.Errorf("%w: %s", ErrMaskedColumn, name)
+			}
+		}
+		return next(ctx, stmt)
+	}
+}
+
+// columnName returns the lower cased column name of an identifier token, without its
+// qualifier, or "" for other tokens.
+func columnName(t sqlToken) string {
+	if t.kind != tokenWord && t.kind != tokenQuotedIdent {
+		return ""
+	}
+	name := t.ident()
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.ToLower(name)
+}
+
+// selectListMask returns the mask of the first masked column mentioned in the select
+// list of query, or nil.
+func selectListMask(query string, dialect Dialect, masks map[string]Mask) Mask {
+	inList := false
+	for _, t := range tokenizeSQL(query, dialect) {
+		kw := t.keyword()
+		if t.depth == 0 && kw == "SELECT" {
+			inList = true
+			continue
+		}
+		if t.depth == 0 && kw == "FROM" && inList {
+			return nil
+		}
+		if inList {
+			if mask := masks[columnName(t)]; mask != nil {
+				return mask
+			}
+		}
+	}
+	return nil
+}
+
+// maskDest masks the values scanned into dest by query.
+func maskDest(m *reflectx.Mapper, dest interface{}, query string, dialect Dialect, masks map[string]Mask) {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return
+	}
+	v = v.Elem()
+
+	elems := []reflect.Value{v}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		elems = elems[:0]
+		for i := 0; i < v.Len(); i++ {
+			elems = append(elems, reflect.Indirect(v.Index(i)))
+		}
+	}
+
+	var scalarMask Mask
+	for _, elem := range elems {
+		if !elem.IsValid() {
+			continue
+		}
+		if isScannable(elem.Type()) {
+			if scalarMask == nil {
+				if scalarMask = selectListMask(query, dialect, masks); scalarMask == nil {
+					return
+				}
+			}
+			maskValue(elem, scalarMask)
+			continue
+		}
+
+		sm := m.TypeMap(elem.Type())
+		for _, fi := range sm.Index {
+			if mask := masks[strings.ToLower(fi.Path)]; mask != nil {
+				if field := fieldByIndexes(elem, fi.Index); field.IsValid() {
+					maskValue(field, mask)
+				}
+			}
+		}
+	}
+}
+
+// maskValue masks the value of v, a settable value scanned from a column. Empty strings
+// are left alone, they are the zero value of fields the query may not have read.
+func maskValue(v reflect.Value, mask Mask) {
+	target := v
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return
+		}
+		target = v.Elem()
+	}
+
+	var text interface{}
+	switch {
+	case target.Kind() == reflect.String:
+		if target.Len() == 0 {
+			return
+		}
+		text = target.String()
+	case target.Kind() == reflect.Slice && target.Type().Elem().Kind() == reflect.Uint8:
+		if target.Len() == 0 {
+			return
+		}
+		text = target.Bytes()
+	default:
+		v.Set(reflect.Zero(v.Type()))
+		return
+	}
+
+	masked := mask(text)
+	switch {
+	case masked == nil && v.Kind() == reflect.Ptr:
+		v.Set(reflect.Zero(v.Type()))
+	case masked == nil:
+		target.Set(reflect.Zero(target.Type()))
+	case target.Kind() == reflect.String:
+		target.SetString(maskText(masked))
+	default:
+		target.SetBytes([]byte(maskText(masked)))
+	}
+}
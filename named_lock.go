@@ -0,0 +1,121 @@
+package gotx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"math"
+	"time"
+)
+
+// lockPollInterval is how often a Postgres advisory lock is tried until the timeout.
+const lockPollInterval = 50 * time.Millisecond
+
+// NamedLock acquires the application level lock name, waiting at most timeout, and
+// holds it until the db transaction ends, whether it commits or rolls back. It
+// serializes critical sections, e.g. jobs which must not run concurrently, across
+// processes sharing the database. If the lock is not acquired in time, an error
+// matching ErrLockTimeout is returned.
+//
+// On MySQL the lock is taken with GET_LOCK and released with RELEASE_LOCK right before
+// the db transaction commits or rolls back, since MySQL ties named locks to the
+// session rather than the transaction. Names are limited to 64 characters. On Postgres
+// a transaction level advisory lock on the hash of name is taken, which the database
+// releases itself. Acquiring a lock the db transaction holds already, e.g. from a
+// nested transaction, succeeds immediately.
+func (t *Transaction) NamedLock(name string, timeout time.Duration) error {
+	if err := t.checkState(); err != nil {
+		return err
+	}
+
+	t.tx.valuesMux.Lock()
+	held := t.tx.locks[name] > 0
+	if held {
+		t.tx.locks[name]++
+	}
+	t.tx.valuesMux.Unlock()
+	if held {
+		return nil
+	}
+
+	var err error
+	switch t.txManager.dialect {
+	case DialectMySQL:
+		err = t.getLockMySQL(name, timeout)
+	case DialectPostgres:
+		err = t.advisoryLockPostgres(name, timeout)
+	default:
+		err = fmt.Errorf("named locks are not supported by the %s dialect", t.txManager.dialect)
+	}
+	if err != nil {
+		return fmt.Errorf("lock %s failed: %w", name, err)
+	}
+
+	t.tx.valuesMux.Lock()
+	if t.tx.locks == nil {
+		t.tx.locks = make(map[string]int)
+	}
+	t.tx.locks[name]++
+	t.tx.valuesMux.Unlock()
+	return nil
+}
+
+func (t *Transaction) getLockMySQL(name string, timeout time.Duration) error {
+	var acquired sql.NullInt64
+	seconds := int64(math.Ceil(timeout.Seconds()))
+	if err := t.GetOne(&acquired, "SELECT GET_LOCK(?, ?)", name, seconds); err != nil {
+		return err
+	}
+
+	if !acquired.Valid {
+		return fmt.Errorf("gotx: GET_LOCK failed")
+	}
+	if acquired.Int64 != 1 {
+		return ErrLockTimeout
+	}
+
+	t.tx.mysqlLocks = true
+	return nil
+}
+
+func (t *Transaction) advisoryLockPostgres(name string, timeout time.Duration) error {
+	deadline := t.txManager.now().Add(timeout)
+	for {
+		var acquired bool
+		if err := t.GetOne(&acquired, "SELECT pg_try_advisory_xact_lock(hashtext($1))", name); err != nil {
+			return err
+		}
+		if acquired {
+			return nil
+		}
+
+		if t.txManager.now().After(deadline) {
+			return ErrLockTimeout
+		}
+		if err := sleepContext(t.ctx, t.txManager.clock, lockPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+// releaseLocks releases the MySQL named locks held by the db tx. It must run before
+// the db tx ends, while its connection is still in use.
+func (t *rawTx) releaseLocks() {
+	t.valuesMux.Lock()
+	locks := t.locks
+	t.locks = nil
+	t.valuesMux.Unlock()
+
+	if !t.mysqlLocks {
+		return
+	}
+
+	for name := range locks {
+		// the context of the transaction may be canceled already, and a lock left
+		// behind would stay held by the pooled connection
+		if _, err := t.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", name); err != nil {
+			log.Printf("gotx: releasing lock %s of tx-%s failed: %v", name, t.id, err)
+		}
+	}
+}
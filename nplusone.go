@@ -0,0 +1,97 @@
+package gotx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// NPlusOneReport describes a SELECT repeated more often than allowed in one db
+// transaction.
+type NPlusOneReport struct {
+	// TxID is the ID of the db transaction.
+	TxID        string
+	Fingerprint string
+	Query       string
+
+	// Count is how often the query ran when it was reported.
+	Count int
+
+	// Stack is the stack of the execution which exceeded the threshold.
+	Stack []byte
+}
+
+func (r *NPlusOneReport) String() string {
+	return fmt.Sprintf("gotx: possible N+1 query, %q ran %d times in tx-%s\n\nat:\n%s",
+		r.Fingerprint, r.Count, r.TxID, r.Stack)
+}
+
+// nPlusOneKey is the key of the query counters of a detector, stored in the values of
+// the db transaction.
+type nPlusOneKey struct{ detector *NPlusOneDetector }
+
+// NPlusOneDetector is a diagnostic Interceptor which reports a SELECT executed more
+// than a threshold of times within one db transaction, the usual sign of an N+1 query
+// pattern hidden behind a repository layer. Executions are grouped by Fingerprint, so
+// the same query with different arguments counts as a repetition. Each query is
+// reported once per db transaction, with the stack of the execution exceeding the
+// threshold.
+//
+//	detector := gotx.NewNPlusOneDetector(10, nil)
+//	tm := gotx.NewTxManager(db, gotx.WithInterceptors(detector))
+type NPlusOneDetector struct {
+	threshold int
+	onDetect  func(report *NPlusOneReport)
+}
+
+// NewNPlusOneDetector creates a detector reporting queries which run more than
+// threshold times in a db transaction to onDetect. Reports are logged if onDetect is
+// nil.
+func NewNPlusOneDetector(threshold int, onDetect func(report *NPlusOneReport)) *NPlusOneDetector {
+	return &NPlusOneDetector{threshold: threshold, onDetect: onDetect}
+}
+
+// Intercept implements Interceptor.
+func (d *NPlusOneDetector) Intercept(ctx context.Context, stmt *Statement, next StatementHandler) error {
+	if tx := stmt.Tx(); tx != nil && statementVerb(stmt.Query, stmt.dialect()) == "SELECT" {
+		fingerprint := fingerprint(stmt.Query, stmt.dialect())
+		if count := d.count(tx, fingerprint); count == d.threshold+1 {
+			d.report(&NPlusOneReport{
+				TxID:        tx.RootID(),
+				Fingerprint: fingerprint,
+				Query:       stmt.Query,
+				Count:       count,
+				Stack:       debug.Stack(),
+			})
+		}
+	}
+
+	return next(ctx, stmt)
+}
+
+// count increments and returns the number of executions of fingerprint in the db
+// transaction of tx.
+func (d *NPlusOneDetector) count(tx *Transaction, fingerprint string) int {
+	tx.tx.valuesMux.Lock()
+	defer tx.tx.valuesMux.Unlock()
+
+	if tx.tx.values == nil {
+		tx.tx.values = make(map[interface{}]interface{})
+	}
+	counts, _ := tx.tx.values[nPlusOneKey{d}].(map[string]int)
+	if counts == nil {
+		counts = make(map[string]int)
+		tx.tx.values[nPlusOneKey{d}] = counts
+	}
+	counts[fingerprint]++
+	return counts[fingerprint]
+}
+
+func (d *NPlusOneDetector) report(report *NPlusOneReport) {
+	if d.onDetect != nil {
+		d.onDetect(report)
+		return
+	}
+	log.Print(report)
+}
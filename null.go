@@ -0,0 +1,190 @@
+package gotx
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Null is a nullable value of type T. It implements sql.Scanner, driver.Valuer and
+// JSON marshaling, so it replaces the sql.NullString family for any T:
+//
+//	type Account struct {
+//		ID    int64             `db:"id"`
+//		Email gotx.Null[string] `db:"email"`
+//	}
+//
+// An invalid Null is stored and marshaled as NULL. Null converts from and to pointers
+// with NullFromPtr and Ptr, for code which models optional values as pointer fields;
+// database/sql scans NULL into pointer fields as nil already.
+type Null[T any] struct {
+	V     T
+	Valid bool
+}
+
+// NewNull returns a valid Null holding v.
+func NewNull[T any](v T) Null[T] {
+	return Null[T]{V: v, Valid: true}
+}
+
+// NullFromPtr returns a Null holding *p, or an invalid Null if p is nil.
+func NullFromPtr[T any](p *T) Null[T] {
+	if p == nil {
+		return Null[T]{}
+	}
+	return NewNull(*p)
+}
+
+// Ptr returns a pointer to the value, or nil if n is invalid.
+func (n Null[T]) Ptr() *T {
+	if !n.Valid {
+		return nil
+	}
+	v := n.V
+	return &v
+}
+
+// ValueOr returns the value, or fallback if n is invalid.
+func (n Null[T]) ValueOr(fallback T) T {
+	if !n.Valid {
+		return fallback
+	}
+	return n.V
+}
+
+// Scan implements sql.Scanner.
+func (n *Null[T]) Scan(src interface{}) error {
+	var zero T
+	n.V, n.Valid = zero, false
+	if src == nil {
+		return nil
+	}
+
+	if scanner, ok := interface{}(&n.V).(sql.Scanner); ok {
+		if err := scanner.Scan(src); err != nil {
+			return err
+		}
+	} else if err := assignValue(reflect.ValueOf(&n.V).Elem(), src); err != nil {
+		return err
+	}
+
+	n.Valid = true
+	return nil
+}
+
+// Value implements driver.Valuer.
+func (n Null[T]) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	if valuer, ok := interface{}(n.V).(driver.Valuer); ok {
+		return valuer.Value()
+	}
+	return driver.DefaultParameterConverter.ConvertValue(n.V)
+}
+
+// MarshalJSON encodes the value, or null if n is invalid.
+func (n Null[T]) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(n.V)
+}
+
+// UnmarshalJSON decodes a value; null makes n invalid.
+func (n *Null[T]) UnmarshalJSON(data []byte) error {
+	var zero T
+	n.V, n.Valid = zero, false
+	if string(data) == "null" {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, &n.V); err != nil {
+		return err
+	}
+	n.Valid = true
+	return nil
+}
+
+// assignValue stores a driver value in dest, converting between the value types
+// drivers return and the common Go types, e.g. []byte to int64 for MySQL.
+func assignValue(dest reflect.Value, src interface{}) error {
+	sv := reflect.ValueOf(src)
+	if sv.Type().AssignableTo(dest.Type()) {
+		dest.Set(sv)
+		return nil
+	}
+
+	var text string
+	switch v := src.(type) {
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	case time.Time:
+		text = v.Format(time.RFC3339Nano)
+	default:
+		if sv.Type().ConvertibleTo(dest.Type()) && dest.Kind() != reflect.String {
+			dest.Set(sv.Convert(dest.Type()))
+			return nil
+		}
+		text = fmt.Sprint(src)
+	}
+
+	switch dest.Kind() {
+	case reflect.String:
+		dest.SetString(text)
+	case reflect.Slice:
+		if dest.Type().Elem().Kind() != reflect.Uint8 {
+			break
+		}
+		dest.SetBytes([]byte(text))
+		return nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		dest.SetBool(b)
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(text, 10, dest.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dest.SetInt(i)
+		return nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(text, 10, dest.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dest.SetUint(u)
+		return nil
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, dest.Type().Bits())
+		if err != nil {
+			return err
+		}
+		dest.SetFloat(f)
+		return nil
+	}
+
+	if dest.Kind() == reflect.String {
+		return nil
+	}
+	if t, ok := dest.Addr().Interface().(*time.Time); ok {
+		parsed, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return err
+		}
+		*t = parsed
+		return nil
+	}
+
+	return fmt.Errorf("gotx: can not scan %T into %s", src, dest.Type())
+}
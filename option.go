@@ -1,6 +1,9 @@
 package gotx
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+)
 
 // PropagationType is an alias of uint8
 type PropagationType uint8
@@ -15,12 +18,202 @@ const (
 	PropagationNew
 )
 
+// RowLimitPolicy decides what happens when a result set exceeds Options.MaxRows.
+type RowLimitPolicy uint8
+
+const (
+	// RowLimitError fails the query with ErrTooManyRows.
+	RowLimitError RowLimitPolicy = iota
+
+	// RowLimitTruncate silently drops the rows beyond the limit.
+	RowLimitTruncate
+)
+
 // Options declares some configurable options when starts a transaction
 type Options struct {
+	// Name is the logical name of the transaction, such as the use case it implements,
+	// e.g. shown in the tags of WithConnectionTag.
+	Name string
+
 	// PropagationType specifies how the tx manager manages transaction propagation
 	Propagation PropagationType
 
 	IsolationLevel sql.IsolationLevel
+
+	// MaxRetries is how many times the txFunc of a root transaction is run again after
+	// failing with an error the retry classifier of the manager deems retryable. Nested
+	// transactions sharing a db tx are never retried on their own, the root transaction
+	// re-runs the whole unit of work instead. Zero disables retries.
+	MaxRetries int
+
+	// RetryBackoff is the delay before the first retry. It is doubled for every
+	// following retry.
+	RetryBackoff time.Duration
+
+	// Timeout bounds how long a transaction may run. The context of the transaction
+	// gets a deadline Timeout after it starts, and once it expires statements fail and
+	// the db transaction is rolled back. A nested transaction joining the db transaction
+	// of its parent only bounds its own statements. Zero means no timeout.
+	Timeout time.Duration
+
+	// MaxRows limits how many rows Select and ForEach read from a result set, protecting
+	// the service from loading unbounded tables into memory. MaxRowsPolicy decides what
+	// happens with larger result sets. Zero means no limit.
+	MaxRows       int
+	MaxRowsPolicy RowLimitPolicy
+
+	// MaxWriteRows limits how many rows the statements of the transaction and of the
+	// transactions nested in it in the same db transaction may affect in total, a guard
+	// against UPDATE or DELETE statements missing their WHERE clause in ad-hoc tools.
+	// The statement exceeding the limit fails with ErrWriteQuotaExceeded and the db
+	// transaction is rolled back. Rows are counted from the rows affected reported by
+	// the driver, so rows returned by INSERT ... RETURNING statements are not counted.
+	// Zero means no limit.
+	MaxWriteRows int64
+
+	// IdempotencyKey makes Exec run txFunc at most once per key. The key and the JSON
+	// encoded IdempotencyResult are recorded in the gotx_idempotency_keys table in the
+	// same transaction. When Exec is called again with a recorded key, txFunc is skipped
+	// and the recorded result is decoded into IdempotencyResult instead.
+	IdempotencyKey string
+
+	// IdempotencyResult is a pointer to the result of txFunc, which txFunc sets and a
+	// replay restores. It may be nil when there is no result to replay.
+	IdempotencyResult interface{}
+
+	// FencingName and FencingToken fence the writes of the transaction: before the db
+	// transaction commits, FencingToken is checked to still be the latest token issued
+	// for FencingName by NextFencingToken, and otherwise the commit fails with
+	// ErrStaleFencingToken. A holder which lost its lock, e.g. after a long GC pause,
+	// can thus not overwrite the changes of the next holder.
+	FencingName  string
+	FencingToken int64
+
+	// GroupCommit runs a root transaction in a group commit of the manager, if enabled
+	// with WithGroupCommit. Propagation and IsolationLevel are ignored for grouped
+	// transactions.
+	GroupCommit bool
+
+	// Priority is the priority of the transaction. Nested transactions inherit the
+	// priority of their parent unless they set one. On MySQL statements get the
+	// matching priority modifiers, and WithLowPriorityLimit bounds how many statements
+	// of low priority transactions run at a time. Interceptors can read it from
+	// Statement.Priority to queue statements themselves.
+	Priority Priority
+
+	// AsyncCommit lets a root transaction on Postgres commit without waiting for its
+	// WAL to be flushed to disk, with SET LOCAL synchronous_commit = off. This is a
+	// durability trade-off: commits return faster and smoother under load, but a crash
+	// of the database server can lose the transactions committed in the last few
+	// hundred milliseconds (up to three times wal_writer_delay), even though their
+	// commit succeeded. The database stays consistent, no transaction is lost partially.
+	// Use it only for data which can be lost or rebuilt, such as sessions, metrics or
+	// caches. Other databases have no per-transaction setting and ignore it.
+	AsyncCommit bool
+
+	// ReadOnly begins a read-only db transaction, and rejects the statements of the
+	// transaction which do not read with ErrReadOnlyTx. Transactions nested in a
+	// read-only transaction with PropagationRequired are read-only as well.
+	ReadOnly bool
+
+	// Savepoint runs a transaction joining the db transaction of its parent within a
+	// savepoint named sp_<depth>_<id>, see Transaction.Savepoints. When it fails, only
+	// its own changes are rolled back, to the savepoint, and its error is returned to
+	// the parent, whose db transaction goes on. Without it a failing nested transaction
+	// rolls back the whole db transaction. Transactions beginning a db transaction
+	// ignore it.
+	Savepoint bool
+
+	// ReplicationPosition receives the replication position of the primary once the
+	// db transaction begun by the transaction committed, see WithReplicationPosition.
+	ReplicationPosition *ReplicationPosition
+
+	// MinReplicationPosition is the position a replica must have applied for a
+	// read-only transaction to run on it, see WithReplicas. Transactions running on
+	// the primary ignore it.
+	MinReplicationPosition ReplicationPosition
+
+	// Labels annotate the transaction, e.g. with the tenant or the feature it serves,
+	// for hooks, interceptors and logs reading them from Transaction.Labels. Nested
+	// transactions inherit the labels of their parent.
+	Labels map[string]string
+
+	// MaxIdle and IdleAction override the idle limit and action set with WithIdleLimit
+	// for a root transaction. A negative MaxIdle disables the idle check.
+	MaxIdle    time.Duration
+	IdleAction IdleAction
+
+	// snapshot marks the transactions of TxManager.Snapshot
+	snapshot bool
+}
+
+// WithName sets Name and returns o.
+func (o *Options) WithName(name string) *Options {
+	o.Name = name
+	return o
+}
+
+// WithSynchronousCommit sets AsyncCommit to the opposite of on and returns o. Turning
+// synchronous commit off may lose recently committed transactions on a crash, see
+// AsyncCommit.
+func (o *Options) WithSynchronousCommit(on bool) *Options {
+	o.AsyncCommit = !on
+	return o
+}
+
+// WithReadOnly sets ReadOnly and returns o.
+func (o *Options) WithReadOnly() *Options {
+	o.ReadOnly = true
+	return o
+}
+
+// WithSavepoint sets Savepoint and returns o.
+func (o *Options) WithSavepoint() *Options {
+	o.Savepoint = true
+	return o
+}
+
+// WithLabel adds the label key with value to Labels and returns o.
+func (o *Options) WithLabel(key, value string) *Options {
+	if o.Labels == nil {
+		o.Labels = make(map[string]string)
+	}
+	o.Labels[key] = value
+	return o
+}
+
+// WithMaxRows sets MaxRows and returns o.
+func (o *Options) WithMaxRows(n int) *Options {
+	o.MaxRows = n
+	return o
+}
+
+// WithWriteQuota sets MaxWriteRows and returns o:
+//
+//	err := tm.Exec(ctx, fixOrders, (&gotx.Options{}).WithWriteQuota(100))
+func (o *Options) WithWriteQuota(maxRows int64) *Options {
+	o.MaxWriteRows = maxRows
+	return o
+}
+
+// WithIdempotencyKey sets IdempotencyKey and IdempotencyResult and returns o:
+//
+//	var receipt Receipt
+//	err := tm.Exec(ctx, func(tx *gotx.Transaction) error {
+//		receipt, err = charge(tx, order)
+//		return err
+//	}, (&gotx.Options{}).WithIdempotencyKey(requestID, &receipt))
+func (o *Options) WithIdempotencyKey(key string, result interface{}) *Options {
+	o.IdempotencyKey = key
+	o.IdempotencyResult = result
+	return o
+}
+
+// WithFencingToken sets FencingName and FencingToken and returns o.
+func (o *Options) WithFencingToken(name string, token int64) *Options {
+	o.FencingName = name
+	o.FencingToken = token
+	return o
 }
 
 func defaultOptions() *Options {
@@ -29,3 +222,14 @@ func defaultOptions() *Options {
 		IsolationLevel: sql.LevelRepeatableRead,
 	}
 }
+
+// ManagerOption configures a TxManager when it is created by NewTxManager.
+type ManagerOption func(tm *TxManager)
+
+// WithInterceptors appends interceptors to the statement execution chain of the manager.
+// Interceptors run in the order they are given.
+func WithInterceptors(interceptors ...Interceptor) ManagerOption {
+	return func(tm *TxManager) {
+		tm.interceptors = append(tm.interceptors, interceptors...)
+	}
+}
@@ -0,0 +1,358 @@
+package gotx
+
+import (
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a page cursor cannot be decoded.
+var ErrInvalidCursor = errors.New("gotx: invalid page cursor")
+
+// errNullCursorValue is returned for NULL order column values, since no row compares
+// greater or less than NULL.
+var errNullCursorValue = errors.New("gotx: NULL cursor value")
+
+// Page describes the page of a result set to load with SelectPage.
+//
+// With OrderBy set SelectPage uses keyset pagination: the first page is loaded with an
+// empty Cursor, following pages with the NextCursor of the previous one. OrderBy must
+// identify rows uniquely, e.g. "created_at", "id", and its columns must not be NULL:
+// loading the next page fails if a row ending a page has a NULL order column. Without
+// OrderBy, or with Offset set, LIMIT/OFFSET pagination is used.
+type Page struct {
+	// Limit is the maximum number of rows of the page.
+	Limit int
+
+	// Offset is the number of rows skipped in offset pagination.
+	Offset int
+
+	// Cursor is the NextCursor returned for the previous page in keyset pagination.
+	Cursor string
+
+	// OrderBy lists the columns the result set is ordered by. They must be plain column
+	// names of the query's result set.
+	OrderBy []string
+
+	// Desc orders the result set in descending order.
+	Desc bool
+}
+
+// PageInfo describes how to load the page following the one returned by SelectPage.
+type PageInfo struct {
+	// HasMore reports whether there are rows after the returned page.
+	HasMore bool
+
+	// NextCursor is the cursor of the next page in keyset pagination.
+	NextCursor string
+
+	// NextOffset is the offset of the next page in offset pagination.
+	NextOffset int
+}
+
+// SelectPage loads a page of the result set of query into dest, which must be a pointer
+// to a slice. query must not contain ORDER BY or LIMIT clauses: it is wrapped in a
+// subquery to which the ordering, keyset predicate and limit are applied using the
+// syntax of the manager's dialect. Bindvars of query must follow the driver's style.
+func (t *Transaction) SelectPage(dest interface{}, query string, page Page, args ...interface{}) (*PageInfo, error) {
+	if err := t.checkState(); err != nil {
+		return nil, err
+	}
+
+	if page.Limit <= 0 {
+		return nil, errors.New("gotx: page limit must be positive")
+	}
+
+	if page.Cursor != "" && page.Offset > 0 {
+		return nil, errors.New("gotx: page cursor and offset are mutually exclusive")
+	}
+
+	keyset := len(page.OrderBy) > 0 && page.Offset == 0
+	args = append([]interface{}{}, args...)
+
+	var b strings.Builder
+	b.WriteString("SELECT * FROM (")
+	b.WriteString(query)
+	b.WriteString(") gotx_page")
+
+	if keyset && page.Cursor != "" {
+		values, err := decodeCursor(page.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if len(values) != len(page.OrderBy) {
+			return nil, ErrInvalidCursor
+		}
+
+		b.WriteString(" WHERE ")
+		args = t.keysetPredicate(&b, page, values, args)
+	}
+
+	if len(page.OrderBy) > 0 {
+		b.WriteString(" ORDER BY ")
+		for i, col := range page.OrderBy {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(col)
+			if page.Desc {
+				b.WriteString(" DESC")
+			}
+		}
+	}
+
+	// one extra row tells whether there is a next page
+	t.writeLimit(&b, page.Limit+1, page.Offset, len(page.OrderBy) > 0)
+
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return nil, errors.New("gotx: dest must be a non-nil pointer to a slice")
+	}
+	slice := v.Elem()
+	start := slice.Len()
+
+	if err := t.Select(dest, b.String(), args...); err != nil {
+		return nil, err
+	}
+
+	info := &PageInfo{}
+	if slice.Len()-start > page.Limit {
+		info.HasMore = true
+		slice.Set(slice.Slice(0, start+page.Limit))
+	}
+	info.NextOffset = page.Offset + slice.Len() - start
+
+	if keyset && info.HasMore {
+		cursor, err := t.encodeCursor(slice.Index(slice.Len()-1), page.OrderBy)
+		if err != nil {
+			return nil, err
+		}
+		info.NextCursor = cursor
+	}
+
+	return info, nil
+}
+
+// keysetPredicate writes the predicate selecting the rows after the cursor values. It
+// uses the expanded form (a > ? OR (a = ? AND b > ?)) since row value comparisons are
+// not supported by all dialects.
+func (t *Transaction) keysetPredicate(b *strings.Builder, page Page, values []interface{}, args []interface{}) []interface{} {
+	op := " > "
+	if page.Desc {
+		op = " < "
+	}
+
+	b.WriteString("(")
+	for i := range page.OrderBy {
+		if i > 0 {
+			b.WriteString(" OR ")
+		}
+		b.WriteString("(")
+		for j := 0; j < i; j++ {
+			args = append(args, values[j])
+			b.WriteString(page.OrderBy[j] + " = " + t.txManager.Placeholder(len(args)) + " AND ")
+		}
+		args = append(args, values[i])
+		b.WriteString(page.OrderBy[i] + op + t.txManager.Placeholder(len(args)))
+		b.WriteString(")")
+	}
+	b.WriteString(")")
+
+	return args
+}
+
+func (t *Transaction) writeLimit(b *strings.Builder, limit, offset int, ordered bool) {
+	switch t.txManager.dialect {
+	case DialectSQLServer, DialectOracle:
+		if !ordered {
+			b.WriteString(" ORDER BY (SELECT NULL)")
+		}
+		fmt.Fprintf(b, " OFFSET %d ROWS FETCH NEXT %d ROWS ONLY", offset, limit)
+	default:
+		fmt.Fprintf(b, " LIMIT %d", limit)
+		if offset > 0 {
+			fmt.Fprintf(b, " OFFSET %d", offset)
+		}
+	}
+}
+
+// encodeCursor encodes the values of the order columns of row.
+func (t *Transaction) encodeCursor(row reflect.Value, columns []string) (string, error) {
+	row = reflect.Indirect(row)
+
+	values := make([]string, len(columns))
+	for i, col := range columns {
+		var field reflect.Value
+		if isScannable(row.Type()) {
+			if len(columns) > 1 {
+				return "", errors.New("gotx: keyset pagination on multiple columns requires struct rows")
+			}
+			field = row
+		} else {
+			fi, ok := t.tx.Mapper.TypeMap(row.Type()).Names[col]
+			if !ok {
+				return "", fmt.Errorf("gotx: order column %s not found in %s", col, row.Type())
+			}
+			field = row.FieldByIndex(fi.Index)
+		}
+
+		value, err := encodeCursorValue(field.Interface())
+		if err == errNullCursorValue {
+			return "", fmt.Errorf("gotx: order column %s is NULL, keyset pagination requires non-NULL order columns", col)
+		}
+		if err != nil {
+			return "", err
+		}
+		values[i] = value
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// encodeCursorValue encodes a value with a type prefix so it can be restored with
+// its original type. NULL values fail with errNullCursorValue.
+func encodeCursorValue(value interface{}) (string, error) {
+	if valuer, ok := value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err != nil {
+			return "", err
+		}
+		value = v
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return "", errNullCursorValue
+	case time.Time:
+		return "t:" + v.Format(time.RFC3339Nano), nil
+	case []byte:
+		return "x:" + base64.StdEncoding.EncodeToString(v), nil
+	case string:
+		return "s:" + v, nil
+	case bool:
+		return "b:" + strconv.FormatBool(v), nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return "i:" + strconv.FormatInt(rv.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "u:" + strconv.FormatUint(rv.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return "f:" + strconv.FormatFloat(rv.Float(), 'g', -1, 64), nil
+	case reflect.String:
+		return "s:" + rv.String(), nil
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return "", errNullCursorValue
+		}
+		return encodeCursorValue(rv.Elem().Interface())
+	}
+
+	return "", fmt.Errorf("gotx: unsupported cursor value type %T", value)
+}
+
+func decodeCursor(cursor string) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var encoded []string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	values := make([]interface{}, len(encoded))
+	for i, s := range encoded {
+		if len(s) < 2 || s[1] != ':' {
+			return nil, ErrInvalidCursor
+		}
+
+		var err error
+		raw := s[2:]
+		switch s[0] {
+		case 't':
+			values[i], err = time.Parse(time.RFC3339Nano, raw)
+		case 'x':
+			values[i], err = base64.StdEncoding.DecodeString(raw)
+		case 's':
+			values[i] = raw
+		case 'b':
+			values[i], err = strconv.ParseBool(raw)
+		case 'i':
+			values[i], err = strconv.ParseInt(raw, 10, 64)
+		case 'u':
+			values[i], err = strconv.ParseUint(raw, 10, 64)
+		case 'f':
+			values[i], err = strconv.ParseFloat(raw, 64)
+		default:
+			err = ErrInvalidCursor
+		}
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+
+	return values, nil
+}
+
+// FindInBatches pages through the result set of query in batches of batchSize rows,
+// loading each batch into dest, a pointer to a slice, and calling fn with the batch,
+// the slice dest points to. dest is emptied before every batch. Batches are loaded with
+// keyset pagination on the key columns, which must identify rows uniquely, not be
+// NULL and be selected by query, so rows are visited in key order. Returning an error
+// from fn stops the iteration.
+//
+//	var accounts []Account
+//	err := tx.FindInBatches(&accounts, 1000, []string{"id"}, "SELECT * FROM account", func(batch interface{}) error {
+//		for _, account := range batch.([]Account) {
+//			// process account
+//		}
+//		return nil
+//	})
+//
+// All batches are read within the transaction, nothing is committed until the whole
+// transaction ends.
+func (t *Transaction) FindInBatches(dest interface{}, batchSize int, keys []string, query string, fn func(batch interface{}) error, args ...interface{}) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return errors.New("gotx: dest must be a non-nil pointer to a slice")
+	}
+	if len(keys) == 0 {
+		return errors.New("gotx: batches need at least one key column")
+	}
+	slice := v.Elem()
+
+	page := Page{Limit: batchSize, OrderBy: keys}
+	for {
+		slice.Set(slice.Slice(0, 0))
+
+		info, err := t.SelectPage(dest, query, page, args...)
+		if err != nil {
+			return err
+		}
+
+		if slice.Len() > 0 {
+			if err := fn(slice.Interface()); err != nil {
+				return err
+			}
+		}
+
+		if !info.HasMore {
+			return nil
+		}
+		page.Cursor = info.NextCursor
+	}
+}
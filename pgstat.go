@@ -0,0 +1,191 @@
+package gotx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxQueryStats bounds the fingerprints collected by WithQueryStats, statements with
+// other fingerprints are not counted once it is reached.
+const maxQueryStats = 5000
+
+// QueryStats are the counters of the statements with one fingerprint, see Fingerprint.
+type QueryStats struct {
+	Fingerprint string `json:"fingerprint"`
+
+	// Query is the text of the first statement seen with the fingerprint.
+	Query string `json:"query"`
+
+	Calls    int64         `json:"calls"`
+	Duration time.Duration `json:"duration"`
+
+	// Callers are the functions calling the Exec which ran the statements, sorted.
+	Callers []string `json:"callers"`
+}
+
+// WithQueryStats counts the statements run by the transactions of the manager per
+// fingerprint and caller function, for QueryStats and PgStatStatementsReport.
+func WithQueryStats() ManagerOption {
+	return func(tm *TxManager) {
+		tm.queryStats = &queryStatsCollector{queries: make(map[string]*queryCollector)}
+	}
+}
+
+// QueryStats returns the counters of the statements per fingerprint, sorted by
+// decreasing duration, or nil if WithQueryStats is not enabled.
+func (tm *TxManager) QueryStats() []QueryStats {
+	if tm.queryStats == nil {
+		return nil
+	}
+	return tm.queryStats.snapshot()
+}
+
+type callerContextKey struct{}
+
+type queryStatsCollector struct {
+	mux     sync.Mutex
+	queries map[string]*queryCollector
+}
+
+type queryCollector struct {
+	stats   QueryStats
+	callers map[string]bool
+}
+
+func (c *queryStatsCollector) record(query string, caller string, dialect Dialect, d time.Duration) {
+	fingerprint := fingerprint(query, dialect)
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	qc := c.queries[fingerprint]
+	if qc == nil {
+		if len(c.queries) >= maxQueryStats {
+			return
+		}
+		qc = &queryCollector{stats: QueryStats{Fingerprint: fingerprint, Query: query}, callers: make(map[string]bool)}
+		c.queries[fingerprint] = qc
+	}
+	qc.stats.Calls++
+	qc.stats.Duration += d
+	if caller != "" {
+		qc.callers[caller] = true
+	}
+}
+
+func (c *queryStatsCollector) snapshot() []QueryStats {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	result := make([]QueryStats, 0, len(c.queries))
+	for _, qc := range c.queries {
+		stats := qc.stats
+		stats.Callers = sortedKeys(qc.callers)
+		result = append(result, stats)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Duration > result[j].Duration })
+	return result
+}
+
+// PgStatEntry is a statement of pg_stat_statements, correlated with the statements run
+// by gotx with the same fingerprint.
+type PgStatEntry struct {
+	QueryID     int64  `json:"query_id"`
+	Query       string `json:"query"`
+	Fingerprint string `json:"fingerprint"`
+
+	// Calls, TotalTime, MeanTime and Rows are the counters of pg_stat_statements for
+	// all clients of the database.
+	Calls     int64         `json:"calls"`
+	TotalTime time.Duration `json:"total_time"`
+	MeanTime  time.Duration `json:"mean_time"`
+	Rows      int64         `json:"rows"`
+
+	// Gotx are the counters of the statements run by this manager, nil if it ran none.
+	Gotx *QueryStats `json:"gotx,omitempty"`
+
+	// Callers are the counters of the transactions of the callers of Gotx.
+	Callers []CallerStats `json:"callers,omitempty"`
+}
+
+// PgStatStatementsReport reads the limit statements of the current database taking
+// the most time from the pg_stat_statements extension and correlates them with the
+// statements run by this manager, by fingerprint, and with the stats of the functions
+// calling Exec for them. The most expensive statements of the database can thus be
+// traced to the code running them. WithQueryStats must be enabled to correlate the
+// statements. The statistics are read in a read-only db transaction of their own.
+func (tm *TxManager) PgStatStatementsReport(ctx context.Context, limit int) ([]PgStatEntry, error) {
+	if tm.dialect != DialectPostgres {
+		return nil, fmt.Errorf("gotx: pg_stat_statements is not available on %s", tm.dialect)
+	}
+
+	tx, err := tm.db.BeginTxx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, fmt.Errorf("gotx: begin diagnostic tx failed: %w", err)
+	}
+	defer tx.Rollback()
+
+	var version string
+	if err := tx.GetContext(ctx, &version, "SHOW server_version_num"); err != nil {
+		return nil, err
+	}
+	timeColumns := "total_exec_time, mean_exec_time"
+	if v, _ := strconv.Atoi(version); v < 130000 {
+		timeColumns = "total_time, mean_time"
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT queryid, query, calls, "+timeColumns+", rows FROM pg_stat_statements"+
+		" WHERE dbid = (SELECT oid FROM pg_database WHERE datname = current_database())"+
+		" ORDER BY 4 DESC LIMIT $1", limit)
+	if err != nil {
+		return nil, fmt.Errorf("gotx: reading pg_stat_statements failed: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []PgStatEntry
+	for rows.Next() {
+		var e PgStatEntry
+		var queryID sql.NullInt64
+		var total, mean float64
+		if err := rows.Scan(&queryID, &e.Query, &e.Calls, &total, &mean, &e.Rows); err != nil {
+			return nil, err
+		}
+		e.QueryID = queryID.Int64
+		e.Fingerprint = Fingerprint(e.Query)
+		e.TotalTime = time.Duration(total * float64(time.Millisecond))
+		e.MeanTime = time.Duration(mean * float64(time.Millisecond))
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	queries := make(map[string]*QueryStats)
+	for _, qs := range tm.QueryStats() {
+		qs := qs
+		queries[qs.Fingerprint] = &qs
+	}
+	callers := make(map[string]CallerStats)
+	for _, cs := range tm.StatsByCaller() {
+		callers[cs.Caller] = cs
+	}
+
+	for i := range entries {
+		qs, ok := queries[entries[i].Fingerprint]
+		if !ok {
+			continue
+		}
+		entries[i].Gotx = qs
+		for _, caller := range qs.Callers {
+			if cs, ok := callers[caller]; ok {
+				entries[i].Callers = append(entries[i].Callers, cs)
+			}
+		}
+	}
+	return entries, nil
+}
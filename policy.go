@@ -0,0 +1,189 @@
+package gotx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrPolicyViolation is matched by errors returned for statements rejected by a Policy.
+var ErrPolicyViolation = errors.New("gotx: policy violation")
+
+// PolicyError describes a statement rejected by a Policy.
+type PolicyError struct {
+	// Rule is the name of the violated rule.
+	Rule string
+	// Reason explains why the statement violates the rule.
+	Reason string
+	Query  string
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("%s: %s: %s", ErrPolicyViolation, e.Rule, e.Reason)
+}
+
+// Is reports whether target is ErrPolicyViolation.
+func (e *PolicyError) Is(target error) bool {
+	return target == ErrPolicyViolation
+}
+
+// PolicyRule is a named check applied to every statement. Check returns a description
+// of the violation, or an empty string when the statement complies with the rule.
+type PolicyRule struct {
+	Name  string
+	Check func(stmt *Statement) string
+}
+
+// Policy is an Interceptor which inspects each statement before it is executed and
+// rejects violations of its rules with a *PolicyError. It is a safety net for shared
+// codebases, not a security boundary: statements are inspected with a lightweight
+// lexer rather than a full SQL parser.
+//
+//	policy := gotx.NewPolicy(gotx.DenyDDL(), gotx.DenyDeleteWithoutWhere())
+//	tm := gotx.NewTxManager(db, gotx.WithInterceptors(policy))
+type Policy struct {
+	rules []PolicyRule
+}
+
+// NewPolicy creates a Policy enforcing rules.
+func NewPolicy(rules ...PolicyRule) *Policy {
+	return &Policy{rules: rules}
+}
+
+// Check returns the error for the first rule stmt violates, or nil.
+func (p *Policy) Check(stmt *Statement) error {
+	for _, rule := range p.rules {
+		if reason := rule.Check(stmt); reason != "" {
+			return &PolicyError{Rule: rule.Name, Reason: reason, Query: stmt.Query}
+		}
+	}
+	return nil
+}
+
+// Intercept implements Interceptor.
+func (p *Policy) Intercept(ctx context.Context, stmt *Statement, next StatementHandler) error {
+	if err := p.Check(stmt); err != nil {
+		return err
+	}
+	return next(ctx, stmt)
+}
+
+var ddlVerbs = map[string]bool{
+	"CREATE":   true,
+	"ALTER":    true,
+	"DROP":     true,
+	"TRUNCATE": true,
+	"RENAME":   true,
+	"GRANT":    true,
+	"REVOKE":   true,
+	"COMMENT":  true,
+}
+
+// DenyDDL rejects schema changing statements such as CREATE, ALTER, DROP and TRUNCATE.
+func DenyDDL() PolicyRule {
+	return PolicyRule{
+		Name: "deny-ddl",
+		Check: func(stmt *Statement) string {
+			if verb := statementVerb(stmt.Query, stmt.dialect()); ddlVerbs[verb] {
+				return verb + " statements are not allowed"
+			}
+			return ""
+		},
+	}
+}
+
+// DenyDeleteWithoutWhere rejects DELETE statements without a WHERE clause.
+func DenyDeleteWithoutWhere() PolicyRule {
+	return PolicyRule{
+		Name: "deny-delete-without-where",
+		Check: func(stmt *Statement) string {
+			if statementVerb(stmt.Query, stmt.dialect()) == "DELETE" && !hasTopLevelKeyword(stmt.Query, "WHERE", stmt.dialect()) {
+				return "DELETE without WHERE clause"
+			}
+			return ""
+		},
+	}
+}
+
+// DenyUpdateWithoutWhere rejects UPDATE statements without a WHERE clause.
+func DenyUpdateWithoutWhere() PolicyRule {
+	return PolicyRule{
+		Name: "deny-update-without-where",
+		Check: func(stmt *Statement) string {
+			if statementVerb(stmt.Query, stmt.dialect()) == "UPDATE" && !hasTopLevelKeyword(stmt.Query, "WHERE", stmt.dialect()) {
+				return "UPDATE without WHERE clause"
+			}
+			return ""
+		},
+	}
+}
+
+var readOnlyVerbs = map[string]bool{
+	"SELECT":   true,
+	"SHOW":     true,
+	"EXPLAIN":  true,
+	"DESCRIBE": true,
+	"DESC":     true,
+	"VALUES":   true,
+}
+
+// ReadOnly only allows statements which read data, such as SELECT, SHOW and EXPLAIN.
+// Locking reads like SELECT ... FOR UPDATE are allowed, and so are the savepoints of
+// nested transactions, which do not write. Reads with data modifying common table
+// expressions, such as WITH d AS (DELETE ...) SELECT ..., are rejected.
+func ReadOnly() PolicyRule {
+	return PolicyRule{
+		Name: "read-only",
+		Check: func(stmt *Statement) string {
+			if verb := statementVerb(stmt.Query, stmt.dialect()); !readOnlyVerbs[verb] && !savepointVerbs[verb] {
+				return verb + " statements are not allowed in read-only mode"
+			}
+			if writes(stmt) {
+				return "data modifying common table expressions are not allowed in read-only mode"
+			}
+			return ""
+		},
+	}
+}
+
+// AllowTables only allows statements referencing the given tables. Table names are
+// compared case insensitively, schema qualified names must be listed as such.
+func AllowTables(tables ...string) PolicyRule {
+	allowed := tableSet(tables)
+	return PolicyRule{
+		Name: "allow-tables",
+		Check: func(stmt *Statement) string {
+			for _, table := range statementTables(stmt.Query, stmt.dialect()) {
+				if !allowed[table] {
+					return "access to table " + table + " is not allowed"
+				}
+			}
+			return ""
+		},
+	}
+}
+
+// DenyTables rejects statements referencing any of the given tables.
+func DenyTables(tables ...string) PolicyRule {
+	denied := tableSet(tables)
+	return PolicyRule{
+		Name: "deny-tables",
+		Check: func(stmt *Statement) string {
+			for _, table := range statementTables(stmt.Query, stmt.dialect()) {
+				if denied[table] {
+					return "access to table " + table + " is denied"
+				}
+			}
+			return ""
+		},
+	}
+}
+
+func tableSet(tables []string) map[string]bool {
+	set := make(map[string]bool, len(tables))
+	for _, t := range tables {
+		set[strings.ToLower(t)] = true
+	}
+	return set
+}
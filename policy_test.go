@@ -0,0 +1,25 @@
+package gotx
+
+import "testing"
+
+func TestReadOnly(t *testing.T) {
+	tests := []struct {
+		query   string
+		allowed bool
+	}{
+		{"SELECT * FROM account FOR UPDATE", true},
+		{"SAVEPOINT sp_1", true},
+		{"WITH a AS (SELECT id FROM account) SELECT * FROM a", true},
+		{"UPDATE account SET name = 'x'", false},
+		{"WITH d AS (DELETE FROM account RETURNING id) SELECT * FROM d", false},
+		{"WITH u AS (UPDATE account SET name = 'x' RETURNING id) SELECT * FROM u", false},
+	}
+
+	policy := NewPolicy(ReadOnly())
+	for _, tt := range tests {
+		err := policy.Check(&Statement{Kind: StatementSelect, Query: tt.query})
+		if allowed := err == nil; allowed != tt.allowed {
+			t.Errorf("Check(%q) = %v, want allowed %v", tt.query, err, tt.allowed)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package gotx
+
+import "strings"
+
+// PgBouncerRetryClassifier treats the errors PgBouncer reports when a server
+// connection fails or a pool is exhausted, and the errors of prepared statements
+// created on one server connection and used on another, as retryable.
+var PgBouncerRetryClassifier = MessageRetryClassifier(
+	"server conn crashed",
+	"server closed the connection unexpectedly",
+	"pgbouncer cannot connect to server",
+	"query_wait_timeout",
+	"no more connections allowed",
+	"server login has been failing",
+	"prepared statement \"",
+)
+
+// sessionFunctions are functions changing the state of the session rather than of
+// the transaction.
+var sessionFunctions = map[string]bool{
+	"PG_ADVISORY_LOCK":            true,
+	"PG_ADVISORY_LOCK_SHARED":     true,
+	"PG_TRY_ADVISORY_LOCK":        true,
+	"PG_TRY_ADVISORY_LOCK_SHARED": true,
+	"PG_ADVISORY_UNLOCK":          true,
+	"PG_ADVISORY_UNLOCK_SHARED":   true,
+	"PG_ADVISORY_UNLOCK_ALL":      true,
+}
+
+// DenySessionState rejects statements changing the state of the database session,
+// which is lost or leaks to other clients behind a transaction pooler such as
+// PgBouncer in transaction mode: SET and RESET other than SET LOCAL, SET TRANSACTION
+// and SET CONSTRAINTS, set_config with is_local false, PREPARE, LISTEN, cursors WITH
+// HOLD, temporary tables not dropped on commit, LOAD, DISCARD and session advisory
+// locks.
+func DenySessionState() PolicyRule {
+	return PolicyRule{
+		Name:  "session-state",
+		Check: sessionStateViolation,
+	}
+}
+
+func sessionStateViolation(stmt *Statement) string {
+	tokens := tokenizeSQL(stmt.Query, stmt.dialect())
+	if len(tokens) == 0 {
+		return ""
+	}
+
+	next := func(i int) string {
+		if i+1 < len(tokens) {
+			return tokens[i+1].keyword()
+		}
+		return ""
+	}
+
+	switch verb := tokens[0].keyword(); verb {
+	case "SET":
+		switch next(0) {
+		case "LOCAL", "TRANSACTION", "CONSTRAINTS":
+			return ""
+		}
+		return "SET changes the session, use SET LOCAL"
+	case "RESET", "PREPARE", "LISTEN", "LOAD", "DISCARD":
+		return verb + " statements change the session"
+	case "DECLARE":
+		for i := range tokens {
+			if tokens[i].keyword() == "WITH" && next(i) == "HOLD" {
+				return "cursors WITH HOLD outlive the transaction"
+			}
+		}
+	case "CREATE":
+		if kw := next(0); kw == "TEMP" || kw == "TEMPORARY" {
+			for i := range tokens {
+				if tokens[i].keyword() == "COMMIT" && next(i) == "DROP" {
+					return ""
+				}
+			}
+			return "temporary tables must be created with ON COMMIT DROP"
+		}
+	}
+
+	for i, t := range tokens {
+		kw := t.keyword()
+		if sessionFunctions[kw] && i+1 < len(tokens) && tokens[i+1].text == "(" {
+			return strings.ToLower(kw) + " takes a session lock, use the _xact_ variant"
+		}
+		if kw == "SET_CONFIG" && setConfigIsSession(tokens[i+1:]) {
+			return "set_config with is_local false changes the session"
+		}
+	}
+	return ""
+}
+
+// setConfigIsSession reports whether the arguments of a set_config call starting at
+// tokens pass false as is_local.
+func setConfigIsSession(tokens []sqlToken) bool {
+	if len(tokens) == 0 || tokens[0].text != "(" {
+		return false
+	}
+
+	depth := tokens[0].depth
+	last := ""
+	for _, t := range tokens[1:] {
+		if t.text == ")" && t.depth == depth {
+			return last == "FALSE"
+		}
+		last = t.keyword()
+	}
+	return false
+}
+
+// WithPgBouncer configures the manager for databases behind a transaction pooler such
+// as PgBouncer in transaction mode, where consecutive transactions of a connection may
+// run on different server connections: statements changing the session are rejected
+// with DenySessionState, the errors of the pooler are retryable in addition to the
+// ones of the retry classifier, even one set by a later WithRetryClassifier, and
+// ValidateQueries prepares queries within a transaction.
+//
+// Prepared statements of the driver must be disabled or kept to a transaction too,
+// e.g. with default_query_exec_mode=simple_protocol for pgx. DBLock takes session
+// locks and must not be used through the pooler.
+func WithPgBouncer() ManagerOption {
+	return func(tm *TxManager) {
+		tm.pooled = true
+		tm.interceptors = append(tm.interceptors, NewPolicy(DenySessionState()))
+	}
+}
@@ -0,0 +1,106 @@
+package gotx
+
+import "context"
+
+// Priority is the priority of a transaction relative to the other transactions of the
+// application, e.g. interactive requests versus background batches.
+type Priority int8
+
+const (
+	PriorityLow    Priority = -1
+	PriorityNormal Priority = 0
+	PriorityHigh   Priority = 1
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "normal"
+	}
+}
+
+// WithPriority sets Priority and returns o.
+func (o *Options) WithPriority(p Priority) *Options {
+	o.Priority = p
+	return o
+}
+
+// WithLowPriorityLimit lets at most n statements of low priority transactions run at a
+// time. Further statements of low priority transactions wait for a slot, so background
+// batches can not occupy all connections of the pool while interactive traffic waits.
+// Statements of other transactions never wait.
+func WithLowPriorityLimit(n int) ManagerOption {
+	return func(tm *TxManager) {
+		tm.lowPrioritySlots = make(chan struct{}, n)
+	}
+}
+
+// acquireSlot waits for a slot for a statement of priority p, and returns the function
+// releasing it.
+func (tm *TxManager) acquireSlot(ctx context.Context, p Priority) (func(), error) {
+	if p != PriorityLow || tm.lowPrioritySlots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case tm.lowPrioritySlots <- struct{}{}:
+		return func() { <-tm.lowPrioritySlots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// priorityHint adds the MySQL priority modifier of p to query: HIGH_PRIORITY for SELECT
+// and INSERT statements of high priority transactions, and LOW_PRIORITY for INSERT,
+// REPLACE, UPDATE and DELETE statements of low priority ones. The modifiers only
+// affect storage engines using table level locks, such as MyISAM. Other queries are
+// returned unchanged.
+func priorityHint(query string, p Priority) string {
+	tokens := tokenizeSQL(query, DialectMySQL)
+	if len(tokens) == 0 {
+		return query
+	}
+
+	var hint string
+	switch verb := tokens[0].keyword(); {
+	case p == PriorityHigh && (verb == "SELECT" || verb == "INSERT"):
+		hint = "HIGH_PRIORITY"
+	case p == PriorityLow && (verb == "INSERT" || verb == "REPLACE" || verb == "UPDATE" || verb == "DELETE"):
+		hint = "LOW_PRIORITY"
+	default:
+		return query
+	}
+
+	if len(tokens) > 1 && tokens[1].keyword() == hint {
+		return query
+	}
+
+	pos := tokens[0].pos + len(tokens[0].text)
+	return query[:pos] + " " + hint + query[pos:]
+}
+
+// applyPriority rewrites stmt for the priority of its transaction.
+func (t *Transaction) applyPriority(stmt *Statement) {
+	stmt.Priority = t.priority
+	if t.priority == PriorityNormal || t.txManager.dialect != DialectMySQL {
+		return
+	}
+
+	switch stmt.Kind {
+	case StatementExec, StatementGet, StatementSelect, StatementQuery:
+		stmt.Query = priorityHint(stmt.Query, t.priority)
+	}
+}
+
+// inheritPriority returns the priority of a transaction started with options in
+// parent, which inherits the priority of its parent unless options set one.
+func inheritPriority(options *Options, parent *Transaction) Priority {
+	if options.Priority != PriorityNormal || parent == nil {
+		return options.Priority
+	}
+	return parent.priority
+}
@@ -0,0 +1,338 @@
+package gotx
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrQueryNotFound is returned when a query name is not registered with the manager.
+var ErrQueryNotFound = errors.New("gotx: query not found")
+
+var queryNamePattern = regexp.MustCompile(`^\s*--\s*name:\s*(\S+)`)
+
+// LoadQueries loads SQL files matching the glob pattern from fsys into the query
+// registry of the manager, so SQL can live in files with editor support instead of Go
+// string literals. Each query is introduced by a name annotation and extends to the
+// next one:
+//
+//	-- name: find-account
+//	SELECT * FROM account WHERE id = ?
+//
+//	-- name: rename-account
+//	UPDATE account SET name = :name WHERE id = :id
+//
+// Loading fails if a name is registered twice. Use Transaction.Named to run registered
+// queries and RequireQueries to check at startup that the names a program uses exist.
+func (tm *TxManager) LoadQueries(fsys fs.FS, pattern string) error {
+	files, err := fs.Glob(fsys, pattern)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("gotx: no query files match %s", pattern)
+	}
+
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+
+		queries, err := parseQueryFile(string(data), tm.dialect)
+		if err != nil {
+			return fmt.Errorf("gotx: %s: %w", file, err)
+		}
+
+		for _, q := range queries {
+			if err := tm.RegisterQuery(q[0], q[1]); err != nil {
+				return fmt.Errorf("gotx: %s: %w", file, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// RegisterQuery adds a query to the registry of the manager under name.
+func (tm *TxManager) RegisterQuery(name string, query string) error {
+	tm.mux.Lock()
+	defer tm.mux.Unlock()
+
+	if tm.queries == nil {
+		tm.queries = make(map[string]string)
+	}
+	if _, ok := tm.queries[name]; ok {
+		return fmt.Errorf("query %s registered twice", name)
+	}
+
+	tm.queries[name] = query
+	return nil
+}
+
+// Query returns the registered query name.
+func (tm *TxManager) Query(name string) (string, bool) {
+	tm.mux.Lock()
+	defer tm.mux.Unlock()
+
+	query, ok := tm.queries[name]
+	return query, ok
+}
+
+// QueryNames returns the sorted names of all registered queries.
+func (tm *TxManager) QueryNames() []string {
+	tm.mux.Lock()
+	defer tm.mux.Unlock()
+
+	names := make([]string, 0, len(tm.queries))
+	for name := range tm.queries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RequireQueries returns an error listing all of names which are not registered. Call
+// it at startup with the names a program references.
+func (tm *TxManager) RequireQueries(names ...string) error {
+	var missing []string
+	for _, name := range names {
+		if _, ok := tm.Query(name); !ok {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrQueryNotFound, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// parseQueryFile splits a query file into name and query pairs.
+func parseQueryFile(content string, dialect Dialect) ([][2]string, error) {
+	var queries [][2]string
+	var name string
+	var body strings.Builder
+
+	flush := func() error {
+		if name == "" {
+			if strings.TrimSpace(body.String()) != "" && len(tokenizeSQL(body.String(), dialect)) > 0 {
+				return errors.New("SQL found before the first name annotation")
+			}
+			return nil
+		}
+
+		query := strings.TrimSpace(body.String())
+		query = strings.TrimSpace(strings.TrimSuffix(query, ";"))
+		if query == "" {
+			return fmt.Errorf("query %s is empty", name)
+		}
+		queries = append(queries, [2]string{name, query})
+		return nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if m := queryNamePattern.FindStringSubmatch(line); m != nil {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			name = m[1]
+			body.Reset()
+			continue
+		}
+
+		body.WriteString(line)
+		body.WriteString("\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return queries, nil
+}
+
+// NamedQuery is a registered query bound to a transaction.
+type NamedQuery struct {
+	tx    *Transaction
+	name  string
+	query string
+}
+
+// Named returns the query registered with the manager under name, bound to the
+// transaction. Running an unknown query returns ErrQueryNotFound.
+//
+//	err := tx.Named("find-account").GetOne(&account, id)
+func (t *Transaction) Named(name string) *NamedQuery {
+	query, _ := t.txManager.Query(name)
+	return &NamedQuery{tx: t, name: name, query: query}
+}
+
+// SQL returns the query text, or an empty string for unknown queries.
+func (q *NamedQuery) SQL() string {
+	return q.query
+}
+
+func (q *NamedQuery) check() error {
+	if q.query == "" {
+		return fmt.Errorf("%w: %s", ErrQueryNotFound, q.name)
+	}
+	return nil
+}
+
+// GetOne runs the query with positional args like Transaction.GetOne.
+func (q *NamedQuery) GetOne(dest interface{}, args ...interface{}) error {
+	if err := q.check(); err != nil {
+		return err
+	}
+	return q.tx.GetOne(dest, q.query, args...)
+}
+
+// Select runs the query with positional args like Transaction.Select.
+func (q *NamedQuery) Select(dest interface{}, args ...interface{}) error {
+	if err := q.check(); err != nil {
+		return err
+	}
+	return q.tx.Select(dest, q.query, args...)
+}
+
+// ForEach runs the query with positional args like Transaction.ForEach.
+func (q *NamedQuery) ForEach(fn func(rows *sqlx.Rows) error, args ...interface{}) error {
+	if err := q.check(); err != nil {
+		return err
+	}
+	return q.tx.ForEach(q.query, fn, args...)
+}
+
+// Exec runs the query with named parameters bound to arg like Transaction.NamedExec
+// and returns the number of affected rows.
+func (q *NamedQuery) Exec(arg interface{}) (int64, error) {
+	if err := q.check(); err != nil {
+		return 0, err
+	}
+	return q.tx.NamedExec(q.query, arg)
+}
+
+// Insert runs the query with named parameters bound to arg like Transaction.Insert
+// and returns the generated ID.
+func (q *NamedQuery) Insert(arg interface{}) (int64, error) {
+	if err := q.check(); err != nil {
+		return 0, err
+	}
+	return q.tx.Insert(q.query, arg)
+}
+
+// QueryValidationError lists the registered queries which failed validation by name.
+type QueryValidationError struct {
+	Errors map[string]error
+}
+
+func (e *QueryValidationError) Error() string {
+	names := make([]string, 0, len(e.Errors))
+	for name := range e.Errors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "gotx: %d invalid queries", len(names))
+	for _, name := range names {
+		fmt.Fprintf(&b, "\n\t%s: %s", name, e.Errors[name])
+	}
+	return b.String()
+}
+
+// ValidateQueries prepares every registered query on the database and deallocates it
+// again, so syntax errors and references to missing tables or columns surface at
+// startup rather than under traffic. Queries are prepared through the driver, which
+// uses the PREPARE and DEALLOCATE messages of the server protocol where the database
+// supports them, and compiled with EXPLAIN on SQLite. With WithPgBouncer queries are
+// prepared within a transaction. All failures are reported together in a
+// *QueryValidationError.
+func (tm *TxManager) ValidateQueries(ctx context.Context) error {
+	failed := make(map[string]error)
+	for _, name := range tm.QueryNames() {
+		query, _ := tm.Query(name)
+		if err := tm.prepareQuery(ctx, query); err != nil {
+			failed[name] = err
+		}
+	}
+
+	if len(failed) > 0 {
+		return &QueryValidationError{Errors: failed}
+	}
+	return nil
+}
+
+// prepareQuery prepares and closes query, binding named parameters to NULL first.
+func (tm *TxManager) prepareQuery(ctx context.Context, query string) error {
+	params := make(map[string]interface{})
+	for _, t := range tokenizeSQL(query, tm.dialect) {
+		if t.kind == tokenParam && t.text[0] == ':' {
+			params[t.text[1:]] = nil
+		}
+	}
+
+	if len(params) > 0 {
+		bound, _, err := bindNamedQuestion(tm.db.Mapper, query, params)
+		if err != nil {
+			return err
+		}
+		query = tm.db.Rebind(bound)
+	} else if tm.rebind {
+		query = rebindQuery(tm.bindType(), query, tm.dialect)
+	}
+
+	if tm.dialect == DialectSQLite {
+		// some sqlite drivers prepare lazily; EXPLAIN compiles without executing
+		rows, err := tm.db.QueryContext(ctx, "EXPLAIN "+query, make([]interface{}, countParams(query, tm.dialect))...)
+		if err != nil {
+			return Translate(err)
+		}
+		return rows.Close()
+	}
+
+	if tm.pooled {
+		// behind a transaction pooler prepared statements only live as long as a tx
+		tx, err := tm.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return Translate(err)
+		}
+		return stmt.Close()
+	}
+
+	stmt, err := tm.db.PrepareContext(ctx, query)
+	if err != nil {
+		return Translate(err)
+	}
+	return stmt.Close()
+}
+
+// countParams returns the number of positional parameters of query.
+func countParams(query string, dialect Dialect) int {
+	n := 0
+	for _, t := range tokenizeSQL(query, dialect) {
+		if t.kind == tokenParam {
+			n++
+		}
+	}
+	return n
+}
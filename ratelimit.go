@@ -0,0 +1,211 @@
+package gotx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// ErrRateLimited is matched by the errors of Exec calls rejected by a rate limit of
+// WithRateLimits.
+var ErrRateLimited = errors.New("gotx: rate limited")
+
+// RateLimitError is returned by Exec calls rejected by a rate limit.
+type RateLimitError struct {
+	// Key is the limiter key of the exhausted limit.
+	Key string
+
+	// RetryAfter is how long until the limit admits a transaction again, e.g. for the
+	// Retry-After header of a 429 Too Many Requests response. Zero if unknown.
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("%s: %s, retry after %s", ErrRateLimited, e.Key, e.RetryAfter.Round(time.Millisecond))
+	}
+	return fmt.Sprintf("%s: %s", ErrRateLimited, e.Key)
+}
+
+// Is reports whether target is ErrRateLimited.
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrRateLimited
+}
+
+// RateLimiter counts the transactions admitted by rate limits. Implementations keep
+// the limits in memory, see NewTokenBucketLimiter, or in a shared store such as Redis
+// to limit all the instances of a service together.
+type RateLimiter interface {
+	// Allow takes a token from the bucket key, which holds up to limit tokens and is
+	// refilled with limit tokens every per. It reports whether a token was available,
+	// and otherwise how long until one is.
+	Allow(ctx context.Context, key string, limit int, per time.Duration) (ok bool, retryAfter time.Duration, err error)
+}
+
+// RateLimitRule limits how many of the transactions it selects may start per period.
+type RateLimitRule struct {
+	// Key identifies the limit in the limiter. Rules sharing a key share their tokens.
+	Key string
+
+	// TxName and Labels select the transactions with this Options.Name and these
+	// labels, inherited ones included. Empty selectors select every transaction.
+	TxName string
+	Labels map[string]string
+
+	// PerLabel gives each value of this label its own limit, e.g. "tenant". The
+	// transactions without the label share one limit.
+	PerLabel string
+
+	// Limit transactions may start every Per.
+	Limit int
+	Per   time.Duration
+}
+
+// WithRateLimits rejects the Exec calls exceeding the rate limits of rules with an
+// error matching ErrRateLimited, before any transaction begins, so expensive
+// operations can not starve the database:
+//
+//	tm := gotx.NewTxManager(db, gotx.WithRateLimits(gotx.NewTokenBucketLimiter(),
+//		gotx.RateLimitRule{Key: "export", TxName: "export", PerLabel: "tenant", Limit: 10, Per: time.Minute},
+//	))
+//	err := tm.Exec(ctx, export, (&gotx.Options{Name: "export"}).WithLabel("tenant", tenantID))
+//
+// Every rule selecting the transaction takes a token, the first exhausted one rejects
+// it. Nested transactions are limited like root ones, retries of a transaction are
+// not limited again. Errors of the limiter fail the Exec call.
+func WithRateLimits(limiter RateLimiter, rules ...RateLimitRule) ManagerOption {
+	return func(tm *TxManager) {
+		tm.rateLimiter = limiter
+		if u, ok := limiter.(clockUser); ok {
+			tm.clockUsers = append(tm.clockUsers, u)
+		}
+		tm.rateLimits = append(tm.rateLimits, rules...)
+	}
+}
+
+// matches reports whether the rule selects a transaction named name with labels.
+func (r *RateLimitRule) matches(name string, labels map[string]string) bool {
+	if r.Limit <= 0 || (r.TxName != "" && r.TxName != name) {
+		return false
+	}
+	for k, v := range r.Labels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// checkRateLimits takes a token from the limits of the transaction started with opt,
+// nested in parent if not nil.
+func (tm *TxManager) checkRateLimits(ctx context.Context, opt *Options, parent *Transaction) error {
+	if tm.rateLimiter == nil || len(tm.rateLimits) == 0 {
+		return nil
+	}
+
+	labels := opt.Labels
+	if parent != nil {
+		labels = inheritOptions(opt, parent, false).Labels
+	}
+
+	for i := range tm.rateLimits {
+		rule := &tm.rateLimits[i]
+		if !rule.matches(opt.Name, labels) {
+			continue
+		}
+
+		key := rule.Key
+		if rule.PerLabel != "" {
+			key += ":" + rule.PerLabel + "=" + labels[rule.PerLabel]
+		}
+		ok, retryAfter, err := tm.rateLimiter.Allow(ctx, key, rule.Limit, rule.Per)
+		if err != nil {
+			return fmt.Errorf("gotx: rate limiter failed: %w", err)
+		}
+		if !ok {
+			return &RateLimitError{Key: key, RetryAfter: retryAfter}
+		}
+	}
+	return nil
+}
+
+// tokenBucketPruneEvery is how many calls of Allow pass between the removals of the
+// full buckets.
+const tokenBucketPruneEvery = 1024
+
+// TokenBucketLimiter is an in-memory RateLimiter with a token bucket per key, limiting
+// the transactions of one process.
+type TokenBucketLimiter struct {
+	mux     sync.Mutex
+	buckets map[string]*tokenBucket
+	calls   int
+	clock   Clock
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+	limit   int
+	per     time.Duration
+}
+
+// NewTokenBucketLimiter returns an empty TokenBucketLimiter. It refills its buckets on
+// the clock of the first manager it is passed to with WithRateLimits.
+func NewTokenBucketLimiter() *TokenBucketLimiter {
+	return &TokenBucketLimiter{buckets: make(map[string]*tokenBucket), clock: SystemClock{}}
+}
+
+// useClock implements clockUser.
+func (l *TokenBucketLimiter) useClock(clock Clock) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+	if _, ok := l.clock.(SystemClock); ok {
+		l.clock = clock
+	}
+}
+
+// refill adds the tokens earned since the last update.
+func (b *tokenBucket) refill(now time.Time) {
+	rate := float64(b.limit) / float64(b.per)
+	b.tokens = math.Min(float64(b.limit), b.tokens+float64(now.Sub(b.updated))*rate)
+	b.updated = now
+}
+
+// Allow implements RateLimiter.
+func (l *TokenBucketLimiter) Allow(ctx context.Context, key string, limit int, per time.Duration) (bool, time.Duration, error) {
+	if limit <= 0 || per <= 0 {
+		return true, 0, nil
+	}
+
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	now := l.clock.Now()
+	l.calls++
+	if l.calls%tokenBucketPruneEvery == 0 {
+		// full buckets are the same as missing ones
+		for k, b := range l.buckets {
+			if b.refill(now); b.tokens >= float64(b.limit) {
+				delete(l.buckets, k)
+			}
+		}
+	}
+
+	b := l.buckets[key]
+	if b == nil {
+		b = &tokenBucket{tokens: float64(limit), updated: now}
+		l.buckets[key] = b
+	}
+	b.limit, b.per = limit, per
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0, nil
+	}
+	rate := float64(limit) / float64(per)
+	return false, time.Duration(math.Ceil((1 - b.tokens) / rate)), nil
+}
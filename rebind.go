@@ -0,0 +1,50 @@
+package gotx
+
+import (
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// WithAutoRebind lets queries be written with ? placeholders for every database: the
+// transactions of the manager rewrite them to the bindvars of the driver before the
+// statements run, e.g. $1, $2 for Postgres or @p1, @p2 for SQL Server. Interceptors
+// see the rewritten query. Question marks in string literals, quoted identifiers and
+// comments are left alone, and ?? is rewritten to a single ?, for the JSON operators
+// of Postgres. Queries already using the bindvars of the driver are not changed.
+func WithAutoRebind() ManagerOption {
+	return func(tm *TxManager) {
+		tm.rebind = true
+	}
+}
+
+// rebindQuery rewrites the ? placeholders of query to the bindvars of bindType.
+func rebindQuery(bindType int, query string, dialect Dialect) string {
+	if bindType == sqlx.QUESTION || bindType == sqlx.UNKNOWN || !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	tokens := tokenizeSQL(query, dialect)
+	last, n := 0, 0
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.kind != tokenParam || t.text != "?" {
+			continue
+		}
+
+		b.WriteString(query[last:t.pos])
+		last = t.pos + 1
+		if i+1 < len(tokens) && tokens[i+1].text == "?" && tokens[i+1].pos == last {
+			// ?? escapes a literal question mark
+			b.WriteByte('?')
+			last++
+			i++
+			continue
+		}
+		n++
+		b.WriteString(bindVar(bindType, n))
+	}
+	b.WriteString(query[last:])
+	return b.String()
+}
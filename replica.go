@@ -0,0 +1,148 @@
+package gotx
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// replicaPollInterval is how often lagging replicas are checked while a transaction
+// waits for one of them to reach its minimum replication position.
+const replicaPollInterval = 10 * time.Millisecond
+
+// ReplicationPosition is an opaque position in the replication stream of the primary
+// database: the WAL LSN on Postgres and the executed GTID set on MySQL. A replica
+// which reached the position has applied every transaction committed before it was
+// captured. The empty position is reached by every replica.
+type ReplicationPosition string
+
+// WithReplicationPosition makes a transaction beginning a db transaction store the
+// replication position of the primary into dst once it committed, and returns o:
+//
+//	var pos gotx.ReplicationPosition
+//	err := tm.Exec(ctx, placeOrder, (&gotx.Options{}).WithReplicationPosition(&pos))
+//	...
+//	// later, e.g. in the next request of the same user carrying pos in a cookie
+//	err = tm.Exec(ctx, showOrders, (&gotx.Options{}).WithReadOnly().WithMinReplicationPosition(pos))
+//
+// The position is read right after the commit, so it may include later transactions
+// of other sessions, never miss this one. Reading it failing does not fail the
+// committed transaction: it is logged and dst is left empty. Databases other than
+// Postgres and MySQL have no position, dst is left empty.
+func (o *Options) WithReplicationPosition(dst *ReplicationPosition) *Options {
+	o.ReplicationPosition = dst
+	return o
+}
+
+// WithMinReplicationPosition sets MinReplicationPosition and returns o.
+func (o *Options) WithMinReplicationPosition(pos ReplicationPosition) *Options {
+	o.MinReplicationPosition = pos
+	return o
+}
+
+// WithReplicas routes the read-only transactions beginning a db transaction to the
+// replicas, in turn, rather than to the db of the manager, the primary. Transactions
+// with a MinReplicationPosition only run on a replica which applied that position,
+// which gives read-your-writes across nodes. If none did, the transaction waits up to
+// wait for one to catch up, polling them, and then runs on the primary. A zero wait
+// skips the lagging replicas at once. Transactions of a WithSession connection stay
+// on the primary.
+func WithReplicas(wait time.Duration, replicas ...*sqlx.DB) ManagerOption {
+	return func(tm *TxManager) {
+		tm.replicas = &replicaSet{dbs: replicas, wait: wait}
+	}
+}
+
+type replicaSet struct {
+	dbs  []*sqlx.DB
+	wait time.Duration
+	next uint32
+}
+
+// dbFor returns the db a db transaction with options begins on.
+func (tm *TxManager) dbFor(ctx context.Context, options *Options) *sqlx.DB {
+	rs := tm.replicas
+	if rs == nil || len(rs.dbs) == 0 || !options.ReadOnly {
+		return tm.db
+	}
+	if _, ok := ctx.Value(sessionContextKey{}).(*session); ok {
+		return tm.db
+	}
+
+	start := int(atomic.AddUint32(&rs.next, 1))
+	if options.MinReplicationPosition == "" {
+		return rs.dbs[start%len(rs.dbs)]
+	}
+
+	deadline := tm.now().Add(rs.wait)
+	for {
+		for i := range rs.dbs {
+			db := rs.dbs[(start+i)%len(rs.dbs)]
+			if tm.reachedPosition(ctx, db, options.MinReplicationPosition) {
+				return db
+			}
+		}
+		if !tm.now().Before(deadline) || sleepContext(ctx, tm.clock, replicaPollInterval) != nil {
+			return tm.db
+		}
+	}
+}
+
+// reachedPosition reports whether the replica db applied pos. Replicas which can not
+// tell, e.g. because they are unreachable, did not.
+func (tm *TxManager) reachedPosition(ctx context.Context, db *sqlx.DB, pos ReplicationPosition) bool {
+	var query string
+	switch tm.dialect {
+	case DialectPostgres:
+		// a server which is not in recovery is a primary
+		query = "SELECT COALESCE(pg_last_wal_replay_lsn() >= $1::pg_lsn, true)"
+	case DialectMySQL:
+		query = "SELECT GTID_SUBSET(?, @@GLOBAL.gtid_executed) = 1"
+	default:
+		return true
+	}
+
+	var reached bool
+	if err := db.QueryRowContext(ctx, query, string(pos)).Scan(&reached); err != nil {
+		log.Printf("gotx: checking replication position of replica failed: %v", err)
+		return false
+	}
+	return reached
+}
+
+// replicationPosition returns the current replication position of the primary.
+func (tm *TxManager) replicationPosition(ctx context.Context) (ReplicationPosition, error) {
+	var query string
+	switch tm.dialect {
+	case DialectPostgres:
+		query = "SELECT pg_current_wal_lsn()::text"
+	case DialectMySQL:
+		query = "SELECT @@GLOBAL.gtid_executed"
+	default:
+		return "", nil
+	}
+
+	var pos string
+	if err := tm.db.QueryRowContext(ctx, query).Scan(&pos); err != nil {
+		return "", err
+	}
+	return ReplicationPosition(pos), nil
+}
+
+// captureReplicationPosition stores the replication position of the primary for
+// trans, which committed, if its options ask for it.
+func (tm *TxManager) captureReplicationPosition(trans *Transaction, opt *Options) {
+	if opt.ReplicationPosition == nil || trans.txID != trans.tx.id {
+		return
+	}
+
+	pos, err := tm.replicationPosition(trans.ctx)
+	if err != nil {
+		log.Printf("gotx: reading replication position after %s failed: %v", trans, err)
+		return
+	}
+	*opt.ReplicationPosition = pos
+}
@@ -0,0 +1,87 @@
+package gotx
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ResultSets iterates over the result sets of a query returning more than one, like a
+// MySQL multi-statement query or a procedure returning several result sets:
+//
+//	sets, err := tx.QueryMulti("CALL account_report(?)", id)
+//	if err != nil {
+//		return err
+//	}
+//	defer sets.Close()
+//
+//	for sets.Next() {
+//		// scan the current result set with sets.Select or sets.Rows
+//	}
+//	return sets.Err()
+type ResultSets struct {
+	rows    *sqlx.Rows
+	started bool
+	err     error
+}
+
+// QueryMulti runs a query returning several result sets. The caller must close the
+// returned ResultSets before running other statements in the transaction.
+func (t *Transaction) QueryMulti(query string, args ...interface{}) (*ResultSets, error) {
+	if err := t.checkState(); err != nil {
+		return nil, err
+	}
+
+	stmt := &Statement{Kind: StatementMultiQuery, Query: query, Args: args}
+	if err := t.run(stmt); err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	return &ResultSets{rows: stmt.Rows}, nil
+}
+
+// Next advances to the next result set and reports whether there is one. The first
+// call moves to the first result set.
+func (r *ResultSets) Next() bool {
+	if r.err != nil {
+		return false
+	}
+
+	if !r.started {
+		r.started = true
+		return true
+	}
+
+	if !r.rows.NextResultSet() {
+		r.err = Translate(r.rows.Err())
+		return false
+	}
+	return true
+}
+
+// Rows returns the rows of the current result set.
+func (r *ResultSets) Rows() *sqlx.Rows {
+	return r.rows
+}
+
+// Select scans all rows of the current result set into dest, which must be a pointer
+// to a slice, like Transaction.Select.
+func (r *ResultSets) Select(dest interface{}) error {
+	scan := scanInto(dest)
+	for r.rows.Next() {
+		if err := scan(r.rows); err != nil {
+			return err
+		}
+	}
+	return Translate(r.rows.Err())
+}
+
+// Err returns the error which stopped the iteration, if any.
+func (r *ResultSets) Err() error {
+	return r.err
+}
+
+// Close closes the result sets.
+func (r *ResultSets) Close() error {
+	return r.rows.Close()
+}
@@ -0,0 +1,61 @@
+package gotx
+
+// StatementResult is the outcome of a statement run in a db transaction.
+type StatementResult struct {
+	// TxID is the ID of the logical transaction which ran the statement.
+	TxID  string
+	Kind  StatementKind
+	Query string
+	Args  []interface{}
+
+	// RowsAffected and LastInsertID are reported by the driver for StatementExec
+	// statements, if it supports them.
+	RowsAffected int64
+	LastInsertID int64
+
+	Err error
+}
+
+// WithStatementResults makes transactions record the result of every statement, so
+// hooks can inspect what a transaction changed with Transaction.StatementResults, e.g.
+// to write audit records in BeforeCommit or publish changes in AfterCommit.
+func WithStatementResults() ManagerOption {
+	return func(tm *TxManager) {
+		tm.recordResults = true
+	}
+}
+
+// StatementResults returns the results of the statements run so far in the db
+// transaction, by this and the other logical transactions sharing it, in order.
+// Results are only recorded with WithStatementResults, and they remain available to
+// the commit and rollback hooks.
+func (t *Transaction) StatementResults() []StatementResult {
+	t.tx.valuesMux.Lock()
+	defer t.tx.valuesMux.Unlock()
+
+	return append([]StatementResult(nil), t.tx.results...)
+}
+
+// recordResult appends the result of stmt to the results of the db transaction.
+func (t *Transaction) recordResult(stmt *Statement, err error) {
+	result := StatementResult{
+		TxID:  t.txID,
+		Kind:  stmt.Kind,
+		Query: stmt.Query,
+		Args:  stmt.Args,
+		Err:   err,
+	}
+
+	if err == nil && stmt.Result != nil {
+		if n, err := stmt.Result.RowsAffected(); err == nil {
+			result.RowsAffected = n
+		}
+		if id, err := stmt.Result.LastInsertId(); err == nil {
+			result.LastInsertID = id
+		}
+	}
+
+	t.tx.valuesMux.Lock()
+	t.tx.results = append(t.tx.results, result)
+	t.tx.valuesMux.Unlock()
+}
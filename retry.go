@@ -0,0 +1,164 @@
+package gotx
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"time"
+)
+
+// maxRetryDelay caps the exponential retry backoff.
+const maxRetryDelay = 5 * time.Second
+
+// RetryClassifier decides whether a transaction which failed with err may be run again.
+type RetryClassifier interface {
+	IsRetryable(err error) bool
+}
+
+// RetryClassifierFunc is an adapter to allow the use of ordinary functions as retry classifiers.
+type RetryClassifierFunc func(err error) bool
+
+// IsRetryable calls f(err).
+func (f RetryClassifierFunc) IsRetryable(err error) bool {
+	return f(err)
+}
+
+// DefaultRetryClassifier treats serialization failures, deadlocks, lock wait timeouts
+// and broken connections as retryable, which covers Postgres and MySQL.
+var DefaultRetryClassifier RetryClassifier = RetryClassifierFunc(func(err error) bool {
+	return errors.Is(err, ErrSerializationFailure) ||
+		errors.Is(err, ErrDeadlock) ||
+		errors.Is(err, ErrLockTimeout) ||
+		errors.Is(err, driver.ErrBadConn)
+})
+
+// AnyRetryable combines classifiers: an error is retryable if any of them says so.
+// Use it to extend DefaultRetryClassifier:
+//
+//	gotx.WithRetryClassifier(gotx.AnyRetryable(
+//		gotx.DefaultRetryClassifier,
+//		gotx.MessageRetryClassifier("server closed the connection unexpectedly"),
+//	))
+func AnyRetryable(classifiers ...RetryClassifier) RetryClassifier {
+	return RetryClassifierFunc(func(err error) bool {
+		for _, c := range classifiers {
+			if c.IsRetryable(err) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// MessageRetryClassifier treats errors whose message contains any of substrings as
+// retryable. It is meant for transient errors which proxies or managed databases only
+// report as text, e.g. PgBouncer or RDS failover messages.
+func MessageRetryClassifier(substrings ...string) RetryClassifier {
+	return RetryClassifierFunc(func(err error) bool {
+		msg := err.Error()
+		for _, s := range substrings {
+			if strings.Contains(msg, s) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// WithRetryClassifier replaces DefaultRetryClassifier as the retry decision of the manager.
+func WithRetryClassifier(c RetryClassifier) ManagerOption {
+	return func(tm *TxManager) {
+		tm.retryClassifier = c
+	}
+}
+
+// IsRetryable reports whether err is retryable according to the retry classifier of
+// the manager, for callers which retry failed transactions themselves, such as job
+// runners or workflow engines.
+func (tm *TxManager) IsRetryable(err error) bool {
+	return err != nil && tm.retryClassifier.IsRetryable(err)
+}
+
+// RetryEvent describes a failed attempt of a transaction which is run again.
+type RetryEvent struct {
+	// Caller is the function calling Exec, and Name the Options.Name of the transaction.
+	Caller string
+	Name   string
+
+	// Attempt is the number of the failed attempt, 1 for the first one.
+	Attempt int
+
+	// Err is the error of the attempt, and Class its ErrorClass.
+	Err   error
+	Class string
+
+	// Backoff is the delay before the next attempt.
+	Backoff time.Duration
+}
+
+// ExecSummary describes a finished Exec call.
+type ExecSummary struct {
+	Caller string
+	Name   string
+
+	// Attempts is the number of times the txFunc ran, 1 unless the transaction was
+	// retried.
+	Attempts int
+
+	// Retryable is set for the Exec calls owning their db transaction, which may be
+	// retried. Nested transactions joining their parent are retried with it.
+	Retryable bool
+
+	// Duration is the time spent in Exec, including the retries and their backoff.
+	Duration time.Duration
+
+	// Err is the error returned by Exec.
+	Err error
+}
+
+// ErrorClass returns a short name of the kind of err, for metrics and logs: one of
+// serialization_failure, deadlock, lock_timeout, unique_violation,
+// foreign_key_violation, check_violation, not_null_violation, bad_conn, timeout,
+// canceled or other. It returns "" for nil.
+func ErrorClass(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	classes := []struct {
+		kind  error
+		class string
+	}{
+		{ErrSerializationFailure, "serialization_failure"},
+		{ErrDeadlock, "deadlock"},
+		{ErrLockTimeout, "lock_timeout"},
+		{ErrUniqueViolation, "unique_violation"},
+		{ErrForeignKeyViolation, "foreign_key_violation"},
+		{ErrCheckViolation, "check_violation"},
+		{ErrNotNullViolation, "not_null_violation"},
+		{driver.ErrBadConn, "bad_conn"},
+		{context.DeadlineExceeded, "timeout"},
+		{context.Canceled, "canceled"},
+	}
+	err = Translate(err)
+	for _, c := range classes {
+		if errors.Is(err, c.kind) {
+			return c.class
+		}
+	}
+	return "other"
+}
+
+// retryDelay returns the backoff before retry attempt+1.
+func retryDelay(backoff time.Duration, attempt int) time.Duration {
+	delay := backoff
+	for i := 0; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxRetryDelay {
+		return maxRetryDelay
+	}
+	return delay
+}
@@ -0,0 +1,185 @@
+package gotx
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	deleteFromPattern  = regexp.MustCompile(`(?is)^\s*DELETE\s+FROM\s+`)
+	deleteTablePattern = regexp.MustCompile(`(?is)^\s*DELETE\s+(?:FROM\s+)?[^\s(]+`)
+)
+
+// DeleteReturning runs a named DELETE query and scans the deleted rows into dest, which
+// must be a pointer to a slice, so the caller can archive or publish the removed rows
+// in the same transaction:
+//
+//	var removed []Session
+//	err := tx.DeleteReturning(&removed, "DELETE FROM session WHERE expires_at < :now", args)
+//
+// Postgres and SQLite use DELETE ... RETURNING * and SQL Server uses OUTPUT DELETED.*.
+// Other dialects select the matching rows with SELECT ... FOR UPDATE first and then
+// delete them, which supports single table DELETE FROM queries only. arg may be nil
+// for queries without parameters.
+func (t *Transaction) DeleteReturning(dest interface{}, query string, arg interface{}) error {
+	if err := t.checkState(); err != nil {
+		return err
+	}
+
+	query2, args, err := t.bindNamed(query, arg)
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+
+	switch t.txManager.dialect {
+	case DialectPostgres, DialectSQLite:
+		if !hasTopLevelKeyword(query2, "RETURNING", t.txManager.dialect) {
+			query2 += " RETURNING *"
+		}
+		err = t.run(&Statement{Kind: StatementQuery, Query: query2, Args: args, EachRow: scanInto(dest)})
+
+	case DialectSQLServer:
+		loc := deleteTablePattern.FindStringIndex(query2)
+		if loc == nil {
+			err = errors.New("gotx: not a DELETE query")
+			break
+		}
+		query2 = query2[:loc[1]] + " OUTPUT DELETED.*" + query2[loc[1]:]
+		err = t.run(&Statement{Kind: StatementQuery, Query: query2, Args: args, EachRow: scanInto(dest)})
+
+	default:
+		loc := deleteFromPattern.FindStringIndex(query2)
+		if loc == nil {
+			err = errors.New("gotx: only single table DELETE FROM queries can return rows")
+			break
+		}
+
+		selectQuery := "SELECT * FROM " + query2[loc[1]:] + " FOR UPDATE"
+		err = t.run(&Statement{Kind: StatementQuery, Query: selectQuery, Args: args, EachRow: scanInto(dest)})
+		if err == nil {
+			_, err = t.exec(query2, args...)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	return nil
+}
+
+// UpdateReturning runs a named UPDATE query and scans the updated rows, as they are
+// after the update including columns modified by triggers, into dest, which must be a
+// pointer to a slice. It saves the second query reading the rows back:
+//
+//	var accounts []Account
+//	err := tx.UpdateReturning(&accounts, "UPDATE account SET balance = balance - :amount WHERE id = :id", arg)
+//
+// Postgres and SQLite use UPDATE ... RETURNING * and SQL Server uses OUTPUT INSERTED.*.
+// MySQL has no such clause, so on MySQL and other dialects the update is emulated for
+// single table UPDATE ... SET queries of tables with an "id" key column: the IDs of the
+// matching rows are selected with SELECT ... FOR UPDATE, the update runs, and the rows
+// with these IDs are selected again. arg may be nil for queries without parameters.
+func (t *Transaction) UpdateReturning(dest interface{}, query string, arg interface{}) error {
+	if err := t.checkState(); err != nil {
+		return err
+	}
+
+	query2, args, err := t.bindNamed(query, arg)
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+
+	switch t.txManager.dialect {
+	case DialectPostgres, DialectSQLite:
+		if !hasTopLevelKeyword(query2, "RETURNING", t.txManager.dialect) {
+			query2 += " RETURNING *"
+		}
+		err = t.run(&Statement{Kind: StatementQuery, Query: query2, Args: args, EachRow: scanInto(dest)})
+
+	case DialectSQLServer:
+		// OUTPUT follows the SET clause
+		tokens := tokenizeSQL(query2, t.txManager.dialect)
+		pos := len(query2)
+		if set := indexTopLevelKeyword(tokens, 0, "SET"); set >= 0 {
+			if i := indexTopLevelKeyword(tokens, set+1, "FROM", "WHERE", "OPTION"); i >= 0 {
+				pos = tokens[i].pos
+			}
+		}
+		query2 = strings.TrimSpace(strings.TrimRight(query2[:pos], " \t\r\n") + " OUTPUT INSERTED.* " + query2[pos:])
+		err = t.run(&Statement{Kind: StatementQuery, Query: query2, Args: args, EachRow: scanInto(dest)})
+
+	default:
+		err = t.emulateUpdateReturning(dest, query2, args)
+	}
+
+	if err != nil {
+		return fmt.Errorf("update failed: %w", err)
+	}
+	return nil
+}
+
+// emulateUpdateReturning locks the IDs of the rows matched by an update, runs the
+// update and selects the updated rows by ID.
+func (t *Transaction) emulateUpdateReturning(dest interface{}, query string, args []interface{}) error {
+	tokens := tokenizeSQL(query, t.txManager.dialect)
+	set := indexTopLevelKeyword(tokens, 0, "SET")
+	if len(tokens) < 3 || tokens[0].keyword() != "UPDATE" || set < 2 {
+		return errors.New("gotx: only single table UPDATE queries can return rows")
+	}
+	for _, tok := range tokens[1:set] {
+		if tok.kind != tokenWord && tok.kind != tokenQuotedIdent && tok.text != "." {
+			return errors.New("gotx: only single table UPDATE queries can return rows")
+		}
+	}
+	table := strings.TrimSpace(query[tokens[1].pos:tokens[set].pos])
+
+	// the WHERE clause uses the arguments after the ones of the SET clause
+	where, whereArgs := "", args
+	if i := indexTopLevelKeyword(tokens, set+1, "WHERE", "ORDER", "LIMIT"); i >= 0 {
+		where = query[tokens[i].pos:]
+		n := 0
+		for _, tok := range tokens[:i] {
+			if tok.kind == tokenParam {
+				n++
+			}
+		}
+		if n > len(args) {
+			n = len(args)
+		}
+		whereArgs = args[n:]
+	}
+
+	var ids []interface{}
+	lockQuery := "SELECT id FROM " + table + " " + where + " FOR UPDATE"
+	err := t.run(&Statement{Kind: StatementQuery, Query: lockQuery, Args: whereArgs, EachRow: scanInto(&ids)})
+	if err != nil {
+		return err
+	}
+
+	if _, err := t.exec(query, args...); err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	selectQuery, selectArgs, err := sqlx.In("SELECT * FROM "+table+" WHERE id IN (?)", ids)
+	if err != nil {
+		return err
+	}
+	selectQuery = t.tx.Rebind(selectQuery)
+	return t.run(&Statement{Kind: StatementQuery, Query: selectQuery, Args: selectArgs, EachRow: scanInto(dest)})
+}
+
+// bindNamed binds the named parameters of query to arg using the bindvars of the
+// driver. A nil arg leaves the query unchanged.
+func (t *Transaction) bindNamed(query string, arg interface{}) (string, []interface{}, error) {
+	if arg == nil {
+		return query, nil, nil
+	}
+	return t.tx.BindNamed(query, arg)
+}
@@ -0,0 +1,90 @@
+package gotx
+
+import (
+	"errors"
+	"fmt"
+	"log"
+)
+
+// RollbackErrorPolicy decides what a transaction returns when rolling it back fails
+// after an error, see WithRollbackErrorPolicy.
+type RollbackErrorPolicy uint8
+
+const (
+	// RollbackErrorJoin returns the error causing the rollback joined with a
+	// *RollbackError wrapping the rollback failure, so errors.Is and errors.As match
+	// both.
+	RollbackErrorJoin RollbackErrorPolicy = iota
+
+	// RollbackErrorReplace returns the rollback failure alone.
+	RollbackErrorReplace
+
+	// RollbackErrorIgnore returns the error causing the rollback alone. The rollback
+	// failure is logged.
+	RollbackErrorIgnore
+)
+
+// RollbackError is a failure to roll back the db transaction TxID after an error,
+// returned joined with that error under RollbackErrorJoin:
+//
+//	err := tm.Exec(ctx, txFunc, nil)
+//	if errors.Is(err, ErrOutOfStock) {
+//		// the business error is still there
+//	}
+//	if rbErr, ok := gotx.RollbackFailure(err); ok {
+//		log.Printf("tx %s may be left open: %v", rbErr.TxID, rbErr.Err)
+//	}
+type RollbackError struct {
+	// TxID is the ID of the logical transaction which began the db transaction.
+	TxID string
+
+	// Err is the error of the rollback.
+	Err error
+}
+
+func (e *RollbackError) Error() string {
+	return fmt.Sprintf("gotx: rollback of tx %s failed: %v", e.TxID, e.Err)
+}
+
+func (e *RollbackError) Unwrap() error {
+	return e.Err
+}
+
+// RollbackFailure returns the rollback failure joined to err, if any.
+func RollbackFailure(err error) (*RollbackError, bool) {
+	var rbErr *RollbackError
+	if errors.As(err, &rbErr) {
+		return rbErr, true
+	}
+	return nil, false
+}
+
+// WithRollbackErrorPolicy sets what a transaction returns when rolling it back fails
+// after an error. The default is RollbackErrorJoin.
+func WithRollbackErrorPolicy(p RollbackErrorPolicy) ManagerOption {
+	return func(tm *TxManager) {
+		tm.rollbackErrorPolicy = p
+	}
+}
+
+// rollbackError returns the error of a transaction of the db transaction txID which
+// failed with err and whose rollback failed with rbErr, according to the policy of
+// the manager.
+func (tm *TxManager) rollbackError(txID string, err, rbErr error) error {
+	if rbErr == nil {
+		return err
+	}
+	if err == nil {
+		return rbErr
+	}
+
+	switch tm.rollbackErrorPolicy {
+	case RollbackErrorReplace:
+		return rbErr
+	case RollbackErrorIgnore:
+		log.Printf("rollback failure: %+v", rbErr)
+		return err
+	default:
+		return errors.Join(err, &RollbackError{TxID: txID, Err: rbErr})
+	}
+}
@@ -0,0 +1,333 @@
+// Package saga runs sagas, sequences of steps each committed in its own transaction
+// with compensating steps undoing them when a later step fails:
+//
+//	checkout := saga.New[Order](tm, "checkout")
+//	checkout.Step("reserve-stock").Do(reserveStock).Compensate(releaseStock).Timeout(5 * time.Second)
+//	checkout.Step("charge").Do(charge).Compensate(refund)
+//	checkout.Step("ship").Do(ship)
+//
+//	err := checkout.Run(ctx, orderID, &order)
+//
+// Steps share a typed state, which is saved as JSON with the progress of the saga in
+// the gotx_sagas table, in the same transaction as the step. A saga interrupted by a
+// process restart is continued by Resume from the last committed step.
+package saga
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/oligo/gotx"
+)
+
+// table is the table storing the progress of sagas.
+const table = "gotx_sagas"
+
+// Status is the status of a saga.
+type Status string
+
+const (
+	// StatusRunning is the status of a saga running its steps.
+	StatusRunning Status = "running"
+	// StatusCompleted is the status of a saga which ran all its steps.
+	StatusCompleted Status = "completed"
+	// StatusCompensating is the status of a saga undoing its steps after one failed.
+	StatusCompensating Status = "compensating"
+	// StatusCompensated is the status of a saga which undid all its completed steps.
+	StatusCompensated Status = "compensated"
+)
+
+var (
+	// ErrCompensated is returned for a saga which failed and was compensated.
+	ErrCompensated = errors.New("saga: compensated")
+
+	// ErrConflict is returned when the progress of a saga was saved by another process
+	// running the same saga concurrently.
+	ErrConflict = errors.New("saga: progress saved concurrently")
+)
+
+// StepFunc is the function of a step or of its compensation. It runs in the
+// transaction of the step and may modify the state, which is saved when the
+// transaction commits.
+type StepFunc[S any] func(tx *gotx.Transaction, state *S) error
+
+// Saga is a sequence of steps sharing a state of type S.
+type Saga[S any] struct {
+	tm    *gotx.TxManager
+	name  string
+	steps []*Step[S]
+}
+
+// Step is a step of a saga, configured with its fluent methods.
+type Step[S any] struct {
+	name       string
+	do         StepFunc[S]
+	compensate StepFunc[S]
+	timeout    time.Duration
+}
+
+// New returns an empty saga named name whose steps run in transactions of tm.
+func New[S any](tm *gotx.TxManager, name string) *Saga[S] {
+	return &Saga[S]{tm: tm, name: name}
+}
+
+// Step appends the step name to the saga and returns it for configuration.
+func (s *Saga[S]) Step(name string) *Step[S] {
+	step := &Step[S]{name: name}
+	s.steps = append(s.steps, step)
+	return step
+}
+
+// Do sets the function of the step and returns st.
+func (st *Step[S]) Do(fn StepFunc[S]) *Step[S] {
+	st.do = fn
+	return st
+}
+
+// Compensate sets the function undoing the step, run when a later step fails, and
+// returns st. Steps without compensation are skipped when the saga is compensated.
+func (st *Step[S]) Compensate(fn StepFunc[S]) *Step[S] {
+	st.compensate = fn
+	return st
+}
+
+// Timeout bounds the transaction of the step and of its compensation, see
+// gotx.Options.Timeout, and returns st.
+func (st *Step[S]) Timeout(d time.Duration) *Step[S] {
+	st.timeout = d
+	return st
+}
+
+// CreateTable creates the table storing the progress of sagas if it does not exist.
+// Call it at startup, or create the table with a migration using the same columns.
+func CreateTable(ctx context.Context, tm *gotx.TxManager) error {
+	var ddl string
+	switch tm.Dialect() {
+	case gotx.DialectSQLServer:
+		ddl = "IF OBJECT_ID('" + table + "') IS NULL CREATE TABLE " + table +
+			" (id NVARCHAR(255) PRIMARY KEY, name NVARCHAR(255) NOT NULL, status NVARCHAR(32) NOT NULL," +
+			" step INT NOT NULL, state NVARCHAR(MAX), error NVARCHAR(MAX), updated_at DATETIME2 NOT NULL)"
+	case gotx.DialectOracle:
+		ddl = "CREATE TABLE " + table +
+			" (id VARCHAR2(255) PRIMARY KEY, name VARCHAR2(255) NOT NULL, status VARCHAR2(32) NOT NULL," +
+			" step NUMBER(10) NOT NULL, state CLOB, error CLOB, updated_at TIMESTAMP NOT NULL)"
+	default:
+		ddl = "CREATE TABLE IF NOT EXISTS " + table +
+			" (id VARCHAR(255) PRIMARY KEY, name VARCHAR(255) NOT NULL, status VARCHAR(32) NOT NULL," +
+			" step INT NOT NULL, state TEXT, error TEXT, updated_at TIMESTAMP NOT NULL)"
+	}
+
+	return tm.CreateIfNotExists(ctx, ddl)
+}
+
+// progress is the saved progress of a saga. Step is the index of the next step to run
+// while running, and the number of steps left to compensate while compensating.
+type progress struct {
+	Status Status         `db:"status"`
+	Step   int            `db:"step"`
+	State  sql.NullString `db:"state"`
+	Err    sql.NullString `db:"error"`
+}
+
+// Run runs the saga id with state, which must be a non-nil pointer. If a step fails,
+// the completed steps are compensated in reverse order and an error matching
+// ErrCompensated, describing the failed step, is returned. Running a saga id again
+// continues it where it stopped, or returns its outcome if it finished, restoring
+// its saved state into state.
+func (s *Saga[S]) Run(ctx context.Context, id string, state *S) error {
+	for _, step := range s.steps {
+		if step.do == nil {
+			return fmt.Errorf("saga %s: step %s has no function", s.name, step.name)
+		}
+	}
+
+	ctx = withSagaID(ctx, id)
+	p, err := s.start(ctx, id, state)
+	if err != nil {
+		return err
+	}
+	return s.continueSaga(ctx, id, p, state)
+}
+
+// Resume continues the sagas of s interrupted while running or compensating, e.g. by
+// a process restart. It returns the first error of a saga after trying all of them.
+func (s *Saga[S]) Resume(ctx context.Context) error {
+	var ids []string
+	err := s.tm.Exec(ctx, func(tx *gotx.Transaction) error {
+		return tx.Select(&ids, "SELECT id FROM "+table+" WHERE name = "+s.tm.Placeholder(1)+
+			" AND status IN ("+s.tm.Placeholder(2)+", "+s.tm.Placeholder(3)+")",
+			s.name, StatusRunning, StatusCompensating)
+	}, &gotx.Options{Propagation: gotx.PropagationNew})
+	if err != nil {
+		return fmt.Errorf("saga %s: loading interrupted sagas failed: %w", s.name, err)
+	}
+
+	var firstErr error
+	for _, id := range ids {
+		var state S
+		if err := s.Run(ctx, id, &state); err != nil && !errors.Is(err, ErrCompensated) && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// start loads the progress of saga id, or saves the initial progress of a new one.
+func (s *Saga[S]) start(ctx context.Context, id string, state *S) (progress, error) {
+	var p progress
+	err := s.tm.Exec(ctx, func(tx *gotx.Transaction) error {
+		err := tx.GetOne(&p, "SELECT status, step, state, error FROM "+table+" WHERE id = "+s.tm.Placeholder(1), id)
+		if err == nil {
+			if p.State.Valid {
+				return json.Unmarshal([]byte(p.State.String), state)
+			}
+			return nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		p = progress{Status: StatusRunning}
+		return s.save(tx, id, p, state, nil)
+	}, &gotx.Options{Propagation: gotx.PropagationNew})
+
+	if err != nil {
+		return p, fmt.Errorf("saga %s: starting %s failed: %w", s.name, id, err)
+	}
+	return p, nil
+}
+
+func (s *Saga[S]) continueSaga(ctx context.Context, id string, p progress, state *S) error {
+	for p.Status == StatusRunning && p.Step < len(s.steps) {
+		step := s.steps[p.Step]
+		err := s.runStep(ctx, id, step, step.do, &p, state)
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, ErrConflict) {
+			return err
+		}
+
+		// the failed step was rolled back, the steps before it are compensated
+		stepErr := fmt.Errorf("step %s failed: %w", step.name, err)
+		p.Status, p.Err = StatusCompensating, sql.NullString{String: stepErr.Error(), Valid: true}
+		if p.Step == 0 {
+			// no step completed, there is nothing to compensate
+			p.Status = StatusCompensated
+		}
+		err = s.tm.Exec(ctx, func(tx *gotx.Transaction) error {
+			return s.save(tx, id, p, state, &p.Step)
+		}, &gotx.Options{Propagation: gotx.PropagationNew})
+		if err != nil {
+			return fmt.Errorf("saga %s: %s: %v, saving compensation failed: %w", s.name, id, stepErr, err)
+		}
+	}
+
+	for p.Status == StatusCompensating && p.Step > 0 {
+		step := s.steps[p.Step-1]
+		if err := s.runStep(ctx, id, step, step.compensate, &p, state); err != nil {
+			return fmt.Errorf("saga %s: %s: compensating step %s failed: %w", s.name, id, step.name, err)
+		}
+	}
+
+	switch p.Status {
+	case StatusCompensating, StatusCompensated:
+		return fmt.Errorf("saga %s: %s: %w: %s", s.name, id, ErrCompensated, p.Err.String)
+	}
+	return nil
+}
+
+// runStep runs fn in the transaction of step and saves the progress in it.
+func (s *Saga[S]) runStep(ctx context.Context, id string, step *Step[S], fn StepFunc[S], p *progress, state *S) error {
+	next := *p
+	if next.Status == StatusRunning {
+		if next.Step++; next.Step == len(s.steps) {
+			next.Status = StatusCompleted
+		}
+	} else if next.Step--; next.Step == 0 {
+		next.Status = StatusCompensated
+	}
+
+	// the state is only modified if the transaction commits
+	working, err := clone(state)
+	if err != nil {
+		return err
+	}
+	err = s.tm.Exec(ctx, func(tx *gotx.Transaction) error {
+		if fn != nil {
+			if err := fn(tx, working); err != nil {
+				return err
+			}
+		}
+		return s.save(tx, id, next, working, &p.Step)
+	}, &gotx.Options{Propagation: gotx.PropagationNew, Timeout: step.timeout})
+
+	if err != nil {
+		return err
+	}
+
+	*p, *state = next, *working
+	return nil
+}
+
+// save saves the progress of saga id. If prevStep is not nil the progress is only
+// saved if the saved step still is *prevStep.
+func (s *Saga[S]) save(tx *gotx.Transaction, id string, p progress, state *S, prevStep *int) error {
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	arg := map[string]interface{}{
+		"id":         id,
+		"name":       s.name,
+		"status":     string(p.Status),
+		"step":       p.Step,
+		"state":      string(encoded),
+		"error":      p.Err,
+		"updated_at": s.tm.Clock().Now().UTC(),
+	}
+
+	if prevStep == nil {
+		_, err := tx.NamedExec("INSERT INTO "+table+" (id, name, status, step, state, error, updated_at)"+
+			" VALUES (:id, :name, :status, :step, :state, :error, :updated_at)", arg)
+		return err
+	}
+
+	arg["prev_step"] = *prevStep
+	n, err := tx.NamedExec("UPDATE "+table+" SET status = :status, step = :step, state = :state,"+
+		" error = :error, updated_at = :updated_at WHERE id = :id AND step = :prev_step", arg)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrConflict
+	}
+	return nil
+}
+
+// clone returns a deep copy of state.
+func clone[S any](state *S) (*S, error) {
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(S)
+	if err := json.Unmarshal(encoded, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// withSagaID returns ctx with the saga ID set in its correlation metadata, so it is
+// passed to the services called by the steps.
+func withSagaID(ctx context.Context, id string) context.Context {
+	c := gotx.CorrelationFromContext(ctx)
+	c.SagaID = id
+	return gotx.WithCorrelation(ctx, c)
+}
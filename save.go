@@ -0,0 +1,147 @@
+package gotx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// Persistable is implemented by entities deciding themselves whether Save inserts or
+// updates them, e.g. entities with keys assigned by the application.
+type Persistable interface {
+	// IsNew reports whether the entity has not been inserted yet.
+	IsNew() bool
+}
+
+// Save inserts entity, a pointer to a struct, into table if it is new and updates its
+// row otherwise:
+//
+//	type Account struct {
+//		ID   int64  `db:"id"`
+//		Name string `db:"name"`
+//	}
+//	err := tx.Save("account", &account)
+//
+// The key column is the column of the field tagged with the key option, as in
+// `db:"account_no,key"`, or "id". An entity is new if its key is the zero value,
+// unless it implements Persistable. New entities are inserted with all columns, and
+// without the key if it is zero, in which case the key generated by the database is
+// stored in the key field: with RETURNING on Postgres and SQLite, OUTPUT on SQL
+// Server and LastInsertId otherwise. Other entities are updated with all columns but
+// the key. Columns are named by the mapper of the transaction, as with UpdateChanged.
+func (t *Transaction) Save(table string, entity interface{}) error {
+	if err := t.checkState(); err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(entity)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("gotx: Save needs a pointer to a struct")
+	}
+	v = v.Elem()
+
+	fields := updatableFields(t.tx.Mapper.TypeMap(v.Type()))
+	var key *reflectx.FieldInfo
+	for _, fi := range fields {
+		if _, ok := fi.Options["key"]; ok {
+			key = fi
+			break
+		}
+		if fi.Path == "id" {
+			key = fi
+		}
+	}
+	if key == nil {
+		return fmt.Errorf("gotx: no key column found in %s", v.Type())
+	}
+
+	keyValue := reflectx.FieldByIndexes(v, key.Index)
+	isNew := keyValue.IsZero()
+	if p, ok := entity.(Persistable); ok {
+		isNew = p.IsNew()
+	}
+
+	if !isNew {
+		var set []string
+		for _, fi := range fields {
+			if fi != key {
+				set = append(set, fi.Path+" = :"+fi.Path)
+			}
+		}
+		if len(set) == 0 {
+			return nil
+		}
+		_, err := t.Update("UPDATE "+table+" SET "+strings.Join(set, ", ")+" WHERE "+key.Path+" = :"+key.Path, entity)
+		return err
+	}
+
+	generated := keyValue.IsZero()
+	var columns, params []string
+	for _, fi := range fields {
+		if fi == key && generated {
+			continue
+		}
+		columns = append(columns, fi.Path)
+		params = append(params, ":"+fi.Path)
+	}
+	values := "(" + strings.Join(columns, ", ") + ") VALUES (" + strings.Join(params, ", ") + ")"
+	insert := "INSERT INTO " + table + " " + values
+
+	if !generated {
+		_, err := t.NamedExec(insert, entity)
+		if err == nil {
+			t.recordChange(ChangeInsert, insert, entity, 0)
+		}
+		return err
+	}
+
+	switch t.txManager.dialect {
+	case DialectPostgres, DialectSQLite:
+		return t.insertReturningKey(insert+" RETURNING "+key.Path, entity, keyValue)
+	case DialectSQLServer:
+		return t.insertReturningKey("INSERT INTO "+table+" ("+strings.Join(columns, ", ")+") OUTPUT INSERTED."+key.Path+
+			" VALUES ("+strings.Join(params, ", ")+")", entity, keyValue)
+	}
+
+	id, err := t.Insert(insert, entity)
+	if err != nil {
+		return err
+	}
+	switch keyValue.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		keyValue.SetInt(id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		keyValue.SetUint(uint64(id))
+	default:
+		return fmt.Errorf("gotx: generated ID can not be stored in key of type %s", keyValue.Type())
+	}
+	return nil
+}
+
+// insertReturningKey runs a named INSERT returning the generated key of the row and
+// scans it into key.
+func (t *Transaction) insertReturningKey(query string, arg interface{}, key reflect.Value) error {
+	bound, err := t.encryptArg(arg)
+	if err != nil {
+		return fmt.Errorf("insert failed: %w", err)
+	}
+
+	query2, args, err := t.tx.BindNamed(query, bound)
+	if err != nil {
+		return fmt.Errorf("insert failed: %w", err)
+	}
+
+	err = t.run(&Statement{Kind: StatementQuery, Query: query2, Args: args, EachRow: func(rows *sqlx.Rows) error {
+		return rows.Scan(key.Addr().Interface())
+	}})
+	if err != nil {
+		return fmt.Errorf("insert failed: %w", err)
+	}
+
+	t.recordChange(ChangeInsert, query, arg, 0)
+	return nil
+}
@@ -0,0 +1,160 @@
+package gotx
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+)
+
+// savepointVerbs are the verbs of the statements managing savepoints.
+var savepointVerbs = map[string]bool{
+	"SAVEPOINT": true,
+	"SAVE":      true,
+	"RELEASE":   true,
+	"ROLLBACK":  true,
+}
+
+// savepoint creates a savepoint named name in the db transaction.
+func (t *Transaction) savepoint(name string) error {
+	if t.txManager.dialect == DialectSQLServer {
+		return t.execSavepoint("SAVE TRANSACTION " + name)
+	}
+	return t.execSavepoint("SAVEPOINT " + name)
+}
+
+// rollbackToSavepoint discards the changes made after savepoint name was created.
+func (t *Transaction) rollbackToSavepoint(name string) error {
+	if t.txManager.dialect == DialectSQLServer {
+		return t.execSavepoint("ROLLBACK TRANSACTION " + name)
+	}
+	return t.execSavepoint("ROLLBACK TO SAVEPOINT " + name)
+}
+
+// releaseSavepoint destroys savepoint name, keeping the changes made after it.
+func (t *Transaction) releaseSavepoint(name string) error {
+	switch t.txManager.dialect {
+	case DialectSQLServer, DialectOracle:
+		// savepoints can not be released explicitly
+		return nil
+	}
+
+	return t.execSavepoint("RELEASE SAVEPOINT " + name)
+}
+
+// execSavepoint runs query, a statement managing savepoints, which is not accounted as a
+// write or statement of t.
+func (t *Transaction) execSavepoint(query string) error {
+	return t.run(&Statement{Kind: StatementExec, Query: query, savepoint: true})
+}
+
+// savepointMark is a savepoint of a nested transaction run with Options.Savepoint, with
+// the state of the db transaction restored when it is rolled back to.
+type savepointMark struct {
+	name    string
+	changes int
+	results int
+}
+
+// savepointName returns the name of the savepoint of t, sp_<depth>_<id> where depth is
+// the nesting depth of t in its db transaction, 1 for a transaction nested in the root,
+// and id is the ID of t. Names are thus unique and tell which transaction rolled back.
+func (t *Transaction) savepointName() string {
+	depth := 0
+	for p := t.parent; p != nil && p.tx == t.tx; p = p.parent {
+		depth++
+	}
+	return fmt.Sprintf("sp_%d_%s", depth, t.txID)
+}
+
+// beginSavepoint creates the savepoint of t if t joins the db transaction of its parent
+// with Options.Savepoint.
+func (t *Transaction) beginSavepoint() error {
+	if !t.opts.Savepoint || t.parent == nil || t.parent.tx != t.tx {
+		return nil
+	}
+
+	name := t.savepointName()
+	if err := t.savepoint(name); err != nil {
+		return fmt.Errorf("gotx: creating savepoint %s failed: %w", name, err)
+	}
+
+	t.tx.valuesMux.Lock()
+	t.tx.savepoints = append(t.tx.savepoints, savepointMark{name: name, changes: len(t.tx.changes), results: len(t.tx.results)})
+	t.tx.valuesMux.Unlock()
+
+	// ActiveTransactions reads the mark from other goroutines
+	t.txManager.mux.Lock()
+	t.savepointMark = name
+	t.txManager.mux.Unlock()
+	log.Printf("%s created savepoint %s\n", t, name)
+	return nil
+}
+
+// popSavepoint removes the savepoint of t, and the ones created after it, from the
+// active savepoints of the db transaction and returns it.
+func (t *Transaction) popSavepoint() savepointMark {
+	t.tx.valuesMux.Lock()
+	defer t.tx.valuesMux.Unlock()
+
+	for i := len(t.tx.savepoints) - 1; i >= 0; i-- {
+		if mark := t.tx.savepoints[i]; mark.name == t.savepointMark {
+			t.tx.savepoints = t.tx.savepoints[:i]
+			return mark
+		}
+	}
+	return savepointMark{name: t.savepointMark, changes: len(t.tx.changes), results: len(t.tx.results)}
+}
+
+// rollbackNested rolls back the changes of t to its savepoint and ends t, leaving the
+// db transaction to its parent.
+func (t *Transaction) rollbackNested() error {
+	mark := t.popSavepoint()
+	err := t.rollbackToSavepoint(mark.name)
+	if err == nil {
+		err = t.releaseSavepoint(mark.name)
+	}
+
+	t.txManager.detach(t)
+	atomic.AddUint32(&t.tx.refCount, ^uint32(0))
+	t.committed = true
+	if err != nil {
+		// the changes of t may be kept, the enclosing transaction must not commit
+		err = fmt.Errorf("gotx: rolling back to savepoint %s failed: %w", mark.name, err)
+		t.tx.doom(err)
+		return err
+	}
+
+	// the changes and results recorded since the savepoint did not happen
+	t.tx.valuesMux.Lock()
+	if len(t.tx.changes) > mark.changes {
+		t.tx.changes = t.tx.changes[:mark.changes]
+	}
+	if len(t.tx.results) > mark.results {
+		t.tx.results = t.tx.results[:mark.results]
+	}
+	t.tx.valuesMux.Unlock()
+
+	log.Printf("%s rolled back to savepoint %s\n", t, mark.name)
+	return nil
+}
+
+// Savepoint returns the name of the savepoint the transaction runs within, see
+// Options.Savepoint, or "" if it has none.
+func (t *Transaction) Savepoint() string {
+	return t.savepointMark
+}
+
+// Savepoints returns the names of the savepoints of the nested transactions active in
+// the db transaction, outermost first. A failing nested transaction run with
+// Options.Savepoint is rolled back to the last of them, e.g. to tell from logs which
+// part of a nested flow was undone.
+func (t *Transaction) Savepoints() []string {
+	t.tx.valuesMux.Lock()
+	defer t.tx.valuesMux.Unlock()
+
+	names := make([]string, len(t.tx.savepoints))
+	for i, mark := range t.tx.savepoints {
+		names[i] = mark.name
+	}
+	return names
+}
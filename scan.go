@@ -0,0 +1,106 @@
+package gotx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// errStopRows is returned by a row callback to stop reading the result set early.
+var errStopRows = errors.New("gotx: stop reading rows")
+
+// queryRows runs a query statement and calls eachRow for every row, honoring the row
+// limit of the transaction.
+func queryRows(ctx context.Context, stmt *Statement, args []interface{}, eachRow func(rows *sqlx.Rows) error) error {
+	rows, err := stmt.tx.tx.QueryxContext(ctx, stmt.Query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	limit, policy := stmt.tx.opts.MaxRows, stmt.tx.opts.MaxRowsPolicy
+	count := 0
+	for rows.Next() {
+		if limit > 0 && count == limit {
+			if policy == RowLimitTruncate {
+				break
+			}
+			return ErrTooManyRows
+		}
+
+		if err := eachRow(rows); err != nil {
+			if err == errStopRows {
+				return nil
+			}
+			return err
+		}
+		count++
+	}
+
+	return rows.Err()
+}
+
+// scanInto returns a row callback appending each row to dest, which must be a pointer
+// to a slice. Like sqlx.Select, rows are scanned into struct elements with StructScan
+// and into scannable elements with Scan.
+func scanInto(dest interface{}) func(rows *sqlx.Rows) error {
+	v := reflect.ValueOf(dest)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Slice {
+		return func(rows *sqlx.Rows) error {
+			return errors.New("gotx: dest must be a non-nil pointer to a slice")
+		}
+	}
+
+	slice := v.Elem()
+	elemType := slice.Type().Elem()
+	isPtr := elemType.Kind() == reflect.Ptr
+	baseType := elemType
+	if isPtr {
+		baseType = elemType.Elem()
+	}
+	scannable := isScannable(baseType)
+
+	return func(rows *sqlx.Rows) error {
+		vp := reflect.New(baseType)
+
+		var err error
+		if scannable {
+			err = rows.Scan(vp.Interface())
+		} else {
+			err = rows.StructScan(vp.Interface())
+		}
+		if err != nil {
+			return err
+		}
+
+		if isPtr {
+			slice.Set(reflect.Append(slice, vp))
+		} else {
+			slice.Set(reflect.Append(slice, vp.Elem()))
+		}
+		return nil
+	}
+}
+
+// isScannable reports whether values of t are scanned directly rather than mapped
+// field by field, following the rules of sqlx.
+func isScannable(t reflect.Type) bool {
+	if reflect.PtrTo(t).Implements(scannerType) {
+		return true
+	}
+	if t.Kind() != reflect.Struct {
+		return true
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath == "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package gotx
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SelectMaps runs a query and returns its rows as maps keyed by column name. It is
+// meant for dynamic and reporting queries for which no struct exists. []byte values
+// of textual columns, which drivers such as MySQL return for most column types, are
+// converted to strings. Binary columns keep their []byte values.
+func (t *Transaction) SelectMaps(query string, args ...interface{}) ([]map[string]interface{}, error) {
+	var result []map[string]interface{}
+	scan := mapScanner()
+
+	err := t.ForEach(query, func(rows *sqlx.Rows) error {
+		row, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		result = append(result, row)
+		return nil
+	}, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetMap runs a query and returns its first row as a map keyed by column name, with
+// the same type coercion as SelectMaps. It returns sql.ErrNoRows if the result set is
+// empty.
+func (t *Transaction) GetMap(query string, args ...interface{}) (map[string]interface{}, error) {
+	if err := t.checkState(); err != nil {
+		return nil, err
+	}
+
+	var result map[string]interface{}
+	scan := mapScanner()
+
+	err := t.run(&Statement{Kind: StatementQuery, Query: query, Args: args, EachRow: func(rows *sqlx.Rows) error {
+		row, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		result = row
+		return errStopRows
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	if result == nil {
+		return nil, sql.ErrNoRows
+	}
+	return result, nil
+}
+
+// mapScanner returns a function scanning rows into maps. Column types are inspected
+// once, on the first row.
+func mapScanner() func(rows *sqlx.Rows) (map[string]interface{}, error) {
+	var binary map[string]bool
+
+	return func(rows *sqlx.Rows) (map[string]interface{}, error) {
+		if binary == nil {
+			types, err := rows.ColumnTypes()
+			if err != nil {
+				return nil, err
+			}
+
+			binary = make(map[string]bool, len(types))
+			for _, ct := range types {
+				binary[ct.Name()] = isBinaryColumn(ct.DatabaseTypeName())
+			}
+		}
+
+		row := make(map[string]interface{})
+		if err := rows.MapScan(row); err != nil {
+			return nil, err
+		}
+
+		for col, value := range row {
+			if b, ok := value.([]byte); ok && !binary[col] {
+				row[col] = string(b)
+			}
+		}
+		return row, nil
+	}
+}
+
+func isBinaryColumn(typeName string) bool {
+	typeName = strings.ToUpper(typeName)
+	return strings.Contains(typeName, "BLOB") ||
+		strings.Contains(typeName, "BINARY") ||
+		strings.Contains(typeName, "BYTEA") ||
+		strings.Contains(typeName, "IMAGE")
+}
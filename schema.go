@@ -0,0 +1,325 @@
+package gotx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Schema is the metadata of the tables of the database: their columns, primary keys
+// and foreign keys.
+type Schema struct {
+	// Tables are the tables of the current schema, keyed by lower-cased name.
+	Tables map[string]*Table
+}
+
+// Table is the metadata of a table.
+type Table struct {
+	Name        string
+	Columns     []Column
+	PrimaryKey  []string
+	ForeignKeys []ForeignKey
+}
+
+// Column is the metadata of a column of a table.
+type Column struct {
+	Name     string
+	Type     string
+	Nullable bool
+
+	// Default is the default expression of the column, if any
+	Default sql.NullString
+}
+
+// ForeignKey is a foreign key of a table, referencing the columns of RefTable.
+type ForeignKey struct {
+	Name       string
+	Columns    []string
+	RefTable   string
+	RefColumns []string
+}
+
+// Table returns the metadata of the table name, compared case insensitively.
+func (s *Schema) Table(name string) (*Table, bool) {
+	t, ok := s.Tables[strings.ToLower(name)]
+	return t, ok
+}
+
+// TableNames returns the names of the tables, sorted.
+func (s *Schema) TableNames() []string {
+	names := make([]string, 0, len(s.Tables))
+	for _, t := range s.Tables {
+		names = append(names, t.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Column returns the column of t named name, compared case insensitively.
+func (t *Table) Column(name string) (*Column, bool) {
+	for i := range t.Columns {
+		if strings.EqualFold(t.Columns[i].Name, name) {
+			return &t.Columns[i], true
+		}
+	}
+	return nil, false
+}
+
+// DependencyOrder returns tables, or all tables if none are given, ordered so that
+// tables come after the tables their foreign keys reference. Rows can be inserted in
+// that order, e.g. to load fixtures, and deleted in the reverse order. Self references
+// are ignored, and cycles are broken by name order.
+func (s *Schema) DependencyOrder(tables ...string) []string {
+	if len(tables) == 0 {
+		tables = s.TableNames()
+	} else {
+		tables = append([]string(nil), tables...)
+		sort.Strings(tables)
+	}
+	wanted := tableSet(tables)
+
+	var order []string
+	state := make(map[string]int) // 1 while visiting, 2 once ordered
+	var visit func(name string)
+	visit = func(name string) {
+		key := strings.ToLower(name)
+		if state[key] != 0 {
+			return
+		}
+		state[key] = 1
+		if t, ok := s.Tables[key]; ok {
+			for _, fk := range t.ForeignKeys {
+				if wanted[strings.ToLower(fk.RefTable)] {
+					visit(fk.RefTable)
+				}
+			}
+		}
+		state[key] = 2
+		order = append(order, name)
+	}
+	for _, name := range tables {
+		visit(name)
+	}
+	return order
+}
+
+// Schema returns the metadata of the tables of the database, read from
+// information_schema, or the catalog of SQLite, on the first call and cached for the
+// lifetime of the manager. Call InvalidateSchema after migrations change the tables.
+// Oracle is not supported.
+func (tm *TxManager) Schema(ctx context.Context) (*Schema, error) {
+	tm.schemaMux.Lock()
+	defer tm.schemaMux.Unlock()
+
+	if tm.schema != nil {
+		return tm.schema, nil
+	}
+
+	var s *Schema
+	var err error
+	switch tm.dialect {
+	case DialectPostgres:
+		s, err = tm.loadInformationSchema(ctx, "current_schema()", "ref.ordinal_position = kcu.position_in_unique_constraint")
+	case DialectSQLServer:
+		s, err = tm.loadInformationSchema(ctx, "SCHEMA_NAME()", "ref.ordinal_position = kcu.ordinal_position")
+	case DialectMySQL:
+		s, err = tm.loadInformationSchema(ctx, "DATABASE()", "")
+	case DialectSQLite:
+		s, err = tm.loadSQLiteSchema(ctx)
+	default:
+		return nil, fmt.Errorf("gotx: schema introspection is not supported on %s", tm.dialect)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gotx: reading schema failed: %w", err)
+	}
+
+	tm.schema = s
+	return s, nil
+}
+
+// InvalidateSchema drops the cached schema, which is read again by the next call of
+// Schema.
+func (tm *TxManager) InvalidateSchema() {
+	tm.schemaMux.Lock()
+	tm.schema = nil
+	tm.schemaMux.Unlock()
+}
+
+// keyColumn is a column of a primary or foreign key.
+type keyColumn struct {
+	Table      string         `db:"table_name"`
+	Constraint string         `db:"constraint_name"`
+	Column     string         `db:"column_name"`
+	RefTable   sql.NullString `db:"ref_table"`
+	RefColumn  sql.NullString `db:"ref_column"`
+}
+
+// loadInformationSchema reads the schema from information_schema. refJoin matches the
+// key columns of a foreign key with the columns they reference, MySQL has them in
+// KEY_COLUMN_USAGE itself.
+func (tm *TxManager) loadInformationSchema(ctx context.Context, schema string, refJoin string) (*Schema, error) {
+	var tables []string
+	err := tm.db.SelectContext(ctx, &tables, "SELECT table_name AS table_name FROM information_schema.tables"+
+		" WHERE table_schema = "+schema+" AND table_type = 'BASE TABLE'")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Schema{Tables: make(map[string]*Table, len(tables))}
+	for _, name := range tables {
+		s.Tables[strings.ToLower(name)] = &Table{Name: name}
+	}
+
+	var columns []struct {
+		Table    string         `db:"table_name"`
+		Name     string         `db:"column_name"`
+		Type     string         `db:"data_type"`
+		Nullable string         `db:"is_nullable"`
+		Default  sql.NullString `db:"column_default"`
+	}
+	err = tm.db.SelectContext(ctx, &columns, "SELECT table_name AS table_name, column_name AS column_name,"+
+		" data_type AS data_type, is_nullable AS is_nullable, column_default AS column_default"+
+		" FROM information_schema.columns WHERE table_schema = "+schema+" ORDER BY table_name, ordinal_position")
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range columns {
+		if t, ok := s.Tables[strings.ToLower(c.Table)]; ok {
+			t.Columns = append(t.Columns, Column{Name: c.Name, Type: c.Type, Nullable: c.Nullable == "YES", Default: c.Default})
+		}
+	}
+
+	var pks []keyColumn
+	err = tm.db.SelectContext(ctx, &pks, "SELECT kcu.table_name AS table_name, kcu.constraint_name AS constraint_name,"+
+		" kcu.column_name AS column_name FROM information_schema.table_constraints tc"+
+		" JOIN information_schema.key_column_usage kcu ON kcu.constraint_schema = tc.constraint_schema"+
+		" AND kcu.constraint_name = tc.constraint_name AND kcu.table_name = tc.table_name"+
+		" WHERE tc.table_schema = "+schema+" AND tc.constraint_type = 'PRIMARY KEY'"+
+		" ORDER BY kcu.table_name, kcu.ordinal_position")
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range pks {
+		if t, ok := s.Tables[strings.ToLower(k.Table)]; ok {
+			t.PrimaryKey = append(t.PrimaryKey, k.Column)
+		}
+	}
+
+	query := "SELECT kcu.table_name AS table_name, kcu.constraint_name AS constraint_name," +
+		" kcu.column_name AS column_name, ref.table_name AS ref_table, ref.column_name AS ref_column" +
+		" FROM information_schema.referential_constraints rc" +
+		" JOIN information_schema.key_column_usage kcu ON kcu.constraint_schema = rc.constraint_schema" +
+		" AND kcu.constraint_name = rc.constraint_name" +
+		" JOIN information_schema.key_column_usage ref ON ref.constraint_schema = rc.unique_constraint_schema" +
+		" AND ref.constraint_name = rc.unique_constraint_name AND " + refJoin +
+		" WHERE kcu.table_schema = " + schema +
+		" ORDER BY kcu.table_name, kcu.constraint_name, kcu.ordinal_position"
+	if refJoin == "" {
+		query = "SELECT table_name AS table_name, constraint_name AS constraint_name, column_name AS column_name," +
+			" referenced_table_name AS ref_table, referenced_column_name AS ref_column" +
+			" FROM information_schema.key_column_usage" +
+			" WHERE table_schema = " + schema + " AND referenced_table_name IS NOT NULL" +
+			" ORDER BY table_name, constraint_name, ordinal_position"
+	}
+
+	var fks []keyColumn
+	if err := tm.db.SelectContext(ctx, &fks, query); err != nil {
+		return nil, err
+	}
+	for _, k := range fks {
+		if t, ok := s.Tables[strings.ToLower(k.Table)]; ok {
+			t.addForeignKeyColumn(k.Constraint, k.Column, k.RefTable.String, k.RefColumn.String)
+		}
+	}
+	return s, nil
+}
+
+// loadSQLiteSchema reads the schema from the catalog of SQLite.
+func (tm *TxManager) loadSQLiteSchema(ctx context.Context) (*Schema, error) {
+	var tables []string
+	err := tm.db.SelectContext(ctx, &tables, "SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Schema{Tables: make(map[string]*Table, len(tables))}
+	for _, name := range tables {
+		t := &Table{Name: name}
+		s.Tables[strings.ToLower(name)] = t
+
+		var columns []struct {
+			CID     int            `db:"cid"`
+			Name    string         `db:"name"`
+			Type    string         `db:"type"`
+			NotNull bool           `db:"notnull"`
+			Default sql.NullString `db:"dflt_value"`
+			PK      int            `db:"pk"`
+		}
+		if err := tm.db.SelectContext(ctx, &columns, "PRAGMA table_info("+quoteSQLiteIdent(name)+")"); err != nil {
+			return nil, err
+		}
+		pk := make(map[int]string)
+		for _, c := range columns {
+			t.Columns = append(t.Columns, Column{Name: c.Name, Type: c.Type, Nullable: !c.NotNull && c.PK == 0, Default: c.Default})
+			if c.PK > 0 {
+				pk[c.PK] = c.Name
+			}
+		}
+		for i := 1; i <= len(pk); i++ {
+			t.PrimaryKey = append(t.PrimaryKey, pk[i])
+		}
+
+		var fks []struct {
+			ID       int            `db:"id"`
+			Seq      int            `db:"seq"`
+			Table    string         `db:"table"`
+			From     string         `db:"from"`
+			To       sql.NullString `db:"to"`
+			OnUpdate string         `db:"on_update"`
+			OnDelete string         `db:"on_delete"`
+			Match    string         `db:"match"`
+		}
+		if err := tm.db.SelectContext(ctx, &fks, "PRAGMA foreign_key_list("+quoteSQLiteIdent(name)+")"); err != nil {
+			return nil, err
+		}
+		for _, fk := range fks {
+			t.addForeignKeyColumn(fmt.Sprintf("fk_%s_%d", name, fk.ID), fk.From, fk.Table, fk.To.String)
+		}
+	}
+
+	// foreign keys without columns reference the primary key
+	for _, t := range s.Tables {
+		for i, fk := range t.ForeignKeys {
+			if ref, ok := s.Table(fk.RefTable); ok && len(ref.PrimaryKey) == len(fk.Columns) {
+				for j, column := range fk.RefColumns {
+					if column == "" {
+						t.ForeignKeys[i].RefColumns[j] = ref.PrimaryKey[j]
+					}
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+func quoteSQLiteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// addForeignKeyColumn adds a column of the foreign key name to t.
+func (t *Table) addForeignKeyColumn(name, column, refTable, refColumn string) {
+	if n := len(t.ForeignKeys); n > 0 && t.ForeignKeys[n-1].Name == name {
+		fk := &t.ForeignKeys[n-1]
+		fk.Columns = append(fk.Columns, column)
+		fk.RefColumns = append(fk.RefColumns, refColumn)
+		return
+	}
+	t.ForeignKeys = append(t.ForeignKeys, ForeignKey{
+		Name:       name,
+		Columns:    []string{column},
+		RefTable:   refTable,
+		RefColumns: []string{refColumn},
+	})
+}
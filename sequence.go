@@ -0,0 +1,116 @@
+package gotx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// sequenceTable is the table storing the next value of the sequences of NextID.
+const sequenceTable = "gotx_sequences"
+
+// defaultIDBlockSize is the number of IDs NextID reserves at once by default.
+const defaultIDBlockSize = 100
+
+// CreateSequenceTable creates the table storing the sequences of NextID if it does not
+// exist. Call it at startup, or create the table with a migration using the same
+// columns.
+func (tm *TxManager) CreateSequenceTable(ctx context.Context) error {
+	var ddl string
+	switch tm.dialect {
+	case DialectSQLServer:
+		ddl = "IF OBJECT_ID('" + sequenceTable + "') IS NULL CREATE TABLE " + sequenceTable +
+			" (name NVARCHAR(255) PRIMARY KEY, next_value BIGINT NOT NULL)"
+	case DialectOracle:
+		ddl = oracleCreateIfNotExists("CREATE TABLE " + sequenceTable +
+			" (name VARCHAR2(255) PRIMARY KEY, next_value NUMBER(19) NOT NULL)")
+	default:
+		ddl = "CREATE TABLE IF NOT EXISTS " + sequenceTable +
+			" (name VARCHAR(255) PRIMARY KEY, next_value BIGINT NOT NULL)"
+	}
+
+	_, err := tm.db.ExecContext(ctx, ddl)
+	return Translate(err)
+}
+
+// WithIDBlockSize sets how many IDs NextID reserves at once per sequence, 100 by
+// default. Larger blocks reserve IDs less often, but leave larger gaps when a process
+// stops before using its block.
+func WithIDBlockSize(n int64) ManagerOption {
+	return func(tm *TxManager) {
+		tm.idBlockSize = n
+	}
+}
+
+// idBlock is the block of IDs of a sequence reserved by the manager, from next to end
+// excluded.
+type idBlock struct {
+	mux       sync.Mutex
+	next, end int64
+}
+
+// NextID returns the next ID of the sequence name, starting at 1, portably across
+// databases and without LastInsertId. IDs are reserved in blocks with the hi/lo
+// algorithm: a short db transaction of its own, even if ctx carries a transaction,
+// moves the next value of the sequence in the gotx_sequences table past a block of
+// IDs, which are then handed out from memory. IDs are unique across processes sharing
+// the table and increase within a process, but processes interleave their blocks and
+// the unused IDs of a block are lost when the process stops, so IDs have gaps.
+func (tm *TxManager) NextID(ctx context.Context, name string) (int64, error) {
+	tm.sequencesMux.Lock()
+	if tm.sequences == nil {
+		tm.sequences = make(map[string]*idBlock)
+	}
+	block := tm.sequences[name]
+	if block == nil {
+		block = &idBlock{}
+		tm.sequences[name] = block
+	}
+	tm.sequencesMux.Unlock()
+
+	block.mux.Lock()
+	defer block.mux.Unlock()
+
+	if block.next < block.end {
+		block.next++
+		return block.next - 1, nil
+	}
+
+	size := tm.idBlockSize
+	if size <= 0 {
+		size = defaultIDBlockSize
+	}
+
+	var hi int64
+	reserve := func(tx *Transaction) error {
+		p1, p2 := tm.Placeholder(1), tm.Placeholder(2)
+		result, err := tx.exec("UPDATE "+sequenceTable+" SET next_value = next_value + "+p1+" WHERE name = "+p2, size, name)
+		if err != nil {
+			return err
+		}
+
+		if n, err := result.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			hi = 1 + size
+			_, err := tx.exec("INSERT INTO "+sequenceTable+" (name, next_value) VALUES ("+p1+", "+p2+")", name, hi)
+			return err
+		}
+
+		return tx.GetOne(&hi, "SELECT next_value FROM "+sequenceTable+" WHERE name = "+p1, name)
+	}
+
+	caller := getCaller()
+	err := tm.exec(ctx, caller, reserve, &Options{Propagation: PropagationNew})
+	if errors.Is(err, ErrUniqueViolation) {
+		// a concurrent process reserved the first block of name, so the row exists now
+		err = tm.exec(ctx, caller, reserve, &Options{Propagation: PropagationNew})
+	}
+	if err != nil {
+		return 0, fmt.Errorf("gotx: reserving IDs of %s failed: %w", name, err)
+	}
+
+	block.next, block.end = hi-size+1, hi
+	return hi - size, nil
+}
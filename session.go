@@ -0,0 +1,102 @@
+package gotx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type sessionContextKey struct{}
+
+// session is a connection pinned by WithSession.
+type session struct {
+	conn *sqlx.Conn
+
+	// busy is set while a db transaction runs on conn
+	busy int32
+}
+
+// WithSession pins a connection of the pool for the duration of fn. The db
+// transactions begun by Exec calls with the context passed to fn, or derived from it,
+// run one after the other on that connection, so they share session state such as
+// temporary tables, MySQL user variables or settings made with SET:
+//
+//	err := tm.WithSession(ctx, func(ctx context.Context) error {
+//		if err := tm.Exec(ctx, createStagingTable, nil); err != nil {
+//			return err
+//		}
+//		return tm.Exec(ctx, mergeStagingTable, nil)
+//	})
+//
+// Nested transactions with PropagationNew and transactions begun concurrently while
+// the connection is in use begin on other connections of the pool. The connection is
+// returned to the pool when fn returns, with its session state, so fn should clean up
+// state other users of the pool must not see. A nested WithSession call keeps the
+// connection of the outer one.
+func (tm *TxManager) WithSession(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(sessionContextKey{}).(*session); ok {
+		return fn(ctx)
+	}
+
+	conn, err := tm.db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("gotx: acquiring session connection failed: %w", err)
+	}
+	defer conn.Close()
+
+	return fn(context.WithValue(ctx, sessionContextKey{}, &session{conn: conn}))
+}
+
+// beginTx begins a db transaction, on the session connection of ctx if it is free and
+// on a connection of the pool of db otherwise. The connection is kept with the tx, so
+// that Transaction.Raw can reach the driver connection running it.
+func (tm *TxManager) beginTx(ctx context.Context, db *sqlx.DB, opts *sql.TxOptions) (*rawTx, error) {
+	s, ok := ctx.Value(sessionContextKey{}).(*session)
+	if ok && atomic.CompareAndSwapInt32(&s.busy, 0, 1) {
+		tx, err := s.conn.BeginTxx(ctx, opts)
+		if err != nil {
+			atomic.StoreInt32(&s.busy, 0)
+			return nil, err
+		}
+		dbTx := newRawTx(tx)
+		dbTx.conn = s.conn
+		dbTx.session = s
+		return dbTx, nil
+	}
+
+	// retry once on a bad connection, like sql.DB.BeginTx does
+	var err error
+	for i := 0; i < 2; i++ {
+		var conn *sqlx.Conn
+		if conn, err = db.Connx(ctx); err != nil {
+			return nil, err
+		}
+
+		var tx *sqlx.Tx
+		if tx, err = conn.BeginTxx(ctx, opts); err == nil {
+			dbTx := newRawTx(tx)
+			dbTx.conn = conn
+			return dbTx, nil
+		}
+		conn.Close()
+		if !errors.Is(err, driver.ErrBadConn) {
+			break
+		}
+	}
+	return nil, err
+}
+
+// releaseConn returns the connection of the tx to the pool, or frees the session
+// connection, once the tx ended.
+func (t *rawTx) releaseConn() {
+	if t.session != nil {
+		atomic.StoreInt32(&t.session.busy, 0)
+	} else if t.conn != nil {
+		t.conn.Close()
+	}
+}
@@ -0,0 +1,92 @@
+package gotx
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Querier runs the read-only queries of a snapshot, see TxManager.Snapshot.
+type Querier interface {
+	// Context returns the context of the snapshot transaction.
+	Context() context.Context
+
+	GetOne(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
+	ForEach(query string, fn func(rows *sqlx.Rows) error, args ...interface{}) error
+	Count(query string, args ...interface{}) (int64, error)
+	Exists(query string, args ...interface{}) (bool, error)
+}
+
+// snapshotQuerier hides the methods of the transaction which are not read-only.
+type snapshotQuerier struct {
+	tx *Transaction
+}
+
+func (q snapshotQuerier) Context() context.Context {
+	return q.tx.Context()
+}
+
+func (q snapshotQuerier) GetOne(dest interface{}, query string, args ...interface{}) error {
+	return q.tx.GetOne(dest, query, args...)
+}
+
+func (q snapshotQuerier) Select(dest interface{}, query string, args ...interface{}) error {
+	return q.tx.Select(dest, query, args...)
+}
+
+func (q snapshotQuerier) ForEach(query string, fn func(rows *sqlx.Rows) error, args ...interface{}) error {
+	return q.tx.ForEach(query, fn, args...)
+}
+
+func (q snapshotQuerier) Count(query string, args ...interface{}) (int64, error) {
+	return q.tx.Count(query, args...)
+}
+
+func (q snapshotQuerier) Exists(query string, args ...interface{}) (bool, error) {
+	return q.tx.Exists(query, args...)
+}
+
+// Snapshot runs fn in a read-only db transaction reading a consistent snapshot of the
+// database, for backups and ETL jobs extracting several tables which must agree with
+// each other:
+//
+//	err := tm.Snapshot(ctx, func(q gotx.Querier) error {
+//		if err := q.ForEach("SELECT * FROM orders", writeOrder); err != nil {
+//			return err
+//		}
+//		return q.ForEach("SELECT * FROM order_lines", writeLine)
+//	})
+//
+// The db transaction is always a new one, even within another transaction, with the
+// isolation level giving a snapshot on the database: repeatable read on Postgres and
+// MySQL, snapshot on SQL Server and serializable elsewhere. Such jobs run for long, so
+// the snapshot is exempt from the watchdogs meant for request transactions: the idle
+// limit, the leak detector and the maximum lifetime of the sweeper. Only ctx bounds
+// it. Statements which do not read fail with ErrReadOnlyTx.
+func (tm *TxManager) Snapshot(ctx context.Context, fn func(q Querier) error) error {
+	opt := &Options{
+		Name:           "snapshot",
+		Propagation:    PropagationNew,
+		IsolationLevel: tm.snapshotIsolation(),
+		ReadOnly:       true,
+		MaxIdle:        -1,
+		snapshot:       true,
+	}
+	return tm.exec(ctx, getCaller(), func(tx *Transaction) error {
+		return fn(snapshotQuerier{tx: tx})
+	}, opt)
+}
+
+// snapshotIsolation returns the isolation level reading a consistent snapshot.
+func (tm *TxManager) snapshotIsolation() sql.IsolationLevel {
+	switch tm.dialect {
+	case DialectPostgres, DialectMySQL:
+		return sql.LevelRepeatableRead
+	case DialectSQLServer:
+		return sql.LevelSnapshot
+	default:
+		return sql.LevelSerializable
+	}
+}
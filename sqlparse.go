@@ -0,0 +1,529 @@
+package gotx
+
+import (
+	"strings"
+	"unicode"
+)
+
+// A minimal SQL lexer used to inspect statements. It does not validate SQL, it only
+// knows enough to skip comments and literals and to find keywords and identifiers.
+
+type sqlTokenKind uint8
+
+const (
+	tokenWord sqlTokenKind = iota
+	tokenQuotedIdent
+	tokenString
+	tokenNumber
+	tokenParam
+	tokenPunct
+)
+
+type sqlToken struct {
+	kind sqlTokenKind
+	text string
+	// depth is the parenthesis nesting level of the token
+	depth int
+	// pos is the byte offset of the token in the query
+	pos int
+}
+
+// keyword returns the upper-cased text of a word token, or "" for other tokens.
+func (t sqlToken) keyword() string {
+	if t.kind != tokenWord {
+		return ""
+	}
+	return strings.ToUpper(t.text)
+}
+
+// ident returns the unquoted identifier of a word or quoted identifier token.
+func (t sqlToken) ident() string {
+	if t.kind == tokenQuotedIdent && len(t.text) >= 2 {
+		return t.text[1 : len(t.text)-1]
+	}
+	return t.text
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// tokenizeSQL splits query into tokens, dropping whitespace and comments. Backslashes
+// escape the next character of quoted strings only in MySQL.
+func tokenizeSQL(query string, dialect Dialect) []sqlToken {
+	var tokens []sqlToken
+	src := []rune(query)
+	depth := 0
+
+	// byte offsets of the runes, ranging over the string to match []rune on invalid UTF-8
+	offsets := make([]int, 0, len(src)+1)
+	for pos := range query {
+		offsets = append(offsets, pos)
+	}
+	offsets = append(offsets, len(query))
+
+	for i := 0; i < len(src); {
+		r := src[i]
+		start := i
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+
+		case r == '-' && i+1 < len(src) && src[i+1] == '-':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+
+		case r == '/' && i+1 < len(src) && src[i+1] == '*':
+			i += 2
+			for i+1 < len(src) && !(src[i] == '*' && src[i+1] == '/') {
+				i++
+			}
+			i += 2
+			continue
+
+		case r == '\'' || r == '"' || r == '`' || r == '[':
+			end := r
+			if r == '[' {
+				end = ']'
+			}
+			i++
+			for i < len(src) {
+				if src[i] == '\\' && (r == '\'' || r == '"') && dialect == DialectMySQL {
+					i += 2
+					continue
+				}
+				if src[i] == end {
+					// a doubled quote escapes itself
+					if i+1 < len(src) && src[i+1] == end && r != '[' {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			i++
+			if i > len(src) {
+				i = len(src)
+			}
+			kind := tokenQuotedIdent
+			if r == '\'' {
+				kind = tokenString
+			}
+			tokens = append(tokens, sqlToken{kind: kind, text: string(src[start:i]), depth: depth, pos: offsets[start]})
+			continue
+
+		case r == '$' && i+1 < len(src) && (src[i+1] == '$' || unicode.IsLetter(src[i+1]) || src[i+1] == '_') && dollarTag(src[i:]) != nil:
+			// postgres dollar quoted string: $tag$ ... $tag$
+			tag := dollarTag(src[i:])
+			i += len(tag)
+			for i < len(src) && !hasRunePrefix(src[i:], tag) {
+				i++
+			}
+			i += len(tag)
+			if i > len(src) {
+				i = len(src)
+			}
+			tokens = append(tokens, sqlToken{kind: tokenString, text: string(src[start:i]), depth: depth, pos: offsets[start]})
+			continue
+
+		case r == '?' || (r == '$' && i+1 < len(src) && unicode.IsDigit(src[i+1])) ||
+			((r == ':' || r == '@') && i+1 < len(src) && isIdentRune(src[i+1]) && !(r == ':' && i > 0 && src[i-1] == ':')):
+			i++
+			for r != '?' && i < len(src) && isIdentRune(src[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenParam, text: string(src[start:i]), depth: depth, pos: offsets[start]})
+			continue
+
+		case unicode.IsDigit(r):
+			for i < len(src) && (unicode.IsDigit(src[i]) || src[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenNumber, text: string(src[start:i]), depth: depth, pos: offsets[start]})
+			continue
+
+		case isIdentRune(r):
+			for i < len(src) && isIdentRune(src[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: tokenWord, text: string(src[start:i]), depth: depth, pos: offsets[start]})
+			continue
+		}
+
+		// punctuation
+		i++
+		switch r {
+		case '(':
+			tokens = append(tokens, sqlToken{kind: tokenPunct, text: "(", depth: depth, pos: offsets[start]})
+			depth++
+			continue
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		}
+		tokens = append(tokens, sqlToken{kind: tokenPunct, text: string(r), depth: depth, pos: offsets[start]})
+	}
+
+	return tokens
+}
+
+// dollarTag returns the opening tag of a dollar quoted string at the start of src, or nil.
+func dollarTag(src []rune) []rune {
+	for i := 1; i < len(src); i++ {
+		if src[i] == '$' {
+			return src[:i+1]
+		}
+		if !isIdentRune(src[i]) || unicode.IsDigit(src[i]) && i == 1 {
+			return nil
+		}
+	}
+	return nil
+}
+
+func hasRunePrefix(src []rune, prefix []rune) bool {
+	if len(src) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if src[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// statementVerb returns the upper-cased leading keyword of query, e.g. SELECT or
+// INSERT. For a statement starting with WITH the verb of the main statement following
+// the common table expressions is returned.
+func statementVerb(query string, dialect Dialect) string {
+	tokens := tokenizeSQL(query, dialect)
+	for i, t := range tokens {
+		if t.depth != 0 || t.kind != tokenWord {
+			continue
+		}
+
+		kw := t.keyword()
+		if kw != "WITH" || i != 0 {
+			return kw
+		}
+
+		// skip the CTE list and look for the main statement
+		for _, t := range tokens[i+1:] {
+			switch kw := t.keyword(); kw {
+			case "SELECT", "INSERT", "UPDATE", "DELETE", "MERGE":
+				if t.depth == 0 {
+					return kw
+				}
+			}
+		}
+		return kw
+	}
+
+	return ""
+}
+
+// hasTopLevelKeyword reports whether keyword appears outside of parentheses in query.
+func hasTopLevelKeyword(query string, keyword string, dialect Dialect) bool {
+	for _, t := range tokenizeSQL(query, dialect) {
+		if t.depth == 0 && t.keyword() == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+// indexTopLevelKeyword returns the index of the first token at or after from which is
+// one of keywords outside of parentheses, or -1.
+func indexTopLevelKeyword(tokens []sqlToken, from int, keywords ...string) int {
+	for i := from; i < len(tokens); i++ {
+		if tokens[i].depth != 0 {
+			continue
+		}
+		for _, keyword := range keywords {
+			if tokens[i].keyword() == keyword {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// tableKeywords are keywords directly followed by a table name.
+var tableKeywords = map[string]bool{
+	"FROM":     true,
+	"JOIN":     true,
+	"INTO":     true,
+	"UPDATE":   true,
+	"TABLE":    true,
+	"TRUNCATE": true,
+}
+
+// clauseKeywords end a comma separated table list after FROM.
+var clauseKeywords = map[string]bool{
+	"WHERE": true, "JOIN": true, "INNER": true, "LEFT": true, "RIGHT": true, "FULL": true,
+	"CROSS": true, "NATURAL": true, "ON": true, "USING": true, "GROUP": true, "ORDER": true,
+	"HAVING": true, "LIMIT": true, "OFFSET": true, "UNION": true, "FOR": true, "SET": true,
+	"VALUES": true, "RETURNING": true, "WINDOW": true, "EXCEPT": true, "INTERSECT": true,
+	"SELECT": true, "DEFAULT": true, "LOCK": true, "FETCH": true,
+}
+
+// statementTables returns the lower-cased names of the tables referenced by query,
+// in order of appearance and without duplicates. Schema qualified names are kept.
+func statementTables(query string, dialect Dialect) []string {
+	tokens := tokenizeSQL(query, dialect)
+	seen := make(map[string]bool)
+	var tables []string
+
+	add := func(name string) {
+		name = strings.ToLower(name)
+		if !seen[name] {
+			seen[name] = true
+			tables = append(tables, name)
+		}
+	}
+
+	// readName reads a possibly qualified name at tokens[i] and returns it with the
+	// index of the following token.
+	readName := func(i int) (string, int) {
+		if i >= len(tokens) || (tokens[i].kind != tokenWord && tokens[i].kind != tokenQuotedIdent) {
+			return "", i
+		}
+		name := tokens[i].ident()
+		i++
+		for i+1 < len(tokens) && tokens[i].text == "." &&
+			(tokens[i+1].kind == tokenWord || tokens[i+1].kind == tokenQuotedIdent) {
+			name += "." + tokens[i+1].ident()
+			i += 2
+		}
+		return name, i
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		kw := tokens[i].keyword()
+		if !tableKeywords[kw] {
+			continue
+		}
+
+		j := i + 1
+		// skip modifiers such as TABLE IF NOT EXISTS, FROM ONLY or UPDATE LOW_PRIORITY
+		for j < len(tokens) {
+			switch tokens[j].keyword() {
+			case "IF", "NOT", "EXISTS", "ONLY", "LOW_PRIORITY", "IGNORE", "TEMPORARY", "LATERAL":
+				j++
+				continue
+			}
+			break
+		}
+
+		for {
+			name, next := readName(j)
+			if name == "" || (tokens[j].kind == tokenWord && clauseKeywords[tokens[j].keyword()]) {
+				break
+			}
+			add(name)
+
+			// DELETE/SELECT ... FROM a x, b y: skip the alias and follow the comma
+			j = next
+			if j < len(tokens) && tokens[j].keyword() == "AS" {
+				j++
+			}
+			if j < len(tokens) && tokens[j].kind == tokenWord && !clauseKeywords[tokens[j].keyword()] {
+				j++
+			}
+			if kw != "FROM" || j >= len(tokens) || tokens[j].text != "," {
+				break
+			}
+			j++
+		}
+	}
+
+	return tables
+}
+
+// splitSQLScript splits a script into statements at semicolons outside of string
+// literals, quoted identifiers, comments and dollar quoted strings. Like the mysql
+// client it honors DELIMITER lines, which change the statement delimiter so that
+// procedure bodies containing semicolons can be kept together. Backslashes escape
+// quotes in the string literals of MySQL only, the other dialects follow the standard.
+// Empty statements are dropped and statements are returned without their delimiter.
+func splitSQLScript(script string, dialect Dialect) []string {
+	var statements []string
+	src := []rune(script)
+	delimiter := []rune(";")
+	start := 0
+
+	flush := func(end int) {
+		stmt := strings.TrimSpace(string(src[start:end]))
+		// skip statements consisting of comments only
+		if len(tokenizeSQL(stmt, dialect)) > 0 {
+			statements = append(statements, stmt)
+		}
+	}
+
+	atLineStart := true
+	for i := 0; i < len(src); {
+		r := src[i]
+
+		// DELIMITER directive at the start of a line
+		if atLineStart && i+10 <= len(src) && strings.EqualFold(string(src[i:i+10]), "DELIMITER ") {
+			end := i
+			for end < len(src) && src[end] != '\n' {
+				end++
+			}
+			flush(i)
+			if fields := strings.Fields(string(src[i:end])); len(fields) > 1 {
+				delimiter = []rune(fields[1])
+			}
+			i = end
+			start = i
+			continue
+		}
+
+		if unicode.IsSpace(r) {
+			if r == '\n' {
+				atLineStart = true
+			}
+			i++
+			continue
+		}
+		atLineStart = false
+
+		switch {
+		case r == '-' && i+1 < len(src) && src[i+1] == '-':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			continue
+
+		case r == '/' && i+1 < len(src) && src[i+1] == '*':
+			i += 2
+			for i+1 < len(src) && !(src[i] == '*' && src[i+1] == '/') {
+				i++
+			}
+			i += 2
+			continue
+
+		case r == '\'' || r == '"' || r == '`':
+			i++
+			for i < len(src) {
+				if src[i] == '\\' && r != '`' && dialect == DialectMySQL {
+					i += 2
+					continue
+				}
+				if src[i] == r {
+					if i+1 < len(src) && src[i+1] == r {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			i++
+			continue
+
+		// the delimiter goes first, DELIMITER $$ must not open a dollar quoted string
+		case hasRunePrefix(src[i:], delimiter):
+			flush(i)
+			i += len(delimiter)
+			start = i
+			continue
+
+		case r == '$' && dollarTag(src[i:]) != nil && !(i+1 < len(src) && unicode.IsDigit(src[i+1])):
+			tag := dollarTag(src[i:])
+			i += len(tag)
+			for i < len(src) && !hasRunePrefix(src[i:], tag) {
+				i++
+			}
+			i += len(tag)
+			continue
+		}
+		i++
+	}
+
+	if start < len(src) {
+		flush(len(src))
+	}
+	return statements
+}
+
+// Fingerprint returns the normalized form of query shared by all executions of the
+// same statement: comments are dropped, whitespace is collapsed, unquoted words are
+// lower-cased, literals and parameters are replaced by ? and lists of them, such as
+// the values of IN lists and of multi-row inserts, are collapsed to a single entry.
+// The names of savepoints are replaced by ? too, as they are unique to a transaction.
+//
+//	Fingerprint("SELECT * FROM account WHERE id IN (1, 2, 3)") // "select * from account where id in (?)"
+//	Fingerprint("ROLLBACK TO SAVEPOINT sp_1_x2Yb9k")           // "rollback to savepoint ?"
+//
+// Backslashes in string literals are not escapes, as in standard SQL. The managers of
+// MySQL databases fingerprint their statements with the backslash escapes of MySQL.
+func Fingerprint(query string) string {
+	return fingerprint(query, DialectUnknown)
+}
+
+// fingerprint returns the Fingerprint of query in dialect.
+func fingerprint(query string, dialect Dialect) string {
+	tokens := tokenizeSQL(query, dialect)
+	savepoint := len(tokens) > 0 && savepointVerbs[tokens[0].keyword()]
+
+	var parts []string
+	for _, t := range tokens {
+		switch t.kind {
+		case tokenString, tokenNumber, tokenParam:
+			parts = append(parts, "?")
+		case tokenWord, tokenQuotedIdent:
+			if savepoint && !savepointKeywords[t.keyword()] {
+				parts = append(parts, "?")
+			} else if t.kind == tokenWord {
+				parts = append(parts, strings.ToLower(t.text))
+			} else {
+				parts = append(parts, t.text)
+			}
+		default:
+			parts = append(parts, t.text)
+		}
+
+		n := len(parts)
+		switch {
+		case n >= 3 && parts[n-1] == "?" && parts[n-2] == "," && parts[n-3] == "?":
+			// ?, ? collapses to ?
+			parts = parts[:n-2]
+		case n >= 7 && parts[n-1] == ")" && parts[n-4] == "," && parts[n-3] == "(" &&
+			equalParts(parts[n-7:n-4], parts[n-3:n]):
+			// (?), (?) collapses to (?)
+			parts = parts[:n-4]
+		}
+	}
+
+	var b strings.Builder
+	for i, part := range parts {
+		if i > 0 && part != "," && part != ")" && part != "." && parts[i-1] != "(" && parts[i-1] != "." {
+			b.WriteByte(' ')
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+// savepointKeywords are the keywords of the statements managing savepoints, the other
+// words of which are savepoint names.
+var savepointKeywords = map[string]bool{
+	"SAVEPOINT": true, "SAVE": true, "RELEASE": true, "ROLLBACK": true,
+	"TO": true, "TRANSACTION": true, "TRAN": true, "WORK": true,
+}
+
+func equalParts(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
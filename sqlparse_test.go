@@ -0,0 +1,112 @@
+package gotx
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitSQLScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		script  string
+		want    []string
+	}{
+		{
+			name:    "semicolons",
+			dialect: DialectPostgres,
+			script:  "CREATE TABLE a (id INT);\n-- a comment; not a statement\nINSERT INTO a VALUES (1);;",
+			want:    []string{"CREATE TABLE a (id INT)", "-- a comment; not a statement\nINSERT INTO a VALUES (1)"},
+		},
+		{
+			name:    "dollar quoted body",
+			dialect: DialectPostgres,
+			script:  "CREATE FUNCTION f() RETURNS INT AS $body$ BEGIN RETURN 1; END $body$ LANGUAGE plpgsql;\nSELECT f();",
+			want: []string{
+				"CREATE FUNCTION f() RETURNS INT AS $body$ BEGIN RETURN 1; END $body$ LANGUAGE plpgsql",
+				"SELECT f()",
+			},
+		},
+		{
+			name:    "mysql delimiter",
+			dialect: DialectMySQL,
+			script: "DELIMITER $$\n" +
+				"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND$$\n" +
+				"DELIMITER ;\n" +
+				"CALL p();\nSELECT 3;",
+			want: []string{
+				"CREATE PROCEDURE p()\nBEGIN\n  SELECT 1;\n  SELECT 2;\nEND",
+				"CALL p()",
+				"SELECT 3",
+			},
+		},
+		{
+			name:    "mysql backslash escape",
+			dialect: DialectMySQL,
+			script:  "INSERT INTO a VALUES ('it\\'s; fine');SELECT 1;",
+			want:    []string{"INSERT INTO a VALUES ('it\\'s; fine')", "SELECT 1"},
+		},
+		{
+			name:    "standard backslash",
+			dialect: DialectPostgres,
+			script:  "INSERT INTO path VALUES ('C:\\');SELECT 1;",
+			want:    []string{"INSERT INTO path VALUES ('C:\\')", "SELECT 1"},
+		},
+		{
+			name:    "standard doubled quote",
+			dialect: DialectSQLite,
+			script:  "INSERT INTO a VALUES ('it''s; fine');SELECT 1",
+			want:    []string{"INSERT INTO a VALUES ('it''s; fine')", "SELECT 1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitSQLScript(tt.script, tt.dialect)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitSQLScript() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT * FROM account WHERE id IN (1, 2, 3)", "select * from account where id in (?)"},
+		{"INSERT INTO t (a, b) VALUES (1, 'x'), (2, 'y')", "insert into t (a, b) values (?)"},
+		{"SAVEPOINT sp_1_x2Yb9kAAAAAAAAAB", "savepoint ?"},
+		{"RELEASE SAVEPOINT sp_2_x2Yb9kAAAAAAAAAC", "release savepoint ?"},
+		{"ROLLBACK TO SAVEPOINT sp_1_x2Yb9kAAAAAAAAAB", "rollback to savepoint ?"},
+		{"SAVE TRANSACTION sp_1_x2Yb9kAAAAAAAAAB", "save transaction ?"},
+		{"ROLLBACK", "rollback"},
+	}
+
+	for _, tt := range tests {
+		if got := Fingerprint(tt.query); got != tt.want {
+			t.Errorf("Fingerprint(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestStatementTables(t *testing.T) {
+	tests := []struct {
+		name    string
+		dialect Dialect
+		query   string
+		want    []string
+	}{
+		{"standard backslash", DialectPostgres, `SELECT * FROM a WHERE path = 'C:\' AND id IN (SELECT id FROM b)`, []string{"a", "b"}},
+		{"mysql backslash escape", DialectMySQL, `SELECT * FROM a WHERE name = 'it\'s' AND id IN (SELECT id FROM b)`, []string{"a", "b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := statementTables(tt.query, tt.dialect); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statementTables() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,159 @@
+package gotx
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// durationSamples is how many recent durations are kept per caller to compute
+// percentiles.
+const durationSamples = 1024
+
+// Stats are counters of the transactions run with Exec by a TxManager, including
+// nested ones.
+type Stats struct {
+	// Active is the number of Exec calls in progress.
+	Active int64 `json:"active"`
+
+	// Committed and RolledBack count the finished Exec calls by outcome.
+	Committed  int64 `json:"committed"`
+	RolledBack int64 `json:"rolled_back"`
+
+	// Retried is the number of retry attempts.
+	Retried int64 `json:"retried"`
+
+	// Duration is the total time spent in finished Exec calls.
+	Duration time.Duration `json:"duration"`
+}
+
+// AvgDuration returns the average duration of finished Exec calls.
+func (s Stats) AvgDuration() time.Duration {
+	if n := s.Committed + s.RolledBack; n > 0 {
+		return s.Duration / time.Duration(n)
+	}
+	return 0
+}
+
+// CallerStats are the counters of the transactions started by one caller function.
+// Percentiles are computed from the most recent durations.
+type CallerStats struct {
+	// Caller is the name of the function calling Exec.
+	Caller string `json:"caller"`
+
+	Committed  int64 `json:"committed"`
+	RolledBack int64 `json:"rolled_back"`
+	Retried    int64 `json:"retried"`
+
+	P50 time.Duration `json:"p50"`
+	P95 time.Duration `json:"p95"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// Stats returns the counters of the manager.
+func (tm *TxManager) Stats() Stats {
+	return tm.stats.snapshot()
+}
+
+// StatsByCaller returns the counters of the manager per caller function, sorted by
+// caller, to find the code paths generating slow or failing transactions.
+func (tm *TxManager) StatsByCaller() []CallerStats {
+	return tm.stats.byCaller()
+}
+
+type statsCollector struct {
+	mux     sync.Mutex
+	stats   Stats
+	callers map[string]*callerCollector
+}
+
+type callerCollector struct {
+	stats     CallerStats
+	durations []time.Duration
+	next      int
+}
+
+func newStatsCollector() *statsCollector {
+	return &statsCollector{callers: make(map[string]*callerCollector)}
+}
+
+func (c *statsCollector) begin() {
+	c.mux.Lock()
+	c.stats.Active++
+	c.mux.Unlock()
+}
+
+func (c *statsCollector) end(caller string, err error, retries int, d time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	cc := c.callers[caller]
+	if cc == nil {
+		cc = &callerCollector{stats: CallerStats{Caller: caller}}
+		c.callers[caller] = cc
+	}
+
+	c.stats.Active--
+	c.stats.Retried += int64(retries)
+	c.stats.Duration += d
+	cc.stats.Retried += int64(retries)
+	if err == nil {
+		c.stats.Committed++
+		cc.stats.Committed++
+	} else {
+		c.stats.RolledBack++
+		cc.stats.RolledBack++
+	}
+
+	if d > cc.stats.Max {
+		cc.stats.Max = d
+	}
+	if len(cc.durations) < durationSamples {
+		cc.durations = append(cc.durations, d)
+	} else {
+		cc.durations[cc.next] = d
+		cc.next = (cc.next + 1) % durationSamples
+	}
+}
+
+func (c *statsCollector) snapshot() Stats {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	return c.stats
+}
+
+func (c *statsCollector) byCaller() []CallerStats {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	result := make([]CallerStats, 0, len(c.callers))
+	for _, cc := range c.callers {
+		stats := cc.stats
+
+		sorted := append([]time.Duration(nil), cc.durations...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		stats.P50 = percentile(sorted, 50)
+		stats.P95 = percentile(sorted, 95)
+		stats.P99 = percentile(sorted, 99)
+
+		result = append(result, stats)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Caller < result[j].Caller })
+	return result
+}
+
+// percentile returns the p-th percentile of sorted durations using the nearest rank.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,62 @@
+package gotx
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// LeakReport describes the use of a transaction after the Exec call running it
+// returned, typically through a *Transaction reference which escaped txFunc.
+type LeakReport struct {
+	TxID string
+
+	// Started is the stack of the Exec call which started the transaction.
+	Started []byte
+
+	// Used is the stack of the use after Exec returned.
+	Used []byte
+}
+
+func (r *LeakReport) String() string {
+	return fmt.Sprintf("gotx: tx-%s used after its Exec call returned\n\nstarted at:\n%s\nused at:\n%s",
+		r.TxID, r.Started, r.Used)
+}
+
+// WithStrict enables strict mode, a diagnostic mode for development and tests. The
+// stack of every Exec call is recorded, and when a transaction is used after its Exec
+// call returned, a LeakReport with the stacks of the Exec call and of the use is
+// logged and passed to the OnLeak hooks. If panicOnLeak is set, the use panics with
+// the report instead of returning ErrInvalidTxState.
+func WithStrict(panicOnLeak bool) ManagerOption {
+	return func(tm *TxManager) {
+		tm.strict = true
+		tm.panicOnLeak = panicOnLeak
+	}
+}
+
+// checkLeak reports the use of t if its Exec call returned already.
+func (t *Transaction) checkLeak() error {
+	if atomic.LoadInt32(&t.finished) == 0 {
+		return nil
+	}
+
+	tm := t.txManager
+	if !tm.strict {
+		return ErrInvalidTxState
+	}
+
+	report := &LeakReport{TxID: t.txID, Started: t.startStack, Used: debug.Stack()}
+	log.Print(report)
+	for _, h := range tm.hooks {
+		if h.OnLeak != nil {
+			h.OnLeak(report)
+		}
+	}
+
+	if tm.panicOnLeak {
+		panic(report.String())
+	}
+	return ErrInvalidTxState
+}
@@ -0,0 +1,215 @@
+package gotx
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ErrTxSwept is matched by the errors of transactions rolled back by the sweeper of
+// WithTxSweeper for exceeding their maximum lifetime.
+var ErrTxSwept = errors.New("gotx: transaction exceeded its maximum lifetime")
+
+// SweepReport describes a db transaction rolled back by the sweeper of WithTxSweeper.
+type SweepReport struct {
+	// TxID is the ID of the logical transaction which began the db transaction, and
+	// Goroutine the goroutine it was bound to.
+	TxID      string
+	Goroutine uint64
+
+	// Reason tells why the transaction was swept: its goroutine exited, or it exceeded
+	// its maximum lifetime.
+	Reason string
+
+	// Age is how long the db transaction was open.
+	Age time.Duration
+
+	// Stack is the stack of the Exec call which began the transaction, recorded in
+	// strict mode only.
+	Stack []byte
+
+	// Err is the error of the rollback, if it failed.
+	Err error
+}
+
+func (r *SweepReport) String() string {
+	s := fmt.Sprintf("gotx: swept db tx-%s of goroutine %d open for %s: %s", r.TxID, r.Goroutine,
+		r.Age.Round(time.Millisecond), r.Reason)
+	if r.Err != nil {
+		s += fmt.Sprintf(", rollback failed: %v", r.Err)
+	}
+	if len(r.Stack) > 0 {
+		s += fmt.Sprintf(", began at:\n%s", r.Stack)
+	}
+	return s
+}
+
+// WithTxSweeper removes the transactions of the manager which can no longer end by
+// themselves: the ones bound to a goroutine which exited without ending them, e.g.
+// after a panic outside of Exec or a Transaction leaked to another goroutine, and, if
+// maxLifetime is positive, the ones open for longer than maxLifetime, snapshots of
+// TxManager.Snapshot excepted. Their db transaction is rolled back, their entries are
+// removed and a SweepReport is logged and passed to the OnSweep hooks. A transaction swept while its goroutine still runs
+// fails its following statements, and its commit with an error matching ErrTxSwept.
+//
+// Transactions are checked every interval by a goroutine which runs only while
+// transactions are open. Finding the exited goroutines takes a dump of all goroutines,
+// which stops the world briefly: the interval should be seconds rather than
+// milliseconds.
+func WithTxSweeper(interval, maxLifetime time.Duration) ManagerOption {
+	return func(tm *TxManager) {
+		tm.sweeper = &txSweeper{interval: interval, maxLifetime: maxLifetime}
+	}
+}
+
+type txSweeper struct {
+	interval    time.Duration
+	maxLifetime time.Duration
+
+	mux     sync.Mutex
+	running bool
+}
+
+// start starts the sweeping goroutine if it is not running.
+func (s *txSweeper) start(tm *TxManager) {
+	if s == nil {
+		return
+	}
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if !s.running {
+		s.running = true
+		go s.run(tm)
+	}
+}
+
+// run sweeps the transactions of tm until none is open anymore.
+func (s *txSweeper) run(tm *TxManager) {
+	tick(tm.clock, s.interval, func() bool {
+		// hold the sweeper lock so start can not miss the exit
+		s.mux.Lock()
+		tm.mux.Lock()
+		empty := len(tm.txMap) == 0
+		tm.mux.Unlock()
+		if empty {
+			s.running = false
+			s.mux.Unlock()
+			return false
+		}
+		s.mux.Unlock()
+
+		for _, report := range s.sweep(tm) {
+			tm.reportSweep(report)
+		}
+		return true
+	})
+}
+
+// sweep rolls back and removes the dead and expired transactions of tm.
+func (s *txSweeper) sweep(tm *TxManager) []*SweepReport {
+	// transactions started during the dump may belong to goroutines missing from it
+	dumped := tm.now()
+	alive := liveGoroutines()
+
+	tm.mux.Lock()
+	type swept struct {
+		tx     *Transaction
+		reason string
+		dead   bool
+	}
+	var victims []swept
+	for goid, txs := range tm.txMap {
+		if !alive[goid] && txs[0].started.Before(dumped) {
+			// the transactions of the goroutine can not end anymore
+			seen := make(map[*rawTx]bool)
+			for _, t := range txs {
+				if !seen[t.tx] {
+					seen[t.tx] = true
+					victims = append(victims, swept{tx: t, reason: "goroutine exited", dead: true})
+				}
+			}
+			delete(tm.txMap, goid)
+			continue
+		}
+
+		if s.maxLifetime <= 0 {
+			continue
+		}
+		for _, t := range txs {
+			// the root of each db transaction, the nested ones are as old or younger
+			if t.txID == t.tx.id && !t.tx.snapshot && tm.since(t.started) > s.maxLifetime {
+				victims = append(victims, swept{tx: t, reason: fmt.Sprintf("open for longer than %s", s.maxLifetime)})
+			}
+		}
+	}
+	tm.mux.Unlock()
+
+	var reports []*SweepReport
+	for _, v := range victims {
+		t := v.tx
+		report := &SweepReport{TxID: t.tx.id, Goroutine: t.goid, Reason: v.reason, Age: tm.since(t.started), Stack: t.startStack}
+
+		if !v.dead {
+			// the goroutine may still use the transaction: its commit must fail
+			t.tx.valuesMux.Lock()
+			if t.tx.doomed == nil {
+				t.tx.doomed = fmt.Errorf("%w: open for %s", ErrTxSwept, report.Age.Round(time.Millisecond))
+			}
+			t.tx.valuesMux.Unlock()
+			tm.detachAll(t)
+		}
+
+		t.tx.cleanup()
+		report.Err = t.tx.Rollback()
+		tm.leaks.untrack(t.tx)
+		tm.idle.untrack(t.tx)
+		t.tx.releaseConn()
+		if v.dead {
+			t.tx.clearValues()
+		}
+		tm.afterRollback(t)
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+func (tm *TxManager) reportSweep(report *SweepReport) {
+	log.Print(report)
+	for _, h := range tm.hooks {
+		if h.OnSweep != nil {
+			h.OnSweep(report)
+		}
+	}
+}
+
+// liveGoroutines returns the IDs of the running goroutines.
+func liveGoroutines() map[uint64]bool {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	alive := make(map[uint64]bool)
+	for _, line := range bytes.Split(buf, []byte("\n")) {
+		if !bytes.HasPrefix(line, goroutineSpace) {
+			continue
+		}
+		line = line[len(goroutineSpace):]
+		if i := bytes.IndexByte(line, ' '); i > 0 {
+			if id, err := parseUintBytes(line[:i], 10, 64); err == nil {
+				alive[id] = true
+			}
+		}
+	}
+	return alive
+}
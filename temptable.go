@@ -0,0 +1,199 @@
+package gotx
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+)
+
+// TempTable is a temporary table created by Transaction.CreateTempTable, which lives
+// until the db transaction ends.
+type TempTable struct {
+	tx      *Transaction
+	name    string
+	columns []string
+}
+
+// CreateTempTable creates a temporary table with the given column definitions, which
+// is dropped automatically when the db transaction commits or rolls back. It takes
+// large IN lists or staging data which are loaded with TempTable.Load and joined by
+// the statements of the transaction:
+//
+//	ids, err := tx.CreateTempTable("wanted_ids", "id BIGINT PRIMARY KEY")
+//	_, err = ids.Load(accountIDs)
+//	err = tx.Select(&accounts, "SELECT a.* FROM account a JOIN "+ids.Name()+" w ON w.id = a.id")
+//
+// On SQL Server the name gets the # prefix of local temporary tables. Oracle only has
+// global temporary tables created ahead, so CreateTempTable is not supported there.
+func (t *Transaction) CreateTempTable(name string, columns string) (*TempTable, error) {
+	if err := t.checkState(); err != nil {
+		return nil, err
+	}
+
+	var create, drop string
+	switch t.txManager.dialect {
+	case DialectPostgres:
+		create = "CREATE TEMPORARY TABLE " + name + " (" + columns + ") ON COMMIT DROP"
+	case DialectMySQL:
+		create = "CREATE TEMPORARY TABLE " + name + " (" + columns + ")"
+		drop = "DROP TEMPORARY TABLE IF EXISTS " + name
+	case DialectSQLite:
+		create = "CREATE TEMPORARY TABLE " + name + " (" + columns + ")"
+		drop = "DROP TABLE IF EXISTS temp." + name
+	case DialectSQLServer:
+		if !strings.HasPrefix(name, "#") {
+			name = "#" + name
+		}
+		create = "CREATE TABLE " + name + " (" + columns + ")"
+		drop = "IF OBJECT_ID('tempdb.." + name + "') IS NOT NULL DROP TABLE " + name
+	default:
+		return nil, fmt.Errorf("gotx: temporary tables are not supported on %s", t.txManager.dialect)
+	}
+
+	if _, err := t.exec(create); err != nil {
+		return nil, err
+	}
+
+	if drop != "" {
+		t.tx.valuesMux.Lock()
+		t.tx.tempTables = append(t.tx.tempTables, drop)
+		t.tx.valuesMux.Unlock()
+	}
+
+	return &TempTable{tx: t, name: name, columns: columnNames(columns, t.txManager.dialect)}, nil
+}
+
+// Name returns the name of the table to use in statements.
+func (tt *TempTable) Name() string {
+	return tt.name
+}
+
+// Load inserts rows into the table and returns the number of inserted rows. rows is a
+// slice of structs or maps whose fields or keys are named like the columns, or of
+// plain values for a table with a single column. Rows are inserted in batches of
+// multi-row INSERT statements.
+func (tt *TempTable) Load(rows interface{}) (int64, error) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return 0, fmt.Errorf("gotx: rows of %s must be a slice", tt.name)
+	}
+	if v.Len() == 0 {
+		return 0, nil
+	}
+
+	params := make([]string, len(tt.columns))
+	for i, column := range tt.columns {
+		params[i] = ":" + column
+	}
+	query := "INSERT INTO " + tt.name + " (" + strings.Join(tt.columns, ", ") + ") VALUES (" + strings.Join(params, ", ") + ")"
+
+	batch := tt.tx.txManager.maxParams() / len(tt.columns)
+
+	var total int64
+	for start := 0; start < v.Len(); start += batch {
+		end := start + batch
+		if end > v.Len() {
+			end = v.Len()
+		}
+
+		chunk, err := tt.rowArgs(v.Slice(start, end))
+		if err != nil {
+			return total, err
+		}
+		n, err := tt.tx.NamedExec(query, chunk)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// rowArgs returns the named arguments of rows, wrapping plain values in maps.
+func (tt *TempTable) rowArgs(rows reflect.Value) (interface{}, error) {
+	elem := rows.Type().Elem()
+	for elem.Kind() == reflect.Ptr {
+		elem = elem.Elem()
+	}
+	if elem.Kind() == reflect.Map || !isScannable(elem) {
+		return rows.Interface(), nil
+	}
+
+	if len(tt.columns) != 1 {
+		return nil, fmt.Errorf("gotx: plain values can only be loaded into a single column, %s has %d", tt.name, len(tt.columns))
+	}
+
+	args := make([]map[string]interface{}, rows.Len())
+	for i := range args {
+		args[i] = map[string]interface{}{tt.columns[0]: rows.Index(i).Interface()}
+	}
+	return args, nil
+}
+
+// maxParams returns the number of parameters a statement may have, keeping within the
+// limits of the databases.
+func (tm *TxManager) maxParams() int {
+	switch tm.dialect {
+	case DialectSQLite:
+		return 999
+	case DialectSQLServer:
+		return 2000
+	default:
+		return 65535
+	}
+}
+
+// columnNames returns the names of the columns defined by a column definition list,
+// skipping table constraints.
+func columnNames(columns string, dialect Dialect) []string {
+	var names []string
+	expectName := true
+	for _, tok := range tokenizeSQL(columns, dialect) {
+		if tok.depth != 0 {
+			continue
+		}
+		if tok.text == "," {
+			expectName = true
+			continue
+		}
+		if !expectName {
+			continue
+		}
+
+		expectName = false
+		switch tok.keyword() {
+		case "PRIMARY", "UNIQUE", "CONSTRAINT", "FOREIGN", "CHECK", "KEY", "INDEX":
+			continue
+		}
+		names = append(names, tok.ident())
+	}
+	return names
+}
+
+// cleanup releases the session state held by the db tx: its open streams, MySQL named
+// locks and temporary tables. It must run before the db tx ends.
+func (t *rawTx) cleanup() {
+	t.closeStreams()
+	t.releaseLocks()
+	t.dropTempTables()
+}
+
+// dropTempTables drops the temporary tables of the db tx which are not dropped by the
+// database itself. It must run before the db tx ends, while its connection is still in
+// use.
+func (t *rawTx) dropTempTables() {
+	t.valuesMux.Lock()
+	drops := t.tempTables
+	t.tempTables = nil
+	t.valuesMux.Unlock()
+
+	for _, drop := range drops {
+		// the context of the transaction may be canceled already, and a table left
+		// behind would stay with the pooled connection
+		if _, err := t.ExecContext(context.Background(), drop); err != nil {
+			log.Printf("gotx: dropping temporary table of tx-%s failed: %v", t.id, err)
+		}
+	}
+}
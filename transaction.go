@@ -1,11 +1,15 @@
 package gotx
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
 	"log"
 	"regexp"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -17,16 +21,86 @@ const (
 var (
 	// ErrInvalidTxState is returned when transaction is not initialized
 	ErrInvalidTxState = errors.New("gotx: tx is already committed or rolled back")
+
+	// ErrTooManyRows is returned when a result set exceeds Options.MaxRows
+	ErrTooManyRows = errors.New("gotx: result set exceeds the row limit")
+
+	// ErrTxSuspended is returned when a transaction is used while a transaction with
+	// PropagationNew started inside it is active
+	ErrTxSuspended = errors.New("gotx: tx is suspended by a nested tx with PropagationNew")
 )
 
 type rawTx struct {
 	*sqlx.Tx
 
+	// id is the ID of the logical transaction which began this tx
+	id string
+
 	// a flag that marks the tx as committed or rolled back
 	// if raw tx is done, repeated commit/rollback will return error
 	// done bool
 	// A counter that tracks how many logical transactions use this tx
 	refCount uint32
+
+	// suspended counts the transactions with PropagationNew which suspend this tx
+	suspended int32
+
+	// snapshot marks the long-lived tx of TxManager.Snapshot
+	snapshot bool
+
+	// values is the key/value store shared by the logical transactions of this tx, and
+	// results are the recorded statement results
+	valuesMux sync.Mutex
+	values    map[interface{}]interface{}
+	results   []StatementResult
+	changes   []Change
+
+	// locks counts the acquisitions of the named locks held by this tx, and
+	// mysqlLocks marks that they must be released before the tx ends
+	locks      map[string]int
+	mysqlLocks bool
+
+	// fences are the fencing tokens checked before the tx commits
+	fences map[string]int64
+
+	// wrote is set once a statement other than Get or Select ran in the tx
+	wrote int32
+
+	// idle watches the tx for idle periods, if enabled
+	idle *idleWatch
+
+	// conn is the connection the tx runs on, and session the connection pinned by
+	// WithSession if conn is its connection
+	conn    *sqlx.Conn
+	session *session
+
+	// tempTables are the statements dropping the temporary tables of the tx
+	tempTables []string
+
+	// invariants are the invariants checked before the tx commits, added with
+	// AddInvariant
+	invariants []Invariant
+
+	// doomed is the error making the commit of the tx fail, such as an exceeded write
+	// quota
+	doomed error
+
+	// savepoints are the savepoints of the active nested transactions run with
+	// Options.Savepoint, outermost first
+	savepoints []savepointMark
+
+	// streams stop the goroutines of Stream reading rows of the tx
+	streams []func()
+}
+
+// clearValues drops the values and results stored in the tx once it ends.
+func (t *rawTx) clearValues() {
+	t.valuesMux.Lock()
+	t.values = nil
+	t.results = nil
+	t.changes = nil
+	t.fences = nil
+	t.valuesMux.Unlock()
 }
 
 func newRawTx(tx *sqlx.Tx) *rawTx {
@@ -34,6 +108,11 @@ func newRawTx(tx *sqlx.Tx) *rawTx {
 }
 
 // Transaction is a logical transaction which wraps a underlying db transaction (physical transaction)
+//
+// A Transaction is bound to the goroutine of the Exec call which started it, and its
+// methods must only be called from that goroutine while the txFunc runs, like the
+// methods of a sql.Tx. Other goroutines may run their own transactions on the same
+// manager, see TxManager.
 type Transaction struct {
 	// tx is the underlying physical transaction
 	tx   *rawTx
@@ -45,10 +124,47 @@ type Transaction struct {
 
 	// reference to tx manager
 	txManager *TxManager
-	// ctx       context.Context
+	ctx       context.Context
+	opts      *Options
 
 	// requiredNew marks if this transaction is created from a new db tx or not
 	requiredNew bool
+
+	// goid is the ID of the goroutine this transaction is bound to
+	goid uint64
+
+	// suspendedTx is the db tx of the enclosing transaction, suspended while this
+	// transaction with PropagationNew is active
+	suspendedTx *rawTx
+
+	// finished is set once the Exec call running this transaction returns, and
+	// startStack is the stack of that call, recorded in strict mode
+	finished   int32
+	startStack []byte
+
+	// parent is the transaction this one is nested in, and children are the nested
+	// transactions, tracked in debug mode only
+	parent   *Transaction
+	children []*Transaction
+
+	started  time.Time
+	duration time.Duration
+	outcome  error
+
+	// statements counts the statements run by this transaction and the ones nested
+	// in it, and statementTime is the time spent executing them in nanoseconds
+	statements    int64
+	statementTime int64
+
+	// writtenRows counts the rows affected by the statements of this transaction and
+	// the ones nested in it in the same db transaction
+	writtenRows int64
+
+	// priority is the priority of Options.Priority, or the inherited one
+	priority Priority
+
+	// savepointMark is the name of the savepoint this transaction runs within, if any
+	savepointMark string
 }
 
 func NewTx(t *rawTx, txID string, requiredNew bool, manager *TxManager) *Transaction {
@@ -58,6 +174,8 @@ func NewTx(t *rawTx, txID string, requiredNew bool, manager *TxManager) *Transac
 		txManager:   manager,
 		requiredNew: requiredNew,
 		committed:   false,
+		ctx:         context.Background(),
+		opts:        defaultOptions(),
 	}
 
 	atomic.AddUint32(&trans.tx.refCount, 1)
@@ -69,30 +187,104 @@ func (t *Transaction) String() string {
 	return fmt.Sprintf("tx-%s", t.txID)
 }
 
+// ID returns the ID of the logical transaction.
+func (t *Transaction) ID() string {
+	return t.txID
+}
+
+// RootID returns the ID of the logical transaction which began the underlying
+// db transaction. Logical transactions sharing a db tx have the same RootID.
+func (t *Transaction) RootID() string {
+	return t.tx.id
+}
+
+// Context returns the context the transaction was started with, carrying the
+// transaction itself for FromContext, the deadline of Options.Timeout and the values
+// added with WithValue. Statements of the
+// transaction run with this context, and interceptors and hooks receive it.
+func (t *Transaction) Context() context.Context {
+	return t.ctx
+}
+
+// WithValue derives a context carrying value under key from the context of the
+// transaction, makes it the context of the transaction and returns it. Statements run
+// afterwards, as well as interceptors and the commit and rollback hooks, see the value.
+func (t *Transaction) WithValue(key, value interface{}) context.Context {
+	ctx := context.WithValue(t.ctx, key, value)
+
+	// ActiveTransactions reads the context from other goroutines
+	t.txManager.mux.Lock()
+	t.ctx = ctx
+	t.txManager.mux.Unlock()
+	return ctx
+}
+
+// Set stores value under key for the lifetime of the db transaction, so layers taking
+// part in the same transaction can share request scoped data, like the current user or
+// computed aggregates, without extra parameters. Nested transactions sharing the db
+// transaction see the same values, while transactions with PropagationNew start with
+// none. Values are dropped when the db transaction commits or rolls back, after the
+// commit and rollback hooks ran. Like context keys, keys should be of an unexported
+// type to avoid collisions between packages.
+func (t *Transaction) Set(key, value interface{}) {
+	t.tx.valuesMux.Lock()
+	defer t.tx.valuesMux.Unlock()
+
+	if t.tx.values == nil {
+		t.tx.values = make(map[interface{}]interface{})
+	}
+	t.tx.values[key] = value
+}
+
+// Value returns the value stored under key with Set, or nil.
+func (t *Transaction) Value(key interface{}) interface{} {
+	t.tx.valuesMux.Lock()
+	defer t.tx.valuesMux.Unlock()
+
+	return t.tx.values[key]
+}
+
 func (t *Transaction) setError(err error) {
 	t.err = err
 }
 
 func (t *Transaction) checkState() error {
+	if err := t.checkLeak(); err != nil {
+		return err
+	}
+
 	if t.tx == nil || t.committed {
 		return ErrInvalidTxState
 	}
 
+	if atomic.LoadInt32(&t.tx.suspended) > 0 {
+		return ErrTxSuspended
+	}
+
 	return nil
 }
 
 func (t *Transaction) Commit() error {
-	t.txManager.Remove(t)
+	t.txManager.detach(t)
 	var err error
 
 	if t.requiredNew {
-		err = t.tx.Commit()
+		err = t.txManager.commitRaw(t)
+		t.resume()
 	} else {
+		if t.savepointMark != "" {
+			name := t.popSavepoint().name
+			if err = t.releaseSavepoint(name); err != nil {
+				err = fmt.Errorf("gotx: releasing savepoint %s failed: %w", name, err)
+				// the changes of t may be lost, the enclosing transaction must not commit
+				t.tx.doom(err)
+			}
+		}
 		// decrease refCount by one
 		leftRefs := atomic.AddUint32(&t.tx.refCount, ^uint32(0))
 		// If refCount decreases to zero, do the real commit
-		if leftRefs <= 0 {
-			err = t.tx.Commit()
+		if leftRefs <= 0 && err == nil {
+			err = t.txManager.commitRaw(t)
 		}
 	}
 
@@ -104,15 +296,22 @@ func (t *Transaction) Commit() error {
 // rollback always do the real rollback. For tx binding to a unique db tx(requiredNew is true),
 // rollback do the db rollback directly. For tx sharing a db tx, rollback do rollback only once.
 func (t *Transaction) Rollback() error {
+	defer t.tx.clearValues()
+	defer t.txManager.leaks.untrack(t.tx)
+	defer t.tx.releaseConn()
+
 	var err error
 	if t.requiredNew {
-		t.txManager.Remove(t)
+		t.txManager.detach(t)
 		atomic.AddUint32(&t.tx.refCount, ^uint32(0))
+		t.tx.cleanup()
 		err = t.tx.Rollback()
+		t.resume()
 	} else {
-		t.txManager.RemoveAll()
+		t.txManager.detachAll(t)
 		if atomic.LoadUint32(&t.tx.refCount) > 0 {
 			atomic.SwapUint32(&t.tx.refCount, 0)
+			t.tx.cleanup()
 			err = t.tx.Rollback()
 		}
 	}
@@ -121,10 +320,19 @@ func (t *Transaction) Rollback() error {
 		return err
 	}
 
+	t.txManager.afterRollback(t)
 	log.Printf("%s rolledback\n", t)
 	return nil
 }
 
+// resume resumes the db tx suspended by this transaction.
+func (t *Transaction) resume() {
+	if t.suspendedTx != nil {
+		atomic.AddInt32(&t.suspendedTx.suspended, -1)
+		t.suspendedTx = nil
+	}
+}
+
 func (t *Transaction) execTxFunc(txFunc func(tx *Transaction) error) {
 	err := txFunc(t)
 
@@ -133,6 +341,90 @@ func (t *Transaction) execTxFunc(txFunc func(tx *Transaction) error) {
 	}
 }
 
+// run passes stmt through the interceptors of the tx manager and executes it.
+func (t *Transaction) run(stmt *Statement) error {
+	stmt.tx = t
+	if t.txManager.rebind {
+		stmt.Query = rebindQuery(t.txManager.bindType(), stmt.Query, t.txManager.dialect)
+	}
+	if err := t.checkReadOnly(stmt); err != nil {
+		return err
+	}
+	t.applyPriority(stmt)
+	if stmt.Kind != StatementGet && stmt.Kind != StatementSelect && !stmt.savepoint {
+		atomic.StoreInt32(&t.tx.wrote, 1)
+	}
+
+	release, err := t.txManager.acquireSlot(t.ctx, stmt.Priority)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	if w := t.tx.idle; w != nil {
+		w.begin(stmt.Query)
+		defer w.end()
+	}
+
+	start := t.txManager.now()
+	err = t.txManager.handler(t.ctx, stmt)
+	elapsed := t.txManager.since(start)
+	if !stmt.savepoint {
+		t.addStatementTime(elapsed)
+	}
+	if err == nil && stmt.Kind == StatementExec && stmt.Result != nil && !stmt.savepoint {
+		err = t.countWrite(stmt.Result)
+	}
+
+	if qs := t.txManager.queryStats; qs != nil {
+		caller, _ := t.ctx.Value(callerContextKey{}).(string)
+		qs.record(stmt.Query, caller, t.txManager.dialect, elapsed)
+	}
+
+	if t.txManager.recordResults {
+		t.recordResult(stmt, err)
+	}
+	return err
+}
+
+// addStatementTime adds the time spent executing a statement to t and the
+// transactions it is nested in.
+func (t *Transaction) addStatementTime(d time.Duration) {
+	for tx := t; tx != nil; tx = tx.parent {
+		atomic.AddInt64(&tx.statements, 1)
+		atomic.AddInt64(&tx.statementTime, int64(d))
+	}
+}
+
+// exec runs a statement which does not return rows.
+func (t *Transaction) exec(query string, args ...interface{}) (sql.Result, error) {
+	stmt := &Statement{Kind: StatementExec, Query: query, Args: args}
+	if err := t.run(stmt); err != nil {
+		return nil, err
+	}
+
+	return stmt.Result, nil
+}
+
+// SQLTx returns the database/sql transaction of t, for libraries which must take part
+// in it themselves, such as job queues inserting jobs in the same transaction.
+// Statements run on it directly bypass the interceptors, hooks and state checks of t.
+func (t *Transaction) SQLTx() *sql.Tx {
+	return t.tx.Tx.Tx
+}
+
+// Raw calls fn with the driver connection the db transaction of t runs on, such as a
+// *stdlib.Conn of pgx, for driver specific APIs which must run in the transaction. As
+// with SQLTx, statements run through the driver connection bypass the interceptors,
+// hooks and state checks of t. The connection must not be used after fn returns, nor
+// concurrently with other statements of the transaction.
+func (t *Transaction) Raw(fn func(driverConn interface{}) error) error {
+	if err := t.checkState(); err != nil {
+		return err
+	}
+	return t.tx.conn.Raw(fn)
+}
+
 // GetOne is the sqlx.Get wrapper
 func (t *Transaction) GetOne(dest interface{}, query string, args ...interface{}) error {
 	if err := t.checkState(); err != nil {
@@ -140,11 +432,15 @@ func (t *Transaction) GetOne(dest interface{}, query string, args ...interface{}
 	}
 
 	// dest should be a pointer to a struct/map
-	err := t.tx.Get(dest, query, args...)
+	err := t.run(&Statement{Kind: StatementGet, Query: query, Args: args, Dest: dest})
 	if err != nil {
 		return err
 	}
 
+	if err := t.Decrypt(dest); err != nil {
+		return err
+	}
+	t.mask(dest, query)
 	return nil
 }
 
@@ -154,12 +450,23 @@ func (t *Transaction) Insert(query string, arg interface{}) (int64, error) {
 		return 0, err
 	}
 
-	result, err := t.tx.NamedExec(query, arg)
+	bound, err := t.encryptArg(arg)
+	if err != nil {
+		return 0, fmt.Errorf("insert failed: %w", err)
+	}
+
+	query2, args, err := t.tx.BindNamed(query, bound)
+	if err != nil {
+		return 0, fmt.Errorf("insert failed: %w", err)
+	}
+
+	result, err := t.exec(query2, args...)
 	if err != nil {
 		return 0, fmt.Errorf("insert failed: %w", err)
 	}
 
 	resultID, err := result.LastInsertId()
+	t.recordChange(ChangeInsert, query, arg, resultID)
 
 	if err != nil {
 		return 0, fmt.Errorf("insert failed: %w", err)
@@ -173,16 +480,69 @@ func (t *Transaction) Select(dest interface{}, query string, args ...interface{}
 		return err
 	}
 
-	err := t.tx.Select(dest, query, args...)
+	err := t.run(&Statement{Kind: StatementSelect, Query: query, Args: args, Dest: dest})
 
 	if err != nil {
 		return fmt.Errorf("query failed: %w", err)
 	}
 
+	if err := t.Decrypt(dest); err != nil {
+		return err
+	}
+	t.mask(dest, query)
 	return nil
 
 }
 
+// Count runs a query returning a single number, typically SELECT COUNT(*) ..., and
+// returns that number.
+func (t *Transaction) Count(query string, args ...interface{}) (int64, error) {
+	var count int64
+	if err := t.GetOne(&count, query, args...); err != nil {
+		return 0, fmt.Errorf("count failed: %w", err)
+	}
+
+	return count, nil
+}
+
+// Exists reports whether query returns at least one row. The query is rewritten to
+// the SELECT EXISTS(...) form of the manager's dialect, so the database stops at the
+// first matching row.
+func (t *Transaction) Exists(query string, args ...interface{}) (bool, error) {
+	var existsQuery string
+	switch t.txManager.dialect {
+	case DialectSQLServer:
+		existsQuery = "SELECT CASE WHEN EXISTS(" + query + ") THEN 1 ELSE 0 END"
+	case DialectOracle:
+		existsQuery = "SELECT CASE WHEN EXISTS(" + query + ") THEN 1 ELSE 0 END FROM dual"
+	default:
+		existsQuery = "SELECT EXISTS(" + query + ")"
+	}
+
+	var exists bool
+	if err := t.GetOne(&exists, existsQuery, args...); err != nil {
+		return false, fmt.Errorf("exists failed: %w", err)
+	}
+
+	return exists, nil
+}
+
+// ForEach runs a query and calls fn for each row of the result set, without loading
+// the whole result set into memory. fn may scan the current row with rows.StructScan,
+// rows.MapScan or rows.Scan. Returning an error from fn stops the iteration.
+func (t *Transaction) ForEach(query string, fn func(rows *sqlx.Rows) error, args ...interface{}) error {
+	if err := t.checkState(); err != nil {
+		return err
+	}
+
+	err := t.run(&Statement{Kind: StatementQuery, Query: query, Args: args, EachRow: fn})
+	if err != nil {
+		return fmt.Errorf("query failed: %w", err)
+	}
+
+	return nil
+}
+
 // Update execute a update sql using sqlx NamedExec.
 func (t *Transaction) Update(query string, arg interface{}) (int64, error) {
 
@@ -194,6 +554,7 @@ func (t *Transaction) Update(query string, arg interface{}) (int64, error) {
 	if err != nil {
 		return 0, fmt.Errorf("update entity failed: %w", err)
 	}
+	t.recordChange(ChangeUpdate, query, arg, 0)
 
 	return updatedRows, nil
 }
@@ -207,6 +568,7 @@ func (t *Transaction) Delete(query string, arg interface{}) (int64, error) {
 	if err != nil || deletedRows <= 0 {
 		return 0, fmt.Errorf("delete entity failed: %w", err)
 	}
+	t.recordChange(ChangeDelete, query, arg, 0)
 
 	if deletedRows <= 0 {
 		log.Printf("delete entity failed: %s", err)
@@ -226,7 +588,12 @@ func (t *Transaction) NamedExec(query string, arg interface{}) (int64, error) {
 		return 0, err
 	}
 
-	query2, args, err := sqlx.Named(query, arg)
+	bound, err := t.encryptArg(arg)
+	if err != nil {
+		return 0, err
+	}
+
+	query2, args, err := bindNamedQuestion(t.tx.Mapper, query, bound)
 	if err != nil {
 		return 0, err
 	}
@@ -244,7 +611,7 @@ func (t *Transaction) NamedExec(query string, arg interface{}) (int64, error) {
 	query2 = t.tx.Rebind(query2)
 	log.Println(query2)
 
-	result, err := t.tx.Exec(query2, args...)
+	result, err := t.exec(query2, args...)
 	if err != nil {
 		return 0, err
 	}
@@ -252,3 +619,23 @@ func (t *Transaction) NamedExec(query string, arg interface{}) (int64, error) {
 	return result.RowsAffected()
 
 }
+
+// ExecScript splits a multi-statement SQL script, such as a seed or maintenance
+// script, and executes its statements one by one in the transaction. Semicolons in
+// string literals, quoted identifiers, comments and Postgres dollar quoted bodies do
+// not split statements, and DELIMITER lines are honored like in the mysql client.
+// Backslash escapes in string literals are only honored on MySQL.
+// Execution stops at the first failing statement.
+func (t *Transaction) ExecScript(sqlText string) error {
+	if err := t.checkState(); err != nil {
+		return err
+	}
+
+	for i, stmt := range splitSQLScript(sqlText, t.txManager.dialect) {
+		if _, err := t.exec(stmt); err != nil {
+			return fmt.Errorf("script statement %d failed: %w", i+1, err)
+		}
+	}
+
+	return nil
+}
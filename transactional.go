@@ -0,0 +1,91 @@
+package gotx
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+)
+
+// Transactional returns a function running fn in a transaction of tm started with
+// options, as an alternative to writing an Exec closure at every call site:
+//
+//	var createOrder = gotx.Transactional(tm, func(ctx context.Context) error {
+//		tx := gotx.MustFromContext(ctx)
+//		...
+//	}, nil)
+//
+// fn receives the context of the transaction, from which FromContext returns it. The
+// transaction is rolled back if fn returns an error. Stats attribute the transactions
+// to fn rather than to the caller of the returned function.
+func Transactional(tm *TxManager, fn func(ctx context.Context) error, options *Options) func(ctx context.Context) error {
+	caller := funcName(fn)
+	return func(ctx context.Context) error {
+		return tm.exec(ctx, caller, func(tx *Transaction) error {
+			return fn(tx.Context())
+		}, options)
+	}
+}
+
+// TransactionalArg is like Transactional for functions taking an argument.
+func TransactionalArg[T any](tm *TxManager, fn func(ctx context.Context, arg T) error, options *Options) func(ctx context.Context, arg T) error {
+	caller := funcName(fn)
+	return func(ctx context.Context, arg T) error {
+		return tm.exec(ctx, caller, func(tx *Transaction) error {
+			return fn(tx.Context(), arg)
+		}, options)
+	}
+}
+
+// TransactionalResult is like Transactional for functions returning a result. The
+// zero value is returned with the error if the transaction fails.
+func TransactionalResult[R any](tm *TxManager, fn func(ctx context.Context) (R, error), options *Options) func(ctx context.Context) (R, error) {
+	caller := funcName(fn)
+	return func(ctx context.Context) (R, error) {
+		var result R
+		err := tm.exec(ctx, caller, func(tx *Transaction) error {
+			var err error
+			result, err = fn(tx.Context())
+			return err
+		}, options)
+
+		if err != nil {
+			var zero R
+			return zero, err
+		}
+		return result, nil
+	}
+}
+
+// TransactionalFunc is like Transactional for functions taking an argument and
+// returning a result:
+//
+//	var transfer = gotx.TransactionalFunc(tm, func(ctx context.Context, req TransferRequest) (*Receipt, error) {
+//		...
+//	}, nil)
+//
+//	receipt, err := transfer(ctx, req)
+func TransactionalFunc[T, R any](tm *TxManager, fn func(ctx context.Context, arg T) (R, error), options *Options) func(ctx context.Context, arg T) (R, error) {
+	caller := funcName(fn)
+	return func(ctx context.Context, arg T) (R, error) {
+		var result R
+		err := tm.exec(ctx, caller, func(tx *Transaction) error {
+			var err error
+			result, err = fn(tx.Context(), arg)
+			return err
+		}, options)
+
+		if err != nil {
+			var zero R
+			return zero, err
+		}
+		return result, nil
+	}
+}
+
+// funcName returns the name of the function fn.
+func funcName(fn interface{}) string {
+	if f := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()); f != nil {
+		return f.Name()
+	}
+	return "unknown"
+}
@@ -0,0 +1,79 @@
+package gotx
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// WithDebug enables debug logging. When the outermost transaction of a goroutine ends,
+// the tree of the logical transactions nested in it is logged with the timing and
+// outcome of every transaction, e.g.:
+//
+//	tx-Xb3kT9aQ1c committed in 12.4ms (3 statements in 2.9ms)
+//	├── tx-pL0aZ7cE2d committed in 3.1ms (2 statements in 1.8ms)
+//	└── tx-R2vYc8nB4f [new] rolled back in 1.2ms (2 statements in 1.1ms): insufficient funds
+func WithDebug() ManagerOption {
+	return func(tm *TxManager) {
+		tm.debug = true
+	}
+}
+
+// finishTx records the outcome of a logical transaction and logs the transaction
+// tree when the outermost transaction ends in debug mode.
+func (tm *TxManager) finishTx(tx *Transaction, err error) {
+	tx.duration = tm.since(tx.started)
+	tx.outcome = err
+	atomic.StoreInt32(&tx.finished, 1)
+	tm.recordSlowTx(tx)
+
+	if tm.debug && tx.parent == nil {
+		log.Printf("transaction tree:\n%s", renderTxTree(tx))
+	}
+}
+
+// renderTxTree renders tx and its nested transactions as a tree.
+func renderTxTree(tx *Transaction) string {
+	var b strings.Builder
+	writeTxNode(&b, tx, "", "")
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func writeTxNode(b *strings.Builder, tx *Transaction, prefix string, childPrefix string) {
+	b.WriteString(prefix)
+	b.WriteString(tx.String())
+	if tx.requiredNew && tx.parent != nil {
+		b.WriteString(" [new]")
+	}
+
+	switch {
+	case tx.duration == 0:
+		b.WriteString(" running")
+	case tx.outcome == nil:
+		fmt.Fprintf(b, " committed in %s", tx.duration)
+	default:
+		fmt.Fprintf(b, " rolled back in %s", tx.duration)
+	}
+	if tx.duration != 0 {
+		n, statementTime := atomic.LoadInt64(&tx.statements), time.Duration(atomic.LoadInt64(&tx.statementTime))
+		if n == 1 {
+			fmt.Fprintf(b, " (1 statement in %s)", statementTime)
+		} else {
+			fmt.Fprintf(b, " (%d statements in %s)", n, statementTime)
+		}
+	}
+	if tx.duration != 0 && tx.outcome != nil {
+		fmt.Fprintf(b, ": %v", tx.outcome)
+	}
+	b.WriteString("\n")
+
+	for i, child := range tx.children {
+		if i == len(tx.children)-1 {
+			writeTxNode(b, child, childPrefix+"└── ", childPrefix+"    ")
+		} else {
+			writeTxNode(b, child, childPrefix+"├── ", childPrefix+"│   ")
+		}
+	}
+}
@@ -3,43 +3,176 @@ package gotx
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
-	"math/rand"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/reflectx"
 )
 
-const bytesForKey = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-
-func generateRandomKey(size int) string {
-	keyBytes := make([]byte, size)
-	for i := range keyBytes {
-		keyBytes[i] = bytesForKey[rand.Intn(len(bytesForKey))]
-	}
-
-	return string(keyBytes)
-}
-
 // TxManager implements a basic transaction manager
+//
+// A TxManager is safe for concurrent use: Exec and its variants, Snapshot, the
+// introspection methods such as ActiveTransactions, Stats and SlowTransactions, and
+// Remove and RemoveAll may be called from any number of goroutines at once. Remove and
+// RemoveAll only act on the transactions of the calling goroutine. Manager options must
+// all be passed to NewTxManager. Hooks and interceptors run in the goroutine of the
+// transaction, except for the ones called by the watchdogs, OnIdle, OnSweep and the
+// AfterRollback of swept transactions, which run in their own goroutine. Hooks and
+// interceptors must thus be safe for concurrent use.
+//
+// txtest.Stress checks the contract under the race detector.
 type TxManager struct {
 	db    *sqlx.DB
 	mux   *sync.Mutex
 	txMap map[uint64][]*Transaction
+
+	dialect         Dialect
+	mapper          *reflectx.Mapper
+	interceptors    []Interceptor
+	hooks           []Hooks
+	retryClassifier RetryClassifier
+
+	// rollbackErrorPolicy decides the error returned when a rollback fails
+	rollbackErrorPolicy RollbackErrorPolicy
+
+	// queries is the registry of named queries
+	queries map[string]string
+
+	// handler runs a statement through the interceptors
+	handler StatementHandler
+
+	stats *statsCollector
+
+	// queryStats counts the statements per fingerprint, if enabled
+	queryStats *queryStatsCollector
+
+	// debug enables the transaction tree log
+	debug bool
+
+	// recordResults makes transactions record statement results
+	recordResults bool
+
+	// strict enables the detection of transactions used after Exec returned
+	strict      bool
+	panicOnLeak bool
+
+	// leaks detects db transactions left open, if enabled
+	leaks *leakDetector
+
+	// replicas run the read-only transactions, if configured
+	replicas *replicaSet
+
+	// sweeper removes the transactions which can not end anymore, if enabled
+	sweeper *txSweeper
+
+	// clock tells the time, the wall clock unless set with WithClock
+	clock Clock
+
+	// clockUsers are given the clock once all options are applied
+	clockUsers []clockUser
+
+	// rateLimiter enforces rateLimits at the start of Exec calls
+	rateLimiter RateLimiter
+	rateLimits  []RateLimitRule
+
+	// changeSink receives the change feed of committed transactions
+	changeSink ChangeSink
+	changeKeys []string
+
+	// enqueuer enqueues the jobs of Transaction.Enqueue, the job outbox if nil
+	enqueuer Enqueuer
+
+	// groups runs the transactions with Options.GroupCommit, if enabled
+	groups *groupCommitter
+
+	// lowPrioritySlots bounds the running statements of low priority transactions
+	lowPrioritySlots chan struct{}
+
+	// admission decides whether db transactions may begin
+	admission AdmissionPolicy
+
+	// pooled avoids session state for databases behind a transaction pooler
+	pooled bool
+
+	// rebind rewrites the ? placeholders of statements to the bindvars of the driver
+	rebind bool
+
+	// schema is the cached metadata of the tables, read by Schema
+	schemaMux sync.Mutex
+	schema    *Schema
+
+	// redactor rewrites the values of exported columns
+	redactor Redactor
+
+	// sequences are the blocks of IDs reserved by NextID, by sequence name
+	sequencesMux sync.Mutex
+	sequences    map[string]*idBlock
+	idBlockSize  int64
+
+	// invariants are checked before db transactions which wrote commit
+	invariants []Invariant
+
+	// masking masks the values read by transactions, if enabled
+	masking *masking
+
+	// encryptor encrypts the fields tagged with the encrypt option, if set
+	encryptor Encryptor
+
+	// idleLimit and idleAction are the defaults for the idle transactions found by idle
+	idleLimit  time.Duration
+	idleAction IdleAction
+	idle       *idleDetector
+
+	// slowTxs are the most recent transactions taking at least slowThreshold
+	slowThreshold time.Duration
+	slowTxs       []TxInfo
 }
 
-func NewTxManager(db *sqlx.DB) *TxManager {
-	return &TxManager{
-		db:    db,
-		mux:   &sync.Mutex{},
-		txMap: make(map[uint64][]*Transaction),
+func NewTxManager(db *sqlx.DB, opts ...ManagerOption) *TxManager {
+	tm := &TxManager{
+		db:              db,
+		mux:             &sync.Mutex{},
+		txMap:           make(map[uint64][]*Transaction),
+		dialect:         dialectOf(db.DriverName()),
+		retryClassifier: DefaultRetryClassifier,
+		stats:           newStatsCollector(),
+		idle:            newIdleDetector(),
 	}
+
+	for _, opt := range opts {
+		opt(tm)
+	}
+	if tm.pooled {
+		tm.retryClassifier = AnyRetryable(tm.retryClassifier, PgBouncerRetryClassifier)
+	}
+	if tm.clock == nil {
+		tm.clock = SystemClock{}
+	}
+	if tm.leaks != nil {
+		tm.leaks.clock = tm.clock
+	}
+	for _, u := range tm.clockUsers {
+		u.useClock(tm.clock)
+	}
+
+	tm.handler = chainInterceptors(tm.interceptors, execStatement)
+	return tm
 }
 
 func (tm *TxManager) Exec(ctx context.Context, txFunc func(tx *Transaction) error, options *Options) error {
+	return tm.exec(ctx, getCaller(), txFunc, options)
+}
+
+// exec implements Exec, attributing the transaction to caller.
+func (tm *TxManager) exec(ctx context.Context, caller string, txFunc func(tx *Transaction) error, options *Options) (err error) {
 	if ctx == nil {
-		panic("context must not be nil")
+		return &OptionsError{Field: "ctx", Reason: "must not be nil"}
 	}
 
 	var opt *Options
@@ -49,10 +182,142 @@ func (tm *TxManager) Exec(ctx context.Context, txFunc func(tx *Transaction) erro
 	} else {
 		opt = options
 	}
+	if err := opt.Validate(); err != nil {
+		return err
+	}
 
-	log.Printf("Tx caller: %s\n", getCaller())
+	log.Printf("Tx caller: %s\n", caller)
 	goid := curGoroutineID()
-	trans := tm.startTx(ctx, goid, opt)
+
+	var parent *Transaction
+	if txs := tm.currentTXs(goid); len(txs) > 0 {
+		parent = txs[len(txs)-1]
+	}
+	if err := tm.checkRateLimits(ctx, opt, parent); err != nil {
+		return err
+	}
+
+	if tm.queryStats != nil {
+		ctx = context.WithValue(ctx, callerContextKey{}, caller)
+	}
+
+	if opt.IdempotencyKey != "" {
+		txFunc = idempotent(txFunc, opt.IdempotencyKey, opt.IdempotencyResult)
+	}
+
+	// Only a transaction owning its db tx can be retried. Nested transactions leave
+	// retrying to the root which re-runs the whole unit of work.
+	retryable := opt.Propagation == PropagationNew || len(tm.currentTXs(goid)) == 0
+
+	// only root transactions can be grouped, nested ones join their parent
+	grouped := opt.GroupCommit && tm.groups != nil && len(tm.currentTXs(goid)) == 0
+
+	start, retries := tm.now(), 0
+	tm.stats.begin()
+	defer func() {
+		d := tm.since(start)
+		tm.stats.end(caller, err, retries, d)
+		if retries > 0 {
+			log.Printf("tx of %s finished after %d attempts in %s: %v", caller, retries+1, d, err)
+		}
+		tm.afterExec(&ExecSummary{Caller: caller, Name: opt.Name, Attempts: retries + 1, Retryable: retryable, Duration: d, Err: err})
+	}()
+
+	// the txFunc of every attempt sees the same state
+	var state *Attempt
+	if retryable {
+		state = &Attempt{}
+		ctx = context.WithValue(ctx, attemptContextKey{}, state)
+	}
+
+	for attempt := 0; ; attempt++ {
+		retries = attempt
+		if state != nil {
+			state.next(attempt+1, err)
+		}
+		if grouped {
+			err = tm.execGrouped(ctx, txFunc, opt)
+		} else {
+			err = tm.execOnce(ctx, goid, txFunc, opt)
+		}
+		if err == nil || !retryable || attempt >= opt.MaxRetries || !tm.retryClassifier.IsRetryable(err) {
+			return err
+		}
+
+		delay := retryDelay(opt.RetryBackoff, attempt)
+		class := ErrorClass(err)
+		log.Printf("tx attempt %d failed with retryable error (%s), retrying in %s: %v", attempt+1, class, delay, err)
+		tm.onRetry(&RetryEvent{Caller: caller, Name: opt.Name, Attempt: attempt + 1, Err: err, Class: class, Backoff: delay})
+		if err := sleepContext(ctx, tm.clock, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// ErrPanicked is matched by the error of Exec calls whose txFunc panicked.
+var ErrPanicked = errors.New("gotx: tx function panicked")
+
+// PanicError is returned by Exec when its txFunc panicked, after the transactions of
+// the goroutine were rolled back.
+type PanicError struct {
+	// Value is the value passed to panic, and Stack the stack of the panicking
+	// goroutine.
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrPanicked, e.Value)
+}
+
+// Is reports whether target is ErrPanicked.
+func (e *PanicError) Is(target error) bool {
+	return target == ErrPanicked
+}
+
+// Unwrap returns Value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// execOnce runs txFunc in a logical transaction and commits or rolls it back.
+func (tm *TxManager) execOnce(ctx context.Context, goid uint64, txFunc func(tx *Transaction) error, opt *Options) (err error) {
+	// a nested transaction can not outlive the deadline of its parent
+	if txs := tm.currentTXs(goid); len(txs) > 0 {
+		if deadline, ok := txs[len(txs)-1].ctx.Deadline(); ok {
+			if own, ok := ctx.Deadline(); !ok || deadline.Before(own) {
+				var cancel context.CancelFunc
+				ctx, cancel = tm.withDeadline(ctx, deadline)
+				defer cancel()
+			}
+		}
+	}
+
+	if opt.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = tm.withTimeout(ctx, opt.Timeout)
+		defer cancel()
+	}
+
+	idleLimit, idleAction := tm.idleSettings(opt)
+	var idleCancel context.CancelFunc
+	if idleLimit > 0 && idleAction == IdleAbort {
+		ctx, idleCancel = context.WithCancel(ctx)
+		defer idleCancel()
+	}
+
+	trans, err := tm.startTx(ctx, goid, opt)
+	if err != nil {
+		return err
+	}
+
+	// only the Exec call beginning the db tx watches it
+	watchIdle := idleLimit > 0 && trans.tx.idle == nil && trans.tx.id == trans.txID
+	if watchIdle {
+		tm.idle.track(tm, trans.tx, idleLimit, idleAction, idleCancel)
+		defer tm.idle.untrack(trans.tx)
+	}
 
 	// rollback the tx when this Exec function panics before tx is committed or rolled back.
 	defer func(id uint64) {
@@ -64,34 +329,58 @@ func (tm *TxManager) Exec(ctx context.Context, txFunc func(tx *Transaction) erro
 				}
 
 			}
+			err = &PanicError{Value: r, Stack: debug.Stack()}
 		}
 	}(goid)
 
 	log.Printf("tx started in goroutine[%d], nested logical tx: %v", goid, tm.currentTXs(goid))
 
-	trans.execTxFunc(txFunc)
+	if err := trans.beginSavepoint(); err != nil {
+		trans.setError(err)
+	} else {
+		trans.execTxFunc(txFunc)
+	}
 
 	// If this logical transaction has errors, we rollback it,
-	// and this will rollback the physical transaction.
-	if trans.err != nil {
-		err := trans.Rollback()
-		if err != nil {
-			return err
-		}
-		return trans.err
+	// and this will rollback the physical transaction, unless
+	// the transaction runs within a savepoint.
+	if trans.err != nil && trans.savepointMark != "" {
+		err = tm.rollbackError(trans.RootID(), trans.err, trans.rollbackNested())
+	} else if trans.err != nil {
+		err = tm.rollbackError(trans.RootID(), trans.err, trans.Rollback())
 	} else {
-		return trans.Commit()
+		err = trans.Commit()
+		if err == nil {
+			tm.captureReplicationPosition(trans, opt)
+		}
+	}
+
+	if err != nil && watchIdle && atomic.LoadInt32(&trans.tx.idle.aborted) == 1 {
+		err = fmt.Errorf("%w: %v", ErrTxIdle, err)
 	}
+
+	tm.finishTx(trans, err)
+	return err
 }
 
-func (tm *TxManager) currentTXs(goid uint64) []*Transaction {
-	if txMap, ok := tm.txMap[goid]; !ok {
-		if txMap == nil {
-			tm.txMap[goid] = make([]*Transaction, 0)
+// applySettings applies the settings of options to the db transaction begun by trans.
+func (tm *TxManager) applySettings(trans *Transaction, options *Options) error {
+	if options.AsyncCommit && tm.dialect == DialectPostgres {
+		if _, err := trans.exec("SET LOCAL synchronous_commit = off"); err != nil {
+			return fmt.Errorf("gotx: disabling synchronous commit failed: %w", err)
 		}
 	}
+	return nil
+}
+
+// currentTXs returns a snapshot of the logical transactions bound to goroutine goid.
+func (tm *TxManager) currentTXs(goid uint64) []*Transaction {
+	tm.mux.Lock()
+	defer tm.mux.Unlock()
 
-	return tm.txMap[goid]
+	txs := make([]*Transaction, len(tm.txMap[goid]))
+	copy(txs, tm.txMap[goid])
+	return txs
 }
 
 func (tm *TxManager) appendTx(goid uint64, trans *Transaction) {
@@ -117,6 +406,34 @@ func (tm *TxManager) removeTx(goid uint64, trans *Transaction) {
 
 }
 
+// detach removes trans from the goroutine it was started in. Unlike Remove it
+// can be called from any goroutine, e.g. from a testing cleanup function.
+func (tm *TxManager) detach(trans *Transaction) {
+	tm.mux.Lock()
+	defer tm.mux.Unlock()
+	tm.removeTx(trans.goid, trans)
+}
+
+// detachAll removes all logical transactions sharing the db tx of trans from the
+// goroutine trans was started in. Suspended transactions of other db txs stay.
+func (tm *TxManager) detachAll(trans *Transaction) {
+	tm.mux.Lock()
+	defer tm.mux.Unlock()
+
+	var kept []*Transaction
+	for _, t := range tm.txMap[trans.goid] {
+		if t.tx != trans.tx {
+			kept = append(kept, t)
+		}
+	}
+
+	if len(kept) == 0 {
+		delete(tm.txMap, trans.goid)
+	} else {
+		tm.txMap[trans.goid] = kept
+	}
+}
+
 func (tm *TxManager) Remove(trans *Transaction) {
 	tm.mux.Lock()
 	defer tm.mux.Unlock()
@@ -131,48 +448,117 @@ func (tm *TxManager) RemoveAll() {
 	delete(tm.txMap, goid)
 }
 
-func (tm *TxManager) startTx(ctx context.Context, goid uint64, options *Options) *Transaction {
+func (tm *TxManager) startTx(ctx context.Context, goid uint64, options *Options) (*Transaction, error) {
 	var trans *Transaction
+	var err error
 
 	switch options.Propagation {
 	case PropagationNew:
-		// new db tx is requested
-		trans = tm.newTx(ctx, nil, options)
+		// new db tx is requested. The db tx of the enclosing transaction is suspended
+		// until the new one ends.
+		trans, err = tm.newTx(ctx, nil, options)
+		if txs := tm.currentTXs(goid); err == nil && len(txs) > 0 {
+			trans.suspendedTx = txs[len(txs)-1].tx
+			atomic.AddInt32(&trans.suspendedTx.suspended, 1)
+		}
 
 	case PropagationRequired:
-		// sharing the same physical transaction with root tx
+		// sharing the physical transaction of the innermost active transaction, which
+		// is the root tx unless a transaction with PropagationNew started since
 		if txMap := tm.currentTXs(goid); len(txMap) == 0 {
-			trans = tm.newTx(ctx, nil, options)
+			trans, err = tm.newTx(ctx, nil, options)
 			// tm.appendTx(goid, rootTx)
 			// return rootTx
 		} else {
-			rootTx := tm.currentTXs(goid)[0]
-			trans = tm.newTx(ctx, rootTx, options)
+			rootTx := txMap[len(txMap)-1]
+			trans, err = tm.newTx(ctx, rootTx, options)
 		}
 
 	default:
-		panic("Unknown propagation type: " + fmt.Sprintf("%d", options.Propagation))
+		return nil, &OptionsError{Field: "Propagation", Reason: fmt.Sprintf("is unknown: %d", options.Propagation)}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if options.FencingName != "" {
+		trans.tx.addFence(options.FencingName, options.FencingToken)
 	}
 
+	trans.goid = goid
+	trans.started = tm.now()
+	if tm.strict {
+		trans.startStack = debug.Stack()
+	}
+	if txs := tm.currentTXs(goid); len(txs) > 0 {
+		trans.parent = txs[len(txs)-1]
+		if tm.debug {
+			trans.parent.children = append(trans.parent.children, trans)
+		}
+	}
+	trans.opts = inheritOptions(options, trans.parent, trans.parent != nil && trans.parent.tx == trans.tx)
+	trans.priority = inheritPriority(options, trans.parent)
 	tm.appendTx(goid, trans)
+	tm.sweeper.start(tm)
 	log.Printf("%s started\n", trans)
-	return trans
+	return trans, nil
 }
 
-func (tm *TxManager) newTx(ctx context.Context, rootTx *Transaction, options *Options) *Transaction {
+func (tm *TxManager) newTx(ctx context.Context, rootTx *Transaction, options *Options) (*Transaction, error) {
 	// txID, err := uuid.NewRandom()
 	// if err != nil {
 	// 	panic(err)
 	// }
 
-	txID := generateRandomKey(10)
+	txID := txIDs.next()
 
 	if rootTx != nil {
-		return NewTx(rootTx.tx, txID, options.Propagation == PropagationNew, tm)
+		trans := NewTx(rootTx.tx, txID, options.Propagation == PropagationNew, tm)
+		trans.ctx = contextWithTx(ctx, trans)
+		trans.opts = options
+		return trans, nil
+	}
+
+	if tm.admission != nil {
+		if err := tm.admission.Admit(ctx, tm, options); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tm.beforeBegin(ctx, options); err != nil {
+		return nil, err
 	}
 
-	dbTx := newRawTx(tm.db.MustBeginTx(ctx, &sql.TxOptions{Isolation: options.IsolationLevel}))
+	dbTx, err := tm.beginTx(ctx, tm.dbFor(ctx, options), &sql.TxOptions{Isolation: options.IsolationLevel, ReadOnly: options.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("gotx: begin tx failed: %w", err)
+	}
+
+	if tm.mapper != nil {
+		dbTx.Mapper = tm.mapper
+	}
+
+	dbTx.id = txID
+	dbTx.snapshot = options.snapshot
+	if !dbTx.snapshot {
+		tm.leaks.track(dbTx)
+	}
+	trans := NewTx(dbTx, txID, options.Propagation == PropagationNew, tm)
+	trans.ctx = contextWithTx(ctx, trans)
+	trans.opts = options
+
+	err = tm.applySettings(trans, options)
+	if err == nil {
+		err = tm.afterBegin(trans)
+	}
+	if err != nil {
+		err = tm.rollbackError(txID, err, dbTx.Rollback())
+		tm.leaks.untrack(dbTx)
+		dbTx.releaseConn()
+		return nil, err
+	}
 
-	return NewTx(dbTx, txID, options.Propagation == PropagationNew, tm)
+	return trans, nil
 
 }
@@ -0,0 +1,54 @@
+package gotx
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync/atomic"
+)
+
+// txIDAlphabet are the characters of transaction IDs.
+const txIDAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+const (
+	txIDPrefixLen  = 6
+	txIDCounterLen = 10
+)
+
+// txIDs generates the IDs of the transactions of all managers of the process.
+var txIDs = newTxIDGenerator()
+
+// txIDGenerator generates unique transaction IDs without locking: a prefix drawn from
+// crypto/rand when the process starts, which tells processes apart, followed by a
+// counter starting at a random value. IDs are 16 characters long and unique within a
+// process until 62^10 IDs were generated.
+type txIDGenerator struct {
+	prefix  [txIDPrefixLen]byte
+	counter uint64
+}
+
+func newTxIDGenerator() *txIDGenerator {
+	var seed [16]byte
+	if _, err := rand.Read(seed[:]); err != nil {
+		panic("gotx: reading random seed failed: " + err.Error())
+	}
+
+	g := &txIDGenerator{counter: binary.LittleEndian.Uint64(seed[8:]) >> 16}
+	encodeBase62(g.prefix[:], binary.LittleEndian.Uint64(seed[:8]))
+	return g
+}
+
+// next returns a new ID.
+func (g *txIDGenerator) next() string {
+	var id [txIDPrefixLen + txIDCounterLen]byte
+	copy(id[:], g.prefix[:])
+	encodeBase62(id[txIDPrefixLen:], atomic.AddUint64(&g.counter, 1))
+	return string(id[:])
+}
+
+// encodeBase62 fills dst with the lowest digits of n in base 62.
+func encodeBase62(dst []byte, n uint64) {
+	for i := len(dst) - 1; i >= 0; i-- {
+		dst[i] = txIDAlphabet[n%62]
+		n /= 62
+	}
+}
@@ -0,0 +1,12 @@
+package gotx
+
+import "testing"
+
+func BenchmarkTxID(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = txIDs.next()
+		}
+	})
+}
@@ -0,0 +1,118 @@
+package txtest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/oligo/gotx"
+)
+
+// ErrInjected is the default error injected by Chaos.
+var ErrInjected = errors.New("txtest: injected failure")
+
+// Chaos injects failures and latency into a TxManager, so rollback handling, retry
+// idempotency and hook behavior can be exercised under realistic failure sequences:
+//
+//	chaos := &txtest.Chaos{FailAfterStatements: 2}
+//	tm := gotx.NewTxManager(db, chaos.Option())
+//
+// Chaos is for tests only and must not be wired into managers of production code: its
+// option is not gated by a build tag, and installed it fails real transactions.
+// Latency is measured by the Clock of the manager, so a txtest.Clock drives it.
+//
+// A zero Chaos injects nothing. Chaos is safe for concurrent use, but its fields must
+// not be changed while transactions are running.
+type Chaos struct {
+	// FailOnBegin makes starting a db transaction fail.
+	FailOnBegin bool
+
+	// FailAfterStatements makes the statement following the first N statements of each
+	// db transaction fail. Zero disables statement failures.
+	FailAfterStatements int
+
+	// FailOnCommit makes committing a db transaction fail. The db transaction is rolled
+	// back instead.
+	FailOnCommit bool
+
+	// Latency is added before every statement, as measured by the Clock of the
+	// manager.
+	Latency time.Duration
+
+	// Err is the injected error. ErrInjected is used when it is nil.
+	Err error
+
+	mu sync.Mutex
+	// statement counters keyed by the root tx ID
+	counters map[string]int
+}
+
+// Option returns the manager option which installs the fault injection points.
+func (c *Chaos) Option() gotx.ManagerOption {
+	hooks := gotx.WithHooks(gotx.Hooks{
+		BeforeBegin: func(ctx context.Context, opts *gotx.Options) error {
+			if c.FailOnBegin {
+				return c.err()
+			}
+			return nil
+		},
+		BeforeCommit: func(tx *gotx.Transaction) error {
+			c.forget(tx)
+			if c.FailOnCommit {
+				return c.err()
+			}
+			return nil
+		},
+		AfterRollback: c.forget,
+	})
+
+	return func(tm *gotx.TxManager) {
+		// the clock of the manager is set once all options are applied
+		gotx.WithInterceptors(gotx.InterceptorFunc(func(ctx context.Context, stmt *gotx.Statement, next gotx.StatementHandler) error {
+			return c.intercept(ctx, tm.Clock(), stmt, next)
+		}))(tm)
+		hooks(tm)
+	}
+}
+
+func (c *Chaos) intercept(ctx context.Context, clock gotx.Clock, stmt *gotx.Statement, next gotx.StatementHandler) error {
+	if c.Latency > 0 {
+		timer := clock.NewTimer(c.Latency)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C():
+		}
+	}
+
+	if c.FailAfterStatements > 0 {
+		c.mu.Lock()
+		if c.counters == nil {
+			c.counters = make(map[string]int)
+		}
+		count := c.counters[stmt.Tx().RootID()]
+		c.counters[stmt.Tx().RootID()] = count + 1
+		c.mu.Unlock()
+
+		if count >= c.FailAfterStatements {
+			return c.err()
+		}
+	}
+
+	return next(ctx, stmt)
+}
+
+func (c *Chaos) forget(tx *gotx.Transaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.counters, tx.RootID())
+}
+
+func (c *Chaos) err() error {
+	if c.Err != nil {
+		return c.Err
+	}
+	return ErrInjected
+}
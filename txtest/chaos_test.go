@@ -0,0 +1,34 @@
+package txtest
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/oligo/gotx"
+)
+
+func TestChaosLatencyUsesClock(t *testing.T) {
+	db := sqlx.NewDb(sql.OpenDB(stressDriver{}), "stressdb")
+	defer db.Close()
+
+	clock := NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	chaos := &Chaos{Latency: time.Hour}
+	tm := gotx.NewTxManager(db, gotx.WithClock(clock), chaos.Option())
+
+	done := make(chan error, 1)
+	go func() {
+		done <- tm.Exec(context.Background(), func(tx *gotx.Transaction) error {
+			var n int
+			return tx.GetOne(&n, "SELECT 1")
+		}, nil)
+	}()
+
+	clock.WaitForTimers(1)
+	clock.Advance(time.Hour)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
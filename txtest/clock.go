@@ -0,0 +1,136 @@
+package txtest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/oligo/gotx"
+)
+
+// Clock is a gotx.Clock whose time only moves when the test advances it, so timeouts,
+// retry backoffs, the watchdogs and the timestamps written by a TxManager are checked
+// deterministically without sleeping:
+//
+//	clock := txtest.NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+//	tm := gotx.NewTxManager(db, gotx.WithClock(clock))
+//
+//	go func() { done <- tm.Exec(ctx, txFunc, &gotx.Options{MaxRetries: 1, RetryBackoff: time.Second}) }()
+//	clock.WaitForTimers(1) // the backoff of the retry
+//	clock.Advance(time.Second)
+//
+// Timers fire during Advance and Set, in the order of their deadlines. Clock is safe
+// for concurrent use.
+type Clock struct {
+	mux    sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*clockTimer
+}
+
+type clockTimer struct {
+	clock    *Clock
+	deadline time.Time
+	c        chan time.Time
+}
+
+var _ gotx.Clock = (*Clock)(nil)
+
+// NewClock returns a Clock set to start.
+func NewClock(start time.Time) *Clock {
+	c := &Clock{now: start}
+	c.cond = sync.NewCond(&c.mux)
+	return c
+}
+
+// Now implements gotx.Clock.
+func (c *Clock) Now() time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.now
+}
+
+// NewTimer implements gotx.Clock. A timer of a non-positive duration fires at once.
+func (c *Clock) NewTimer(d time.Duration) gotx.Timer {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	t := &clockTimer{clock: c, deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.c <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward by d and fires the timers expiring until then.
+func (c *Clock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to now and fires the timers expiring until then. The clock never
+// moves backwards: an earlier now is ignored.
+func (c *Clock) Set(now time.Time) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if now.Before(c.now) {
+		return
+	}
+	sort.SliceStable(c.timers, func(i, j int) bool {
+		return c.timers[i].deadline.Before(c.timers[j].deadline)
+	})
+
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.deadline.After(now) {
+			pending = append(pending, t)
+			continue
+		}
+		// timers see the time they expired at, like time.Timer
+		c.now = t.deadline
+		t.c <- t.deadline
+	}
+	c.timers = pending
+	c.now = now
+	c.cond.Broadcast()
+}
+
+// Timers returns how many timers are waiting to fire.
+func (c *Clock) Timers() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return len(c.timers)
+}
+
+// WaitForTimers blocks until at least n timers are waiting to fire, e.g. until the
+// goroutine under test sleeps before its next retry, so that Advance is not called
+// too early.
+func (c *Clock) WaitForTimers(n int) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+func (t *clockTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *clockTimer) Stop() bool {
+	c := t.clock
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	for i, pending := range c.timers {
+		if pending == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			c.cond.Broadcast()
+			return true
+		}
+	}
+	return false
+}
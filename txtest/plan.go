@@ -0,0 +1,297 @@
+package txtest
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/oligo/gotx"
+)
+
+// PlanProblem is a query plan pattern reported by a PlanGuard.
+type PlanProblem struct {
+	Query string
+	// Table is the table the problem was found on, if the plan names one.
+	Table string
+	// Detail is the line or row of the plan showing the problem.
+	Detail string
+}
+
+func (p PlanProblem) String() string {
+	return fmt.Sprintf("%s in the plan of %q", p.Detail, p.Query)
+}
+
+var (
+	pgSeqScan    = regexp.MustCompile(`Seq Scan on (\S+)`)
+	tableAliases = regexp.MustCompile("(?i)\\b(?:FROM|JOIN|UPDATE)\\s+([\\w.`\"]+)(?:\\s+(?:AS\\s+)?(\\w+))?")
+)
+
+// PlanGuard runs EXPLAIN for every unique query executed through a TxManager in tests
+// and reports plans which scan large tables fully or show missing indexes, so query
+// regressions are caught in CI rather than in production:
+//
+//	guard := txtest.NewPlanGuard(t, "account", "ledger_entry")
+//	tm := gotx.NewTxManager(db, guard.Option())
+//
+// Full scans are reported for the tables given to NewPlanGuard, or for all tables when
+// none are given. Missing index patterns, such as automatic indexes on SQLite and join
+// buffers on MySQL, are reported for all tables. Plans are inspected on MySQL, Postgres
+// and SQLite; queries on other databases are not checked. Since the test data is
+// usually small, databases may prefer full scans the production data would not get:
+// keep the guarded tables to the ones which are large in production and seed enough
+// rows, or run the statistics commands of the database, before relying on the guard.
+type PlanGuard struct {
+	// WarnOnly logs problems instead of failing the test.
+	WarnOnly bool
+
+	t       testing.TB
+	tables  map[string]bool
+	dialect gotx.Dialect
+
+	mu       sync.Mutex
+	seen     map[string]bool
+	problems []PlanProblem
+}
+
+// NewPlanGuard creates a PlanGuard reporting problems to t.
+func NewPlanGuard(t testing.TB, tables ...string) *PlanGuard {
+	g := &PlanGuard{t: t, seen: make(map[string]bool)}
+	if len(tables) > 0 {
+		g.tables = make(map[string]bool)
+		for _, table := range tables {
+			g.tables[strings.ToLower(table)] = true
+		}
+	}
+	return g
+}
+
+// Option returns the manager option which installs the guard.
+func (g *PlanGuard) Option() gotx.ManagerOption {
+	interceptors := gotx.WithInterceptors(gotx.InterceptorFunc(g.intercept))
+	return func(tm *gotx.TxManager) {
+		g.dialect = tm.Dialect()
+		interceptors(tm)
+	}
+}
+
+// Problems returns the problems reported so far.
+func (g *PlanGuard) Problems() []PlanProblem {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	problems := make([]PlanProblem, len(g.problems))
+	copy(problems, g.problems)
+	return problems
+}
+
+func (g *PlanGuard) intercept(ctx context.Context, stmt *gotx.Statement, next gotx.StatementHandler) error {
+	if g.explainable(stmt.Query) && g.firstSeen(stmt.Query) {
+		problems, err := g.explain(ctx, stmt)
+		if err != nil {
+			g.t.Logf("txtest: explaining %q failed: %v", stmt.Query, err)
+		}
+		g.report(problems)
+	}
+
+	return next(ctx, stmt)
+}
+
+// explainable reports whether query is a statement the guard can explain.
+func (g *PlanGuard) explainable(query string) bool {
+	switch g.dialect {
+	case gotx.DialectMySQL, gotx.DialectPostgres, gotx.DialectSQLite:
+	default:
+		return false
+	}
+
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "WITH", "UPDATE", "DELETE":
+		return true
+	}
+	return false
+}
+
+func (g *PlanGuard) firstSeen(query string) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.seen[query] {
+		return false
+	}
+	g.seen[query] = true
+	return true
+}
+
+func (g *PlanGuard) report(problems []PlanProblem) {
+	g.mu.Lock()
+	g.problems = append(g.problems, problems...)
+	g.mu.Unlock()
+
+	for _, p := range problems {
+		if g.WarnOnly {
+			g.t.Logf("txtest: %s", p)
+		} else {
+			g.t.Errorf("txtest: %s", p)
+		}
+	}
+}
+
+// guarded reports whether full scans of table, which may be an alias used by query,
+// are problems.
+func (g *PlanGuard) guarded(query string, table string) bool {
+	if g.tables == nil {
+		return true
+	}
+	table = strings.ToLower(strings.Trim(table, "`\""))
+	if g.tables[table] {
+		return true
+	}
+	for _, m := range tableAliases.FindAllStringSubmatch(query, -1) {
+		if strings.EqualFold(m[2], table) {
+			table = strings.ToLower(strings.Trim(m[1], "`\""))
+			break
+		}
+	}
+	if g.tables[table] {
+		return true
+	}
+	if i := strings.LastIndexByte(table, '.'); i >= 0 {
+		return g.tables[table[i+1:]]
+	}
+	return false
+}
+
+// explain runs EXPLAIN for stmt in its transaction and returns the problems of the
+// plan.
+func (g *PlanGuard) explain(ctx context.Context, stmt *gotx.Statement) ([]PlanProblem, error) {
+	tx := stmt.Tx().SQLTx()
+
+	switch g.dialect {
+	case gotx.DialectPostgres:
+		// a failed statement aborts a postgres transaction, so EXPLAIN runs in a savepoint
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT gotx_explain"); err != nil {
+			return nil, err
+		}
+		plan, err := queryPlan(ctx, tx, "EXPLAIN "+stmt.Query, stmt.Args)
+		if err != nil {
+			_, _ = tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT gotx_explain")
+			return nil, err
+		}
+		if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT gotx_explain"); err != nil {
+			return nil, err
+		}
+		return g.postgresProblems(stmt.Query, plan), nil
+
+	case gotx.DialectMySQL:
+		plan, err := queryPlan(ctx, tx, "EXPLAIN "+stmt.Query, stmt.Args)
+		if err != nil {
+			return nil, err
+		}
+		return g.mysqlProblems(stmt.Query, plan), nil
+
+	default:
+		plan, err := queryPlan(ctx, tx, "EXPLAIN QUERY PLAN "+stmt.Query, stmt.Args)
+		if err != nil {
+			return nil, err
+		}
+		return g.sqliteProblems(stmt.Query, plan), nil
+	}
+}
+
+func (g *PlanGuard) postgresProblems(query string, plan []map[string]string) []PlanProblem {
+	var problems []PlanProblem
+	for _, row := range plan {
+		line := strings.TrimSpace(row["QUERY PLAN"])
+		if m := pgSeqScan.FindStringSubmatch(line); m != nil && g.guarded(query, m[1]) {
+			problems = append(problems, PlanProblem{Query: query, Table: m[1], Detail: line})
+		}
+	}
+	return problems
+}
+
+func (g *PlanGuard) mysqlProblems(query string, plan []map[string]string) []PlanProblem {
+	var problems []PlanProblem
+	for _, row := range plan {
+		table := row["table"]
+		detail := fmt.Sprintf("type=%s key=%s extra=%s on %s", row["type"], row["key"], row["Extra"], table)
+
+		switch {
+		case row["type"] == "ALL" && g.guarded(query, table):
+			problems = append(problems, PlanProblem{Query: query, Table: table, Detail: "full scan " + detail})
+		case strings.Contains(row["Extra"], "join buffer"):
+			problems = append(problems, PlanProblem{Query: query, Table: table, Detail: "missing join index " + detail})
+		}
+	}
+	return problems
+}
+
+func (g *PlanGuard) sqliteProblems(query string, plan []map[string]string) []PlanProblem {
+	var problems []PlanProblem
+	for _, row := range plan {
+		detail := row["detail"]
+		fields := strings.Fields(detail)
+
+		switch {
+		case strings.Contains(detail, "AUTOMATIC"):
+			problems = append(problems, PlanProblem{Query: query, Detail: detail})
+		case len(fields) >= 2 && fields[0] == "SCAN":
+			// SQLite before 3.36 prints SCAN TABLE name
+			table := fields[1]
+			if table == "TABLE" && len(fields) >= 3 {
+				table = fields[2]
+			}
+			if g.guarded(query, table) {
+				problems = append(problems, PlanProblem{Query: query, Table: table, Detail: detail})
+			}
+		}
+	}
+	return problems
+}
+
+// queryPlan runs an EXPLAIN query and returns its rows as maps of column names to
+// values.
+func queryPlan(ctx context.Context, tx *sql.Tx, query string, args []interface{}) ([]map[string]string, error) {
+	rows, err := tx.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []map[string]string
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]string, len(columns))
+		for i, column := range columns {
+			switch v := values[i].(type) {
+			case nil:
+			case []byte:
+				row[column] = string(v)
+			default:
+				row[column] = fmt.Sprint(v)
+			}
+		}
+		plan = append(plan, row)
+	}
+	return plan, rows.Err()
+}
@@ -0,0 +1,189 @@
+package txtest
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/oligo/gotx"
+)
+
+// RecordedStatement is a statement captured by a Recorder.
+type RecordedStatement struct {
+	Query string
+	Args  []interface{}
+	// TxID is the ID of the logical transaction which ran the statement.
+	TxID string
+	// RootTxID is the ID of the db transaction the statement ran in.
+	RootTxID string
+	// Err is the error returned by the statement, if any.
+	Err error
+}
+
+// Recorder is a gotx.Interceptor which captures every statement executed through a
+// TxManager, so tests can verify data access behavior without parsing logs:
+//
+//	rec := txtest.NewRecorder()
+//	tm := gotx.NewTxManager(db, gotx.WithInterceptors(rec))
+//	...
+//	rec.AssertExecuted(t, "INSERT INTO account%")
+//	rec.AssertTxCount(t, 1)
+//
+// Patterns use the syntax of SQL LIKE: % matches any sequence of characters and _
+// matches a single character. Matching is case insensitive and runs of whitespace in
+// queries are collapsed to a single space.
+type Recorder struct {
+	mu         sync.Mutex
+	statements []RecordedStatement
+}
+
+// NewRecorder creates an empty Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Intercept implements gotx.Interceptor.
+func (r *Recorder) Intercept(ctx context.Context, stmt *gotx.Statement, next gotx.StatementHandler) error {
+	err := next(ctx, stmt)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = append(r.statements, RecordedStatement{
+		Query:    stmt.Query,
+		Args:     stmt.Args,
+		TxID:     stmt.Tx().ID(),
+		RootTxID: stmt.Tx().RootID(),
+		Err:      err,
+	})
+
+	return err
+}
+
+// Statements returns a copy of the recorded statements in execution order.
+func (r *Recorder) Statements() []RecordedStatement {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	statements := make([]RecordedStatement, len(r.statements))
+	copy(statements, r.statements)
+	return statements
+}
+
+// Reset discards all recorded statements.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.statements = nil
+}
+
+// Find returns the recorded statements matching pattern.
+func (r *Recorder) Find(pattern string) []RecordedStatement {
+	re := compileLike(pattern)
+
+	var found []RecordedStatement
+	for _, stmt := range r.Statements() {
+		if re.MatchString(normalizeQuery(stmt.Query)) {
+			found = append(found, stmt)
+		}
+	}
+
+	return found
+}
+
+// AssertExecuted reports an error if no recorded statement matches pattern.
+func (r *Recorder) AssertExecuted(t testing.TB, pattern string) {
+	t.Helper()
+	if len(r.Find(pattern)) == 0 {
+		t.Errorf("txtest: no statement matching %q was executed, got:\n%s", pattern, r.dump())
+	}
+}
+
+// AssertNotExecuted reports an error if any recorded statement matches pattern.
+func (r *Recorder) AssertNotExecuted(t testing.TB, pattern string) {
+	t.Helper()
+	if found := r.Find(pattern); len(found) > 0 {
+		t.Errorf("txtest: unexpected statement matching %q: %s", pattern, found[0].Query)
+	}
+}
+
+// AssertExecutedTimes reports an error unless exactly n recorded statements match pattern.
+func (r *Recorder) AssertExecutedTimes(t testing.TB, pattern string, n int) {
+	t.Helper()
+	if found := r.Find(pattern); len(found) != n {
+		t.Errorf("txtest: expected %d statements matching %q, got %d", n, pattern, len(found))
+	}
+}
+
+// AssertOrder reports an error unless statements matching patterns were executed in
+// the given order. Other statements may be executed in between.
+func (r *Recorder) AssertOrder(t testing.TB, patterns ...string) {
+	t.Helper()
+
+	statements := r.Statements()
+	pos := 0
+	for _, pattern := range patterns {
+		re := compileLike(pattern)
+		for pos < len(statements) && !re.MatchString(normalizeQuery(statements[pos].Query)) {
+			pos++
+		}
+
+		if pos == len(statements) {
+			t.Errorf("txtest: no statement matching %q found in the expected order, got:\n%s", pattern, r.dump())
+			return
+		}
+		pos++
+	}
+}
+
+// AssertTxCount reports an error unless the recorded statements ran in exactly n db
+// transactions. Nested logical transactions sharing a db tx are counted once.
+func (r *Recorder) AssertTxCount(t testing.TB, n int) {
+	t.Helper()
+
+	seen := make(map[string]struct{})
+	for _, stmt := range r.Statements() {
+		seen[stmt.RootTxID] = struct{}{}
+	}
+
+	if len(seen) != n {
+		t.Errorf("txtest: expected statements in %d transactions, got %d", n, len(seen))
+	}
+}
+
+func (r *Recorder) dump() string {
+	var b strings.Builder
+	for _, stmt := range r.Statements() {
+		b.WriteString("\t[tx-")
+		b.WriteString(stmt.TxID)
+		b.WriteString("] ")
+		b.WriteString(normalizeQuery(stmt.Query))
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+func normalizeQuery(query string) string {
+	return strings.Join(strings.Fields(query), " ")
+}
+
+// compileLike converts a SQL LIKE pattern to a regular expression.
+func compileLike(pattern string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("(?is)^")
+	for _, r := range normalizeQuery(pattern) {
+		switch r {
+		case '%':
+			b.WriteString(".*")
+		case '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	b.WriteString("$")
+
+	return regexp.MustCompile(b.String())
+}
@@ -0,0 +1,206 @@
+package txtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/oligo/gotx"
+)
+
+// errStress is the error of the transactions which Stress rolls back on purpose.
+var errStress = errors.New("txtest: stress rollback")
+
+type stressKey struct{}
+
+// StressOptions configures Stress.
+type StressOptions struct {
+	// Goroutines is how many goroutines run transactions at once, 8 if zero.
+	Goroutines int
+
+	// Iterations is how many transactions every goroutine runs, 100 if zero.
+	Iterations int
+
+	// Query is the read-only statement run in every transaction, "SELECT 1" if empty.
+	Query string
+}
+
+// StressReport counts the transactions run by Stress and the hooks they called.
+type StressReport struct {
+	Execs       int64
+	Commits     int64
+	Rollbacks   int64
+	ExecHooks   int64
+	Introspects int64
+}
+
+// Stress checks the concurrency contract of a manager of db created with managerOpts:
+// it runs root, nested, independent, failing and savepoint transactions from many
+// goroutines at once, calls Remove and RemoveAll between them and reads
+// ActiveTransactions, SlowTransactions and Stats from another goroutine meanwhile. Run
+// it with the race detector, which reports unsynchronized state of the manager as data
+// races:
+//
+//	func TestConcurrency(t *testing.T) {
+//		txtest.Stress(t, db, txtest.StressOptions{}, gotx.WithTxSweeper(time.Second, 0))
+//	}
+//
+//	go test -race -run TestConcurrency ./...
+//
+// The manager is created with hooks counting the commits, rollbacks and Exec calls
+// added to managerOpts. Stress fails t if a transaction fails other than on purpose,
+// if the hooks miss a transaction, or if transactions are still bound to a goroutine
+// once all Exec calls returned.
+func Stress(t testing.TB, db *sqlx.DB, opts StressOptions, managerOpts ...gotx.ManagerOption) *StressReport {
+	t.Helper()
+
+	if opts.Goroutines <= 0 {
+		opts.Goroutines = 8
+	}
+	if opts.Iterations <= 0 {
+		opts.Iterations = 100
+	}
+	if opts.Query == "" {
+		opts.Query = "SELECT 1"
+	}
+
+	report := &StressReport{}
+	managerOpts = append(managerOpts[:len(managerOpts):len(managerOpts)], gotx.WithHooks(gotx.Hooks{
+		AfterCommit:   func(tx *gotx.Transaction) { atomic.AddInt64(&report.Commits, 1) },
+		AfterRollback: func(tx *gotx.Transaction) { atomic.AddInt64(&report.Rollbacks, 1) },
+		AfterExec:     func(s *gotx.ExecSummary) { atomic.AddInt64(&report.ExecHooks, 1) },
+	}))
+	tm := gotx.NewTxManager(db, managerOpts...)
+
+	ctx := context.Background()
+	query := func(tx *gotx.Transaction) error {
+		var v interface{}
+		return tx.GetOne(&v, opts.Query)
+	}
+
+	// the workloads, with the error each one fails with on purpose
+	type workload struct {
+		run      func() error
+		expected error
+	}
+	workloads := []workload{
+		// a root transaction deriving its context
+		{run: func() error {
+			return tm.Exec(ctx, func(tx *gotx.Transaction) error {
+				tx.WithValue(stressKey{}, tx.ID())
+				return query(tx)
+			}, nil)
+		}},
+		// transactions nested in the db transaction of their parent, removing the ended
+		// ones again
+		{run: func() error {
+			return tm.Exec(ctx, func(tx *gotx.Transaction) error {
+				if err := query(tx); err != nil {
+					return err
+				}
+				var nested *gotx.Transaction
+				err := tm.Exec(tx.Context(), func(tx *gotx.Transaction) error {
+					nested = tx
+					return tm.Exec(tx.Context(), query, nil)
+				}, nil)
+				tm.Remove(nested)
+				return err
+			}, nil)
+		}},
+		// an independent transaction suspending its parent
+		{run: func() error {
+			return tm.Exec(ctx, func(tx *gotx.Transaction) error {
+				return tm.Exec(tx.Context(), query, &gotx.Options{Propagation: gotx.PropagationNew})
+			}, nil)
+		}},
+		// a nested transaction failing its root
+		{expected: errStress, run: func() error {
+			return tm.Exec(ctx, func(tx *gotx.Transaction) error {
+				return tm.Exec(tx.Context(), func(tx *gotx.Transaction) error {
+					if err := query(tx); err != nil {
+						return err
+					}
+					return errStress
+				}, nil)
+			}, nil)
+		}},
+		// a nested transaction rolled back to its savepoint, its root going on
+		{run: func() error {
+			return tm.Exec(ctx, func(tx *gotx.Transaction) error {
+				err := tm.Exec(tx.Context(), func(tx *gotx.Transaction) error {
+					if err := query(tx); err != nil {
+						return err
+					}
+					return errStress
+				}, (&gotx.Options{}).WithSavepoint())
+				if !errors.Is(err, errStress) {
+					return err
+				}
+				return query(tx)
+			}, nil)
+		}},
+		// a goroutine clearing its transactions with RemoveAll between two
+		{run: func() error {
+			err := tm.Exec(ctx, query, nil)
+			tm.RemoveAll()
+			return err
+		}},
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, opts.Goroutines)
+	done := make(chan struct{})
+
+	// the introspection of the manager races with the transactions
+	var observer sync.WaitGroup
+	observer.Add(1)
+	go func() {
+		defer observer.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			_ = tm.ActiveTransactions()
+			_ = tm.SlowTransactions()
+			_ = tm.Stats()
+			atomic.AddInt64(&report.Introspects, 1)
+		}
+	}()
+
+	for g := 0; g < opts.Goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < opts.Iterations; i++ {
+				w := workloads[(g+i)%len(workloads)]
+				err := w.run()
+				atomic.AddInt64(&report.Execs, 1)
+				if (w.expected == nil && err != nil) || !errors.Is(err, w.expected) {
+					errs <- fmt.Errorf("goroutine %d, iteration %d: %v", g, i, err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(done)
+	observer.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("txtest: stress transaction failed: %v", err)
+	}
+	if active := tm.ActiveTransactions(); len(active) > 0 {
+		t.Errorf("txtest: %d transactions left bound to goroutines: %v", len(active), active)
+	}
+	if report.Commits+report.Rollbacks == 0 || atomic.LoadInt64(&report.ExecHooks) < report.Execs {
+		t.Errorf("txtest: hooks missed transactions: %+v", *report)
+	}
+	return report
+}
@@ -0,0 +1,80 @@
+package txtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/oligo/gotx"
+)
+
+// stressDriver is a database accepting every statement, whose queries return a single
+// row with the value 1, so Stress exercises the manager without a database server.
+type stressDriver struct{}
+
+func (stressDriver) Connect(context.Context) (driver.Conn, error) { return stressConn{}, nil }
+func (d stressDriver) Driver() driver.Driver                      { return d }
+func (stressDriver) Open(string) (driver.Conn, error)             { return stressConn{}, nil }
+
+type stressConn struct{}
+
+func (stressConn) Prepare(query string) (driver.Stmt, error) { return stressStmt{}, nil }
+func (stressConn) Close() error                              { return nil }
+func (stressConn) Begin() (driver.Tx, error)                 { return stressTx{}, nil }
+
+func (stressConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return stressTx{}, ctx.Err()
+}
+
+func (stressConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return driver.RowsAffected(1), ctx.Err()
+}
+
+func (stressConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &stressRows{}, ctx.Err()
+}
+
+type stressStmt struct{}
+
+func (stressStmt) Close() error  { return nil }
+func (stressStmt) NumInput() int { return -1 }
+func (stressStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return driver.RowsAffected(1), nil
+}
+func (stressStmt) Query(args []driver.Value) (driver.Rows, error) { return &stressRows{}, nil }
+
+type stressTx struct{}
+
+func (stressTx) Commit() error   { return nil }
+func (stressTx) Rollback() error { return nil }
+
+type stressRows struct {
+	done bool
+}
+
+func (r *stressRows) Columns() []string { return []string{"value"} }
+func (r *stressRows) Close() error      { return nil }
+
+func (r *stressRows) Next(dest []driver.Value) error {
+	if r.done {
+		return io.EOF
+	}
+	r.done = true
+	dest[0] = int64(1)
+	return nil
+}
+
+func TestStress(t *testing.T) {
+	db := sqlx.NewDb(sql.OpenDB(stressDriver{}), "stressdb")
+	defer db.Close()
+
+	report := Stress(t, db, StressOptions{Goroutines: 8, Iterations: 50},
+		gotx.WithTxSweeper(10*time.Millisecond, 0), gotx.WithSlowThreshold(time.Nanosecond))
+	if report.Execs != 8*50 {
+		t.Errorf("ran %d transactions, want %d", report.Execs, 8*50)
+	}
+}
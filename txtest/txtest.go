@@ -0,0 +1,62 @@
+// Package txtest provides helpers for writing database tests against gotx.
+package txtest
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/oligo/gotx"
+)
+
+// errRollback is returned from the transaction function to force a rollback.
+var errRollback = errors.New("txtest: rollback")
+
+// WithTx runs fn inside a transaction of its own which is always rolled back, so
+// changes made by one test are never visible to another one. The transaction is
+// started with PropagationNew and bound to the calling goroutine, which makes WithTx
+// safe to use from tests running with t.Parallel().
+//
+// A rollback handler is registered with t.Cleanup, so the transaction is released
+// even when fn stops the test early with t.FailNow or t.Fatal. A panic in fn is
+// propagated to the caller after the rollback.
+func WithTx(t testing.TB, tm *gotx.TxManager, fn func(tx *gotx.Transaction)) {
+	t.Helper()
+
+	var (
+		current   *gotx.Transaction
+		recovered interface{}
+	)
+
+	t.Cleanup(func() {
+		if current != nil {
+			if err := current.Rollback(); err != nil {
+				t.Errorf("txtest: rollback failed: %v", err)
+			}
+		}
+	})
+
+	err := tm.Exec(context.Background(), func(tx *gotx.Transaction) (err error) {
+		current = tx
+		defer func() {
+			if r := recover(); r != nil {
+				recovered = r
+				err = errRollback
+			}
+		}()
+
+		fn(tx)
+		return errRollback
+	}, &gotx.Options{Propagation: gotx.PropagationNew})
+
+	// Exec has rolled back the transaction, nothing left for the cleanup handler.
+	current = nil
+
+	if recovered != nil {
+		panic(recovered)
+	}
+
+	if err != nil && !errors.Is(err, errRollback) {
+		t.Fatalf("txtest: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package gotx
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// ErrNoChanges is returned by UpdateChanged when no column differs.
+var ErrNoChanges = errors.New("gotx: no changed columns to update")
+
+// UpdateChanged compares two values of the same struct type, the row as it was read
+// and as it should be, and updates only the columns whose fields differ:
+//
+//	before := account
+//	account.Email = email
+//	_, err := tx.UpdateChanged("account", before, account)
+//	// UPDATE account SET email = ? WHERE id = ?
+//
+// Columns are named by the mapper of the transaction, as with Select. keyColumns
+// locate the row with their values in before and default to "id"; they are never
+// updated. Fields of nested structs which are not embedded are skipped. Touching fewer
+// columns keeps triggers, row locks and the WAL volume of wide tables to what really
+// changed. It returns the number of updated rows, or ErrNoChanges if no column
+// differs, in which case no statement runs.
+func (t *Transaction) UpdateChanged(table string, before, after interface{}, keyColumns ...string) (int64, error) {
+	if err := t.checkState(); err != nil {
+		return 0, err
+	}
+
+	if len(keyColumns) == 0 {
+		keyColumns = []string{"id"}
+	}
+
+	bv := reflect.Indirect(reflect.ValueOf(before))
+	av := reflect.Indirect(reflect.ValueOf(after))
+	if bv.Kind() != reflect.Struct || av.Kind() != reflect.Struct || bv.Type() != av.Type() {
+		return 0, errors.New("gotx: UpdateChanged needs two structs of the same type")
+	}
+
+	keys := tableSet(keyColumns)
+	args := make(map[string]interface{})
+	var set []string
+	for _, fi := range updatableFields(t.tx.Mapper.TypeMap(av.Type())) {
+		if keys[strings.ToLower(fi.Path)] {
+			continue
+		}
+
+		old := reflectx.FieldByIndexesReadOnly(bv, fi.Index).Interface()
+		value := reflectx.FieldByIndexesReadOnly(av, fi.Index).Interface()
+		if fieldEqual(old, value) {
+			continue
+		}
+		if _, ok := fi.Options["encrypt"]; ok && t.txManager.encryptor != nil {
+			var err error
+			if value, err = t.encryptField(fi, value); err != nil {
+				return 0, err
+			}
+		}
+		set = append(set, fi.Path+" = :"+fi.Path)
+		args[fi.Path] = value
+	}
+	if len(set) == 0 {
+		return 0, ErrNoChanges
+	}
+
+	where := make([]string, len(keyColumns))
+	for i, key := range keyColumns {
+		field := t.tx.Mapper.FieldByName(bv, key)
+		if !field.IsValid() {
+			return 0, fmt.Errorf("gotx: key column %s not found in %s", key, bv.Type())
+		}
+		where[i] = key + " = :" + key
+		args[key] = field.Interface()
+	}
+
+	query := "UPDATE " + table + " SET " + strings.Join(set, ", ") + " WHERE " + strings.Join(where, " AND ")
+	return t.Update(query, args)
+}
+
+// updatableFields returns the fields of a struct mapping to columns: the scannable
+// fields of the struct and of its embedded structs.
+func updatableFields(sm *reflectx.StructMap) []*reflectx.FieldInfo {
+	var fields []*reflectx.FieldInfo
+	for _, fi := range sm.Index {
+		if fi.Name == "" || strings.Contains(fi.Path, ".") || !isScannable(fi.Field.Type) {
+			continue
+		}
+
+		// skip the fields of scannable structs such as sql.NullString
+		nested := false
+		for p := fi.Parent; p != nil && p.Field.Type != nil; p = p.Parent {
+			if isScannable(p.Field.Type) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			fields = append(fields, fi)
+		}
+	}
+	return fields
+}
+
+// fieldEqual reports whether two field values are the same.
+func fieldEqual(a, b interface{}) bool {
+	if ta, ok := a.(time.Time); ok {
+		tb, ok := b.(time.Time)
+		return ok && ta.Equal(tb)
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,241 @@
+package gotx
+
+import (
+	"context"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// usageTable is the table recording the usage metered by a UsageMeter.
+const usageTable = "gotx_usage"
+
+// usageMaxDepth bounds the walk of scan destinations estimating their size.
+const usageMaxDepth = 8
+
+// Usage is the database usage of a tenant, metered by a UsageMeter.
+type Usage struct {
+	Tenant string
+
+	// RowsWritten are the rows affected by INSERT, UPDATE and DELETE statements.
+	RowsWritten int64
+
+	// RowsRead are the rows returned by queries, and BytesRead an estimate of their
+	// size once scanned: the lengths of strings and byte slices plus the sizes of the
+	// other values. The rows passed to Query are counted but not sized.
+	RowsRead  int64
+	BytesRead int64
+}
+
+// UsageMeter is an Interceptor metering the usage of the transactions labeled with a
+// tenant, for usage-based billing:
+//
+//	tm := gotx.NewTxManager(db, gotx.WithUsageMeter(gotx.NewUsageMeter("tenant")))
+//	err := tm.CreateUsageTable(ctx)
+//	...
+//	err = tm.Exec(ctx, txFunc, (&gotx.Options{}).WithLabel("tenant", tenantID))
+//
+// The usage of a db transaction is accumulated per tenant, nested transactions may
+// run for another tenant, and inserted into the usage table once it committed, a row
+// per tenant. Rolled back transactions are not recorded. Recording failing does not
+// fail the committed transaction: it is logged and the usage is lost.
+type UsageMeter struct {
+	label string
+}
+
+type usageKey struct{ m *UsageMeter }
+
+// NewUsageMeter returns a meter of the transactions labeled with label, e.g. "tenant",
+// whose value is the tenant.
+func NewUsageMeter(label string) *UsageMeter {
+	return &UsageMeter{label: label}
+}
+
+// WithUsageMeter meters the usage of the transactions with meter.
+func WithUsageMeter(meter *UsageMeter) ManagerOption {
+	return func(tm *TxManager) {
+		WithInterceptors(meter)(tm)
+		WithHooks(Hooks{AfterCommit: meter.record})(tm)
+	}
+}
+
+// Intercept implements Interceptor.
+func (m *UsageMeter) Intercept(ctx context.Context, stmt *Statement, next StatementHandler) error {
+	tx := stmt.Tx()
+	if tx == nil {
+		return next(ctx, stmt)
+	}
+	tenant, ok := tx.opts.Labels[m.label]
+	if !ok || stmt.savepoint {
+		return next(ctx, stmt)
+	}
+
+	var usage Usage
+	if stmt.Kind == StatementQuery && stmt.EachRow != nil {
+		eachRow := stmt.EachRow
+		stmt.EachRow = func(rows *sqlx.Rows) error {
+			usage.RowsRead++
+			return eachRow(rows)
+		}
+		defer func() { stmt.EachRow = eachRow }()
+	}
+
+	err := next(ctx, stmt)
+	if err != nil {
+		return err
+	}
+
+	switch stmt.Kind {
+	case StatementExec:
+		if stmt.Result != nil {
+			if n, err := stmt.Result.RowsAffected(); err == nil && n > 0 {
+				usage.RowsWritten = n
+			}
+		}
+	case StatementGet:
+		usage.RowsRead, usage.BytesRead = 1, estimateSize(reflect.ValueOf(stmt.Dest), 0)
+	case StatementSelect:
+		v := reflect.Indirect(reflect.ValueOf(stmt.Dest))
+		if v.Kind() == reflect.Slice {
+			usage.RowsRead = int64(v.Len())
+		}
+		usage.BytesRead = estimateSize(v, 0)
+	}
+	m.add(tx, tenant, &usage)
+	return nil
+}
+
+// add adds usage of tenant to the db transaction of tx.
+func (m *UsageMeter) add(tx *Transaction, tenant string, usage *Usage) {
+	if usage.RowsWritten == 0 && usage.RowsRead == 0 {
+		return
+	}
+
+	tx.tx.valuesMux.Lock()
+	defer tx.tx.valuesMux.Unlock()
+
+	if tx.tx.values == nil {
+		tx.tx.values = make(map[interface{}]interface{})
+	}
+	tenants, _ := tx.tx.values[usageKey{m}].(map[string]*Usage)
+	if tenants == nil {
+		tenants = make(map[string]*Usage)
+		tx.tx.values[usageKey{m}] = tenants
+	}
+	total := tenants[tenant]
+	if total == nil {
+		total = &Usage{Tenant: tenant}
+		tenants[tenant] = total
+	}
+	total.RowsWritten += usage.RowsWritten
+	total.RowsRead += usage.RowsRead
+	total.BytesRead += usage.BytesRead
+}
+
+// record inserts the usage of the committed db transaction of tx into the usage table.
+func (m *UsageMeter) record(tx *Transaction) {
+	tx.tx.valuesMux.Lock()
+	tenants, _ := tx.tx.values[usageKey{m}].(map[string]*Usage)
+	tx.tx.valuesMux.Unlock()
+	if len(tenants) == 0 {
+		return
+	}
+
+	tm := tx.txManager
+	query := tm.db.Rebind("INSERT INTO " + usageTable +
+		" (tenant, tx_id, tx_name, rows_written, rows_read, bytes_read, recorded_at) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	now := tm.now().UTC()
+
+	// the transaction context may have expired while committing
+	ctx := context.Background()
+	for _, u := range tenants {
+		_, err := tm.db.ExecContext(ctx, query, u.Tenant, tx.RootID(), tx.opts.Name, u.RowsWritten, u.RowsRead, u.BytesRead, now)
+		if err != nil {
+			log.Printf("gotx: recording usage of tenant %s by %s failed: %v", u.Tenant, tx, err)
+		}
+	}
+}
+
+// estimateSize estimates the memory used by the values of v.
+func estimateSize(v reflect.Value, depth int) int64 {
+	if !v.IsValid() || depth > usageMaxDepth {
+		return 0
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		return estimateSize(v.Elem(), depth+1)
+	case reflect.String:
+		return int64(v.Len())
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return int64(v.Len())
+		}
+		var n int64
+		for i := 0; i < v.Len(); i++ {
+			n += estimateSize(v.Index(i), depth+1)
+		}
+		return n
+	case reflect.Map:
+		var n int64
+		iter := v.MapRange()
+		for iter.Next() {
+			n += estimateSize(iter.Key(), depth+1) + estimateSize(iter.Value(), depth+1)
+		}
+		return n
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return int64(v.Type().Size())
+		}
+		var n int64
+		for i := 0; i < v.NumField(); i++ {
+			n += estimateSize(v.Field(i), depth+1)
+		}
+		return n
+	default:
+		return int64(v.Type().Size())
+	}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// CreateUsageTable creates the table recording the usage of WithUsageMeter if it does
+// not exist. Call it at startup, or create the table with a migration using the same
+// columns.
+func (tm *TxManager) CreateUsageTable(ctx context.Context) error {
+	var ddl string
+	switch tm.dialect {
+	case DialectSQLServer:
+		ddl = "IF OBJECT_ID('" + usageTable + "') IS NULL CREATE TABLE " + usageTable +
+			" (tenant NVARCHAR(255) NOT NULL, tx_id NVARCHAR(64) NOT NULL, tx_name NVARCHAR(255) NOT NULL," +
+			" rows_written BIGINT NOT NULL, rows_read BIGINT NOT NULL, bytes_read BIGINT NOT NULL, recorded_at DATETIME2 NOT NULL)"
+	case DialectOracle:
+		ddl = oracleCreateIfNotExists("CREATE TABLE " + usageTable +
+			" (tenant VARCHAR2(255) NOT NULL, tx_id VARCHAR2(64) NOT NULL, tx_name VARCHAR2(255)," +
+			" rows_written NUMBER(19) NOT NULL, rows_read NUMBER(19) NOT NULL, bytes_read NUMBER(19) NOT NULL, recorded_at TIMESTAMP NOT NULL)")
+	default:
+		ddl = "CREATE TABLE IF NOT EXISTS " + usageTable +
+			" (tenant VARCHAR(255) NOT NULL, tx_id VARCHAR(64) NOT NULL, tx_name VARCHAR(255) NOT NULL," +
+			" rows_written BIGINT NOT NULL, rows_read BIGINT NOT NULL, bytes_read BIGINT NOT NULL, recorded_at TIMESTAMP NOT NULL)"
+	}
+
+	_, err := tm.db.ExecContext(ctx, ddl)
+	return Translate(err)
+}
+
+// TenantUsage returns the usage of tenant recorded since since.
+func (tm *TxManager) TenantUsage(ctx context.Context, tenant string, since time.Time) (*Usage, error) {
+	usage := &Usage{Tenant: tenant}
+	err := tm.db.QueryRowxContext(ctx, tm.db.Rebind("SELECT COALESCE(SUM(rows_written), 0), COALESCE(SUM(rows_read), 0),"+
+		" COALESCE(SUM(bytes_read), 0) FROM "+usageTable+" WHERE tenant = ? AND recorded_at >= ?"), tenant, since.UTC()).
+		Scan(&usage.RowsWritten, &usage.RowsRead, &usage.BytesRead)
+	if err != nil {
+		return nil, Translate(err)
+	}
+	return usage, nil
+}
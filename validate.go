@@ -0,0 +1,82 @@
+package gotx
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidOptions is matched by the errors of Exec calls with invalid options or
+// arguments, which are returned before any transaction begins.
+var ErrInvalidOptions = errors.New("gotx: invalid options")
+
+// OptionsError describes an invalid field of Options, or an invalid argument of Exec.
+type OptionsError struct {
+	// Field is the name of the invalid field, e.g. "Propagation", or "ctx" for the
+	// context passed to Exec.
+	Field string
+
+	// Reason tells what is wrong with the value.
+	Reason string
+}
+
+func (e *OptionsError) Error() string {
+	return fmt.Sprintf("%s: %s %s", ErrInvalidOptions, e.Field, e.Reason)
+}
+
+// Is reports whether target is ErrInvalidOptions.
+func (e *OptionsError) Is(target error) bool {
+	return target == ErrInvalidOptions
+}
+
+// Validate checks the fields of o and returns an *OptionsError describing the first
+// invalid one. Exec validates its options itself, Validate is for options built ahead
+// of time, e.g. from configuration.
+func (o *Options) Validate() error {
+	invalid := func(field, format string, args ...interface{}) error {
+		return &OptionsError{Field: field, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	switch {
+	case o.Propagation != PropagationRequired && o.Propagation != PropagationNew:
+		return invalid("Propagation", "is unknown: %d", o.Propagation)
+	case o.IsolationLevel < sql.LevelDefault || o.IsolationLevel > sql.LevelLinearizable:
+		return invalid("IsolationLevel", "is unknown: %d", o.IsolationLevel)
+	case o.MaxRetries < 0:
+		return invalid("MaxRetries", "must not be negative: %d", o.MaxRetries)
+	case o.RetryBackoff < 0:
+		return invalid("RetryBackoff", "must not be negative: %s", o.RetryBackoff)
+	case o.Timeout < 0:
+		return invalid("Timeout", "must not be negative: %s", o.Timeout)
+	case o.MaxRows < 0:
+		return invalid("MaxRows", "must not be negative: %d", o.MaxRows)
+	case o.MaxRowsPolicy != RowLimitError && o.MaxRowsPolicy != RowLimitTruncate:
+		return invalid("MaxRowsPolicy", "is unknown: %d", o.MaxRowsPolicy)
+	case o.MaxWriteRows < 0:
+		return invalid("MaxWriteRows", "must not be negative: %d", o.MaxWriteRows)
+	case o.IdempotencyResult != nil && o.IdempotencyKey == "":
+		return invalid("IdempotencyResult", "is set without IdempotencyKey")
+	case o.FencingToken != 0 && o.FencingName == "":
+		return invalid("FencingToken", "is set without FencingName")
+	case o.Priority < PriorityLow || o.Priority > PriorityHigh:
+		return invalid("Priority", "is unknown: %d", o.Priority)
+	case o.IdleAction != IdleWarn && o.IdleAction != IdleAbort:
+		return invalid("IdleAction", "is unknown: %d", o.IdleAction)
+	}
+
+	if _, ok := o.Labels[""]; ok {
+		return invalid("Labels", "must not have an empty key")
+	}
+	return nil
+}
+
+// MustValidate is like Validate but panics if o is invalid, for options defined in
+// package variables:
+//
+//	var reportOptions = (&gotx.Options{Timeout: time.Minute}).WithReadOnly().MustValidate()
+func (o *Options) MustValidate() *Options {
+	if err := o.Validate(); err != nil {
+		panic(err)
+	}
+	return o
+}
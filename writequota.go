@@ -0,0 +1,54 @@
+package gotx
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrWriteQuotaExceeded is returned by the statement making a transaction write more
+// rows than Options.MaxWriteRows, and by the commit of its db transaction.
+var ErrWriteQuotaExceeded = errors.New("gotx: write quota exceeded")
+
+// countWrite adds the rows affected by a statement to the rows written by t and the
+// transactions it is nested in within the same db transaction, and fails once one of
+// them exceeds its write quota. The statement already ran, so the db transaction is
+// then doomed: its commit fails even if the error is ignored.
+func (t *Transaction) countWrite(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil || n <= 0 {
+		return nil
+	}
+
+	for tx := t; tx != nil && tx.tx == t.tx; tx = tx.parent {
+		written := atomic.AddInt64(&tx.writtenRows, n)
+		if limit := tx.opts.MaxWriteRows; limit > 0 && written > limit {
+			err := fmt.Errorf("%w: %s wrote %d rows, limit is %d", ErrWriteQuotaExceeded, tx, written, limit)
+			t.tx.valuesMux.Lock()
+			if t.tx.doomed == nil {
+				t.tx.doomed = err
+			}
+			t.tx.valuesMux.Unlock()
+			return err
+		}
+	}
+	return nil
+}
+
+// doom makes the commit of the db transaction fail with err, unless it is doomed
+// already.
+func (t *rawTx) doom(err error) {
+	t.valuesMux.Lock()
+	if t.doomed == nil {
+		t.doomed = err
+	}
+	t.valuesMux.Unlock()
+}
+
+// checkDoomed returns the error which doomed the db transaction of t, if any.
+func (t *Transaction) checkDoomed() error {
+	t.tx.valuesMux.Lock()
+	defer t.tx.valuesMux.Unlock()
+	return t.tx.doomed
+}